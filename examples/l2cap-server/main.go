@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"math"
 
@@ -24,77 +25,24 @@ func main() {
 	}
 
 	a := hci.NewConn(sck)
-
-	if err := a.Reset(); err != nil {
-		panic(err)
-	}
-
-	addr, err := a.ReadBDAddr()
+	defer a.Close()
+
+	s, err := a.Init(context.Background(), &hci.InitOptions{
+		AdvertisingData: []hci.DataType{
+			hci.FlagsDataTypeLEGeneralDiscoverableMode | hci.FlagsDataTypeBREDRNotSupported,
+			hci.CompleteLocalName("Muxer"),
+		},
+		AdvertisingParameters: &hci.SetAdvertisingParametersRequest{
+			AdvertisingIntervalMin: 100,
+			AdvertisingIntervalMax: 120,
+		},
+		Advertise: true,
+	})
 	if err != nil {
 		panic(err)
 	}
 
-	log.Printf("got bdaddr %x", addr)
-
-	if err := a.ClearFilterAcceptList(); err != nil {
-		panic(err)
-	}
-
-	n, err := a.ReadFilterAcceptListSize()
-	if err != nil {
-		panic(err)
-	}
-
-	log.Printf("got filter accept list size %v", n)
-
-	if err := a.SetEventMask(
-		hci.EventMaskDisconnectionCompleteEvent |
-			hci.EventMaskEncryptionChangeEvent |
-			hci.EventMaskHardwareErrorEvent |
-			hci.EventMaskEncryptionKeyRefreshCompleteEvent |
-			hci.EventMaskLEMetaEvent); err != nil {
-		panic(err)
-	}
-
-	if err := a.LESetEventMask(
-		hci.LEEventMaskConnectionCompleteEvent |
-			hci.LEEventMaskAdvertisingReportEvent |
-			hci.LEEventMaskConnectionUpdateCompleteEvent |
-			hci.LEEventMaskLongTermKeyRequestEvent |
-			hci.LEEventMaskReadRemoteUsedFeaturesCompleteEvent); err != nil {
-		panic(err)
-	}
-
-	bs, err := a.LEReadBufferSize()
-	if err != nil {
-		panic(err)
-	}
-
-	log.Printf("got buffer size %v", bs)
-
-	ss, err := a.LEReadSupportedStates()
-	if err != nil {
-		panic(err)
-	}
-
-	log.Printf("got supported states %v", ss)
-
-	if err := a.SetAdvertisingData(
-		hci.FlagsDataTypeLEGeneralDiscoverableMode|hci.FlagsDataTypeBREDRNotSupported,
-		hci.CompleteLocalName("Muxer")); err != nil {
-		panic(err)
-	}
-
-	if err := a.LESetAdvertisingParameters(&hci.SetAdvertisingParametersRequest{
-		AdvertisingIntervalMin: 100,
-		AdvertisingIntervalMax: 120,
-	}); err != nil {
-		panic(err)
-	}
-
-	if err := a.LESetAdvertisingEnable(true); err != nil {
-		panic(err)
-	}
+	log.Printf("got bdaddr %x, acl buffers %d x %d, supported states %v", s.BDAddr, s.ACLPackets, s.ACLMTU, s.Capabilities.LEStates.Names())
 
 	for {
 		conn, err := a.Accept()
@@ -3,22 +3,114 @@ package hci
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
 type Adapter struct {
 	*Socket
 
 	onPacketLock sync.Mutex
-	onPacket map[string]func(Packet, error)
+	onPacket     map[string]func(Packet, error)
 
 	ACLMTU                  uint16
 	ACLPacketsRemaining     uint16
 	ACLPacketsRemainingCond *sync.Cond
 	ACLPacketsPending       map[uint16]uint16
+
+	tx txScheduler // guarded by ACLPacketsRemainingCond.L
+
+	// ISOMTU is the size of the controller's ISO data buffers, zero if it
+	// has none. Their credits are guarded by ACLPacketsRemainingCond.L.
+	ISOMTU              uint16
+	isoPacketsRemaining uint16
+	isoPacketsPending   map[uint16]uint16
+
+	isoLock    sync.Mutex
+	isoStreams map[uint16]*ISOStream
+	bigStreams map[uint8][]*ISOStream // the BIS streams of each BIG handle.
+
+	capabilitiesLock sync.Mutex
+	capabilities     *Capabilities
+
+	// IRK is the local identity resolving key, if any.
+	IRK IRK
+
+	// ConnectionParameterPolicy, if set, decides whether connection
+	// parameters requested by peers are accepted.
+	ConnectionParameterPolicy ConnectionParameterPolicy
+
+	// LongTermKeyLookup, if set, supplies the keys peripheral connections
+	// are encrypted with. Without it, every request for a key is rejected.
+	LongTermKeyLookup LongTermKeyLookup
+
+	// Resolver, if set, resolves the addresses of peers that connect or
+	// advertise with a resolvable private address the controller could not
+	// resolve itself.
+	Resolver *Resolver
+
+	addressLock  sync.Mutex // held while the random address or advertising state must not change.
+	stopRotation chan struct{}
+
+	// randomAddressLock guards randomAddress, the random device address
+	// last programmed into the controller, which only changes with
+	// addressLock held.
+	randomAddressLock sync.Mutex
+	randomAddress     BDAddr
+
+	// activityLock guards whether the host wants legacy advertising and
+	// extended scanning enabled, which the reader clears when the controller
+	// stops them on its own. filterPolicyUpdates counts the running
+	// ApplyFilterPolicy updates, during which both stay paused. It also
+	// guards the configuration of extended scanning and of each advertising
+	// set, which is restored after a reset.
+	activityLock        sync.Mutex
+	advertising         bool
+	scan                *HCILESetExtendedScanEnableCommandPacket
+	filterPolicyUpdates int
+	scanParameters      *SetExtendedScanParametersRequest
+	advertisingSets     map[uint8]*advertisingSet
+
+	// resolvingListLock guards the host's copy of the resolving list and the
+	// address resolution settings, which are restored after a reset.
+	resolvingListLock sync.Mutex
+	resolvingList     []resolvingListEntry
+	addressResolution bool
+	rpaTimeout        time.Duration
+
+	filterAcceptListLock sync.Mutex
+	filterAcceptList     []FilterAcceptListEntry
+	filterAcceptListSize uint8
+
+	commandTimeoutLock sync.Mutex
+	commandTimeout     time.Duration
+
+	connsLock sync.Mutex
+	conns     map[uint16]*Conn
+
+	readerDone  chan struct{} // guarded by faultLock once supervised.
+	faultLock   sync.Mutex
+	faults      chan *fault
+	initOptions *InitOptions
+
+	hostFlowControlLock sync.Mutex
+	hostFlowControl     bool
+
+	// p256Lock serializes the P-256 commands, whose events do not identify
+	// the command they complete.
+	p256Lock sync.Mutex
+
+	advertisingParameters *SetAdvertisingParametersRequest
+	advertisingData       []DataType
+
+	closeOnce    sync.Once
+	closing      chan struct{}
+	transmitDone chan struct{}
 }
 
 func NewConn(s *Socket) *Adapter {
@@ -28,51 +120,196 @@ func NewConn(s *Socket) *Adapter {
 		ACLMTU:                  1023,
 		ACLPacketsRemainingCond: sync.NewCond(&sync.Mutex{}),
 		ACLPacketsPending:       make(map[uint16]uint16),
+		conns:                   make(map[uint16]*Conn),
+		isoPacketsPending:       make(map[uint16]uint16),
+		isoStreams:              make(map[uint16]*ISOStream),
+		bigStreams:              make(map[uint8][]*ISOStream),
+		advertisingSets:         make(map[uint8]*advertisingSet),
+		closing:                 make(chan struct{}),
+		transmitDone:            make(chan struct{}),
 	}
-	go func() {
-		for {
-			p, err := a.ReadPacket()
-			if err != nil {
-				a.onPacketLock.Lock()
-				for _, cb := range a.onPacket {
-					go cb(nil, err)
+	a.readerDone = make(chan struct{})
+	go a.readLoop(a.readerDone)
+	go a.transmit()
+	return a
+}
+
+// readLoop dispatches the packets read from the socket until it fails. If a
+// supervisor is running, the failure is reported to it instead.
+func (a *Adapter) readLoop(done chan struct{}) {
+	for {
+		p, err := a.ReadPacket()
+		var decodeErr *DecodeError
+		if errors.As(err, &decodeErr) {
+			zap.L().Warn("dropping undecodable packet", zap.Error(err))
+			continue
+		}
+		if err != nil {
+			// mark the reader stopped before the supervisor can observe the
+			// fault so that it reopens the socket.
+			close(done)
+			if !a.fault(&fault{reason: RecoveryReasonSocketLost, err: err}) {
+				for _, c := range a.Connections() {
+					c.teardown(err)
 				}
-				a.onPacketLock.Unlock()
-				return
+				a.teardownISOStreams(err)
+				a.broadcast(nil, err)
 			}
-			switch p := p.(type) {
-			case *NumberOfCompletedPacketsEventPacket:
-				a.ACLPacketsRemainingCond.L.Lock()
-				for i := 0; i < int(p.NumHandles); i++ {
-					a.ACLPacketsRemaining += p.NumCompletedPackets[i]
+			return
+		}
+		switch p := p.(type) {
+		case *NumberOfCompletedPacketsEventPacket:
+			a.ACLPacketsRemainingCond.L.Lock()
+			for i := 0; i < int(p.NumHandles); i++ {
+				h, n := p.ConnectionHandles[i], p.NumCompletedPackets[i]
+				if a.completeISOPackets(h, n) {
+					continue
+				}
+				if n > a.ACLPacketsPending[h] {
+					// the controller completed packets we did not count,
+					// such as those sent before the handle was tracked.
+					n = a.ACLPacketsPending[h]
 				}
-				a.ACLPacketsRemainingCond.Broadcast()
-				a.ACLPacketsRemainingCond.L.Unlock()
-			case *DisconnectionCompleteEventPacket:
-				a.ACLPacketsRemainingCond.L.Lock()
-				a.ACLPacketsRemaining += a.ACLPacketsPending[p.ConnectionHandle]
-				delete(a.ACLPacketsPending, p.ConnectionHandle)
-				a.ACLPacketsRemainingCond.Broadcast()
-				a.ACLPacketsRemainingCond.L.Unlock()
+				a.ACLPacketsPending[h] -= n
+				if a.ACLPacketsPending[h] == 0 {
+					delete(a.ACLPacketsPending, h)
+				}
+				a.ACLPacketsRemaining += n
 			}
-			a.onPacketLock.Lock()
-			for _, cb := range a.onPacket {
-				go cb(p, nil)
+			a.ACLPacketsRemainingCond.Broadcast()
+			a.ACLPacketsRemainingCond.L.Unlock()
+		case *DisconnectionCompleteEventPacket:
+			if p.Status != 0 {
+				break
 			}
-			a.onPacketLock.Unlock()
+			a.ACLPacketsRemainingCond.L.Lock()
+			a.ACLPacketsRemaining += a.ACLPacketsPending[p.ConnectionHandle]
+			delete(a.ACLPacketsPending, p.ConnectionHandle)
+			a.isoPacketsRemaining += a.isoPacketsPending[p.ConnectionHandle]
+			delete(a.isoPacketsPending, p.ConnectionHandle)
+			a.ACLPacketsRemainingCond.Broadcast()
+			a.ACLPacketsRemainingCond.L.Unlock()
+			if s, ok := a.isoStream(p.ConnectionHandle); ok {
+				s.teardown(&DisconnectError{
+					ConnectionHandle: p.ConnectionHandle,
+					Reason:           DisconnectReason(p.Reason),
+				})
+			}
+		case *HardwareErrorEventPacket:
+			a.fault(&fault{reason: RecoveryReasonHardwareError, hardwareCode: p.HardwareCode})
+		case *LEAdvertisingReportEventPacket:
+			for i, r := range p.Reports {
+				p.Reports[i].IdentityAddressType, p.Reports[i].IdentityAddress = a.identity(r.AddressType, r.Address)
+			}
+		case *LEExtendedAdvertisingReportEventPacket:
+			for i, r := range p.Reports {
+				p.Reports[i].IdentityAddressType, p.Reports[i].IdentityAddress = a.identity(r.AddressType, r.Address)
+			}
+		case *LEScanTimeoutEventPacket:
+			// scanning for a duration ended.
+			a.activityLock.Lock()
+			a.scan = nil
+			a.activityLock.Unlock()
+		case *LEAdvertisingSetTerminatedEventPacket:
+			a.activityLock.Lock()
+			if s, ok := a.advertisingSets[p.AdvertisingHandle]; ok {
+				s.enabled = nil
+			}
+			a.activityLock.Unlock()
+		case *LEConnectionCompleteEventPacket:
+			if p.Role == RolePeripheral {
+				a.advertisingStopped(p.Status)
+			}
+			if p.Status == 0 {
+				p.established = a.newConn(&Conn{
+					ConnectionHandle:     p.ConnectionHandle,
+					Role:                 p.Role,
+					PeerAddressType:      p.PeerAddressType,
+					PeerAddress:          p.PeerAddress,
+					ConnectionInterval:   p.ConnectionInterval,
+					PeripheralLatency:    p.PeripheralLatency,
+					SupervisionTimeout:   p.SupervisionTimeout,
+					CentralClockAccuracy: p.CentralClockAccuracy,
+				})
+			}
+		case *LEEnhancedConnectionCompleteEventPacket:
+			if p.Role == RolePeripheral {
+				a.advertisingStopped(p.Status)
+			}
+			if p.Status == 0 {
+				p.established = a.newConn(p.conn())
+			}
+		case *LECISEstablishedEventPacket:
+			if p.Status == 0 {
+				p.established = a.newISOStream(p.ConnectionHandle)
+			}
+		case *LEBIGCompleteEventPacket:
+			if p.Status == 0 {
+				p.established = a.newBIGStreams(p.BIGHandle, p.ConnectionHandles)
+			}
+		case *LEBIGSyncEstablishedEventPacket:
+			if p.Status == 0 {
+				p.established = a.newBIGStreams(p.BIGHandle, p.ConnectionHandles)
+			}
+		case *LETerminateBIGCompleteEventPacket:
+			a.teardownBIG(p.BIGHandle, &BIGTerminatedError{BIGHandle: p.BIGHandle, Reason: p.Reason})
+		case *LEBIGSyncLostEventPacket:
+			a.teardownBIG(p.BIGHandle, &BIGTerminatedError{BIGHandle: p.BIGHandle, Reason: p.Reason})
+		case *ISODataPacket:
+			// like ACL data, ISO data is only of interest to its stream.
+			if s, ok := a.isoStream(p.ConnectionHandle); ok {
+				s.receive(p)
+			} else {
+				zap.L().Debug("dropping iso data for unknown stream", zap.Uint16("handle", p.ConnectionHandle))
+			}
+			continue
+		case *ACLDataPacket:
+			// ACL data is only of interest to the connection it belongs to.
+			if c, ok := a.Connection(p.ConnectionHandle); ok {
+				c.handle(p)
+			} else {
+				zap.L().Debug("dropping data for unknown connection", zap.Uint16("handle", p.ConnectionHandle))
+				releaseACLDataPacket(p)
+			}
+			continue
 		}
-	}()
-	return a
+		a.route(p)
+		a.broadcast(p, nil)
+	}
+}
+
+// broadcast invokes every registered callback with p or err.
+func (a *Adapter) broadcast(p Packet, err error) {
+	a.onPacketLock.Lock()
+	for _, cb := range a.onPacket {
+		go cb(p, err)
+	}
+	a.onPacketLock.Unlock()
+}
+
+type opResult struct {
+	buf []byte
+	err error
 }
 
 func (a *Adapter) op(p CommandPacket) ([]byte, error) {
-	done := make(chan []byte)
-	defer close(done)
+	if err := a.checkSupported(p.Opcode()); err != nil {
+		return nil, err
+	}
+	// done is buffered and never closed so a callback that raced with a
+	// timeout cannot block or panic.
+	done := make(chan opResult, 1)
 	id := uuid.NewString()
 	a.onPacketLock.Lock()
 	a.onPacket[id] = func(q Packet, err error) {
 		if err != nil {
-			done <- nil
+			a.onPacketLock.Lock()
+			delete(a.onPacket, id)
+			a.onPacketLock.Unlock()
+			select {
+			case done <- opResult{err: err}:
+			default:
+			}
 			return
 		}
 		switch q := q.(type) {
@@ -83,14 +320,127 @@ func (a *Adapter) op(p CommandPacket) ([]byte, error) {
 			a.onPacketLock.Lock()
 			delete(a.onPacket, id)
 			a.onPacketLock.Unlock()
-			done <- q.ReturnParameters
+			select {
+			case done <- opResult{buf: q.ReturnParameters}:
+			default:
+			}
 		}
 	}
 	a.onPacketLock.Unlock()
 	if err := a.WritePacket(p); err != nil {
+		a.onPacketLock.Lock()
+		delete(a.onPacket, id)
+		a.onPacketLock.Unlock()
 		return nil, err
 	}
-	return <-done, nil
+	r := a.wait(id, p.Opcode(), done)
+	if r.err == nil && len(r.buf) == 0 {
+		return nil, io.ErrShortBuffer
+	}
+	return r.buf, r.err
+}
+
+// CommandTimeout returns how long a command waits for the controller to
+// respond, or zero if commands wait indefinitely.
+func (a *Adapter) CommandTimeout() time.Duration {
+	a.commandTimeoutLock.Lock()
+	defer a.commandTimeoutLock.Unlock()
+	return a.commandTimeout
+}
+
+// SetCommandTimeout bounds how long a command waits for the controller to
+// respond if d is positive. Commands already waiting are not affected.
+func (a *Adapter) SetCommandTimeout(d time.Duration) {
+	a.commandTimeoutLock.Lock()
+	a.commandTimeout = d
+	a.commandTimeoutLock.Unlock()
+}
+
+// wait waits for the result of a command, giving up after CommandTimeout.
+func (a *Adapter) wait(id string, opcode Opcode, done chan opResult) opResult {
+	timeout := a.CommandTimeout()
+	if timeout <= 0 {
+		return <-done
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case r := <-done:
+		return r
+	case <-t.C:
+		a.onPacketLock.Lock()
+		delete(a.onPacket, id)
+		a.onPacketLock.Unlock()
+		err := fmt.Errorf("%w: opcode 0x%04x", ErrCommandTimeout, uint16(opcode))
+		a.fault(&fault{reason: RecoveryReasonCommandTimeout, err: err})
+		return opResult{err: err}
+	}
+}
+
+// opStatus issues a command that the controller acknowledges with a Command
+// Status event rather than a Command Complete event.
+func (a *Adapter) opStatus(p CommandPacket) error {
+	if err := a.checkSupported(p.Opcode()); err != nil {
+		return err
+	}
+	done := make(chan opResult, 1)
+	id := uuid.NewString()
+	a.onPacketLock.Lock()
+	a.onPacket[id] = func(q Packet, err error) {
+		if err != nil {
+			a.onPacketLock.Lock()
+			delete(a.onPacket, id)
+			a.onPacketLock.Unlock()
+			select {
+			case done <- opResult{err: err}:
+			default:
+			}
+			return
+		}
+		switch q := q.(type) {
+		case *CommandStatusEventPacket:
+			if q.CommandOpcode != p.Opcode() {
+				return
+			}
+			a.onPacketLock.Lock()
+			delete(a.onPacket, id)
+			a.onPacketLock.Unlock()
+			var r opResult
+			switch q.Status {
+			case 0:
+			case 0x01: // unknown HCI command
+				r.err = ErrUnsupportedCommand
+			default:
+				r.err = errors.New("command failed")
+			}
+			select {
+			case done <- r:
+			default:
+			}
+		}
+	}
+	a.onPacketLock.Unlock()
+	if err := a.WritePacket(p); err != nil {
+		a.onPacketLock.Lock()
+		delete(a.onPacket, id)
+		a.onPacketLock.Unlock()
+		return err
+	}
+	return a.wait(id, p.Opcode(), done).err
+}
+
+// subscribe registers cb to be invoked for every packet read by the adapter.
+// The returned function removes the registration.
+func (a *Adapter) subscribe(cb func(Packet, error)) func() {
+	id := uuid.NewString()
+	a.onPacketLock.Lock()
+	a.onPacket[id] = cb
+	a.onPacketLock.Unlock()
+	return func() {
+		a.onPacketLock.Lock()
+		delete(a.onPacket, id)
+		a.onPacketLock.Unlock()
+	}
 }
 
 func (a *Adapter) Reset() error {
@@ -127,6 +477,9 @@ func (a *Adapter) ClearFilterAcceptList() error {
 	if buf[0] != 0 {
 		return errors.New("command failed")
 	}
+	a.filterAcceptListLock.Lock()
+	a.filterAcceptList = nil
+	a.filterAcceptListLock.Unlock()
 	return err
 }
 
@@ -138,6 +491,9 @@ func (a *Adapter) ReadFilterAcceptListSize() (uint8, error) {
 	if buf[0] != 0 {
 		return 0, errors.New("command failed")
 	}
+	a.filterAcceptListLock.Lock()
+	a.filterAcceptListSize = buf[1]
+	a.filterAcceptListLock.Unlock()
 	return buf[1], nil
 }
 
@@ -148,8 +504,14 @@ type LEReadBufferSizeResponse struct {
 	TotalNumISODataPackets   uint8
 }
 
+// LEReadBufferSize reads the size of the controller's LE ACL buffers and, if
+// the controller supports LE Read Buffer Size [v2], its ISO buffers.
 func (a *Adapter) LEReadBufferSize() (*LEReadBufferSizeResponse, error) {
-	buf, err := a.op(NewGenericCommandPacket(OpcodeLEReadBufferSize))
+	opcode := OpcodeLEReadBufferSize
+	if c := a.Capabilities(); c != nil && c.Supports(OpcodeLEReadBufferSizeV2) {
+		opcode = OpcodeLEReadBufferSizeV2
+	}
+	buf, err := a.op(NewGenericCommandPacket(opcode))
 	if err != nil {
 		return nil, err
 	}
@@ -165,16 +527,16 @@ func (a *Adapter) LEReadBufferSize() (*LEReadBufferSizeResponse, error) {
 		r.TotalNumISODataPackets = buf[6]
 	}
 	a.ACLMTU = r.LEACLDataPacketLength
+	a.ISOMTU = r.ISODataPacketLength
 
 	a.ACLPacketsRemainingCond.L.Lock()
 	a.ACLPacketsRemaining = uint16(r.TotalNumLEACLDataPackets)
+	a.isoPacketsRemaining = uint16(r.TotalNumISODataPackets)
 	a.ACLPacketsRemainingCond.Broadcast()
 	a.ACLPacketsRemainingCond.L.Unlock()
 	return r, nil
 }
 
-type LESupportedStates uint64
-
 func (a *Adapter) LEReadSupportedStates() (LESupportedStates, error) {
 	buf, err := a.op(NewGenericCommandPacket(OpcodeLEReadSupportedStates))
 	if err != nil {
@@ -187,6 +549,34 @@ func (a *Adapter) LEReadSupportedStates() (LESupportedStates, error) {
 }
 
 func (a *Adapter) LESetAdvertisingEnable(enable bool) error {
+	a.addressLock.Lock()
+	defer a.addressLock.Unlock()
+	return a.setAdvertisingEnable(enable)
+}
+
+// setAdvertisingEnable starts or stops legacy advertising. While a filter
+// policy is applied, the change is deferred until it has been. The caller
+// must hold addressLock.
+func (a *Adapter) setAdvertisingEnable(enable bool) error {
+	a.activityLock.Lock()
+	if a.filterPolicyUpdates > 0 {
+		a.advertising = enable
+		a.activityLock.Unlock()
+		return nil
+	}
+	a.activityLock.Unlock()
+	if err := a.advertisingEnable(enable); err != nil {
+		return err
+	}
+	a.activityLock.Lock()
+	a.advertising = enable
+	a.activityLock.Unlock()
+	return nil
+}
+
+// advertisingEnable starts or stops legacy advertising without changing the
+// state it is restored to.
+func (a *Adapter) advertisingEnable(enable bool) error {
 	buf, err := a.op(&LESetAdvertisingEnableCommandPacket{AdvertisingEnable: enable})
 	if err != nil {
 		return err
@@ -197,98 +587,170 @@ func (a *Adapter) LESetAdvertisingEnable(enable bool) error {
 	return nil
 }
 
+// advertisingStopped records that the controller stopped legacy advertising
+// after a peripheral connection completed with status, which it does when
+// the connection is established or high duty cycle directed advertising
+// times out.
+func (a *Adapter) advertisingStopped(status uint8) {
+	if status != 0 && status != 0x3C { // advertising timeout
+		return
+	}
+	a.activityLock.Lock()
+	a.advertising = false
+	a.activityLock.Unlock()
+}
+
+// pauseLocked stops legacy advertising and extended scanning, if enabled, for
+// a change the controller disallows while they are. The caller must hold
+// addressLock and call resumeLocked afterwards.
+func (a *Adapter) pauseLocked() error {
+	a.activityLock.Lock()
+	advertising, scan, paused := a.advertising, a.scan, a.filterPolicyUpdates > 0
+	a.activityLock.Unlock()
+	if paused {
+		return nil
+	}
+	if advertising {
+		if err := a.advertisingEnable(false); err != nil {
+			return err
+		}
+	}
+	if scan != nil {
+		if err := a.scanEnable(&HCILESetExtendedScanEnableCommandPacket{}); err != nil {
+			if advertising {
+				if err := a.advertisingEnable(true); err != nil {
+					zap.L().Warn("failed to resume advertising", zap.Error(err))
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// resumeLocked enables the advertising and scanning the host wants after
+// pauseLocked, unless a connection or timeout ended them in the meantime or
+// a filter policy is still being applied. The caller must hold addressLock.
+func (a *Adapter) resumeLocked() error {
+	a.activityLock.Lock()
+	advertising, scan, paused := a.advertising, a.scan, a.filterPolicyUpdates > 0
+	a.activityLock.Unlock()
+	if paused {
+		return nil
+	}
+	var err error
+	if scan != nil {
+		err = a.scanEnable(scan)
+	}
+	if advertising {
+		if aerr := a.advertisingEnable(true); err == nil {
+			err = aerr
+		}
+	}
+	return err
+}
+
 type Conn struct {
 	*Adapter
 
-	ConnectionHandle     uint16
-	Role                 Role
-	PeerAddressType      PeerAddressType
-	PeerAddress          BDAddr
+	ConnectionHandle uint16
+	Role             Role
+	PeerAddressType  PeerAddressType
+	PeerAddress      BDAddr
+	// ConnectionInterval, PeripheralLatency and SupervisionTimeout are the
+	// parameters the connection was established with, see Parameters for
+	// the current ones.
 	ConnectionInterval   uint16
 	PeripheralLatency    uint16
 	SupervisionTimeout   uint16
 	CentralClockAccuracy CentralClockAccuracy
 
-	bufCh chan []byte
-	errCh chan error
+	// LocalResolvablePrivateAddress and PeerResolvablePrivateAddress are set
+	// when the connection was established with controller-based privacy.
+	LocalResolvablePrivateAddress BDAddr
+	PeerResolvablePrivateAddress  BDAddr
+
+	// PeerIdentityAddressType and PeerIdentityAddress hold the peer's
+	// identity, if it could be resolved, or else its connection address.
+	PeerIdentityAddressType PeerAddressType
+	PeerIdentityAddress     BDAddr
+
+	// linkLock guards the link layer state, which the reader updates as the
+	// controller reports changes.
+	linkLock    sync.Mutex
+	txPHY       PHY
+	rxPHY       PHY
+	dataLength  DataLength
+	interval    uint16
+	latency     uint16
+	timeout     uint16
+	onPHYUpdate func(tx, rx PHY)
+
+	// remoteVersion and remoteFeatures cache the peer's information once it
+	// has been read.
+	remoteLock          sync.Mutex
+	remoteVersion       *RemoteVersionInformation
+	remoteFeatures      LEFeatures
+	remoteFeaturesValid bool
+
+	encryptionLock     sync.Mutex
+	encrypted          bool
+	encryptionKeySize  uint8
+	onEncryptionChange func(encrypted bool, keySize uint8)
+
+	cisRequests chan *CISRequest
+
+	bufCh chan *rxPDU
+
+	// MaxPDUSize bounds the size of a reassembled L2CAP PDU, including its
+	// basic header. Larger PDUs are dropped. It defaults to the largest PDU
+	// L2CAP can describe.
+	MaxPDUSize int
+	stats      ReassemblyStats
+
+	inboxLock  sync.Mutex
+	inbox      []*ACLDataPacket
+	inboxReady chan struct{}
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	closeErr  error
 }
 
 func (a *Adapter) Accept() (*Conn, error) {
-	conn := make(chan *Conn)
-	defer close(conn)
-	errch := make(chan error)
-	defer close(errch)
+	conn := make(chan *Conn, 1)
+	errch := make(chan error, 1)
 	id := uuid.NewString()
 	a.onPacketLock.Lock()
 	a.onPacket[id] = func(p Packet, err error) {
+		if errors.Is(err, ErrRecovering) {
+			// keep waiting for connections on the recovered controller.
+			return
+		}
 		if err != nil {
+			a.onPacketLock.Lock()
+			delete(a.onPacket, id)
+			a.onPacketLock.Unlock()
 			errch <- err
 			return
 		}
 		switch p := p.(type) {
 		case *LEConnectionCompleteEventPacket:
+			if p.Status != 0 || p.Role != RolePeripheral {
+				return
+			}
 			a.onPacketLock.Lock()
 			delete(a.onPacket, id)
 			a.onPacketLock.Unlock()
-			c := &Conn{
-				Adapter:              a,
-				ConnectionHandle:     p.ConnectionHandle,
-				Role:                 p.Role,
-				PeerAddressType:      p.PeerAddressType,
-				PeerAddress:          p.PeerAddress,
-				ConnectionInterval:   p.ConnectionInterval,
-				PeripheralLatency:    p.PeripheralLatency,
-				SupervisionTimeout:   p.SupervisionTimeout,
-				CentralClockAccuracy: p.CentralClockAccuracy,
-				bufCh:                make(chan []byte),
-				errCh:                make(chan error),
+			conn <- p.established
+		case *LEEnhancedConnectionCompleteEventPacket:
+			if p.Status != 0 || p.Role != RolePeripheral {
+				return
 			}
-			go func() {
-				cid := uuid.NewString()
-				var buf []byte
-				a.onPacketLock.Lock()
-				a.onPacket[cid] = func(q Packet, err error) {
-					if err != nil {
-						c.errCh <- err
-						return
-					}
-					switch q := q.(type) {
-					case *DisconnectionCompleteEventPacket:
-						if q.ConnectionHandle == c.ConnectionHandle {
-							a.onPacketLock.Lock()
-							delete(a.onPacket, cid)
-							a.onPacketLock.Unlock()
-						}
-					case *ACLDataPacket:
-						if q.ConnectionHandle != p.ConnectionHandle {
-							// this packet is for another connection.
-							return
-						}
-						switch q.PacketBoundaryFlag {
-						case 0b01: // continuation packet
-							buf = append(buf, q.Payload...)
-						case 0b10: // start packet
-							if len(buf) > 0 {
-								c.errCh <- errors.New("unexpected start packet")
-								return
-							}
-							buf = q.Payload
-						default:
-							// unhandled packet type
-							c.errCh <- errors.New("unhandled packet type")
-							return
-						}
-						// introspect the packet to see if we're done
-						if len(buf) >= 4 && len(buf) == int(binary.LittleEndian.Uint16(buf[:2]))+4 {
-							// this packet is complete
-							c.bufCh <- buf
-							buf = nil
-						}
-					}
-				}
-				a.onPacketLock.Unlock()
-			}()
-			conn <- c
+			a.onPacketLock.Lock()
+			delete(a.onPacket, id)
+			a.onPacketLock.Unlock()
+			conn <- p.established
 		}
 	}
 	a.onPacketLock.Unlock()
@@ -300,50 +762,198 @@ func (a *Adapter) Accept() (*Conn, error) {
 	}
 }
 
+// newConn attaches c to the adapter and starts reassembling the ACL data
+// addressed to its connection handle.
+func (a *Adapter) newConn(c *Conn) *Conn {
+	c.Adapter = a
+	c.txPHY, c.rxPHY = PHYLE1M, PHYLE1M
+	c.dataLength = DataLength{
+		MaxTxOctets: DefaultMaxOctets,
+		MaxTxTime:   DefaultMaxTime,
+		MaxRxOctets: DefaultMaxOctets,
+		MaxRxTime:   DefaultMaxTime,
+	}
+	c.interval, c.latency, c.timeout = c.ConnectionInterval, c.PeripheralLatency, c.SupervisionTimeout
+	c.PeerIdentityAddressType, c.PeerIdentityAddress = a.identity(c.PeerAddressType, c.PeerAddress)
+	c.bufCh = make(chan *rxPDU)
+	if c.MaxPDUSize == 0 {
+		c.MaxPDUSize = maxPDUSize
+	}
+	c.closed = make(chan struct{})
+	c.cisRequests = make(chan *CISRequest, cisRequestQueueLength)
+	a.ACLPacketsRemainingCond.L.Lock()
+	a.tx.add(c)
+	a.ACLPacketsRemainingCond.L.Unlock()
+	a.connsLock.Lock()
+	a.conns[c.ConnectionHandle] = c
+	a.connsLock.Unlock()
+	c.inboxReady = make(chan struct{}, 1)
+	go c.reassemble()
+	return c
+}
+
+// handle applies an event addressed to the connection. It runs on the
+// adapter's reader, so it must not wait for the controller.
+func (c *Conn) handle(p Packet) {
+	switch p := p.(type) {
+	case *DisconnectionCompleteEventPacket:
+		if p.Status == 0 {
+			c.teardown(&DisconnectError{
+				ConnectionHandle: c.ConnectionHandle,
+				Reason:           DisconnectReason(p.Reason),
+			})
+		}
+	case *LEPHYUpdateCompleteEventPacket:
+		if p.Status != 0 {
+			return
+		}
+		c.linkLock.Lock()
+		c.txPHY, c.rxPHY = p.TxPHY, p.RxPHY
+		cb := c.onPHYUpdate
+		c.linkLock.Unlock()
+		if cb != nil {
+			go cb(p.TxPHY, p.RxPHY)
+		}
+	case *LEConnectionUpdateCompleteEventPacket:
+		if p.Status != 0 {
+			return
+		}
+		c.linkLock.Lock()
+		c.interval, c.latency, c.timeout = p.ConnectionInterval, p.PeripheralLatency, p.SupervisionTimeout
+		c.linkLock.Unlock()
+	case *LERemoteConnectionParameterRequestEventPacket:
+		go func() {
+			if err := c.replyRemoteConnectionParameterRequest(p); err != nil {
+				zap.L().Warn("failed to reply to connection parameter request", zap.Error(err))
+			}
+		}()
+	case *LELongTermKeyRequestEventPacket:
+		go func() {
+			if err := c.replyLongTermKeyRequest(p); err != nil {
+				zap.L().Warn("failed to reply to long term key request", zap.Error(err))
+			}
+		}()
+	case *EncryptionChangeEventPacket:
+		if p.Status != 0 {
+			return
+		}
+		c.encryptionLock.Lock()
+		c.encrypted, c.encryptionKeySize = p.EncryptionEnabled != 0, p.EncryptionKeySize
+		c.encryptionLock.Unlock()
+		go c.encryptionChanged()
+	case *LEReadRemoteFeaturesCompleteEventPacket:
+		if p.Status != 0 {
+			return
+		}
+		c.remoteLock.Lock()
+		c.remoteFeatures, c.remoteFeaturesValid = p.LEFeatures, true
+		c.remoteLock.Unlock()
+	case *LEDataLengthChangeEventPacket:
+		c.linkLock.Lock()
+		c.dataLength = DataLength{
+			MaxTxOctets: p.MaxTxOctets,
+			MaxTxTime:   p.MaxTxTime,
+			MaxRxOctets: p.MaxRxOctets,
+			MaxRxTime:   p.MaxRxTime,
+		}
+		c.linkLock.Unlock()
+	case *LECISRequestEventPacket:
+		c.queueCISRequest(p)
+	case *ACLDataPacket:
+		c.inboxLock.Lock()
+		c.inbox = append(c.inbox, p)
+		c.inboxLock.Unlock()
+		select {
+		case c.inboxReady <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Read reads the next L2CAP PDU. The PDU is considered consumed when Read
+// returns, see ReadPDU.
 func (c *Conn) Read(buf []byte) (int, error) {
 	select {
-	case b := <-c.bufCh:
-		n := copy(buf, b)
-		if n < len(b) {
+	case p := <-c.bufCh:
+		n := copy(buf, p.buf)
+		p.free()
+		if n < len(p.buf) {
 			return n, io.ErrShortBuffer
 		}
-		return len(b), nil
-	case err := <-c.errCh:
-		return 0, err
+		return n, nil
+	case <-c.closed:
+		return 0, c.closeErr
 	}
 }
 
+// Write sends an L2CAP PDU, fragmenting it as necessary. It is scheduled
+// according to the priority of its channel, see TxPriority.
 func (c *Conn) Write(buf []byte) (int, error) {
-	for i := 0; i < len(buf); i += int(c.ACLMTU) {
-		var pb uint8
+	if err := c.WritePriority(buf, txPriority(buf)); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// WritePriority sends an L2CAP PDU in the given priority class. Writing an
+// empty PDU is a no op.
+func (c *Conn) WritePriority(buf []byte, priority TxPriority) error {
+	if len(buf) == 0 {
+		return nil
+	}
+	if priority >= numTxPriorities {
+		priority = TxPriorityBulk
+	}
+	var fragments []*ACLDataPacket
+	n := c.fragmentSize()
+	for i := 0; i < len(buf); i += n {
+		pb := ACLPacketBoundaryFirstNonFlushable
 		if i > 0 {
-			pb = 1
+			pb = ACLPacketBoundaryContinuation
 		}
 
-		j := i + int(c.ACLMTU)
+		j := i + n
 		if j > len(buf) {
 			j = len(buf)
 		}
 
-		p := &ACLDataPacket{
+		fragments = append(fragments, &ACLDataPacket{
 			ConnectionHandle:   c.ConnectionHandle,
 			PacketBoundaryFlag: pb,
+			BroadcastFlag:      ACLBroadcastPointToPoint,
 			Payload:            buf[i:j],
-		}
-		if err := c.WritePacket(p); err != nil {
-			return 0, err
-		}
+		})
 	}
-	return len(buf), nil
+	return c.enqueue(fragments, priority)
 }
 
+// WritePacket sends a single ACL data packet through the connection's
+// transmit queue. Other packets are written to the socket directly.
 func (c *Conn) WritePacket(p Packet) error {
-	c.ACLPacketsRemainingCond.L.Lock()
-	for c.ACLPacketsRemaining == 0 {
-		c.ACLPacketsRemainingCond.Wait()
-	}
-	c.ACLPacketsRemaining--
-	c.ACLPacketsPending[c.ConnectionHandle]++
-	c.ACLPacketsRemainingCond.L.Unlock()
-	return c.Socket.WritePacket(p)
+	q, ok := p.(*ACLDataPacket)
+	if !ok {
+		return c.Socket.WritePacket(p)
+	}
+	if q.BroadcastFlag != ACLBroadcastPointToPoint {
+		return errors.New("broadcast is not supported on LE")
+	}
+	switch q.PacketBoundaryFlag {
+	case ACLPacketBoundaryFirstNonFlushable, ACLPacketBoundaryContinuation:
+	default:
+		return errors.New("invalid packet boundary flag for LE")
+	}
+	priority := TxPriorityBulk
+	if q.PacketBoundaryFlag != ACLPacketBoundaryContinuation {
+		priority = txPriority(q.Payload)
+	}
+	return c.enqueue([]*ACLDataPacket{q}, priority)
+}
+
+func (c *Conn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
 }
@@ -0,0 +1,136 @@
+package hci
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+)
+
+// Random device addresses, Vol 6, Part B, Section 1.3.2.
+//
+// BDAddr holds addresses in HCI (little-endian) byte order, so the two most
+// significant bits that select the random address sub-type live in the last
+// byte.
+
+type RandomAddressType uint8
+
+const (
+	RandomAddressTypeStatic               RandomAddressType = 0b11
+	RandomAddressTypeNonResolvablePrivate RandomAddressType = 0b00
+	RandomAddressTypeResolvablePrivate    RandomAddressType = 0b01
+)
+
+// Type returns the sub-type of a random device address.
+func (a BDAddr) Type() RandomAddressType {
+	return RandomAddressType(a[5] >> 6)
+}
+
+// IRK is an Identity Resolving Key in HCI (little-endian) byte order.
+type IRK [16]byte
+
+// NewStaticRandomAddress generates a static random address. A static address
+// is expected to remain the same at least until the next power cycle.
+func NewStaticRandomAddress() (BDAddr, error) {
+	for {
+		var addr BDAddr
+		if _, err := rand.Read(addr[:]); err != nil {
+			return addr, err
+		}
+		addr[5] |= 0b11 << 6
+		if !allBits(addr[:], 0b11<<6) {
+			return addr, nil
+		}
+	}
+}
+
+// NewNonResolvablePrivateAddress generates a non-resolvable private address.
+func NewNonResolvablePrivateAddress() (BDAddr, error) {
+	for {
+		var addr BDAddr
+		if _, err := rand.Read(addr[:]); err != nil {
+			return addr, err
+		}
+		addr[5] &^= 0b11 << 6
+		if !allBits(addr[:], 0) {
+			return addr, nil
+		}
+	}
+}
+
+// NewResolvablePrivateAddress generates a resolvable private address from the
+// local IRK.
+func NewResolvablePrivateAddress(irk IRK) (BDAddr, error) {
+	for {
+		var addr BDAddr
+		if _, err := rand.Read(addr[3:]); err != nil {
+			return addr, err
+		}
+		addr[5] = addr[5]&^(0b11<<6) | 0b01<<6
+		if allBits(addr[3:], 0b01<<6) {
+			continue
+		}
+		hash, err := ah(irk, [3]byte{addr[3], addr[4], addr[5]})
+		if err != nil {
+			return addr, err
+		}
+		copy(addr[:3], hash[:])
+		return addr, nil
+	}
+}
+
+// ResolvePrivateAddress reports whether addr is a resolvable private address
+// generated from irk.
+func ResolvePrivateAddress(irk IRK, addr BDAddr) (bool, error) {
+	if addr.Type() != RandomAddressTypeResolvablePrivate {
+		return false, nil
+	}
+	hash, err := ah(irk, [3]byte{addr[3], addr[4], addr[5]})
+	if err != nil {
+		return false, err
+	}
+	return hash[0] == addr[0] && hash[1] == addr[1] && hash[2] == addr[2], nil
+}
+
+// allBits reports whether the random part of an address is all zeros or all
+// ones, which the specification disallows. msb is the value of the last byte
+// with only the sub-type bits applied.
+func allBits(b []byte, msb byte) bool {
+	zeros, ones := true, true
+	for i, v := range b {
+		if i == len(b)-1 {
+			v ^= msb
+			if v != 0 {
+				zeros = false
+			}
+			if v != 0b00111111 {
+				ones = false
+			}
+			continue
+		}
+		if v != 0 {
+			zeros = false
+		}
+		if v != 0xFF {
+			ones = false
+		}
+	}
+	return zeros || ones
+}
+
+// ah is the random address hash function, Vol 3, Part H, Section 2.2.2. Both
+// the input and the output are in little-endian byte order.
+func ah(irk IRK, r [3]byte) ([3]byte, error) {
+	var hash [3]byte
+	k := make([]byte, 16)
+	for i := range irk {
+		k[15-i] = irk[i]
+	}
+	c, err := aes.NewCipher(k)
+	if err != nil {
+		return hash, err
+	}
+	b := make([]byte, 16)
+	b[13], b[14], b[15] = r[2], r[1], r[0]
+	c.Encrypt(b, b)
+	hash[0], hash[1], hash[2] = b[15], b[14], b[13]
+	return hash, nil
+}
@@ -0,0 +1,256 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// AdvertisingReportEventType is the type of a legacy advertising PDU.
+type AdvertisingReportEventType uint8
+
+const (
+	AdvertisingReportEventTypeAdvInd        AdvertisingReportEventType = 0x00
+	AdvertisingReportEventTypeAdvDirectInd  AdvertisingReportEventType = 0x01
+	AdvertisingReportEventTypeAdvScanInd    AdvertisingReportEventType = 0x02
+	AdvertisingReportEventTypeAdvNonconnInd AdvertisingReportEventType = 0x03
+	AdvertisingReportEventTypeScanRsp       AdvertisingReportEventType = 0x04
+)
+
+// AdvertisingReport is a single report of an LE Advertising Report event.
+type AdvertisingReport struct {
+	EventType   AdvertisingReportEventType
+	AddressType PeerAddressType
+	Address     BDAddr
+	Data        []byte
+	// RSSI is in dBm, 127 if unavailable.
+	RSSI int8
+
+	// IdentityAddressType and IdentityAddress hold the advertiser's
+	// identity, if it could be resolved, or else its advertising address.
+	IdentityAddressType PeerAddressType
+	IdentityAddress     BDAddr
+}
+
+type LEAdvertisingReportEventPacket struct {
+	Reports []AdvertisingReport
+}
+
+func (p *LEAdvertisingReportEventPacket) Marshal() ([]byte, error) {
+	n := 5
+	for _, r := range p.Reports {
+		if len(r.Data) > 31 {
+			return nil, errors.New("advertising data too long")
+		}
+		n += 10 + len(r.Data)
+	}
+	if n-3 > 0xFF {
+		return nil, errors.New("too many reports")
+	}
+	buf := make([]byte, n)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = byte(n - 3)
+	buf[3] = byte(LEMetaSubeventCodeAdvertisingReport)
+	buf[4] = byte(len(p.Reports))
+	b := buf[5:]
+	for _, r := range p.Reports {
+		b[0] = byte(r.EventType)
+		b[1] = byte(r.AddressType)
+		copy(b[2:8], r.Address[:])
+		b[8] = byte(len(r.Data))
+		copy(b[9:], r.Data)
+		b[9+len(r.Data)] = byte(r.RSSI)
+		b = b[10+len(r.Data):]
+	}
+	return buf, nil
+}
+
+func (p *LEAdvertisingReportEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if len(buf) < 5 || len(buf) != int(buf[2])+3 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeAdvertisingReport) {
+		return errors.New("incorrect subevent")
+	}
+	p.Reports = make([]AdvertisingReport, buf[4])
+	buf = buf[5:]
+	for i := range p.Reports {
+		if len(buf) < 10 || len(buf) < 10+int(buf[8]) {
+			return io.ErrShortBuffer
+		}
+		n := int(buf[8])
+		r := AdvertisingReport{
+			EventType:   AdvertisingReportEventType(buf[0]),
+			AddressType: PeerAddressType(buf[1]),
+			Data:        buf[9 : 9+n],
+			RSSI:        int8(buf[9+n]),
+		}
+		copy(r.Address[:], buf[2:8])
+		r.IdentityAddressType, r.IdentityAddress = r.AddressType, r.Address
+		p.Reports[i] = r
+		buf = buf[10+n:]
+	}
+	return nil
+}
+
+// ExtendedAdvertisingEventType describes an extended advertising report.
+type ExtendedAdvertisingEventType uint16
+
+const (
+	ExtendedAdvertisingEventTypeConnectable  ExtendedAdvertisingEventType = (1 << 0)
+	ExtendedAdvertisingEventTypeScannable    ExtendedAdvertisingEventType = (1 << 1)
+	ExtendedAdvertisingEventTypeDirected     ExtendedAdvertisingEventType = (1 << 2)
+	ExtendedAdvertisingEventTypeScanResponse ExtendedAdvertisingEventType = (1 << 3)
+	ExtendedAdvertisingEventTypeLegacy       ExtendedAdvertisingEventType = (1 << 4)
+
+	// The data status occupies bits 5 and 6.
+	ExtendedAdvertisingEventTypeIncomplete ExtendedAdvertisingEventType = (1 << 5)
+	ExtendedAdvertisingEventTypeTruncated  ExtendedAdvertisingEventType = (2 << 5)
+)
+
+// ExtendedAdvertisingReport is a single report of an LE Extended Advertising
+// Report event. Advertising data too long for one event is split across
+// reports whose event type is marked incomplete.
+type ExtendedAdvertisingReport struct {
+	EventType    ExtendedAdvertisingEventType
+	AddressType  PeerAddressType
+	Address      BDAddr
+	PrimaryPHY   PHY
+	SecondaryPHY PHY // zero if there is no secondary advertising.
+	// AdvertisingSID is 0xFF if the advertiser provided no ADI.
+	AdvertisingSID uint8
+	// TxPower and RSSI are in dBm, 127 if unavailable.
+	TxPower int8
+	RSSI    int8
+	// PeriodicAdvertisingInterval is in units of 1.25ms, zero if there is no
+	// periodic advertising.
+	PeriodicAdvertisingInterval uint16
+	DirectAddressType           PeerAddressType
+	DirectAddress               BDAddr
+	Data                        []byte
+
+	// IdentityAddressType and IdentityAddress hold the advertiser's
+	// identity, if it could be resolved, or else its advertising address.
+	IdentityAddressType PeerAddressType
+	IdentityAddress     BDAddr
+}
+
+type LEExtendedAdvertisingReportEventPacket struct {
+	Reports []ExtendedAdvertisingReport
+}
+
+func (p *LEExtendedAdvertisingReportEventPacket) Marshal() ([]byte, error) {
+	n := 5
+	for _, r := range p.Reports {
+		if len(r.Data) > 229 {
+			return nil, errors.New("advertising data too long")
+		}
+		n += 24 + len(r.Data)
+	}
+	if n-3 > 0xFF {
+		return nil, errors.New("too many reports")
+	}
+	buf := make([]byte, n)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = byte(n - 3)
+	buf[3] = byte(LEMetaSubeventCodeExtendedAdvertisingReport)
+	buf[4] = byte(len(p.Reports))
+	b := buf[5:]
+	for _, r := range p.Reports {
+		binary.LittleEndian.PutUint16(b[0:], uint16(r.EventType))
+		b[2] = byte(r.AddressType)
+		copy(b[3:9], r.Address[:])
+		b[9] = byte(r.PrimaryPHY)
+		b[10] = byte(r.SecondaryPHY)
+		b[11] = r.AdvertisingSID
+		b[12] = byte(r.TxPower)
+		b[13] = byte(r.RSSI)
+		binary.LittleEndian.PutUint16(b[14:], r.PeriodicAdvertisingInterval)
+		b[16] = byte(r.DirectAddressType)
+		copy(b[17:23], r.DirectAddress[:])
+		b[23] = byte(len(r.Data))
+		copy(b[24:], r.Data)
+		b = b[24+len(r.Data):]
+	}
+	return buf, nil
+}
+
+func (p *LEExtendedAdvertisingReportEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if len(buf) < 5 || len(buf) != int(buf[2])+3 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeExtendedAdvertisingReport) {
+		return errors.New("incorrect subevent")
+	}
+	p.Reports = make([]ExtendedAdvertisingReport, buf[4])
+	buf = buf[5:]
+	for i := range p.Reports {
+		if len(buf) < 24 || len(buf) < 24+int(buf[23]) {
+			return io.ErrShortBuffer
+		}
+		n := int(buf[23])
+		r := ExtendedAdvertisingReport{
+			EventType:                   ExtendedAdvertisingEventType(binary.LittleEndian.Uint16(buf[0:])),
+			AddressType:                 PeerAddressType(buf[2]),
+			PrimaryPHY:                  PHY(buf[9]),
+			SecondaryPHY:                PHY(buf[10]),
+			AdvertisingSID:              buf[11],
+			TxPower:                     int8(buf[12]),
+			RSSI:                        int8(buf[13]),
+			PeriodicAdvertisingInterval: binary.LittleEndian.Uint16(buf[14:]),
+			DirectAddressType:           PeerAddressType(buf[16]),
+			Data:                        buf[24 : 24+n],
+		}
+		copy(r.Address[:], buf[3:9])
+		copy(r.DirectAddress[:], buf[17:23])
+		r.IdentityAddressType, r.IdentityAddress = r.AddressType, r.Address
+		p.Reports[i] = r
+		buf = buf[24+n:]
+	}
+	return nil
+}
+
+// OnAdvertisingReport invokes cb with the legacy advertising reports received
+// while scanning. The returned function stops delivery.
+func (a *Adapter) OnAdvertisingReport(cb func(*LEAdvertisingReportEventPacket)) func() {
+	return a.subscribe(func(p Packet, err error) {
+		if p, ok := p.(*LEAdvertisingReportEventPacket); ok {
+			cb(p)
+		}
+	})
+}
+
+// OnExtendedAdvertisingReport invokes cb with the extended advertising
+// reports received while scanning. The returned function stops delivery.
+func (a *Adapter) OnExtendedAdvertisingReport(cb func(*LEExtendedAdvertisingReportEventPacket)) func() {
+	return a.subscribe(func(p Packet, err error) {
+		if p, ok := p.(*LEExtendedAdvertisingReportEventPacket); ok {
+			cb(p)
+		}
+	})
+}
+
+// identity returns the identity address behind a peer address, as reported
+// by the controller or resolved by the Resolver, or else the address itself.
+func (a *Adapter) identity(addrType PeerAddressType, addr BDAddr) (PeerAddressType, BDAddr) {
+	switch addrType {
+	case PeerAddressTypePublicIdentityAddress:
+		return PeerAddressTypePublicDeviceAddress, addr
+	case PeerAddressTypeRandomIdentityAddress:
+		return PeerAddressTypeRandomDeviceAddress, addr
+	}
+	if a.Resolver != nil {
+		if id, ok := a.Resolver.Resolve(addrType, addr); ok {
+			return id.AddressType, id.Address
+		}
+	}
+	return addrType, addr
+}
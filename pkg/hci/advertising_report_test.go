@@ -0,0 +1,84 @@
+package hci_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/muxable/bluetooth/pkg/hci"
+	"github.com/muxable/bluetooth/pkg/hci/hcitest"
+)
+
+func TestAdvertisingReportResolvesIdentity(t *testing.T) {
+	a, c, err := hcitest.NewAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	defer a.Close()
+
+	irk := hci.IRK{0xec, 0x02, 0x34, 0xa3, 0x57, 0xc8, 0xad, 0x05, 0x34, 0x10, 0x10, 0xa6, 0x0a, 0x39, 0x7d, 0x9b}
+	identity := hci.BDAddr{0x01, 0x02, 0x03, 0x04, 0x05, 0xC6}
+	a.Resolver = &hci.Resolver{}
+	a.Resolver.Add(hci.Identity{AddressType: hci.PeerAddressTypeRandomDeviceAddress, Address: identity, IRK: irk})
+	rpa, err := hci.NewResolvablePrivateAddress(irk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := make(chan *hci.LEAdvertisingReportEventPacket, 1)
+	defer a.OnAdvertisingReport(func(p *hci.LEAdvertisingReportEventPacket) { legacy <- p })()
+	extended := make(chan *hci.LEExtendedAdvertisingReportEventPacket, 1)
+	defer a.OnExtendedAdvertisingReport(func(p *hci.LEExtendedAdvertisingReportEventPacket) { extended <- p })()
+
+	other := hci.BDAddr{0x11, 0x12, 0x13, 0x14, 0x15, 0x16}
+	if err := c.WritePacket(&hci.LEAdvertisingReportEventPacket{Reports: []hci.AdvertisingReport{
+		{EventType: hci.AdvertisingReportEventTypeAdvInd, AddressType: hci.PeerAddressTypeRandomDeviceAddress, Address: rpa, Data: []byte{0x02, 0x01, 0x06}, RSSI: -40},
+		{EventType: hci.AdvertisingReportEventTypeScanRsp, AddressType: hci.PeerAddressTypePublicDeviceAddress, Address: other, RSSI: -50},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-legacy:
+		if len(p.Reports) != 2 {
+			t.Fatalf("got %d reports, want 2", len(p.Reports))
+		}
+		if r := p.Reports[0]; r.Address != rpa || r.IdentityAddress != identity || !bytes.Equal(r.Data, []byte{0x02, 0x01, 0x06}) || r.RSSI != -40 {
+			t.Errorf("first report = %+v", r)
+		}
+		if r := p.Reports[1]; r.IdentityAddress != other || r.IdentityAddressType != hci.PeerAddressTypePublicDeviceAddress {
+			t.Errorf("second report = %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no advertising report")
+	}
+
+	if err := c.WritePacket(&hci.LEExtendedAdvertisingReportEventPacket{Reports: []hci.ExtendedAdvertisingReport{{
+		EventType:      hci.ExtendedAdvertisingEventTypeConnectable | hci.ExtendedAdvertisingEventTypeScannable,
+		AddressType:    hci.PeerAddressTypeRandomDeviceAddress,
+		Address:        rpa,
+		PrimaryPHY:     hci.PHYLE1M,
+		SecondaryPHY:   hci.PHYLE2M,
+		AdvertisingSID: 3,
+		TxPower:        4,
+		RSSI:           -60,
+		Data:           make([]byte, 200),
+	}}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-extended:
+		if len(p.Reports) != 1 {
+			t.Fatalf("got %d reports, want 1", len(p.Reports))
+		}
+		r := p.Reports[0]
+		if r.IdentityAddress != identity || r.IdentityAddressType != hci.PeerAddressTypeRandomDeviceAddress {
+			t.Errorf("identity = %v %v, want %v", r.IdentityAddressType, r.IdentityAddress, identity)
+		}
+		if r.SecondaryPHY != hci.PHYLE2M || r.AdvertisingSID != 3 || r.TxPower != 4 || r.RSSI != -60 || len(r.Data) != 200 {
+			t.Errorf("report = %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no extended advertising report")
+	}
+}
@@ -0,0 +1,286 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Controller capability discovery, Vol 4, Part E, Sections 7.4.1 to 7.4.3,
+// 7.8.3 and 7.8.27.
+
+// ErrUnsupportedCommand is returned when the controller does not support the
+// command being issued.
+var ErrUnsupportedCommand = errors.New("unsupported command")
+
+type LocalVersionInformation struct {
+	HCIVersion        uint8
+	HCISubversion     uint16
+	LMPVersion        uint8
+	CompanyIdentifier uint16
+	LMPSubversion     uint16
+}
+
+// LMPFeatures is the LMP feature mask, Vol 2, Part C, Section 3.3.
+type LMPFeatures uint64
+
+const (
+	LMPFeaturesBREDRNotSupported      LMPFeatures = (1 << 37)
+	LMPFeaturesLESupportedController  LMPFeatures = (1 << 38)
+	LMPFeaturesSimultaneousLEAndBREDR LMPFeatures = (1 << 39)
+	LMPFeaturesExtendedFeatures       LMPFeatures = (1 << 63)
+)
+
+// Has reports whether all of the features in f are set.
+func (l LMPFeatures) Has(f LMPFeatures) bool {
+	return l&f == f
+}
+
+// SupportedCommands is the supported commands bit mask returned by Read Local
+// Supported Commands, Vol 4, Part E, Section 6.27.
+type SupportedCommands [64]byte
+
+// supportedCommandBits maps opcodes to their octet and bit in
+// SupportedCommands. Opcodes that are not listed are assumed supported.
+var supportedCommandBits = map[Opcode][2]uint8{
+	OpcodeDisconnect:                              {0, 5},
+	OpcodeReadRemoteVersionInformation:            {2, 7},
+	OpcodeSetEventMask:                            {5, 6},
+	OpcodeReset:                                   {5, 7},
+	OpcodeReadTransmitPowerLevel:                  {10, 2},
+	OpcodeSetControllerToHostFlowControl:          {10, 5},
+	OpcodeHostBufferSize:                          {10, 6},
+	OpcodeHostNumberOfCompletedPackets:            {10, 7},
+	OpcodeReadLocalVersionInformation:             {14, 3},
+	OpcodeReadLocalSupportedFeatures:              {14, 5},
+	OpcodeReadBufferSize:                          {14, 7},
+	OpcodeReadBDAddr:                              {15, 1},
+	OpcodeReadRSSI:                                {15, 5},
+	OpcodeReadEncryptionKeySize:                   {20, 4},
+	OpcodeSetEventMaskPage2:                       {22, 2},
+	OpcodeLESetEventMask:                          {25, 0},
+	OpcodeLEReadBufferSize:                        {25, 1},
+	OpcodeLEReadLocalSupportedFeatures:            {25, 2},
+	OpcodeLESetRandomAddress:                      {25, 4},
+	OpcodeLESetAdvertisingParameters:              {25, 5},
+	OpcodeLEReadAdvertisingPhysicalChannelTxPower: {25, 6},
+	OpcodeSetAdvertisingData:                      {25, 7},
+	OpcodeLESetAdvertisingEnable:                  {26, 1},
+	OpcodeLECreateConnectionCancel:                {26, 5},
+	OpcodeReadFilterAcceptListSize:                {26, 6},
+	OpcodeClearFilterAcceptList:                   {26, 7},
+	OpcodeAddDeviceToFilterAcceptList:             {27, 0},
+	OpcodeRemoveDeviceFromFilterAcceptList:        {27, 1},
+	OpcodeLEConnectionUpdate:                      {27, 2},
+	OpcodeLEReadRemoteFeatures:                    {27, 5},
+	OpcodeLEEncrypt:                               {27, 6},
+	OpcodeLERand:                                  {27, 7},
+	OpcodeLEEnableEncryption:                      {28, 0},
+	OpcodeLELongTermKeyRequestReply:               {28, 1},
+	OpcodeLELongTermKeyRequestNegativeReply:       {28, 2},
+	OpcodeLEReadSupportedStates:                   {28, 3},
+
+	OpcodeLERemoteConnectionParameterRequestReply:         {33, 4},
+	OpcodeLERemoteConnectionParameterRequestNegativeReply: {33, 5},
+	OpcodeLESetDataLength:                                 {33, 6},
+	OpcodeLEReadSuggestedDefaultDataLength:                {33, 7},
+	OpcodeLEWriteSuggestedDefaultDataLength:               {34, 0},
+	OpcodeLEReadLocalP256PublicKey:                        {34, 1},
+	OpcodeLEGenerateDHKey:                                 {34, 2},
+	OpcodeLEAddDeviceToResolvingList:                      {34, 3},
+	OpcodeLERemoveDeviceFromResolvingList:                 {34, 4},
+	OpcodeLEClearResolvingList:                            {34, 5},
+	OpcodeLEReadResolvingListSize:                         {34, 6},
+	OpcodeLEReadPeerResolvableAddress:                     {34, 7},
+	OpcodeLEReadLocalResolvableAddress:                    {35, 0},
+	OpcodeLESetAddressResolutionEnable:                    {35, 1},
+	OpcodeLESetResolvablePrivateAddressTimeout:            {35, 2},
+	OpcodeLEReadMaximumDataLength:                         {35, 3},
+	OpcodeLEReadPHY:                                       {35, 4},
+	OpcodeLESetDefaultPHY:                                 {35, 5},
+	OpcodeLESetPHY:                                        {35, 6},
+	OpcodeLESetAdvertisingSetRandomAddress:                {36, 1},
+	OpcodeLESetExtendedAdvertisingParameters:              {36, 2},
+	OpcodeLESetExtendedAdvertisingEnable:                  {36, 5},
+	OpcodeLESetPeriodicAdvertisingEnable:                  {37, 4},
+	OpcodeLESetExtendedScanParameters:                     {37, 5},
+	OpcodeLESetExtendedScanEnable:                         {37, 6},
+	OpcodeLEPeriodicAdvertisingCreateSync:                 {38, 0},
+	OpcodeLEPeriodicAdvertisingCreateSyncCancel:           {38, 1},
+	OpcodeLEPeriodicAdvertisingTerminateSync:              {38, 2},
+	OpcodeLEReadTransmitPower:                             {38, 7},
+	OpcodeLEReadRFPathCompensation:                        {39, 0},
+	OpcodeLEWriteRFPathCompensation:                       {39, 1},
+	OpcodeLESetPrivacyMode:                                {39, 2},
+	OpcodeLEReadBufferSizeV2:                              {41, 5},
+	OpcodeLESetCIGParameters:                              {41, 7},
+	OpcodeLECreateCIS:                                     {42, 1},
+	OpcodeLERemoveCIG:                                     {42, 2},
+	OpcodeLEAcceptCISRequest:                              {42, 3},
+	OpcodeLERejectCISRequest:                              {42, 4},
+	OpcodeLECreateBIG:                                     {42, 5},
+	OpcodeLECreateBIGTest:                                 {42, 6},
+	OpcodeLETerminateBIG:                                  {42, 7},
+	OpcodeLEBIGCreateSync:                                 {43, 0},
+	OpcodeLEBIGTerminateSync:                              {43, 1},
+	OpcodeLESetupISODataPath:                              {43, 3},
+	OpcodeLERemoveISODataPath:                             {43, 4},
+	OpcodeLESetHostFeature:                                {44, 1},
+
+	OpcodeLEEnhancedReadTransmitPowerLevel:  {44, 3},
+	OpcodeLEReadRemoteTransmitPowerLevel:    {44, 4},
+	OpcodeLESetPathLossReportingParameters:  {44, 5},
+	OpcodeLESetPathLossReportingEnable:      {44, 6},
+	OpcodeLESetTransmitPowerReportingEnable: {44, 7},
+}
+
+// Supports reports whether the command is supported. Commands without a known
+// bit are reported as supported.
+func (s *SupportedCommands) Supports(opcode Opcode) bool {
+	b, ok := supportedCommandBits[opcode]
+	if !ok {
+		return true
+	}
+	return s[b[0]]&(1<<b[1]) != 0
+}
+
+// Capabilities describes what the controller supports.
+type Capabilities struct {
+	Version    LocalVersionInformation
+	Commands   SupportedCommands
+	Features   LMPFeatures
+	LEFeatures LEFeatures
+	LEStates   LESupportedStates
+}
+
+// Supports reports whether the controller supports the command.
+func (c *Capabilities) Supports(opcode Opcode) bool {
+	return c.Commands.Supports(opcode)
+}
+
+// checkSupported fails fast if the capabilities have been read and the
+// controller does not support opcode.
+func (a *Adapter) checkSupported(opcode Opcode) error {
+	if c := a.Capabilities(); c != nil && !c.Supports(opcode) {
+		return fmt.Errorf("%w: opcode 0x%04x", ErrUnsupportedCommand, uint16(opcode))
+	}
+	return nil
+}
+
+func (a *Adapter) ReadLocalVersionInformation() (*LocalVersionInformation, error) {
+	buf, err := a.op(NewGenericCommandPacket(OpcodeReadLocalVersionInformation))
+	if err != nil {
+		return nil, err
+	}
+	if buf[0] != 0 {
+		return nil, errors.New("command failed")
+	}
+	if len(buf) < 9 {
+		return nil, io.ErrShortBuffer
+	}
+	return &LocalVersionInformation{
+		HCIVersion:        buf[1],
+		HCISubversion:     binary.LittleEndian.Uint16(buf[2:4]),
+		LMPVersion:        buf[4],
+		CompanyIdentifier: binary.LittleEndian.Uint16(buf[5:7]),
+		LMPSubversion:     binary.LittleEndian.Uint16(buf[7:9]),
+	}, nil
+}
+
+func (a *Adapter) ReadLocalSupportedCommands() (*SupportedCommands, error) {
+	buf, err := a.op(NewGenericCommandPacket(OpcodeReadLocalSupportedCommands))
+	if err != nil {
+		return nil, err
+	}
+	if buf[0] != 0 {
+		return nil, errors.New("command failed")
+	}
+	var s SupportedCommands
+	if copy(s[:], buf[1:]) != len(s) {
+		return nil, io.ErrShortBuffer
+	}
+	return &s, nil
+}
+
+func (a *Adapter) ReadLocalSupportedFeatures() (LMPFeatures, error) {
+	buf, err := a.op(NewGenericCommandPacket(OpcodeReadLocalSupportedFeatures))
+	if err != nil {
+		return 0, err
+	}
+	if buf[0] != 0 {
+		return 0, errors.New("command failed")
+	}
+	if len(buf) < 9 {
+		return 0, io.ErrShortBuffer
+	}
+	return LMPFeatures(binary.LittleEndian.Uint64(buf[1:9])), nil
+}
+
+func (a *Adapter) LEReadLocalSupportedFeatures() (LEFeatures, error) {
+	buf, err := a.op(NewGenericCommandPacket(OpcodeLEReadLocalSupportedFeatures))
+	if err != nil {
+		return 0, err
+	}
+	if buf[0] != 0 {
+		return 0, errors.New("command failed")
+	}
+	if len(buf) < 9 {
+		return 0, io.ErrShortBuffer
+	}
+	return LEFeatures(binary.LittleEndian.Uint64(buf[1:9])), nil
+}
+
+// ReadCapabilities reads the controller's version, supported commands and
+// features and stores them in the adapter. Subsequent commands the controller
+// does not support fail with ErrUnsupportedCommand without being sent.
+func (a *Adapter) ReadCapabilities() (*Capabilities, error) {
+	c := &Capabilities{}
+	v, err := a.ReadLocalVersionInformation()
+	if err != nil {
+		return nil, err
+	}
+	c.Version = *v
+	s, err := a.ReadLocalSupportedCommands()
+	if err != nil {
+		return nil, err
+	}
+	c.Commands = *s
+	if c.Features, err = a.ReadLocalSupportedFeatures(); err != nil {
+		return nil, err
+	}
+	if !c.Features.Has(LMPFeaturesLESupportedController) {
+		return nil, errors.New("controller does not support LE")
+	}
+	if c.LEFeatures, err = a.LEReadLocalSupportedFeatures(); err != nil {
+		return nil, err
+	}
+	if c.Supports(OpcodeLEReadSupportedStates) {
+		if c.LEStates, err = a.LEReadSupportedStates(); err != nil {
+			return nil, err
+		}
+	}
+	a.setCapabilities(c)
+	return c, nil
+}
+
+// Capabilities returns what the controller supports, or nil if the
+// capabilities have not been read with ReadCapabilities.
+func (a *Adapter) Capabilities() *Capabilities {
+	a.capabilitiesLock.Lock()
+	defer a.capabilitiesLock.Unlock()
+	return a.capabilities
+}
+
+func (a *Adapter) setCapabilities(c *Capabilities) {
+	a.capabilitiesLock.Lock()
+	a.capabilities = c
+	a.capabilitiesLock.Unlock()
+}
+
+// SupportsLEFeatures reports whether the controller supports all of the LE
+// features in f. It reports false if the capabilities have not been read.
+func (a *Adapter) SupportsLEFeatures(f LEFeatures) bool {
+	c := a.Capabilities()
+	return c != nil && c.LEFeatures.Has(f)
+}
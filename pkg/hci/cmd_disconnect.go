@@ -0,0 +1,150 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DisconnectReason is the HCI error code reported when a connection is
+// terminated, Vol 1, Part F.
+type DisconnectReason uint8
+
+const (
+	DisconnectReasonHardwareFailure                     DisconnectReason = 0x03
+	DisconnectReasonAuthenticationFailure               DisconnectReason = 0x05
+	DisconnectReasonConnectionTimeout                   DisconnectReason = 0x08
+	DisconnectReasonRemoteUserTerminatedConnection      DisconnectReason = 0x13
+	DisconnectReasonRemoteDeviceTerminatedLowResources  DisconnectReason = 0x14
+	DisconnectReasonRemoteDeviceTerminatedPowerOff      DisconnectReason = 0x15
+	DisconnectReasonConnectionTerminatedByLocalHost     DisconnectReason = 0x16
+	DisconnectReasonUnsupportedRemoteFeature            DisconnectReason = 0x1A
+	DisconnectReasonLMPResponseTimeout                  DisconnectReason = 0x22
+	DisconnectReasonPairingWithUnitKeyNotSupported      DisconnectReason = 0x29
+	DisconnectReasonUnacceptableConnectionParameters    DisconnectReason = 0x3B
+	DisconnectReasonConnectionFailedToBeEstablished     DisconnectReason = 0x3E
+	DisconnectReasonConnectionTerminatedDueToMICFailure DisconnectReason = 0x3D
+)
+
+// valid reports whether r may be passed to the Disconnect command, Vol 4,
+// Part E, Section 7.1.6.
+func (r DisconnectReason) valid() bool {
+	switch r {
+	case DisconnectReasonAuthenticationFailure,
+		DisconnectReasonRemoteUserTerminatedConnection,
+		DisconnectReasonRemoteDeviceTerminatedLowResources,
+		DisconnectReasonRemoteDeviceTerminatedPowerOff,
+		DisconnectReasonUnsupportedRemoteFeature,
+		DisconnectReasonPairingWithUnitKeyNotSupported,
+		DisconnectReasonUnacceptableConnectionParameters:
+		return true
+	}
+	return false
+}
+
+// DisconnectError is returned by reads and writes on a connection that has
+// been terminated.
+type DisconnectError struct {
+	ConnectionHandle uint16
+	Reason           DisconnectReason
+}
+
+func (e *DisconnectError) Error() string {
+	return fmt.Sprintf("connection 0x%04x disconnected: reason 0x%02x", e.ConnectionHandle, uint8(e.Reason))
+}
+
+type HCIDisconnectCommandPacket struct {
+	ConnectionHandle uint16
+	Reason           DisconnectReason
+}
+
+func (p *HCIDisconnectCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 7)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeDisconnect))
+	buf[3] = 3
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	buf[6] = byte(p.Reason)
+	return buf, nil
+}
+
+func (p *HCIDisconnectCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeDisconnect) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 3 || len(buf) != 7 {
+		return io.ErrShortBuffer
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.Reason = DisconnectReason(buf[6])
+	return nil
+}
+
+func (p *HCIDisconnectCommandPacket) Opcode() Opcode {
+	return OpcodeDisconnect
+}
+
+// Disconnect terminates the connection and waits for the controller to report
+// that it is gone. Pending and subsequent reads and writes fail with a
+// *DisconnectError. If the connection was already terminated, that error is
+// returned instead.
+func (c *Conn) Disconnect(reason DisconnectReason) error {
+	if !reason.valid() {
+		return errors.New("invalid disconnect reason")
+	}
+	select {
+	case <-c.closed:
+		return c.closeErr
+	default:
+	}
+	if err := c.opStatus(&HCIDisconnectCommandPacket{
+		ConnectionHandle: c.ConnectionHandle,
+		Reason:           reason,
+	}); err != nil {
+		return err
+	}
+	<-c.closed
+	if _, ok := c.closeErr.(*DisconnectError); ok {
+		return nil
+	}
+	return c.closeErr
+}
+
+// Close disconnects with DisconnectReasonRemoteUserTerminatedConnection.
+func (c *Conn) Close() error {
+	return c.Disconnect(DisconnectReasonRemoteUserTerminatedConnection)
+}
+
+// Done returns a channel that is closed once the connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.closed
+}
+
+// Err returns why the connection closed, or nil while it is open.
+func (c *Conn) Err() error {
+	select {
+	case <-c.closed:
+		return c.closeErr
+	default:
+		return nil
+	}
+}
+
+// teardown marks the connection closed with err, waking any pending reads and
+// writes. Only the first call has an effect.
+func (c *Conn) teardown(err error) {
+	c.closeOnce.Do(func() {
+		c.closeErr = err
+		close(c.closed)
+		c.connsLock.Lock()
+		if c.conns[c.ConnectionHandle] == c {
+			delete(c.conns, c.ConnectionHandle)
+		}
+		c.connsLock.Unlock()
+		// fail writes still waiting to be transmitted.
+		c.ACLPacketsRemainingCond.L.Lock()
+		c.tx.remove(c, err)
+		c.ACLPacketsRemainingCond.L.Unlock()
+	})
+}
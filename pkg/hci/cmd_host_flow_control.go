@@ -0,0 +1,224 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Controller to host flow control, Vol 4, Part E, Sections 4.2, 7.3.38 to
+// 7.3.40.
+
+type FlowControlEnable uint8
+
+const (
+	FlowControlEnableOff FlowControlEnable = 0x00
+	FlowControlEnableACL FlowControlEnable = 0x01
+)
+
+type HCISetControllerToHostFlowControlCommandPacket struct {
+	FlowControlEnable
+}
+
+func (p *HCISetControllerToHostFlowControlCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 5)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeSetControllerToHostFlowControl))
+	buf[3] = 1
+	buf[4] = byte(p.FlowControlEnable)
+	return buf, nil
+}
+
+func (p *HCISetControllerToHostFlowControlCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeSetControllerToHostFlowControl) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 1 || len(buf) != 5 {
+		return io.ErrShortBuffer
+	}
+	p.FlowControlEnable = FlowControlEnable(buf[4])
+	return nil
+}
+
+func (p *HCISetControllerToHostFlowControlCommandPacket) Opcode() Opcode {
+	return OpcodeSetControllerToHostFlowControl
+}
+
+func (a *Adapter) SetControllerToHostFlowControl(enable FlowControlEnable) error {
+	buf, err := a.op(&HCISetControllerToHostFlowControlCommandPacket{FlowControlEnable: enable})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	a.hostFlowControlLock.Lock()
+	a.hostFlowControl = enable == FlowControlEnableACL
+	a.hostFlowControlLock.Unlock()
+	return nil
+}
+
+type HCIHostBufferSizeCommandPacket struct {
+	HostACLDataPacketLength            uint16
+	HostSynchronousDataPacketLength    uint8
+	HostTotalNumACLDataPackets         uint16
+	HostTotalNumSynchronousDataPackets uint16
+}
+
+func (p *HCIHostBufferSizeCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 11)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeHostBufferSize))
+	buf[3] = 7
+	binary.LittleEndian.PutUint16(buf[4:], p.HostACLDataPacketLength)
+	buf[6] = p.HostSynchronousDataPacketLength
+	binary.LittleEndian.PutUint16(buf[7:], p.HostTotalNumACLDataPackets)
+	binary.LittleEndian.PutUint16(buf[9:], p.HostTotalNumSynchronousDataPackets)
+	return buf, nil
+}
+
+func (p *HCIHostBufferSizeCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeHostBufferSize) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 7 || len(buf) != 11 {
+		return io.ErrShortBuffer
+	}
+	p.HostACLDataPacketLength = binary.LittleEndian.Uint16(buf[4:])
+	p.HostSynchronousDataPacketLength = buf[6]
+	p.HostTotalNumACLDataPackets = binary.LittleEndian.Uint16(buf[7:])
+	p.HostTotalNumSynchronousDataPackets = binary.LittleEndian.Uint16(buf[9:])
+	return nil
+}
+
+func (p *HCIHostBufferSizeCommandPacket) Opcode() Opcode {
+	return OpcodeHostBufferSize
+}
+
+// HostBufferSize tells the controller how many ACL data packets of what size
+// the host can hold before they are consumed.
+func (a *Adapter) HostBufferSize(aclLength, numACL uint16) error {
+	if aclLength < 27 || numACL == 0 {
+		return errors.New("invalid host buffer size")
+	}
+	buf, err := a.op(&HCIHostBufferSizeCommandPacket{
+		HostACLDataPacketLength:    aclLength,
+		HostTotalNumACLDataPackets: numACL,
+	})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+// EnableHostFlowControl limits the controller to numACL unconsumed ACL data
+// packets of at most aclLength bytes. Credits are returned as connections'
+// PDUs are consumed.
+func (a *Adapter) EnableHostFlowControl(aclLength, numACL uint16) error {
+	if err := a.HostBufferSize(aclLength, numACL); err != nil {
+		return err
+	}
+	return a.SetControllerToHostFlowControl(FlowControlEnableACL)
+}
+
+type HCIHostNumberOfCompletedPacketsCommandPacket struct {
+	NumHandles              uint8
+	ConnectionHandles       []uint16
+	HostNumCompletedPackets []uint16
+}
+
+func (p *HCIHostNumberOfCompletedPacketsCommandPacket) Marshal() ([]byte, error) {
+	if len(p.ConnectionHandles) != int(p.NumHandles) || len(p.HostNumCompletedPackets) != int(p.NumHandles) {
+		return nil, errors.New("invalid number of handles")
+	}
+	buf := make([]byte, 5+4*int(p.NumHandles))
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeHostNumberOfCompletedPackets))
+	buf[3] = byte(1 + 4*int(p.NumHandles))
+	buf[4] = p.NumHandles
+	for i := 0; i < int(p.NumHandles); i++ {
+		binary.LittleEndian.PutUint16(buf[5+i*2:], p.ConnectionHandles[i])
+		binary.LittleEndian.PutUint16(buf[5+(int(p.NumHandles)+i)*2:], p.HostNumCompletedPackets[i])
+	}
+	return buf, nil
+}
+
+func (p *HCIHostNumberOfCompletedPacketsCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeHostNumberOfCompletedPackets) {
+		return errors.New("incorrect packet")
+	}
+	if len(buf) < 5 || len(buf) != 4+int(buf[3]) || int(buf[3]) != 1+4*int(buf[4]) {
+		return io.ErrShortBuffer
+	}
+	p.NumHandles = buf[4]
+	p.ConnectionHandles = make([]uint16, p.NumHandles)
+	p.HostNumCompletedPackets = make([]uint16, p.NumHandles)
+	for i := 0; i < int(p.NumHandles); i++ {
+		p.ConnectionHandles[i] = binary.LittleEndian.Uint16(buf[5+i*2:])
+		p.HostNumCompletedPackets[i] = binary.LittleEndian.Uint16(buf[5+(int(p.NumHandles)+i)*2:])
+	}
+	return nil
+}
+
+func (p *HCIHostNumberOfCompletedPacketsCommandPacket) Opcode() Opcode {
+	return OpcodeHostNumberOfCompletedPackets
+}
+
+// rxPDU is a reassembled L2CAP PDU and the pooled buffer it is held in. It
+// holds the controller credit of its first ACL data packet.
+type rxPDU struct {
+	conn   *Conn
+	buf    []byte
+	pooled *buffer
+}
+
+// free returns the PDU's buffer and controller credit. buf must not be used
+// afterwards.
+func (p *rxPDU) free() {
+	putBuffer(p.pooled)
+	p.conn.release(1)
+}
+
+// ReadPDU returns the next L2CAP PDU without consuming it. One controller
+// buffer is only returned once release is called, so a consumer that falls
+// behind throttles the peer instead of accumulating data. The buffers of the
+// PDU's other fragments are returned as they are reassembled. release must be
+// called exactly once, the PDU must not be referenced afterwards.
+func (c *Conn) ReadPDU() ([]byte, func(), error) {
+	select {
+	case p := <-c.bufCh:
+		var once sync.Once
+		return p.buf, func() { once.Do(p.free) }, nil
+	case <-c.closed:
+		return nil, nil, c.closeErr
+	}
+}
+
+// release returns n ACL data packet credits to the controller if controller
+// to host flow control is enabled. The Host Number Of Completed Packets
+// command is sent without waiting for a command slot or response.
+func (c *Conn) release(n uint16) {
+	if n == 0 || c.isClosed() {
+		// the controller forgets the credits of a disconnected handle.
+		return
+	}
+	c.hostFlowControlLock.Lock()
+	enabled := c.hostFlowControl
+	c.hostFlowControlLock.Unlock()
+	if !enabled {
+		return
+	}
+	if err := c.Adapter.WritePacket(&HCIHostNumberOfCompletedPacketsCommandPacket{
+		NumHandles:              1,
+		ConnectionHandles:       []uint16{c.ConnectionHandle},
+		HostNumCompletedPackets: []uint16{n},
+	}); err != nil {
+		zap.L().Warn("failed to return controller credits", zap.Uint16("handle", c.ConnectionHandle), zap.Error(err))
+	}
+}
@@ -0,0 +1,86 @@
+package hci_test
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/muxable/bluetooth/pkg/hci"
+	"github.com/muxable/bluetooth/pkg/hci/hcitest"
+)
+
+// expectCredits waits for the host to return n controller credits and checks
+// that no more follow.
+func expectCredits(t *testing.T, returned chan uint16, n int) {
+	t.Helper()
+	got := 0
+	for got < n {
+		select {
+		case m := <-returned:
+			got += int(m)
+		case <-time.After(time.Second):
+			t.Fatalf("%d credits returned, want %d", got, n)
+		}
+	}
+	select {
+	case m := <-returned:
+		t.Fatalf("%d credits returned, want %d", got+int(m), n)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestHostFlowControlCredits(t *testing.T) {
+	s, c, err := hcitest.NewController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	returned := make(chan uint16, 64)
+	c.HandleCommand = func(opcode hci.Opcode, params []byte) []hci.Packet {
+		if opcode != hci.OpcodeHostNumberOfCompletedPackets {
+			return nil
+		}
+		for i := 0; i < int(params[0]); i++ {
+			returned <- binary.LittleEndian.Uint16(params[1+2*int(params[0])+2*i:])
+		}
+		return []hci.Packet{}
+	}
+	a := hci.NewConn(s)
+	defer c.Close()
+	defer a.Close()
+	if err := a.EnableHostFlowControl(27, 4); err != nil {
+		t.Fatal(err)
+	}
+	conn := hcitest.Connect(t, a, c, 1, hci.RolePeripheral)
+
+	// the PDU spans more packets than the host has buffers for.
+	packets := marshalPDU(t, 1, 100, 20)
+	for _, p := range packets {
+		if _, err := c.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf, release, err := conn.ReadPDU()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != 104 {
+		t.Fatalf("read %d bytes, want 104", len(buf))
+	}
+	// the fragments are copied, only the PDU holds a credit.
+	expectCredits(t, returned, len(packets)-1)
+	release()
+	expectCredits(t, returned, 1)
+
+	// a PDU in a single packet holds its credit until released.
+	for _, p := range marshalPDU(t, 1, 10, 27) {
+		if _, err := c.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, release, err = conn.ReadPDU(); err != nil {
+		t.Fatal(err)
+	}
+	expectCredits(t, returned, 0)
+	release()
+	expectCredits(t, returned, 1)
+}
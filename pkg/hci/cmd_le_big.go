@@ -0,0 +1,855 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Broadcast isochronous groups, Vol 4, Part E, Sections 7.8.103 to 7.8.107,
+// 7.7.65.27 to 7.7.65.30 and 7.7.65.34.
+
+// BroadcastCode encrypts the BISes of a BIG.
+type BroadcastCode [16]byte
+
+// NewBroadcastCode returns the broadcast code of a string of up to 16 UTF-8
+// octets, zero padded, Vol 3, Part C, Section 3.2.6.
+func NewBroadcastCode(s string) (BroadcastCode, error) {
+	var c BroadcastCode
+	if len(s) == 0 || len(s) > len(c) {
+		return c, errors.New("invalid broadcast code length")
+	}
+	copy(c[:], s)
+	return c, nil
+}
+
+// BIGParameters configures a BIG broadcast on a periodic advertising train.
+type BIGParameters struct {
+	BIGHandle         uint8
+	AdvertisingHandle uint8
+	NumBIS            uint8
+	// SDUInterval is in microseconds, MaxTransportLatency in milliseconds.
+	SDUInterval         uint32
+	MaxSDU              uint16
+	MaxTransportLatency uint16
+	RTN                 uint8
+	PHY                 PHYs
+	Packing             ISOPacking
+	Framing             ISOFraming
+	// Encryption encrypts the BISes with BroadcastCode.
+	Encryption    bool
+	BroadcastCode BroadcastCode
+}
+
+type HCILECreateBIGCommandPacket struct {
+	BIGParameters
+}
+
+func (p *HCILECreateBIGCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 35)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLECreateBIG))
+	buf[3] = 31
+	buf[4] = p.BIGHandle
+	buf[5] = p.AdvertisingHandle
+	buf[6] = p.NumBIS
+	putUint24(buf[7:], p.SDUInterval)
+	binary.LittleEndian.PutUint16(buf[10:], p.MaxSDU)
+	binary.LittleEndian.PutUint16(buf[12:], p.MaxTransportLatency)
+	buf[14] = p.RTN
+	buf[15] = byte(p.PHY)
+	buf[16] = byte(p.Packing)
+	buf[17] = byte(p.Framing)
+	if p.Encryption {
+		buf[18] = 1
+	}
+	copy(buf[19:], p.BroadcastCode[:])
+	return buf, nil
+}
+
+func (p *HCILECreateBIGCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLECreateBIG) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 31 || len(buf) != 35 {
+		return io.ErrShortBuffer
+	}
+	p.BIGHandle = buf[4]
+	p.AdvertisingHandle = buf[5]
+	p.NumBIS = buf[6]
+	p.SDUInterval = uint24(buf[7:])
+	p.MaxSDU = binary.LittleEndian.Uint16(buf[10:])
+	p.MaxTransportLatency = binary.LittleEndian.Uint16(buf[12:])
+	p.RTN = buf[14]
+	p.PHY = PHYs(buf[15])
+	p.Packing = ISOPacking(buf[16])
+	p.Framing = ISOFraming(buf[17])
+	p.Encryption = buf[18] == 1
+	copy(p.BroadcastCode[:], buf[19:])
+	return nil
+}
+
+func (p *HCILECreateBIGCommandPacket) Opcode() Opcode {
+	return OpcodeLECreateBIG
+}
+
+// BIGTestParameters configures a BIG with explicit link layer parameters
+// rather than letting the controller derive them.
+type BIGTestParameters struct {
+	BIGHandle         uint8
+	AdvertisingHandle uint8
+	NumBIS            uint8
+	// SDUInterval is in microseconds, ISOInterval in units of 1.25ms.
+	SDUInterval   uint32
+	ISOInterval   uint16
+	NSE           uint8
+	MaxSDU        uint16
+	MaxPDU        uint16
+	PHY           PHYs
+	Packing       ISOPacking
+	Framing       ISOFraming
+	BN            uint8
+	IRC           uint8
+	PTO           uint8
+	Encryption    bool
+	BroadcastCode BroadcastCode
+}
+
+type HCILECreateBIGTestCommandPacket struct {
+	BIGTestParameters
+}
+
+func (p *HCILECreateBIGTestCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 40)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLECreateBIGTest))
+	buf[3] = 36
+	buf[4] = p.BIGHandle
+	buf[5] = p.AdvertisingHandle
+	buf[6] = p.NumBIS
+	putUint24(buf[7:], p.SDUInterval)
+	binary.LittleEndian.PutUint16(buf[10:], p.ISOInterval)
+	buf[12] = p.NSE
+	binary.LittleEndian.PutUint16(buf[13:], p.MaxSDU)
+	binary.LittleEndian.PutUint16(buf[15:], p.MaxPDU)
+	buf[17] = byte(p.PHY)
+	buf[18] = byte(p.Packing)
+	buf[19] = byte(p.Framing)
+	buf[20] = p.BN
+	buf[21] = p.IRC
+	buf[22] = p.PTO
+	if p.Encryption {
+		buf[23] = 1
+	}
+	copy(buf[24:], p.BroadcastCode[:])
+	return buf, nil
+}
+
+func (p *HCILECreateBIGTestCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLECreateBIGTest) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 36 || len(buf) != 40 {
+		return io.ErrShortBuffer
+	}
+	p.BIGHandle = buf[4]
+	p.AdvertisingHandle = buf[5]
+	p.NumBIS = buf[6]
+	p.SDUInterval = uint24(buf[7:])
+	p.ISOInterval = binary.LittleEndian.Uint16(buf[10:])
+	p.NSE = buf[12]
+	p.MaxSDU = binary.LittleEndian.Uint16(buf[13:])
+	p.MaxPDU = binary.LittleEndian.Uint16(buf[15:])
+	p.PHY = PHYs(buf[17])
+	p.Packing = ISOPacking(buf[18])
+	p.Framing = ISOFraming(buf[19])
+	p.BN = buf[20]
+	p.IRC = buf[21]
+	p.PTO = buf[22]
+	p.Encryption = buf[23] == 1
+	copy(p.BroadcastCode[:], buf[24:])
+	return nil
+}
+
+func (p *HCILECreateBIGTestCommandPacket) Opcode() Opcode {
+	return OpcodeLECreateBIGTest
+}
+
+type HCILETerminateBIGCommandPacket struct {
+	BIGHandle uint8
+	Reason    DisconnectReason
+}
+
+func (p *HCILETerminateBIGCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 6)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLETerminateBIG))
+	buf[3] = 2
+	buf[4] = p.BIGHandle
+	buf[5] = byte(p.Reason)
+	return buf, nil
+}
+
+func (p *HCILETerminateBIGCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLETerminateBIG) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 2 || len(buf) != 6 {
+		return io.ErrShortBuffer
+	}
+	p.BIGHandle = buf[4]
+	p.Reason = DisconnectReason(buf[5])
+	return nil
+}
+
+func (p *HCILETerminateBIGCommandPacket) Opcode() Opcode {
+	return OpcodeLETerminateBIG
+}
+
+// BIGSyncParameters selects the BISes of a BIG to receive. The BIG is
+// described by the BIGInfo of the periodic advertising train SyncHandle is
+// synchronized to.
+type BIGSyncParameters struct {
+	BIGHandle     uint8
+	SyncHandle    uint16
+	Encryption    bool
+	BroadcastCode BroadcastCode
+	// MSE bounds the subevents used to receive each BIS PDU, zero leaving it
+	// to the controller.
+	MSE uint8
+	// BIGSyncTimeout is in units of 10ms.
+	BIGSyncTimeout uint16
+	// BISes are the indices, starting at 1, of the BISes to receive.
+	BISes []uint8
+}
+
+type HCILEBIGCreateSyncCommandPacket struct {
+	BIGSyncParameters
+}
+
+func (p *HCILEBIGCreateSyncCommandPacket) Marshal() ([]byte, error) {
+	n := len(p.BISes)
+	if n == 0 || n > 0x1F {
+		return nil, errors.New("invalid number of bises")
+	}
+	buf := make([]byte, 28+n)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLEBIGCreateSync))
+	buf[3] = byte(24 + n)
+	buf[4] = p.BIGHandle
+	binary.LittleEndian.PutUint16(buf[5:], p.SyncHandle)
+	if p.Encryption {
+		buf[7] = 1
+	}
+	copy(buf[8:], p.BroadcastCode[:])
+	buf[24] = p.MSE
+	binary.LittleEndian.PutUint16(buf[25:], p.BIGSyncTimeout)
+	buf[27] = byte(n)
+	copy(buf[28:], p.BISes)
+	return buf, nil
+}
+
+func (p *HCILEBIGCreateSyncCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLEBIGCreateSync) {
+		return errors.New("incorrect packet")
+	}
+	if len(buf) < 28 || len(buf) != int(buf[3])+4 || len(buf) != 28+int(buf[27]) {
+		return io.ErrShortBuffer
+	}
+	p.BIGHandle = buf[4]
+	p.SyncHandle = binary.LittleEndian.Uint16(buf[5:])
+	p.Encryption = buf[7] == 1
+	copy(p.BroadcastCode[:], buf[8:24])
+	p.MSE = buf[24]
+	p.BIGSyncTimeout = binary.LittleEndian.Uint16(buf[25:])
+	p.BISes = append([]uint8(nil), buf[28:]...)
+	return nil
+}
+
+func (p *HCILEBIGCreateSyncCommandPacket) Opcode() Opcode {
+	return OpcodeLEBIGCreateSync
+}
+
+type HCILEBIGTerminateSyncCommandPacket struct {
+	BIGHandle uint8
+}
+
+func (p *HCILEBIGTerminateSyncCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 5)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLEBIGTerminateSync))
+	buf[3] = 1
+	buf[4] = p.BIGHandle
+	return buf, nil
+}
+
+func (p *HCILEBIGTerminateSyncCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLEBIGTerminateSync) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 1 || len(buf) != 5 {
+		return io.ErrShortBuffer
+	}
+	p.BIGHandle = buf[4]
+	return nil
+}
+
+func (p *HCILEBIGTerminateSyncCommandPacket) Opcode() Opcode {
+	return OpcodeLEBIGTerminateSync
+}
+
+// BIGTerminatedError is returned by the streams of a BIG that was terminated
+// or whose synchronization was lost.
+type BIGTerminatedError struct {
+	BIGHandle uint8
+	Reason    DisconnectReason
+}
+
+func (e *BIGTerminatedError) Error() string {
+	return fmt.Sprintf("big 0x%02x terminated: reason 0x%02x", e.BIGHandle, uint8(e.Reason))
+}
+
+// BIG is a broadcast isochronous group created by the local device. Its
+// SDUs are written through the ISOStreams of its BISes once their input
+// data paths are set up.
+type BIG struct {
+	adapter *Adapter
+
+	BIGHandle uint8
+	BISes     []*ISOStream
+
+	// BIGSyncDelay and TransportLatency are in microseconds.
+	BIGSyncDelay     uint32
+	TransportLatency uint32
+	PHY              PHY
+	NSE              uint8
+	BN               uint8
+	PTO              uint8
+	IRC              uint8
+	MaxPDU           uint16
+	// ISOInterval is in units of 1.25ms.
+	ISOInterval uint16
+}
+
+// CreateBIG creates a BIG on a periodic advertising train and blocks until
+// the controller reports it created. The advertising set must be advertising
+// periodically, see LESetPeriodicAdvertisingEnable and
+// LESetExtendedAdvertisingEnable, for receivers to find the BIG.
+func (a *Adapter) CreateBIG(params *BIGParameters) (*BIG, error) {
+	return a.createBIG(params.BIGHandle, &HCILECreateBIGCommandPacket{BIGParameters: *params})
+}
+
+// CreateBIGTest is CreateBIG with explicit link layer parameters, for
+// testing.
+func (a *Adapter) CreateBIGTest(params *BIGTestParameters) (*BIG, error) {
+	return a.createBIG(params.BIGHandle, &HCILECreateBIGTestCommandPacket{BIGTestParameters: *params})
+}
+
+func (a *Adapter) createBIG(handle uint8, q CommandPacket) (*BIG, error) {
+	done := make(chan *LEBIGCompleteEventPacket, 1)
+	errch := make(chan error, 1)
+	cancel := a.subscribe(func(p Packet, err error) {
+		if err != nil {
+			select {
+			case errch <- err:
+			default:
+			}
+			return
+		}
+		if p, ok := p.(*LEBIGCompleteEventPacket); ok && p.BIGHandle == handle {
+			select {
+			case done <- p:
+			default:
+			}
+		}
+	})
+	defer cancel()
+
+	if err := a.opStatus(q); err != nil {
+		return nil, err
+	}
+	select {
+	case p := <-done:
+		if p.Status != 0 {
+			return nil, fmt.Errorf("big 0x%02x not created: status 0x%02x", handle, p.Status)
+		}
+		return &BIG{
+			adapter:          a,
+			BIGHandle:        p.BIGHandle,
+			BISes:            p.established,
+			BIGSyncDelay:     p.BIGSyncDelay,
+			TransportLatency: p.TransportLatency,
+			PHY:              p.PHY,
+			NSE:              p.NSE,
+			BN:               p.BN,
+			PTO:              p.PTO,
+			IRC:              p.IRC,
+			MaxPDU:           p.MaxPDU,
+			ISOInterval:      p.ISOInterval,
+		}, nil
+	case err := <-errch:
+		return nil, err
+	case <-a.closing:
+		return nil, ErrAdapterClosed
+	}
+}
+
+// Terminate terminates the BIG and waits for the controller to report it
+// gone. The BIS streams then fail with a *BIGTerminatedError.
+func (b *BIG) Terminate(reason DisconnectReason) error {
+	a := b.adapter
+	done := make(chan struct{}, 1)
+	errch := make(chan error, 1)
+	cancel := a.subscribe(func(p Packet, err error) {
+		if err != nil {
+			select {
+			case errch <- err:
+			default:
+			}
+			return
+		}
+		if p, ok := p.(*LETerminateBIGCompleteEventPacket); ok && p.BIGHandle == b.BIGHandle {
+			select {
+			case done <- struct{}{}:
+			default:
+			}
+		}
+	})
+	defer cancel()
+
+	if err := a.opStatus(&HCILETerminateBIGCommandPacket{BIGHandle: b.BIGHandle, Reason: reason}); err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	case err := <-errch:
+		return err
+	case <-a.closing:
+		return ErrAdapterClosed
+	}
+}
+
+// Close terminates with DisconnectReasonRemoteUserTerminatedConnection.
+func (b *BIG) Close() error {
+	return b.Terminate(DisconnectReasonRemoteUserTerminatedConnection)
+}
+
+// BIGSync is a BIG the local device is synchronized to. Its SDUs are read
+// through the ISOStreams of the selected BISes once their output data paths
+// are set up.
+type BIGSync struct {
+	adapter *Adapter
+
+	BIGHandle uint8
+	BISes     []*ISOStream
+
+	// TransportLatency is in microseconds.
+	TransportLatency uint32
+	NSE              uint8
+	BN               uint8
+	PTO              uint8
+	IRC              uint8
+	MaxPDU           uint16
+	// ISOInterval is in units of 1.25ms.
+	ISOInterval uint16
+}
+
+// BIGCreateSync synchronizes to BISes of a BIG and blocks until the
+// controller reports the synchronization established. params.SyncHandle is
+// that of the periodic advertising train carrying the BIG, see
+// LEPeriodicAdvertisingCreateSync and OnBIGInfoAdvertisingReport.
+func (a *Adapter) BIGCreateSync(params *BIGSyncParameters) (*BIGSync, error) {
+	done := make(chan *LEBIGSyncEstablishedEventPacket, 1)
+	errch := make(chan error, 1)
+	cancel := a.subscribe(func(p Packet, err error) {
+		if err != nil {
+			select {
+			case errch <- err:
+			default:
+			}
+			return
+		}
+		if p, ok := p.(*LEBIGSyncEstablishedEventPacket); ok && p.BIGHandle == params.BIGHandle {
+			select {
+			case done <- p:
+			default:
+			}
+		}
+	})
+	defer cancel()
+
+	if err := a.opStatus(&HCILEBIGCreateSyncCommandPacket{BIGSyncParameters: *params}); err != nil {
+		return nil, err
+	}
+	select {
+	case p := <-done:
+		if p.Status != 0 {
+			return nil, fmt.Errorf("big 0x%02x sync not established: status 0x%02x", params.BIGHandle, p.Status)
+		}
+		return &BIGSync{
+			adapter:          a,
+			BIGHandle:        p.BIGHandle,
+			BISes:            p.established,
+			TransportLatency: p.TransportLatency,
+			NSE:              p.NSE,
+			BN:               p.BN,
+			PTO:              p.PTO,
+			IRC:              p.IRC,
+			MaxPDU:           p.MaxPDU,
+			ISOInterval:      p.ISOInterval,
+		}, nil
+	case err := <-errch:
+		return nil, err
+	case <-a.closing:
+		return nil, ErrAdapterClosed
+	}
+}
+
+// Terminate stops receiving the BIG. The BIS streams then fail with a
+// *BIGTerminatedError.
+func (s *BIGSync) Terminate() error {
+	buf, err := s.adapter.op(&HCILEBIGTerminateSyncCommandPacket{BIGHandle: s.BIGHandle})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	s.adapter.teardownBIG(s.BIGHandle, &BIGTerminatedError{
+		BIGHandle: s.BIGHandle,
+		Reason:    DisconnectReasonConnectionTerminatedByLocalHost,
+	})
+	return nil
+}
+
+// Close is Terminate.
+func (s *BIGSync) Close() error {
+	return s.Terminate()
+}
+
+// newBIGStreams registers the streams of the BISes of a BIG.
+func (a *Adapter) newBIGStreams(handle uint8, bises []uint16) []*ISOStream {
+	streams := make([]*ISOStream, len(bises))
+	for i, h := range bises {
+		streams[i] = a.newISOStream(h)
+	}
+	a.isoLock.Lock()
+	a.bigStreams[handle] = streams
+	a.isoLock.Unlock()
+	return streams
+}
+
+// teardownBIG closes the streams of a BIG with err and returns their ISO
+// buffer credits.
+func (a *Adapter) teardownBIG(handle uint8, err error) {
+	a.isoLock.Lock()
+	streams := a.bigStreams[handle]
+	delete(a.bigStreams, handle)
+	a.isoLock.Unlock()
+	a.ACLPacketsRemainingCond.L.Lock()
+	for _, s := range streams {
+		a.isoPacketsRemaining += a.isoPacketsPending[s.ConnectionHandle]
+		delete(a.isoPacketsPending, s.ConnectionHandle)
+	}
+	a.ACLPacketsRemainingCond.Broadcast()
+	a.ACLPacketsRemainingCond.L.Unlock()
+	for _, s := range streams {
+		s.teardown(err)
+	}
+}
+
+// OnBIGInfoAdvertisingReport invokes cb with the BIGInfo received on
+// synchronized periodic advertising trains, which describes the BIGs that
+// can be synchronized to. The returned function stops delivery.
+func (a *Adapter) OnBIGInfoAdvertisingReport(cb func(*LEBIGInfoAdvertisingReportEventPacket)) func() {
+	return a.subscribe(func(p Packet, err error) {
+		if p, ok := p.(*LEBIGInfoAdvertisingReportEventPacket); ok {
+			cb(p)
+		}
+	})
+}
+
+type LEBIGCompleteEventPacket struct {
+	Status    uint8
+	BIGHandle uint8
+	// BIGSyncDelay and TransportLatency are in microseconds.
+	BIGSyncDelay      uint32
+	TransportLatency  uint32
+	PHY               PHY
+	NSE               uint8
+	BN                uint8
+	PTO               uint8
+	IRC               uint8
+	MaxPDU            uint16
+	ISOInterval       uint16
+	ConnectionHandles []uint16
+
+	// established holds the streams registered with the adapter when the
+	// BIG was created.
+	established []*ISOStream
+}
+
+func (p *LEBIGCompleteEventPacket) Marshal() ([]byte, error) {
+	n := len(p.ConnectionHandles)
+	buf := make([]byte, 22+2*n)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = byte(19 + 2*n)
+	buf[3] = byte(LEMetaSubeventCodeBIGComplete)
+	buf[4] = p.Status
+	buf[5] = p.BIGHandle
+	putUint24(buf[6:], p.BIGSyncDelay)
+	putUint24(buf[9:], p.TransportLatency)
+	buf[12] = byte(p.PHY)
+	buf[13] = p.NSE
+	buf[14] = p.BN
+	buf[15] = p.PTO
+	buf[16] = p.IRC
+	binary.LittleEndian.PutUint16(buf[17:], p.MaxPDU)
+	binary.LittleEndian.PutUint16(buf[19:], p.ISOInterval)
+	buf[21] = byte(n)
+	for i, h := range p.ConnectionHandles {
+		binary.LittleEndian.PutUint16(buf[22+2*i:], h)
+	}
+	return buf, nil
+}
+
+func (p *LEBIGCompleteEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != byte(LEMetaSubeventCodeBIGComplete) {
+		return errors.New("incorrect subevent")
+	}
+	if len(buf) < 6 {
+		return io.ErrShortBuffer
+	}
+	p.Status = buf[4]
+	p.BIGHandle = buf[5]
+	if p.Status != 0 {
+		// the remaining parameters are only valid on success.
+		return nil
+	}
+	if len(buf) < 22 || len(buf) != 22+2*int(buf[21]) {
+		return io.ErrShortBuffer
+	}
+	p.BIGSyncDelay = uint24(buf[6:])
+	p.TransportLatency = uint24(buf[9:])
+	p.PHY = PHY(buf[12])
+	p.NSE = buf[13]
+	p.BN = buf[14]
+	p.PTO = buf[15]
+	p.IRC = buf[16]
+	p.MaxPDU = binary.LittleEndian.Uint16(buf[17:])
+	p.ISOInterval = binary.LittleEndian.Uint16(buf[19:])
+	p.ConnectionHandles = make([]uint16, buf[21])
+	for i := range p.ConnectionHandles {
+		p.ConnectionHandles[i] = binary.LittleEndian.Uint16(buf[22+2*i:])
+	}
+	return nil
+}
+
+type LETerminateBIGCompleteEventPacket struct {
+	BIGHandle uint8
+	Reason    DisconnectReason
+}
+
+func (p *LETerminateBIGCompleteEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 6)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 3
+	buf[3] = byte(LEMetaSubeventCodeTerminateBIGComplete)
+	buf[4] = p.BIGHandle
+	buf[5] = byte(p.Reason)
+	return buf, nil
+}
+
+func (p *LETerminateBIGCompleteEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 3 || len(buf) != 6 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeTerminateBIGComplete) {
+		return errors.New("incorrect subevent")
+	}
+	p.BIGHandle = buf[4]
+	p.Reason = DisconnectReason(buf[5])
+	return nil
+}
+
+type LEBIGSyncEstablishedEventPacket struct {
+	Status    uint8
+	BIGHandle uint8
+	// TransportLatency is in microseconds.
+	TransportLatency  uint32
+	NSE               uint8
+	BN                uint8
+	PTO               uint8
+	IRC               uint8
+	MaxPDU            uint16
+	ISOInterval       uint16
+	ConnectionHandles []uint16
+
+	// established holds the streams registered with the adapter when the
+	// synchronization was established.
+	established []*ISOStream
+}
+
+func (p *LEBIGSyncEstablishedEventPacket) Marshal() ([]byte, error) {
+	n := len(p.ConnectionHandles)
+	buf := make([]byte, 18+2*n)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = byte(15 + 2*n)
+	buf[3] = byte(LEMetaSubeventCodeBIGSyncEstablished)
+	buf[4] = p.Status
+	buf[5] = p.BIGHandle
+	putUint24(buf[6:], p.TransportLatency)
+	buf[9] = p.NSE
+	buf[10] = p.BN
+	buf[11] = p.PTO
+	buf[12] = p.IRC
+	binary.LittleEndian.PutUint16(buf[13:], p.MaxPDU)
+	binary.LittleEndian.PutUint16(buf[15:], p.ISOInterval)
+	buf[17] = byte(n)
+	for i, h := range p.ConnectionHandles {
+		binary.LittleEndian.PutUint16(buf[18+2*i:], h)
+	}
+	return buf, nil
+}
+
+func (p *LEBIGSyncEstablishedEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != byte(LEMetaSubeventCodeBIGSyncEstablished) {
+		return errors.New("incorrect subevent")
+	}
+	if len(buf) < 6 {
+		return io.ErrShortBuffer
+	}
+	p.Status = buf[4]
+	p.BIGHandle = buf[5]
+	if p.Status != 0 {
+		// the remaining parameters are only valid on success.
+		return nil
+	}
+	if len(buf) < 18 || len(buf) != 18+2*int(buf[17]) {
+		return io.ErrShortBuffer
+	}
+	p.TransportLatency = uint24(buf[6:])
+	p.NSE = buf[9]
+	p.BN = buf[10]
+	p.PTO = buf[11]
+	p.IRC = buf[12]
+	p.MaxPDU = binary.LittleEndian.Uint16(buf[13:])
+	p.ISOInterval = binary.LittleEndian.Uint16(buf[15:])
+	p.ConnectionHandles = make([]uint16, buf[17])
+	for i := range p.ConnectionHandles {
+		p.ConnectionHandles[i] = binary.LittleEndian.Uint16(buf[18+2*i:])
+	}
+	return nil
+}
+
+type LEBIGSyncLostEventPacket struct {
+	BIGHandle uint8
+	Reason    DisconnectReason
+}
+
+func (p *LEBIGSyncLostEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 6)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 3
+	buf[3] = byte(LEMetaSubeventCodeBIGSyncLost)
+	buf[4] = p.BIGHandle
+	buf[5] = byte(p.Reason)
+	return buf, nil
+}
+
+func (p *LEBIGSyncLostEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 3 || len(buf) != 6 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeBIGSyncLost) {
+		return errors.New("incorrect subevent")
+	}
+	p.BIGHandle = buf[4]
+	p.Reason = DisconnectReason(buf[5])
+	return nil
+}
+
+type LEBIGInfoAdvertisingReportEventPacket struct {
+	SyncHandle uint16
+	NumBIS     uint8
+	NSE        uint8
+	// ISOInterval is in units of 1.25ms, SDUInterval in microseconds.
+	ISOInterval uint16
+	BN          uint8
+	PTO         uint8
+	IRC         uint8
+	MaxPDU      uint16
+	SDUInterval uint32
+	MaxSDU      uint16
+	PHY         PHY
+	Framing     ISOFraming
+	Encryption  bool
+}
+
+func (p *LEBIGInfoAdvertisingReportEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 23)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 20
+	buf[3] = byte(LEMetaSubeventCodeBIGInfoAdvertisingReport)
+	binary.LittleEndian.PutUint16(buf[4:], p.SyncHandle)
+	buf[6] = p.NumBIS
+	buf[7] = p.NSE
+	binary.LittleEndian.PutUint16(buf[8:], p.ISOInterval)
+	buf[10] = p.BN
+	buf[11] = p.PTO
+	buf[12] = p.IRC
+	binary.LittleEndian.PutUint16(buf[13:], p.MaxPDU)
+	putUint24(buf[15:], p.SDUInterval)
+	binary.LittleEndian.PutUint16(buf[18:], p.MaxSDU)
+	buf[20] = byte(p.PHY)
+	buf[21] = byte(p.Framing)
+	if p.Encryption {
+		buf[22] = 1
+	}
+	return buf, nil
+}
+
+func (p *LEBIGInfoAdvertisingReportEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 20 || len(buf) != 23 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeBIGInfoAdvertisingReport) {
+		return errors.New("incorrect subevent")
+	}
+	p.SyncHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.NumBIS = buf[6]
+	p.NSE = buf[7]
+	p.ISOInterval = binary.LittleEndian.Uint16(buf[8:])
+	p.BN = buf[10]
+	p.PTO = buf[11]
+	p.IRC = buf[12]
+	p.MaxPDU = binary.LittleEndian.Uint16(buf[13:])
+	p.SDUInterval = uint24(buf[15:])
+	p.MaxSDU = binary.LittleEndian.Uint16(buf[18:])
+	p.PHY = PHY(buf[20])
+	p.Framing = ISOFraming(buf[21])
+	p.Encryption = buf[22] == 1
+	return nil
+}
@@ -0,0 +1,652 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.uber.org/zap"
+)
+
+// Connected isochronous groups and streams, Vol 4, Part E, Sections 7.8.97,
+// 7.8.99 to 7.8.102, 7.8.115, 7.7.65.25 and 7.7.65.26.
+
+// LEHostFeatureConnectedIsochronousStreams is the LE feature bit the host
+// sets with LESetHostFeature to use CISes.
+const LEHostFeatureConnectedIsochronousStreams uint8 = 32
+
+type HCILESetHostFeatureCommandPacket struct {
+	BitNumber uint8
+	BitValue  bool
+}
+
+func (p *HCILESetHostFeatureCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 6)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetHostFeature))
+	buf[3] = 2
+	buf[4] = p.BitNumber
+	if p.BitValue {
+		buf[5] = 1
+	}
+	return buf, nil
+}
+
+func (p *HCILESetHostFeatureCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetHostFeature) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 2 || len(buf) != 6 {
+		return io.ErrShortBuffer
+	}
+	p.BitNumber = buf[4]
+	p.BitValue = buf[5] == 1
+	return nil
+}
+
+func (p *HCILESetHostFeatureCommandPacket) Opcode() Opcode {
+	return OpcodeLESetHostFeature
+}
+
+// LESetHostFeature sets or clears a host controlled bit of the LE features
+// the controller advertises to peers. It may not be used while connected.
+func (a *Adapter) LESetHostFeature(bit uint8, value bool) error {
+	buf, err := a.op(&HCILESetHostFeatureCommandPacket{BitNumber: bit, BitValue: value})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+type ISOPacking uint8
+
+const (
+	ISOPackingSequential  ISOPacking = 0x00
+	ISOPackingInterleaved ISOPacking = 0x01
+)
+
+type ISOFraming uint8
+
+const (
+	ISOFramingUnframed ISOFraming = 0x00
+	ISOFramingFramed   ISOFraming = 0x01
+)
+
+// CIGParameters configures a connected isochronous group. C to P fields
+// describe the central to peripheral direction, P to C the reverse.
+type CIGParameters struct {
+	CIGID uint8
+	// SDUIntervalCToP and SDUIntervalPToC are in microseconds.
+	SDUIntervalCToP uint32
+	SDUIntervalPToC uint32
+	WorstCaseSCA    uint8
+	Packing         ISOPacking
+	Framing         ISOFraming
+	// MaxTransportLatencyCToP and MaxTransportLatencyPToC are in
+	// milliseconds.
+	MaxTransportLatencyCToP uint16
+	MaxTransportLatencyPToC uint16
+	CISes                   []CISParameters
+}
+
+type CISParameters struct {
+	CISID      uint8
+	MaxSDUCToP uint16
+	MaxSDUPToC uint16
+	PHYCToP    PHYs
+	PHYPToC    PHYs
+	RTNCToP    uint8
+	RTNPToC    uint8
+}
+
+type HCILESetCIGParametersCommandPacket struct {
+	CIGParameters
+}
+
+func (p *HCILESetCIGParametersCommandPacket) Marshal() ([]byte, error) {
+	n := len(p.CISes)
+	if n == 0 || n > 0x1F {
+		return nil, errors.New("invalid number of cises")
+	}
+	buf := make([]byte, 19+9*n)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetCIGParameters))
+	buf[3] = byte(15 + 9*n)
+	buf[4] = p.CIGID
+	putUint24(buf[5:], p.SDUIntervalCToP)
+	putUint24(buf[8:], p.SDUIntervalPToC)
+	buf[11] = p.WorstCaseSCA
+	buf[12] = byte(p.Packing)
+	buf[13] = byte(p.Framing)
+	binary.LittleEndian.PutUint16(buf[14:], p.MaxTransportLatencyCToP)
+	binary.LittleEndian.PutUint16(buf[16:], p.MaxTransportLatencyPToC)
+	buf[18] = byte(n)
+	for i, c := range p.CISes {
+		b := buf[19+9*i:]
+		b[0] = c.CISID
+		binary.LittleEndian.PutUint16(b[1:], c.MaxSDUCToP)
+		binary.LittleEndian.PutUint16(b[3:], c.MaxSDUPToC)
+		b[5] = byte(c.PHYCToP)
+		b[6] = byte(c.PHYPToC)
+		b[7] = c.RTNCToP
+		b[8] = c.RTNPToC
+	}
+	return buf, nil
+}
+
+func (p *HCILESetCIGParametersCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetCIGParameters) {
+		return errors.New("incorrect packet")
+	}
+	if len(buf) < 19 || len(buf) != int(buf[3])+4 || len(buf) != 19+9*int(buf[18]) {
+		return io.ErrShortBuffer
+	}
+	p.CIGID = buf[4]
+	p.SDUIntervalCToP = uint24(buf[5:])
+	p.SDUIntervalPToC = uint24(buf[8:])
+	p.WorstCaseSCA = buf[11]
+	p.Packing = ISOPacking(buf[12])
+	p.Framing = ISOFraming(buf[13])
+	p.MaxTransportLatencyCToP = binary.LittleEndian.Uint16(buf[14:])
+	p.MaxTransportLatencyPToC = binary.LittleEndian.Uint16(buf[16:])
+	p.CISes = make([]CISParameters, buf[18])
+	for i := range p.CISes {
+		b := buf[19+9*i:]
+		p.CISes[i] = CISParameters{
+			CISID:      b[0],
+			MaxSDUCToP: binary.LittleEndian.Uint16(b[1:]),
+			MaxSDUPToC: binary.LittleEndian.Uint16(b[3:]),
+			PHYCToP:    PHYs(b[5]),
+			PHYPToC:    PHYs(b[6]),
+			RTNCToP:    b[7],
+			RTNPToC:    b[8],
+		}
+	}
+	return nil
+}
+
+func (p *HCILESetCIGParametersCommandPacket) Opcode() Opcode {
+	return OpcodeLESetCIGParameters
+}
+
+// LESetCIGParameters creates or reconfigures a CIG and returns the
+// connection handles assigned to its CISes, in the order given.
+func (a *Adapter) LESetCIGParameters(params *CIGParameters) ([]uint16, error) {
+	buf, err := a.op(&HCILESetCIGParametersCommandPacket{CIGParameters: *params})
+	if err != nil {
+		return nil, err
+	}
+	if buf[0] != 0 {
+		return nil, errors.New("command failed")
+	}
+	if len(buf) < 3 || len(buf) != 3+2*int(buf[2]) {
+		return nil, io.ErrShortBuffer
+	}
+	handles := make([]uint16, buf[2])
+	for i := range handles {
+		handles[i] = binary.LittleEndian.Uint16(buf[3+2*i:])
+	}
+	return handles, nil
+}
+
+type HCILERemoveCIGCommandPacket struct {
+	CIGID uint8
+}
+
+func (p *HCILERemoveCIGCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 5)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLERemoveCIG))
+	buf[3] = 1
+	buf[4] = p.CIGID
+	return buf, nil
+}
+
+func (p *HCILERemoveCIGCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLERemoveCIG) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 1 || len(buf) != 5 {
+		return io.ErrShortBuffer
+	}
+	p.CIGID = buf[4]
+	return nil
+}
+
+func (p *HCILERemoveCIGCommandPacket) Opcode() Opcode {
+	return OpcodeLERemoveCIG
+}
+
+// LERemoveCIG removes a CIG whose CISes are all disconnected.
+func (a *Adapter) LERemoveCIG(cigID uint8) error {
+	buf, err := a.op(&HCILERemoveCIGCommandPacket{CIGID: cigID})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+// CISConnection pairs a CIS, by the handle LESetCIGParameters assigned it,
+// with the ACL connection to create it on.
+type CISConnection struct {
+	CISConnectionHandle uint16
+	Conn                *Conn
+}
+
+type HCILECreateCISCommandPacket struct {
+	CISConnectionHandles []uint16
+	ACLConnectionHandles []uint16
+}
+
+func (p *HCILECreateCISCommandPacket) Marshal() ([]byte, error) {
+	n := len(p.CISConnectionHandles)
+	if n == 0 || n > 0x1F || len(p.ACLConnectionHandles) != n {
+		return nil, errors.New("invalid number of cises")
+	}
+	buf := make([]byte, 5+4*n)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLECreateCIS))
+	buf[3] = byte(1 + 4*n)
+	buf[4] = byte(n)
+	for i := 0; i < n; i++ {
+		binary.LittleEndian.PutUint16(buf[5+4*i:], p.CISConnectionHandles[i])
+		binary.LittleEndian.PutUint16(buf[7+4*i:], p.ACLConnectionHandles[i])
+	}
+	return buf, nil
+}
+
+func (p *HCILECreateCISCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLECreateCIS) {
+		return errors.New("incorrect packet")
+	}
+	if len(buf) < 5 || len(buf) != int(buf[3])+4 || len(buf) != 5+4*int(buf[4]) {
+		return io.ErrShortBuffer
+	}
+	n := int(buf[4])
+	p.CISConnectionHandles = make([]uint16, n)
+	p.ACLConnectionHandles = make([]uint16, n)
+	for i := 0; i < n; i++ {
+		p.CISConnectionHandles[i] = binary.LittleEndian.Uint16(buf[5+4*i:])
+		p.ACLConnectionHandles[i] = binary.LittleEndian.Uint16(buf[7+4*i:])
+	}
+	return nil
+}
+
+func (p *HCILECreateCISCommandPacket) Opcode() Opcode {
+	return OpcodeLECreateCIS
+}
+
+// CIS is an established connected isochronous stream. Its SDUs are read and
+// written through the embedded ISOStream once a data path is set up.
+type CIS struct {
+	*ISOStream
+
+	// Conn is the ACL connection the CIS was created on.
+	Conn *Conn
+
+	// CIGSyncDelay, CISSyncDelay and the transport latencies are in
+	// microseconds.
+	CIGSyncDelay         uint32
+	CISSyncDelay         uint32
+	TransportLatencyCToP uint32
+	TransportLatencyPToC uint32
+	PHYCToP              PHY
+	PHYPToC              PHY
+	NSE                  uint8
+	BNCToP               uint8
+	BNPToC               uint8
+	FTCToP               uint8
+	FTPToC               uint8
+	MaxPDUCToP           uint16
+	MaxPDUPToC           uint16
+	// ISOInterval is in units of 1.25ms.
+	ISOInterval uint16
+}
+
+func newCIS(p *LECISEstablishedEventPacket, c *Conn) *CIS {
+	return &CIS{
+		ISOStream:            p.established,
+		Conn:                 c,
+		CIGSyncDelay:         p.CIGSyncDelay,
+		CISSyncDelay:         p.CISSyncDelay,
+		TransportLatencyCToP: p.TransportLatencyCToP,
+		TransportLatencyPToC: p.TransportLatencyPToC,
+		PHYCToP:              p.PHYCToP,
+		PHYPToC:              p.PHYPToC,
+		NSE:                  p.NSE,
+		BNCToP:               p.BNCToP,
+		BNPToC:               p.BNPToC,
+		FTCToP:               p.FTCToP,
+		FTPToC:               p.FTPToC,
+		MaxPDUCToP:           p.MaxPDUCToP,
+		MaxPDUPToC:           p.MaxPDUPToC,
+		ISOInterval:          p.ISOInterval,
+	}
+}
+
+// CISError reports a CIS that could not be established.
+type CISError struct {
+	ConnectionHandle uint16
+	Status           uint8
+}
+
+func (e *CISError) Error() string {
+	return fmt.Sprintf("cis 0x%04x not established: status 0x%02x", e.ConnectionHandle, e.Status)
+}
+
+// waitCISEstablished waits for the CIS Established events of handles after
+// issue succeeds and returns the CISes in the same order. Failed CISes are
+// nil and the first failure is returned as a *CISError.
+func (a *Adapter) waitCISEstablished(handles []uint16, conns []*Conn, issue func() error) ([]*CIS, error) {
+	want := make(map[uint16]int, len(handles))
+	for i, h := range handles {
+		want[h] = i
+	}
+	events := make(chan *LECISEstablishedEventPacket, len(handles))
+	errch := make(chan error, 1)
+	cancel := a.subscribe(func(p Packet, err error) {
+		if err != nil {
+			select {
+			case errch <- err:
+			default:
+			}
+			return
+		}
+		if p, ok := p.(*LECISEstablishedEventPacket); ok {
+			if _, ok := want[p.ConnectionHandle]; ok {
+				select {
+				case events <- p:
+				default:
+				}
+			}
+		}
+	})
+	defer cancel()
+
+	if err := issue(); err != nil {
+		return nil, err
+	}
+	cises := make([]*CIS, len(handles))
+	var firstErr error
+	for remaining := len(handles); remaining > 0; remaining-- {
+		select {
+		case p := <-events:
+			i := want[p.ConnectionHandle]
+			if p.Status != 0 {
+				if firstErr == nil {
+					firstErr = &CISError{ConnectionHandle: p.ConnectionHandle, Status: p.Status}
+				}
+				continue
+			}
+			cises[i] = newCIS(p, conns[i])
+		case err := <-errch:
+			return cises, err
+		case <-a.closing:
+			return cises, ErrAdapterClosed
+		}
+	}
+	return cises, firstErr
+}
+
+// CreateCIS creates CISes of a configured CIG on their ACL connections, as
+// central, and blocks until the controller reports each established or
+// failed. The CISes are returned in the order given, failed ones as nil
+// along with a *CISError for the first failure.
+func (a *Adapter) CreateCIS(conns ...CISConnection) ([]*CIS, error) {
+	q := &HCILECreateCISCommandPacket{}
+	acl := make([]*Conn, len(conns))
+	for i, c := range conns {
+		q.CISConnectionHandles = append(q.CISConnectionHandles, c.CISConnectionHandle)
+		q.ACLConnectionHandles = append(q.ACLConnectionHandles, c.Conn.ConnectionHandle)
+		acl[i] = c.Conn
+	}
+	return a.waitCISEstablished(q.CISConnectionHandles, acl, func() error {
+		return a.opStatus(q)
+	})
+}
+
+// Disconnect terminates the CIS and waits for the controller to report that
+// it is gone.
+func (c *CIS) Disconnect(reason DisconnectReason) error {
+	if !reason.valid() {
+		return errors.New("invalid disconnect reason")
+	}
+	if c.isClosed() {
+		return c.closeErr
+	}
+	if err := c.adapter.opStatus(&HCIDisconnectCommandPacket{
+		ConnectionHandle: c.ConnectionHandle,
+		Reason:           reason,
+	}); err != nil {
+		return err
+	}
+	<-c.closed
+	if _, ok := c.closeErr.(*DisconnectError); ok {
+		return nil
+	}
+	return c.closeErr
+}
+
+// Close disconnects with DisconnectReasonRemoteUserTerminatedConnection.
+func (c *CIS) Close() error {
+	return c.Disconnect(DisconnectReasonRemoteUserTerminatedConnection)
+}
+
+// cisRequestQueueLength is the number of CIS requests a connection holds for
+// AcceptCIS. Further requests are rejected.
+const cisRequestQueueLength = 4
+
+// CISRequest is a peer's request to create a CIS on a peripheral connection.
+// It must be accepted or rejected.
+type CISRequest struct {
+	conn                *Conn
+	CISConnectionHandle uint16
+	CIGID               uint8
+	CISID               uint8
+}
+
+// AcceptCIS returns the next CIS the central requests on the connection.
+func (c *Conn) AcceptCIS() (*CISRequest, error) {
+	select {
+	case r := <-c.cisRequests:
+		return r, nil
+	case <-c.closed:
+		return nil, c.closeErr
+	}
+}
+
+// queueCISRequest holds a CIS request for AcceptCIS, rejecting it if too
+// many are pending.
+func (c *Conn) queueCISRequest(p *LECISRequestEventPacket) {
+	r := &CISRequest{
+		conn:                c,
+		CISConnectionHandle: p.CISConnectionHandle,
+		CIGID:               p.CIGID,
+		CISID:               p.CISID,
+	}
+	select {
+	case c.cisRequests <- r:
+	default:
+		go func() {
+			// limited resources.
+			if err := r.Reject(0x0D); err != nil {
+				zap.L().Warn("failed to reject cis request", zap.Error(err))
+			}
+		}()
+	}
+}
+
+type HCILERejectCISRequestCommandPacket struct {
+	ConnectionHandle uint16
+	Reason           uint8
+}
+
+func (p *HCILERejectCISRequestCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 7)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLERejectCISRequest))
+	buf[3] = 3
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	buf[6] = p.Reason
+	return buf, nil
+}
+
+func (p *HCILERejectCISRequestCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLERejectCISRequest) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 3 || len(buf) != 7 {
+		return io.ErrShortBuffer
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.Reason = buf[6]
+	return nil
+}
+
+func (p *HCILERejectCISRequestCommandPacket) Opcode() Opcode {
+	return OpcodeLERejectCISRequest
+}
+
+// Accept accepts the request and blocks until the CIS is established.
+func (r *CISRequest) Accept() (*CIS, error) {
+	cises, err := r.conn.waitCISEstablished([]uint16{r.CISConnectionHandle}, []*Conn{r.conn}, func() error {
+		return r.conn.opStatus(NewHCIConnectionHandleCommandPacket(OpcodeLEAcceptCISRequest, r.CISConnectionHandle))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cises[0], nil
+}
+
+// Reject rejects the request with an HCI error code as reason.
+func (r *CISRequest) Reject(reason uint8) error {
+	buf, err := r.conn.op(&HCILERejectCISRequestCommandPacket{ConnectionHandle: r.CISConnectionHandle, Reason: reason})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+type LECISEstablishedEventPacket struct {
+	Status               uint8
+	ConnectionHandle     uint16
+	CIGSyncDelay         uint32
+	CISSyncDelay         uint32
+	TransportLatencyCToP uint32
+	TransportLatencyPToC uint32
+	PHYCToP              PHY
+	PHYPToC              PHY
+	NSE                  uint8
+	BNCToP               uint8
+	BNPToC               uint8
+	FTCToP               uint8
+	FTPToC               uint8
+	MaxPDUCToP           uint16
+	MaxPDUPToC           uint16
+	ISOInterval          uint16
+
+	// established is the stream registered with the adapter when the CIS
+	// was established.
+	established *ISOStream
+}
+
+func (p *LECISEstablishedEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 32)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 29
+	buf[3] = byte(LEMetaSubeventCodeCISEstablished)
+	buf[4] = p.Status
+	binary.LittleEndian.PutUint16(buf[5:], p.ConnectionHandle)
+	putUint24(buf[7:], p.CIGSyncDelay)
+	putUint24(buf[10:], p.CISSyncDelay)
+	putUint24(buf[13:], p.TransportLatencyCToP)
+	putUint24(buf[16:], p.TransportLatencyPToC)
+	buf[19] = byte(p.PHYCToP)
+	buf[20] = byte(p.PHYPToC)
+	buf[21] = p.NSE
+	buf[22] = p.BNCToP
+	buf[23] = p.BNPToC
+	buf[24] = p.FTCToP
+	buf[25] = p.FTPToC
+	binary.LittleEndian.PutUint16(buf[26:], p.MaxPDUCToP)
+	binary.LittleEndian.PutUint16(buf[28:], p.MaxPDUPToC)
+	binary.LittleEndian.PutUint16(buf[30:], p.ISOInterval)
+	return buf, nil
+}
+
+func (p *LECISEstablishedEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 29 || len(buf) != 32 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeCISEstablished) {
+		return errors.New("incorrect subevent")
+	}
+	p.Status = buf[4]
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[5:])
+	p.CIGSyncDelay = uint24(buf[7:])
+	p.CISSyncDelay = uint24(buf[10:])
+	p.TransportLatencyCToP = uint24(buf[13:])
+	p.TransportLatencyPToC = uint24(buf[16:])
+	p.PHYCToP = PHY(buf[19])
+	p.PHYPToC = PHY(buf[20])
+	p.NSE = buf[21]
+	p.BNCToP = buf[22]
+	p.BNPToC = buf[23]
+	p.FTCToP = buf[24]
+	p.FTPToC = buf[25]
+	p.MaxPDUCToP = binary.LittleEndian.Uint16(buf[26:])
+	p.MaxPDUPToC = binary.LittleEndian.Uint16(buf[28:])
+	p.ISOInterval = binary.LittleEndian.Uint16(buf[30:])
+	return nil
+}
+
+type LECISRequestEventPacket struct {
+	ACLConnectionHandle uint16
+	CISConnectionHandle uint16
+	CIGID               uint8
+	CISID               uint8
+}
+
+func (p *LECISRequestEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 10)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 7
+	buf[3] = byte(LEMetaSubeventCodeCISRequest)
+	binary.LittleEndian.PutUint16(buf[4:], p.ACLConnectionHandle)
+	binary.LittleEndian.PutUint16(buf[6:], p.CISConnectionHandle)
+	buf[8] = p.CIGID
+	buf[9] = p.CISID
+	return buf, nil
+}
+
+func (p *LECISRequestEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 7 || len(buf) != 10 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeCISRequest) {
+		return errors.New("incorrect subevent")
+	}
+	p.ACLConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.CISConnectionHandle = binary.LittleEndian.Uint16(buf[6:])
+	p.CIGID = buf[8]
+	p.CISID = buf[9]
+	return nil
+}
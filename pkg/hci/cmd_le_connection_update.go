@@ -0,0 +1,294 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Connection parameter updates, Vol 4, Part E, Sections 7.8.18, 7.8.31,
+// 7.8.32, 7.7.65.3 and 7.7.65.6.
+
+// ConnectionUpdateRequest is a set of connection parameters proposed by either
+// side of a connection. Intervals are in units of 1.25 ms, the supervision
+// timeout in units of 10 ms and CE lengths in units of 0.625 ms.
+type ConnectionUpdateRequest struct {
+	IntervalMin        uint16
+	IntervalMax        uint16
+	MaxLatency         uint16
+	SupervisionTimeout uint16
+	MinCELength        uint16
+	MaxCELength        uint16
+}
+
+// Valid reports whether the parameters are within the ranges allowed by the
+// specification, including the requirement that the supervision timeout is
+// larger than twice the effective connection interval.
+func (r *ConnectionUpdateRequest) Valid() bool {
+	if r.IntervalMin < 0x0006 || r.IntervalMax > 0x0C80 || r.IntervalMin > r.IntervalMax {
+		return false
+	}
+	if r.MaxLatency > 0x01F3 {
+		return false
+	}
+	if r.SupervisionTimeout < 0x000A || r.SupervisionTimeout > 0x0C80 {
+		return false
+	}
+	return int(r.SupervisionTimeout)*4 > (1+int(r.MaxLatency))*int(r.IntervalMax)
+}
+
+// ConnectionParameterPolicy decides whether to accept connection parameters
+// requested by the peer.
+type ConnectionParameterPolicy func(c *Conn, r *ConnectionUpdateRequest) bool
+
+// AcceptConnectionParameters reports whether the adapter's policy accepts r.
+// Without a policy, any valid parameters are accepted.
+func (c *Conn) AcceptConnectionParameters(r *ConnectionUpdateRequest) bool {
+	if !r.Valid() {
+		return false
+	}
+	if c.ConnectionParameterPolicy == nil {
+		return true
+	}
+	return c.ConnectionParameterPolicy(c, r)
+}
+
+// HCIConnectionParametersCommandPacket encodes the commands that carry a
+// connection handle followed by a full set of connection parameters.
+type HCIConnectionParametersCommandPacket struct {
+	opcode           Opcode
+	ConnectionHandle uint16
+	ConnectionUpdateRequest
+}
+
+func (p *HCIConnectionParametersCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 18)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(p.opcode))
+	buf[3] = 14
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	binary.LittleEndian.PutUint16(buf[6:], p.IntervalMin)
+	binary.LittleEndian.PutUint16(buf[8:], p.IntervalMax)
+	binary.LittleEndian.PutUint16(buf[10:], p.MaxLatency)
+	binary.LittleEndian.PutUint16(buf[12:], p.SupervisionTimeout)
+	binary.LittleEndian.PutUint16(buf[14:], p.MinCELength)
+	binary.LittleEndian.PutUint16(buf[16:], p.MaxCELength)
+	return buf, nil
+}
+
+func (p *HCIConnectionParametersCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 14 || len(buf) != 18 {
+		return io.ErrShortBuffer
+	}
+	p.opcode = Opcode(binary.LittleEndian.Uint16(buf[1:]))
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.IntervalMin = binary.LittleEndian.Uint16(buf[6:])
+	p.IntervalMax = binary.LittleEndian.Uint16(buf[8:])
+	p.MaxLatency = binary.LittleEndian.Uint16(buf[10:])
+	p.SupervisionTimeout = binary.LittleEndian.Uint16(buf[12:])
+	p.MinCELength = binary.LittleEndian.Uint16(buf[14:])
+	p.MaxCELength = binary.LittleEndian.Uint16(buf[16:])
+	return nil
+}
+
+func (p *HCIConnectionParametersCommandPacket) Opcode() Opcode {
+	return p.opcode
+}
+
+// Parameters returns the connection interval, peripheral latency and
+// supervision timeout as last reported by the controller.
+func (c *Conn) Parameters() (interval, latency, timeout uint16) {
+	c.linkLock.Lock()
+	defer c.linkLock.Unlock()
+	return c.interval, c.latency, c.timeout
+}
+
+// UpdateConnection changes the connection parameters. It may only be called
+// by the central; a peripheral should request an update through L2CAP
+// instead. It blocks until the controller reports the new parameters.
+func (c *Conn) UpdateConnection(r *ConnectionUpdateRequest) error {
+	if !r.Valid() {
+		return errors.New("invalid connection parameters")
+	}
+	done := make(chan *LEConnectionUpdateCompleteEventPacket, 1)
+	errch := make(chan error, 1)
+	cancel := c.subscribe(func(p Packet, err error) {
+		if err != nil {
+			select {
+			case errch <- err:
+			default:
+			}
+			return
+		}
+		if p, ok := p.(*LEConnectionUpdateCompleteEventPacket); ok && p.ConnectionHandle == c.ConnectionHandle {
+			select {
+			case done <- p:
+			default:
+			}
+		}
+	})
+	defer cancel()
+
+	if err := c.opStatus(&HCIConnectionParametersCommandPacket{
+		opcode:                  OpcodeLEConnectionUpdate,
+		ConnectionHandle:        c.ConnectionHandle,
+		ConnectionUpdateRequest: *r,
+	}); err != nil {
+		return err
+	}
+	select {
+	case p := <-done:
+		if p.Status != 0 {
+			return errors.New("connection update failed")
+		}
+		return nil
+	case err := <-errch:
+		return err
+	case <-c.closed:
+		return c.closeErr
+	}
+}
+
+type HCILERemoteConnectionParameterRequestNegativeReplyCommandPacket struct {
+	ConnectionHandle uint16
+	Reason           uint8
+}
+
+func (p *HCILERemoteConnectionParameterRequestNegativeReplyCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 7)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLERemoteConnectionParameterRequestNegativeReply))
+	buf[3] = 3
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	buf[6] = p.Reason
+	return buf, nil
+}
+
+func (p *HCILERemoteConnectionParameterRequestNegativeReplyCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLERemoteConnectionParameterRequestNegativeReply) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 3 || len(buf) != 7 {
+		return io.ErrShortBuffer
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.Reason = buf[6]
+	return nil
+}
+
+func (p *HCILERemoteConnectionParameterRequestNegativeReplyCommandPacket) Opcode() Opcode {
+	return OpcodeLERemoteConnectionParameterRequestNegativeReply
+}
+
+// replyRemoteConnectionParameterRequest answers a connection parameter request
+// from the peer's link layer according to the connection parameter policy.
+func (c *Conn) replyRemoteConnectionParameterRequest(p *LERemoteConnectionParameterRequestEventPacket) error {
+	r := &ConnectionUpdateRequest{
+		IntervalMin:        p.IntervalMin,
+		IntervalMax:        p.IntervalMax,
+		MaxLatency:         p.MaxLatency,
+		SupervisionTimeout: p.Timeout,
+	}
+	var q CommandPacket = &HCIConnectionParametersCommandPacket{
+		opcode:                  OpcodeLERemoteConnectionParameterRequestReply,
+		ConnectionHandle:        c.ConnectionHandle,
+		ConnectionUpdateRequest: *r,
+	}
+	if !c.AcceptConnectionParameters(r) {
+		q = &HCILERemoteConnectionParameterRequestNegativeReplyCommandPacket{
+			ConnectionHandle: c.ConnectionHandle,
+			Reason:           0x3B, // Unacceptable Connection Parameters
+		}
+	}
+	buf, err := c.op(q)
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+type LEConnectionUpdateCompleteEventPacket struct {
+	Status             uint8
+	ConnectionHandle   uint16
+	ConnectionInterval uint16
+	PeripheralLatency  uint16
+	SupervisionTimeout uint16
+}
+
+func (p *LEConnectionUpdateCompleteEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 13)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 10
+	buf[3] = byte(LEMetaSubeventCodeConnectionUpdate)
+	buf[4] = p.Status
+	binary.LittleEndian.PutUint16(buf[5:], p.ConnectionHandle)
+	binary.LittleEndian.PutUint16(buf[7:], p.ConnectionInterval)
+	binary.LittleEndian.PutUint16(buf[9:], p.PeripheralLatency)
+	binary.LittleEndian.PutUint16(buf[11:], p.SupervisionTimeout)
+	return buf, nil
+}
+
+func (p *LEConnectionUpdateCompleteEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 10 || len(buf) != 13 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeConnectionUpdate) {
+		return errors.New("incorrect subevent")
+	}
+	p.Status = buf[4]
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[5:])
+	p.ConnectionInterval = binary.LittleEndian.Uint16(buf[7:])
+	p.PeripheralLatency = binary.LittleEndian.Uint16(buf[9:])
+	p.SupervisionTimeout = binary.LittleEndian.Uint16(buf[11:])
+	return nil
+}
+
+type LERemoteConnectionParameterRequestEventPacket struct {
+	ConnectionHandle uint16
+	IntervalMin      uint16
+	IntervalMax      uint16
+	MaxLatency       uint16
+	Timeout          uint16
+}
+
+func (p *LERemoteConnectionParameterRequestEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 14)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 11
+	buf[3] = byte(LEMetaSubeventCodeRemoteConnectionParameterRequest)
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	binary.LittleEndian.PutUint16(buf[6:], p.IntervalMin)
+	binary.LittleEndian.PutUint16(buf[8:], p.IntervalMax)
+	binary.LittleEndian.PutUint16(buf[10:], p.MaxLatency)
+	binary.LittleEndian.PutUint16(buf[12:], p.Timeout)
+	return buf, nil
+}
+
+func (p *LERemoteConnectionParameterRequestEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 11 || len(buf) != 14 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeRemoteConnectionParameterRequest) {
+		return errors.New("incorrect subevent")
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.IntervalMin = binary.LittleEndian.Uint16(buf[6:])
+	p.IntervalMax = binary.LittleEndian.Uint16(buf[8:])
+	p.MaxLatency = binary.LittleEndian.Uint16(buf[10:])
+	p.Timeout = binary.LittleEndian.Uint16(buf[12:])
+	return nil
+}
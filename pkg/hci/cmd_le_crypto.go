@@ -0,0 +1,291 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Controller security primitives, Vol 4, Part E, Sections 7.8.22, 7.8.23,
+// 7.8.36, 7.8.37, 7.8.126, 7.7.65.8 and 7.7.65.9.
+
+// DHKeyType selects the private key LE Generate DHKey [v2] uses.
+type DHKeyType uint8
+
+const (
+	DHKeyTypeGenerated DHKeyType = 0x00
+	DHKeyTypeDebug     DHKeyType = 0x01
+)
+
+type HCILEEncryptCommandPacket struct {
+	Key       [16]byte
+	Plaintext [16]byte
+}
+
+func (p *HCILEEncryptCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 36)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLEEncrypt))
+	buf[3] = 32
+	copy(buf[4:], p.Key[:])
+	copy(buf[20:], p.Plaintext[:])
+	return buf, nil
+}
+
+func (p *HCILEEncryptCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLEEncrypt) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 32 || len(buf) != 36 {
+		return io.ErrShortBuffer
+	}
+	copy(p.Key[:], buf[4:])
+	copy(p.Plaintext[:], buf[20:])
+	return nil
+}
+
+func (p *HCILEEncryptCommandPacket) Opcode() Opcode {
+	return OpcodeLEEncrypt
+}
+
+// LEEncrypt encrypts plaintext with key using AES-128 on the controller. The
+// key, plaintext and result are in little endian order.
+func (a *Adapter) LEEncrypt(key, plaintext [16]byte) ([16]byte, error) {
+	var data [16]byte
+	buf, err := a.op(&HCILEEncryptCommandPacket{Key: key, Plaintext: plaintext})
+	if err != nil {
+		return data, err
+	}
+	if buf[0] != 0 {
+		return data, errors.New("command failed")
+	}
+	if len(buf) < 17 {
+		return data, io.ErrShortBuffer
+	}
+	copy(data[:], buf[1:17])
+	return data, nil
+}
+
+// LERand returns a random number generated by the controller.
+func (a *Adapter) LERand() (uint64, error) {
+	buf, err := a.op(NewGenericCommandPacket(OpcodeLERand))
+	if err != nil {
+		return 0, err
+	}
+	if buf[0] != 0 {
+		return 0, errors.New("command failed")
+	}
+	if len(buf) < 9 {
+		return 0, io.ErrShortBuffer
+	}
+	return binary.LittleEndian.Uint64(buf[1:9]), nil
+}
+
+// LEReadLocalP256PublicKey makes the controller generate a new P-256 key
+// pair and returns its public key. The private key is used by subsequent
+// DHKey generation.
+func (a *Adapter) LEReadLocalP256PublicKey() (P256PublicKey, error) {
+	a.p256Lock.Lock()
+	defer a.p256Lock.Unlock()
+	done := make(chan *LEReadLocalP256PublicKeyCompleteEventPacket, 1)
+	errch := make(chan error, 1)
+	cancel := a.subscribe(func(p Packet, err error) {
+		if err != nil {
+			select {
+			case errch <- err:
+			default:
+			}
+			return
+		}
+		if p, ok := p.(*LEReadLocalP256PublicKeyCompleteEventPacket); ok {
+			select {
+			case done <- p:
+			default:
+			}
+		}
+	})
+	defer cancel()
+
+	if err := a.opStatus(NewGenericCommandPacket(OpcodeLEReadLocalP256PublicKey)); err != nil {
+		return P256PublicKey{}, err
+	}
+	select {
+	case p := <-done:
+		if p.Status != 0 {
+			return P256PublicKey{}, errors.New("p-256 public key generation failed")
+		}
+		return p.PublicKey, nil
+	case err := <-errch:
+		return P256PublicKey{}, err
+	}
+}
+
+type HCILEGenerateDHKeyCommandPacket struct {
+	RemotePublicKey P256PublicKey
+}
+
+func (p *HCILEGenerateDHKeyCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 68)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLEGenerateDHKey))
+	buf[3] = 64
+	copy(buf[4:], p.RemotePublicKey[:])
+	return buf, nil
+}
+
+func (p *HCILEGenerateDHKeyCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLEGenerateDHKey) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 64 || len(buf) != 68 {
+		return io.ErrShortBuffer
+	}
+	copy(p.RemotePublicKey[:], buf[4:])
+	return nil
+}
+
+func (p *HCILEGenerateDHKeyCommandPacket) Opcode() Opcode {
+	return OpcodeLEGenerateDHKey
+}
+
+type HCILEGenerateDHKeyV2CommandPacket struct {
+	RemotePublicKey P256PublicKey
+	KeyType         DHKeyType
+}
+
+func (p *HCILEGenerateDHKeyV2CommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 69)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLEGenerateDHKeyV2))
+	buf[3] = 65
+	copy(buf[4:], p.RemotePublicKey[:])
+	buf[68] = byte(p.KeyType)
+	return buf, nil
+}
+
+func (p *HCILEGenerateDHKeyV2CommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLEGenerateDHKeyV2) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 65 || len(buf) != 69 {
+		return io.ErrShortBuffer
+	}
+	copy(p.RemotePublicKey[:], buf[4:68])
+	p.KeyType = DHKeyType(buf[68])
+	return nil
+}
+
+func (p *HCILEGenerateDHKeyV2CommandPacket) Opcode() Opcode {
+	return OpcodeLEGenerateDHKeyV2
+}
+
+// LEGenerateDHKey computes the Diffie-Hellman key of the remote public key
+// and the private key of the last LEReadLocalP256PublicKey.
+func (a *Adapter) LEGenerateDHKey(remote P256PublicKey) (DHKey, error) {
+	return a.generateDHKey(&HCILEGenerateDHKeyCommandPacket{RemotePublicKey: remote})
+}
+
+// LEGenerateDHKeyV2 is LEGenerateDHKey, optionally using the debug private
+// key of Vol 3, Part H, Section 2.3.5.6.1 instead of the generated one.
+func (a *Adapter) LEGenerateDHKeyV2(remote P256PublicKey, keyType DHKeyType) (DHKey, error) {
+	return a.generateDHKey(&HCILEGenerateDHKeyV2CommandPacket{RemotePublicKey: remote, KeyType: keyType})
+}
+
+func (a *Adapter) generateDHKey(q CommandPacket) (DHKey, error) {
+	a.p256Lock.Lock()
+	defer a.p256Lock.Unlock()
+	done := make(chan *LEGenerateDHKeyCompleteEventPacket, 1)
+	errch := make(chan error, 1)
+	cancel := a.subscribe(func(p Packet, err error) {
+		if err != nil {
+			select {
+			case errch <- err:
+			default:
+			}
+			return
+		}
+		if p, ok := p.(*LEGenerateDHKeyCompleteEventPacket); ok {
+			select {
+			case done <- p:
+			default:
+			}
+		}
+	})
+	defer cancel()
+
+	if err := a.opStatus(q); err != nil {
+		return DHKey{}, err
+	}
+	select {
+	case p := <-done:
+		if p.Status != 0 {
+			// the remote public key is not a point on the curve.
+			return DHKey{}, errors.New("dhkey generation failed")
+		}
+		return p.DHKey, nil
+	case err := <-errch:
+		return DHKey{}, err
+	}
+}
+
+type LEReadLocalP256PublicKeyCompleteEventPacket struct {
+	Status    uint8
+	PublicKey P256PublicKey
+}
+
+func (p *LEReadLocalP256PublicKeyCompleteEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 69)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 66
+	buf[3] = byte(LEMetaSubeventCodeReadLocalP256PublicKeyComplete)
+	buf[4] = p.Status
+	copy(buf[5:], p.PublicKey[:])
+	return buf, nil
+}
+
+func (p *LEReadLocalP256PublicKeyCompleteEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 66 || len(buf) != 69 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeReadLocalP256PublicKeyComplete) {
+		return errors.New("incorrect subevent")
+	}
+	p.Status = buf[4]
+	copy(p.PublicKey[:], buf[5:])
+	return nil
+}
+
+type LEGenerateDHKeyCompleteEventPacket struct {
+	Status uint8
+	DHKey  DHKey
+}
+
+func (p *LEGenerateDHKeyCompleteEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 37)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 34
+	buf[3] = byte(LEMetaSubeventCodeGenerateDHKeyComplete)
+	buf[4] = p.Status
+	copy(buf[5:], p.DHKey[:])
+	return buf, nil
+}
+
+func (p *LEGenerateDHKeyCompleteEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 34 || len(buf) != 37 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeGenerateDHKeyComplete) {
+		return errors.New("incorrect subevent")
+	}
+	p.Status = buf[4]
+	copy(p.DHKey[:], buf[5:])
+	return nil
+}
@@ -0,0 +1,238 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Data Length Extension, Vol 4, Part E, Sections 7.8.33 to 7.8.35, 7.8.46 and
+// 7.7.65.7.
+
+const (
+	// DefaultMaxOctets and DefaultMaxTime are the link layer payload size and
+	// transmission time in microseconds before any data length update.
+	DefaultMaxOctets = 27
+	DefaultMaxTime   = 328
+)
+
+type HCILESetDataLengthCommandPacket struct {
+	ConnectionHandle uint16
+	TxOctets         uint16
+	TxTime           uint16
+}
+
+func (p *HCILESetDataLengthCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 10)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetDataLength))
+	buf[3] = 6
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	binary.LittleEndian.PutUint16(buf[6:], p.TxOctets)
+	binary.LittleEndian.PutUint16(buf[8:], p.TxTime)
+	return buf, nil
+}
+
+func (p *HCILESetDataLengthCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetDataLength) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 6 || len(buf) != 10 {
+		return io.ErrShortBuffer
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.TxOctets = binary.LittleEndian.Uint16(buf[6:])
+	p.TxTime = binary.LittleEndian.Uint16(buf[8:])
+	return nil
+}
+
+func (p *HCILESetDataLengthCommandPacket) Opcode() Opcode {
+	return OpcodeLESetDataLength
+}
+
+// DataLength holds the negotiated link layer payload sizes and transmission
+// times of a connection.
+type DataLength struct {
+	MaxTxOctets uint16
+	MaxTxTime   uint16
+	MaxRxOctets uint16
+	MaxRxTime   uint16
+}
+
+// DataLength returns the data length of the connection as last reported by
+// the controller.
+func (c *Conn) DataLength() DataLength {
+	c.linkLock.Lock()
+	defer c.linkLock.Unlock()
+	return c.dataLength
+}
+
+// SetDataLength suggests the maximum link layer payload size and transmission
+// time for the connection. The negotiated values are reported asynchronously
+// and reflected in DataLength.
+func (c *Conn) SetDataLength(txOctets, txTime uint16) error {
+	if txOctets < 0x001B || txOctets > 0x00FB {
+		return errors.New("invalid tx octets")
+	}
+	if txTime < 0x0148 || txTime > 0x4290 {
+		return errors.New("invalid tx time")
+	}
+	buf, err := c.op(&HCILESetDataLengthCommandPacket{
+		ConnectionHandle: c.ConnectionHandle,
+		TxOctets:         txOctets,
+		TxTime:           txTime,
+	})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+type LEReadSuggestedDefaultDataLengthResponse struct {
+	SuggestedMaxTxOctets uint16
+	SuggestedMaxTxTime   uint16
+}
+
+func (a *Adapter) LEReadSuggestedDefaultDataLength() (*LEReadSuggestedDefaultDataLengthResponse, error) {
+	buf, err := a.op(NewGenericCommandPacket(OpcodeLEReadSuggestedDefaultDataLength))
+	if err != nil {
+		return nil, err
+	}
+	if buf[0] != 0 {
+		return nil, errors.New("command failed")
+	}
+	if len(buf) < 5 {
+		return nil, io.ErrShortBuffer
+	}
+	return &LEReadSuggestedDefaultDataLengthResponse{
+		SuggestedMaxTxOctets: binary.LittleEndian.Uint16(buf[1:3]),
+		SuggestedMaxTxTime:   binary.LittleEndian.Uint16(buf[3:5]),
+	}, nil
+}
+
+type HCILEWriteSuggestedDefaultDataLengthCommandPacket struct {
+	SuggestedMaxTxOctets uint16
+	SuggestedMaxTxTime   uint16
+}
+
+func (p *HCILEWriteSuggestedDefaultDataLengthCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 8)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLEWriteSuggestedDefaultDataLength))
+	buf[3] = 4
+	binary.LittleEndian.PutUint16(buf[4:], p.SuggestedMaxTxOctets)
+	binary.LittleEndian.PutUint16(buf[6:], p.SuggestedMaxTxTime)
+	return buf, nil
+}
+
+func (p *HCILEWriteSuggestedDefaultDataLengthCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLEWriteSuggestedDefaultDataLength) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 4 || len(buf) != 8 {
+		return io.ErrShortBuffer
+	}
+	p.SuggestedMaxTxOctets = binary.LittleEndian.Uint16(buf[4:])
+	p.SuggestedMaxTxTime = binary.LittleEndian.Uint16(buf[6:])
+	return nil
+}
+
+func (p *HCILEWriteSuggestedDefaultDataLengthCommandPacket) Opcode() Opcode {
+	return OpcodeLEWriteSuggestedDefaultDataLength
+}
+
+// LEWriteSuggestedDefaultDataLength sets the data length the controller
+// requests on new connections.
+func (a *Adapter) LEWriteSuggestedDefaultDataLength(txOctets, txTime uint16) error {
+	buf, err := a.op(&HCILEWriteSuggestedDefaultDataLengthCommandPacket{
+		SuggestedMaxTxOctets: txOctets,
+		SuggestedMaxTxTime:   txTime,
+	})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+type LEReadMaximumDataLengthResponse struct {
+	SupportedMaxTxOctets uint16
+	SupportedMaxTxTime   uint16
+	SupportedMaxRxOctets uint16
+	SupportedMaxRxTime   uint16
+}
+
+func (a *Adapter) LEReadMaximumDataLength() (*LEReadMaximumDataLengthResponse, error) {
+	buf, err := a.op(NewGenericCommandPacket(OpcodeLEReadMaximumDataLength))
+	if err != nil {
+		return nil, err
+	}
+	if buf[0] != 0 {
+		return nil, errors.New("command failed")
+	}
+	if len(buf) < 9 {
+		return nil, io.ErrShortBuffer
+	}
+	return &LEReadMaximumDataLengthResponse{
+		SupportedMaxTxOctets: binary.LittleEndian.Uint16(buf[1:3]),
+		SupportedMaxTxTime:   binary.LittleEndian.Uint16(buf[3:5]),
+		SupportedMaxRxOctets: binary.LittleEndian.Uint16(buf[5:7]),
+		SupportedMaxRxTime:   binary.LittleEndian.Uint16(buf[7:9]),
+	}, nil
+}
+
+type LEDataLengthChangeEventPacket struct {
+	ConnectionHandle uint16
+	MaxTxOctets      uint16
+	MaxTxTime        uint16
+	MaxRxOctets      uint16
+	MaxRxTime        uint16
+}
+
+func (p *LEDataLengthChangeEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 14)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 11
+	buf[3] = byte(LEMetaSubeventCodeDataLengthChange)
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	binary.LittleEndian.PutUint16(buf[6:], p.MaxTxOctets)
+	binary.LittleEndian.PutUint16(buf[8:], p.MaxTxTime)
+	binary.LittleEndian.PutUint16(buf[10:], p.MaxRxOctets)
+	binary.LittleEndian.PutUint16(buf[12:], p.MaxRxTime)
+	return buf, nil
+}
+
+func (p *LEDataLengthChangeEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 11 || len(buf) != 14 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeDataLengthChange) {
+		return errors.New("incorrect subevent")
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.MaxTxOctets = binary.LittleEndian.Uint16(buf[6:])
+	p.MaxTxTime = binary.LittleEndian.Uint16(buf[8:])
+	p.MaxRxOctets = binary.LittleEndian.Uint16(buf[10:])
+	p.MaxRxTime = binary.LittleEndian.Uint16(buf[12:])
+	return nil
+}
+
+// fragmentSize returns the ACL payload size used when segmenting writes,
+// rounded down to a multiple of the negotiated link layer payload size so
+// the controller does not have to send short PDUs mid-SDU.
+func (c *Conn) fragmentSize() int {
+	n := int(c.ACLMTU)
+	if o := int(c.DataLength().MaxTxOctets); o > 0 && n > o {
+		n -= n % o
+	}
+	return n
+}
@@ -0,0 +1,332 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"go.uber.org/zap"
+)
+
+// LE encryption, Vol 4, Part E, Sections 7.4.12, 7.8.24, 7.8.25, 7.8.26,
+// 7.7.8, 7.7.39 and 7.7.65.5.
+
+// LongTermKey is the key a link is encrypted with, in the little endian
+// order used by HCI.
+type LongTermKey [16]byte
+
+// LongTermKeyLookup returns the long term key identified by the random number
+// and encrypted diversifier the central sent, or false if there is none. Keys
+// generated with LE Secure Connections are requested with both set to zero.
+type LongTermKeyLookup func(c *Conn, rand uint64, ediv uint16) (LongTermKey, bool)
+
+type HCILEEnableEncryptionCommandPacket struct {
+	ConnectionHandle     uint16
+	RandomNumber         uint64
+	EncryptedDiversifier uint16
+	LongTermKey          LongTermKey
+}
+
+func (p *HCILEEnableEncryptionCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 32)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLEEnableEncryption))
+	buf[3] = 28
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	binary.LittleEndian.PutUint64(buf[6:], p.RandomNumber)
+	binary.LittleEndian.PutUint16(buf[14:], p.EncryptedDiversifier)
+	copy(buf[16:], p.LongTermKey[:])
+	return buf, nil
+}
+
+func (p *HCILEEnableEncryptionCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLEEnableEncryption) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 28 || len(buf) != 32 {
+		return io.ErrShortBuffer
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.RandomNumber = binary.LittleEndian.Uint64(buf[6:])
+	p.EncryptedDiversifier = binary.LittleEndian.Uint16(buf[14:])
+	copy(p.LongTermKey[:], buf[16:])
+	return nil
+}
+
+func (p *HCILEEnableEncryptionCommandPacket) Opcode() Opcode {
+	return OpcodeLEEnableEncryption
+}
+
+type HCILELongTermKeyRequestReplyCommandPacket struct {
+	ConnectionHandle uint16
+	LongTermKey      LongTermKey
+}
+
+func (p *HCILELongTermKeyRequestReplyCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 22)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLELongTermKeyRequestReply))
+	buf[3] = 18
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	copy(buf[6:], p.LongTermKey[:])
+	return buf, nil
+}
+
+func (p *HCILELongTermKeyRequestReplyCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLELongTermKeyRequestReply) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 18 || len(buf) != 22 {
+		return io.ErrShortBuffer
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	copy(p.LongTermKey[:], buf[6:])
+	return nil
+}
+
+func (p *HCILELongTermKeyRequestReplyCommandPacket) Opcode() Opcode {
+	return OpcodeLELongTermKeyRequestReply
+}
+
+// StartEncryption encrypts the link with ltk, or refreshes the key of a link
+// that is already encrypted. It may only be called by the central and blocks
+// until the controller reports the outcome.
+func (c *Conn) StartEncryption(rand uint64, ediv uint16, ltk LongTermKey) error {
+	if c.Role != RoleCentral {
+		return errors.New("only the central may start encryption")
+	}
+	done := make(chan uint8, 1)
+	cancel := c.subscribe(func(p Packet, err error) {
+		var status uint8
+		switch p := p.(type) {
+		case *EncryptionChangeEventPacket:
+			if p.ConnectionHandle != c.ConnectionHandle {
+				return
+			}
+			status = p.Status
+		case *EncryptionKeyRefreshCompleteEventPacket:
+			if p.ConnectionHandle != c.ConnectionHandle {
+				return
+			}
+			status = p.Status
+		default:
+			return
+		}
+		select {
+		case done <- status:
+		default:
+		}
+	})
+	defer cancel()
+
+	if err := c.opStatus(&HCILEEnableEncryptionCommandPacket{
+		ConnectionHandle:     c.ConnectionHandle,
+		RandomNumber:         rand,
+		EncryptedDiversifier: ediv,
+		LongTermKey:          ltk,
+	}); err != nil {
+		return err
+	}
+	select {
+	case status := <-done:
+		if status != 0 {
+			return errors.New("encryption failed")
+		}
+		return nil
+	case <-c.closed:
+		return c.closeErr
+	}
+}
+
+// replyLongTermKeyRequest answers the controller's request for the key the
+// central is starting encryption with, using the adapter's key lookup.
+func (c *Conn) replyLongTermKeyRequest(p *LELongTermKeyRequestEventPacket) error {
+	var q CommandPacket = NewHCIConnectionHandleCommandPacket(OpcodeLELongTermKeyRequestNegativeReply, c.ConnectionHandle)
+	if c.LongTermKeyLookup != nil {
+		if ltk, ok := c.LongTermKeyLookup(c, p.RandomNumber, p.EncryptedDiversifier); ok {
+			q = &HCILELongTermKeyRequestReplyCommandPacket{ConnectionHandle: c.ConnectionHandle, LongTermKey: ltk}
+		}
+	}
+	buf, err := c.op(q)
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+// ReadEncryptionKeySize reads the size in octets of the key the link is
+// encrypted with.
+func (c *Conn) ReadEncryptionKeySize() (uint8, error) {
+	buf, err := c.op(NewHCIConnectionHandleCommandPacket(OpcodeReadEncryptionKeySize, c.ConnectionHandle))
+	if err != nil {
+		return 0, err
+	}
+	if buf[0] != 0 {
+		return 0, errors.New("command failed")
+	}
+	if len(buf) < 4 {
+		return 0, io.ErrShortBuffer
+	}
+	return buf[3], nil
+}
+
+// Encryption returns whether the link is encrypted and the size of its key
+// in octets. The key size is zero while it is not known.
+func (c *Conn) Encryption() (bool, uint8) {
+	c.encryptionLock.Lock()
+	defer c.encryptionLock.Unlock()
+	return c.encrypted, c.encryptionKeySize
+}
+
+// OnEncryptionChange invokes cb whenever encryption of the link is enabled or
+// disabled, once the key size is known.
+func (c *Conn) OnEncryptionChange(cb func(encrypted bool, keySize uint8)) {
+	c.encryptionLock.Lock()
+	c.onEncryptionChange = cb
+	c.encryptionLock.Unlock()
+}
+
+// encryptionChanged completes an encryption change applied by handle. The
+// key size of an encrypted link reported without it is read from the
+// controller before the callback is invoked.
+func (c *Conn) encryptionChanged() {
+	encrypted, keySize := c.Encryption()
+	if encrypted && keySize == 0 {
+		n, err := c.ReadEncryptionKeySize()
+		if err != nil {
+			zap.L().Warn("failed to read encryption key size", zap.Uint16("handle", c.ConnectionHandle), zap.Error(err))
+		}
+		c.encryptionLock.Lock()
+		if c.encrypted && c.encryptionKeySize == 0 {
+			c.encryptionKeySize = n
+		}
+		c.encryptionLock.Unlock()
+		encrypted, keySize = c.Encryption()
+	}
+	c.encryptionLock.Lock()
+	cb := c.onEncryptionChange
+	c.encryptionLock.Unlock()
+	if cb != nil {
+		cb(encrypted, keySize)
+	}
+}
+
+// EncryptionChangeEventPacket is the Encryption Change event. Version 2 of
+// the event also carries the key size, which is zero for version 1.
+type EncryptionChangeEventPacket struct {
+	Status            uint8
+	ConnectionHandle  uint16
+	EncryptionEnabled uint8
+	EncryptionKeySize uint8
+}
+
+// Marshal encodes version 2 of the event if the key size is set.
+func (p *EncryptionChangeEventPacket) Marshal() ([]byte, error) {
+	if p.EncryptionKeySize == 0 {
+		buf := make([]byte, 7)
+		buf[0] = byte(PacketTypeEvent)
+		buf[1] = byte(EventCodeEncryptionChange)
+		buf[2] = 4
+		buf[3] = p.Status
+		binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+		buf[6] = p.EncryptionEnabled
+		return buf, nil
+	}
+	buf := make([]byte, 8)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeEncryptionChangeV2)
+	buf[2] = 5
+	buf[3] = p.Status
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	buf[6] = p.EncryptionEnabled
+	buf[7] = p.EncryptionKeySize
+	return buf, nil
+}
+
+func (p *EncryptionChangeEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) {
+		return errors.New("incorrect packet")
+	}
+	switch EventCode(buf[1]) {
+	case EventCodeEncryptionChange:
+		if buf[2] != 4 || len(buf) != 7 {
+			return io.ErrShortBuffer
+		}
+		p.EncryptionKeySize = 0
+	case EventCodeEncryptionChangeV2:
+		if buf[2] != 5 || len(buf) != 8 {
+			return io.ErrShortBuffer
+		}
+		p.EncryptionKeySize = buf[7]
+	default:
+		return errors.New("incorrect packet")
+	}
+	p.Status = buf[3]
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.EncryptionEnabled = buf[6]
+	return nil
+}
+
+type EncryptionKeyRefreshCompleteEventPacket struct {
+	Status           uint8
+	ConnectionHandle uint16
+}
+
+func (p *EncryptionKeyRefreshCompleteEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 6)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeEncryptionKeyRefreshComplete)
+	buf[2] = 3
+	buf[3] = p.Status
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	return buf, nil
+}
+
+func (p *EncryptionKeyRefreshCompleteEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeEncryptionKeyRefreshComplete) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 3 || len(buf) != 6 {
+		return io.ErrShortBuffer
+	}
+	p.Status = buf[3]
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	return nil
+}
+
+type LELongTermKeyRequestEventPacket struct {
+	ConnectionHandle     uint16
+	RandomNumber         uint64
+	EncryptedDiversifier uint16
+}
+
+func (p *LELongTermKeyRequestEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 16)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 13
+	buf[3] = byte(LEMetaSubeventCodeLongTermKeyRequest)
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	binary.LittleEndian.PutUint64(buf[6:], p.RandomNumber)
+	binary.LittleEndian.PutUint16(buf[14:], p.EncryptedDiversifier)
+	return buf, nil
+}
+
+func (p *LELongTermKeyRequestEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 13 || len(buf) != 16 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeLongTermKeyRequest) {
+		return errors.New("incorrect subevent")
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.RandomNumber = binary.LittleEndian.Uint64(buf[6:])
+	p.EncryptedDiversifier = binary.LittleEndian.Uint16(buf[14:])
+	return nil
+}
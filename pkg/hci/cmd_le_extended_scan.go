@@ -0,0 +1,231 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+type ScanType uint8
+
+const (
+	ScanTypePassive ScanType = 0x00
+	ScanTypeActive  ScanType = 0x01
+)
+
+// ScanningPHYParameters configures scanning on one PHY. ScanInterval and
+// ScanWindow are in units of 0.625ms.
+type ScanningPHYParameters struct {
+	ScanType     ScanType
+	ScanInterval uint16
+	ScanWindow   uint16
+}
+
+// Section 7.8.64
+type HCILESetExtendedScanParametersCommandPacket struct {
+	OwnAddressType       OwnAddressType
+	ScanningFilterPolicy uint8
+	ScanningPHYs         PHYs
+	// Parameters holds the parameters of each PHY in ScanningPHYs, in
+	// ascending order of PHY.
+	Parameters []ScanningPHYParameters
+}
+
+func (p *HCILESetExtendedScanParametersCommandPacket) Marshal() ([]byte, error) {
+	n := len(p.Parameters)
+	buf := make([]byte, 7+5*n)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetExtendedScanParameters))
+	buf[3] = byte(3 + 5*n)
+	buf[4] = byte(p.OwnAddressType)
+	buf[5] = p.ScanningFilterPolicy
+	buf[6] = byte(p.ScanningPHYs)
+	for i, q := range p.Parameters {
+		b := buf[7+5*i:]
+		b[0] = byte(q.ScanType)
+		binary.LittleEndian.PutUint16(b[1:], q.ScanInterval)
+		binary.LittleEndian.PutUint16(b[3:], q.ScanWindow)
+	}
+	return buf, nil
+}
+
+func (p *HCILESetExtendedScanParametersCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetExtendedScanParameters) {
+		return errors.New("incorrect packet")
+	}
+	if len(buf) < 7 || len(buf) != int(buf[3])+4 || (len(buf)-7)%5 != 0 {
+		return io.ErrShortBuffer
+	}
+	p.OwnAddressType = OwnAddressType(buf[4])
+	p.ScanningFilterPolicy = buf[5]
+	p.ScanningPHYs = PHYs(buf[6])
+	p.Parameters = make([]ScanningPHYParameters, (len(buf)-7)/5)
+	for i := range p.Parameters {
+		b := buf[7+5*i:]
+		p.Parameters[i] = ScanningPHYParameters{
+			ScanType:     ScanType(b[0]),
+			ScanInterval: binary.LittleEndian.Uint16(b[1:]),
+			ScanWindow:   binary.LittleEndian.Uint16(b[3:]),
+		}
+	}
+	return nil
+}
+
+func (p *HCILESetExtendedScanParametersCommandPacket) Opcode() Opcode {
+	return OpcodeLESetExtendedScanParameters
+}
+
+type SetExtendedScanParametersRequest struct {
+	OwnAddressType       OwnAddressType
+	ScanningFilterPolicy uint8
+	// ScanningPHYs defaults to LE 1M.
+	ScanningPHYs PHYs
+	Parameters   []ScanningPHYParameters
+}
+
+// LESetExtendedScanParameters configures extended scanning, which reports
+// advertisements with LE Extended Advertising Report events.
+func (a *Adapter) LESetExtendedScanParameters(request *SetExtendedScanParametersRequest) error {
+	scanningPHYs := request.ScanningPHYs
+	if scanningPHYs == 0 {
+		scanningPHYs = PHYsLE1M
+	}
+	n := 0
+	for phys := scanningPHYs; phys != 0; phys &= phys - 1 {
+		n++
+	}
+	if len(request.Parameters) != n {
+		return errors.New("scanning parameters do not match the scanning phys")
+	}
+	buf, err := a.op(&HCILESetExtendedScanParametersCommandPacket{
+		OwnAddressType:       request.OwnAddressType,
+		ScanningFilterPolicy: request.ScanningFilterPolicy,
+		ScanningPHYs:         scanningPHYs,
+		Parameters:           request.Parameters,
+	})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	r := *request
+	r.ScanningPHYs = scanningPHYs
+	r.Parameters = append([]ScanningPHYParameters(nil), request.Parameters...)
+	a.activityLock.Lock()
+	a.scanParameters = &r
+	a.activityLock.Unlock()
+	return nil
+}
+
+// Section 7.8.65
+type HCILESetExtendedScanEnableCommandPacket struct {
+	Enable           bool
+	FilterDuplicates uint8
+	// Duration is in units of 10ms and Period in units of 1.28s. Zero scans
+	// continuously.
+	Duration uint16
+	Period   uint16
+}
+
+func (p *HCILESetExtendedScanEnableCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 10)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetExtendedScanEnable))
+	buf[3] = 6
+	if p.Enable {
+		buf[4] = 1
+	}
+	buf[5] = p.FilterDuplicates
+	binary.LittleEndian.PutUint16(buf[6:], p.Duration)
+	binary.LittleEndian.PutUint16(buf[8:], p.Period)
+	return buf, nil
+}
+
+func (p *HCILESetExtendedScanEnableCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetExtendedScanEnable) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 6 || len(buf) != 10 {
+		return io.ErrShortBuffer
+	}
+	p.Enable = buf[4] == 1
+	p.FilterDuplicates = buf[5]
+	p.Duration = binary.LittleEndian.Uint16(buf[6:])
+	p.Period = binary.LittleEndian.Uint16(buf[8:])
+	return nil
+}
+
+func (p *HCILESetExtendedScanEnableCommandPacket) Opcode() Opcode {
+	return OpcodeLESetExtendedScanEnable
+}
+
+// LESetExtendedScanEnable starts or stops extended scanning, which must have
+// been configured with LESetExtendedScanParameters. duration, in units of
+// 10ms, and period, in units of 1.28s, are zero to scan continuously.
+// Scanning is also needed to synchronize to periodic advertising, see
+// LEPeriodicAdvertisingCreateSync.
+//
+// The adapter pauses scanning while it changes the random address or applies
+// a filter policy, see ApplyFilterPolicy.
+func (a *Adapter) LESetExtendedScanEnable(enable bool, filterDuplicates uint8, duration, period uint16) error {
+	p := &HCILESetExtendedScanEnableCommandPacket{
+		Enable:           enable,
+		FilterDuplicates: filterDuplicates,
+		Duration:         duration,
+		Period:           period,
+	}
+	var scan *HCILESetExtendedScanEnableCommandPacket
+	if enable {
+		scan = p
+	}
+	a.addressLock.Lock()
+	defer a.addressLock.Unlock()
+	a.activityLock.Lock()
+	if a.filterPolicyUpdates > 0 {
+		// deferred until the filter policy is applied.
+		a.scan = scan
+		a.activityLock.Unlock()
+		return nil
+	}
+	a.activityLock.Unlock()
+	if err := a.scanEnable(p); err != nil {
+		return err
+	}
+	a.activityLock.Lock()
+	a.scan = scan
+	a.activityLock.Unlock()
+	return nil
+}
+
+// scanEnable sends p without changing the scanning state it is restored to.
+func (a *Adapter) scanEnable(p *HCILESetExtendedScanEnableCommandPacket) error {
+	buf, err := a.op(p)
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+// Section 7.7.65.17
+type LEScanTimeoutEventPacket struct{}
+
+func (p *LEScanTimeoutEventPacket) Marshal() ([]byte, error) {
+	return []byte{byte(PacketTypeEvent), byte(EventCodeLEMeta), 1, byte(LEMetaSubeventCodeScanTimeout)}, nil
+}
+
+func (p *LEScanTimeoutEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 1 || len(buf) != 4 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeScanTimeout) {
+		return errors.New("incorrect subevent")
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package hci
+
+import "errors"
+
+// FilterAcceptListAddressTypeAnonymous matches advertisements sent without an
+// address. It is only valid in the filter accept list.
+const FilterAcceptListAddressTypeAnonymous PeerAddressType = 0xFF
+
+type FilterAcceptListEntry struct {
+	AddressType PeerAddressType
+	Address     BDAddr
+}
+
+// AddDeviceToFilterAcceptList adds a device to the controller's filter accept
+// list. If the list size has been read with ReadFilterAcceptListSize, adding
+// beyond that capacity fails without contacting the controller.
+func (a *Adapter) AddDeviceToFilterAcceptList(addrType PeerAddressType, addr BDAddr) error {
+	entry := FilterAcceptListEntry{AddressType: addrType, Address: addr}
+
+	a.filterAcceptListLock.Lock()
+	defer a.filterAcceptListLock.Unlock()
+	for _, e := range a.filterAcceptList {
+		if e == entry {
+			return nil
+		}
+	}
+	if a.filterAcceptListSize > 0 && len(a.filterAcceptList) >= int(a.filterAcceptListSize) {
+		return errors.New("filter accept list full")
+	}
+
+	buf, err := a.op(NewHCIPeerAddressCommandPacket(OpcodeAddDeviceToFilterAcceptList, addrType, addr))
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	a.filterAcceptList = append(a.filterAcceptList, entry)
+	return nil
+}
+
+func (a *Adapter) RemoveDeviceFromFilterAcceptList(addrType PeerAddressType, addr BDAddr) error {
+	entry := FilterAcceptListEntry{AddressType: addrType, Address: addr}
+
+	a.filterAcceptListLock.Lock()
+	defer a.filterAcceptListLock.Unlock()
+	buf, err := a.op(NewHCIPeerAddressCommandPacket(OpcodeRemoveDeviceFromFilterAcceptList, addrType, addr))
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	for i, e := range a.filterAcceptList {
+		if e == entry {
+			a.filterAcceptList = append(a.filterAcceptList[:i], a.filterAcceptList[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// FilterAcceptList returns the entries the host has added to the controller's
+// filter accept list since it was last cleared.
+func (a *Adapter) FilterAcceptList() []FilterAcceptListEntry {
+	a.filterAcceptListLock.Lock()
+	defer a.filterAcceptListLock.Unlock()
+	return append([]FilterAcceptListEntry(nil), a.filterAcceptList...)
+}
+
+// ApplyFilterPolicy runs update with advertising and scanning paused, so that
+// it may change the filter accept list and the advertising or scanning filter
+// policy, which the controller disallows while the list is in use. A pending
+// LEExtendedCreateConnectionV2 is waited for, since initiating cannot be
+// paused. Advertising and scanning are restored afterwards, and a failure to
+// restore them is returned if update succeeded.
+//
+// Advertising and scanning enabled or disabled while update runs, by update
+// or otherwise, take effect once it returns. Connections cannot be initiated
+// until then.
+func (a *Adapter) ApplyFilterPolicy(update func() error) (err error) {
+	a.addressLock.Lock()
+	if err := a.pauseLocked(); err != nil {
+		a.addressLock.Unlock()
+		return err
+	}
+	a.activityLock.Lock()
+	a.filterPolicyUpdates++
+	a.activityLock.Unlock()
+	a.addressLock.Unlock()
+
+	defer func() {
+		a.addressLock.Lock()
+		defer a.addressLock.Unlock()
+		a.activityLock.Lock()
+		a.filterPolicyUpdates--
+		a.activityLock.Unlock()
+		if rerr := a.resumeLocked(); err == nil {
+			err = rerr
+		}
+	}()
+	return update()
+}
+
+// applyingFilterPolicy reports whether an ApplyFilterPolicy update is running.
+func (a *Adapter) applyingFilterPolicy() bool {
+	a.activityLock.Lock()
+	defer a.activityLock.Unlock()
+	return a.filterPolicyUpdates > 0
+}
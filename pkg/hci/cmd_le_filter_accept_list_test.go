@@ -0,0 +1,65 @@
+package hci_test
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/muxable/bluetooth/pkg/hci"
+	"github.com/muxable/bluetooth/pkg/hci/hcitest"
+)
+
+func TestApplyFilterPolicy(t *testing.T) {
+	s, c, err := hcitest.NewController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lock sync.Mutex
+	var commands []string
+	c.HandleCommand = func(opcode hci.Opcode, params []byte) []hci.Packet {
+		lock.Lock()
+		defer lock.Unlock()
+		switch opcode {
+		case hci.OpcodeLESetAdvertisingEnable:
+			commands = append(commands, fmt.Sprintf("advertising %d", params[0]))
+		case hci.OpcodeLESetExtendedScanEnable:
+			commands = append(commands, fmt.Sprintf("scanning %d", params[0]))
+		case hci.OpcodeAddDeviceToFilterAcceptList:
+			commands = append(commands, "add")
+		}
+		return nil
+	}
+	a := hci.NewConn(s)
+	defer c.Close()
+	defer a.Close()
+
+	if err := a.LESetAdvertisingEnable(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.LESetExtendedScanEnable(true, 0, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	commands = nil
+	lock.Unlock()
+
+	if err := a.ApplyFilterPolicy(func() error {
+		if err := a.AddDeviceToFilterAcceptList(hci.PeerAddressTypePublicDeviceAddress, hci.BDAddr{1}); err != nil {
+			return err
+		}
+		// deferred until the update returns.
+		if err := a.LESetAdvertisingEnable(false); err != nil {
+			return err
+		}
+		return a.LESetExtendedScanEnable(true, 1, 0, 0)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"advertising 0", "scanning 0", "add", "scanning 1"}
+	lock.Lock()
+	defer lock.Unlock()
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("commands = %q, want %q", commands, want)
+	}
+}
@@ -0,0 +1,143 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ISO data paths, Vol 4, Part E, Sections 7.8.109 and 7.8.110.
+
+type ISODataPathDirection uint8
+
+const (
+	// ISODataPathDirectionInput carries SDUs from the host to the controller.
+	ISODataPathDirectionInput ISODataPathDirection = 0x00
+	// ISODataPathDirectionOutput carries SDUs from the controller to the
+	// host.
+	ISODataPathDirectionOutput ISODataPathDirection = 0x01
+)
+
+// ISODataPathIDHCI routes the data path over HCI. Other values select vendor
+// specific transports.
+const ISODataPathIDHCI uint8 = 0x00
+
+// CodecID is a coding format followed by a company ID and vendor defined
+// codec ID, Vol 4, Part E, Section 7.8.109.
+type CodecID [5]byte
+
+// CodecIDTransparent passes SDUs through the controller unchanged.
+var CodecIDTransparent = CodecID{0x03}
+
+type ISODataPath struct {
+	ConnectionHandle uint16
+	Direction        ISODataPathDirection
+	DataPathID       uint8
+	CodecID          CodecID
+	// ControllerDelay is in microseconds.
+	ControllerDelay    uint32
+	CodecConfiguration []byte
+}
+
+type HCILESetupISODataPathCommandPacket struct {
+	ISODataPath
+}
+
+func (p *HCILESetupISODataPathCommandPacket) Marshal() ([]byte, error) {
+	if len(p.CodecConfiguration) > 0xFF-13 {
+		return nil, errors.New("codec configuration too long")
+	}
+	buf := make([]byte, 17, 17+len(p.CodecConfiguration))
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetupISODataPath))
+	buf[3] = byte(13 + len(p.CodecConfiguration))
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	buf[6] = byte(p.Direction)
+	buf[7] = p.DataPathID
+	copy(buf[8:], p.CodecID[:])
+	putUint24(buf[13:], p.ControllerDelay)
+	buf[16] = byte(len(p.CodecConfiguration))
+	return append(buf, p.CodecConfiguration...), nil
+}
+
+func (p *HCILESetupISODataPathCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetupISODataPath) {
+		return errors.New("incorrect packet")
+	}
+	if len(buf) < 17 || len(buf) != int(buf[3])+4 || int(buf[3]) != 13+int(buf[16]) {
+		return io.ErrShortBuffer
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.Direction = ISODataPathDirection(buf[6])
+	p.DataPathID = buf[7]
+	copy(p.CodecID[:], buf[8:13])
+	p.ControllerDelay = uint24(buf[13:])
+	p.CodecConfiguration = append([]byte(nil), buf[17:]...)
+	return nil
+}
+
+func (p *HCILESetupISODataPathCommandPacket) Opcode() Opcode {
+	return OpcodeLESetupISODataPath
+}
+
+// LESetupISODataPath sets up the data path of an established CIS or BIS in
+// one direction.
+func (a *Adapter) LESetupISODataPath(path *ISODataPath) error {
+	buf, err := a.op(&HCILESetupISODataPathCommandPacket{ISODataPath: *path})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+type HCILERemoveISODataPathCommandPacket struct {
+	ConnectionHandle uint16
+	// Directions is a bit mask of 1 << ISODataPathDirection.
+	Directions uint8
+}
+
+func (p *HCILERemoveISODataPathCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 7)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLERemoveISODataPath))
+	buf[3] = 3
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	buf[6] = p.Directions
+	return buf, nil
+}
+
+func (p *HCILERemoveISODataPathCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLERemoveISODataPath) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 3 || len(buf) != 7 {
+		return io.ErrShortBuffer
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.Directions = buf[6]
+	return nil
+}
+
+func (p *HCILERemoveISODataPathCommandPacket) Opcode() Opcode {
+	return OpcodeLERemoveISODataPath
+}
+
+// LERemoveISODataPath removes the data paths of a CIS or BIS in the given
+// directions.
+func (a *Adapter) LERemoveISODataPath(handle uint16, directions ...ISODataPathDirection) error {
+	var mask uint8
+	for _, d := range directions {
+		mask |= 1 << d
+	}
+	buf, err := a.op(&HCILERemoveISODataPathCommandPacket{ConnectionHandle: handle, Directions: mask})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package hci
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.uber.org/zap"
+)
+
+// Periodic advertising, Vol 4, Part E, Section 7.8.63.
+
+type PeriodicAdvertisingEnable uint8
+
+const (
+	PeriodicAdvertisingEnableEnable PeriodicAdvertisingEnable = (1 << 0)
+	// PeriodicAdvertisingEnableIncludeADI includes the ADI field in
+	// AUX_SYNC_IND PDUs.
+	PeriodicAdvertisingEnableIncludeADI PeriodicAdvertisingEnable = (1 << 1)
+)
+
+type HCILESetPeriodicAdvertisingEnableCommandPacket struct {
+	Enable            PeriodicAdvertisingEnable
+	AdvertisingHandle uint8
+}
+
+func (p *HCILESetPeriodicAdvertisingEnableCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 6)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetPeriodicAdvertisingEnable))
+	buf[3] = 2
+	buf[4] = byte(p.Enable)
+	buf[5] = p.AdvertisingHandle
+	return buf, nil
+}
+
+func (p *HCILESetPeriodicAdvertisingEnableCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetPeriodicAdvertisingEnable) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 2 || len(buf) != 6 {
+		return io.ErrShortBuffer
+	}
+	p.Enable = PeriodicAdvertisingEnable(buf[4])
+	p.AdvertisingHandle = buf[5]
+	return nil
+}
+
+func (p *HCILESetPeriodicAdvertisingEnableCommandPacket) Opcode() Opcode {
+	return OpcodeLESetPeriodicAdvertisingEnable
+}
+
+// LESetPeriodicAdvertisingEnable starts or stops the periodic advertising
+// train of an advertising set, which must have been configured with
+// LESetPeriodicAdvertisingParametersV2. The train is only transmitted once
+// extended advertising is enabled on the set too, see
+// LESetExtendedAdvertisingEnable. A zero enable stops the train.
+func (a *Adapter) LESetPeriodicAdvertisingEnable(handle uint8, enable PeriodicAdvertisingEnable) error {
+	buf, err := a.op(&HCILESetPeriodicAdvertisingEnableCommandPacket{Enable: enable, AdvertisingHandle: handle})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	a.activityLock.Lock()
+	if s, ok := a.advertisingSets[handle]; ok {
+		s.periodic = enable
+	}
+	a.activityLock.Unlock()
+	return nil
+}
+
+// Synchronizing to periodic advertising, Vol 4, Part E, Section 7.8.67.
+
+type PeriodicAdvertisingCreateSyncOptions uint8
+
+const (
+	// PeriodicAdvertisingCreateSyncOptionsUsePeriodicAdvertiserList
+	// synchronizes to any advertiser on the periodic advertiser list instead
+	// of the given one.
+	PeriodicAdvertisingCreateSyncOptionsUsePeriodicAdvertiserList  PeriodicAdvertisingCreateSyncOptions = (1 << 0)
+	PeriodicAdvertisingCreateSyncOptionsReportingInitiallyDisabled PeriodicAdvertisingCreateSyncOptions = (1 << 1)
+	PeriodicAdvertisingCreateSyncOptionsDuplicateFiltering         PeriodicAdvertisingCreateSyncOptions = (1 << 2)
+)
+
+type PeriodicAdvertisingCreateSyncParameters struct {
+	Options               PeriodicAdvertisingCreateSyncOptions
+	AdvertisingSID        uint8
+	AdvertiserAddressType PeerAddressType
+	AdvertiserAddress     BDAddr
+	// Skip is the number of periodic advertising packets that may be
+	// skipped after a successful receive.
+	Skip uint16
+	// SyncTimeout is in units of 10ms.
+	SyncTimeout uint16
+	SyncCTEType uint8
+}
+
+type HCILEPeriodicAdvertisingCreateSyncCommandPacket struct {
+	PeriodicAdvertisingCreateSyncParameters
+}
+
+func (p *HCILEPeriodicAdvertisingCreateSyncCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 18)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLEPeriodicAdvertisingCreateSync))
+	buf[3] = 14
+	buf[4] = byte(p.Options)
+	buf[5] = p.AdvertisingSID
+	buf[6] = byte(p.AdvertiserAddressType)
+	copy(buf[7:13], p.AdvertiserAddress[:])
+	binary.LittleEndian.PutUint16(buf[13:], p.Skip)
+	binary.LittleEndian.PutUint16(buf[15:], p.SyncTimeout)
+	buf[17] = p.SyncCTEType
+	return buf, nil
+}
+
+func (p *HCILEPeriodicAdvertisingCreateSyncCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLEPeriodicAdvertisingCreateSync) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 14 || len(buf) != 18 {
+		return io.ErrShortBuffer
+	}
+	p.Options = PeriodicAdvertisingCreateSyncOptions(buf[4])
+	p.AdvertisingSID = buf[5]
+	p.AdvertiserAddressType = PeerAddressType(buf[6])
+	copy(p.AdvertiserAddress[:], buf[7:13])
+	p.Skip = binary.LittleEndian.Uint16(buf[13:])
+	p.SyncTimeout = binary.LittleEndian.Uint16(buf[15:])
+	p.SyncCTEType = buf[17]
+	return nil
+}
+
+func (p *HCILEPeriodicAdvertisingCreateSyncCommandPacket) Opcode() Opcode {
+	return OpcodeLEPeriodicAdvertisingCreateSync
+}
+
+// PeriodicAdvertisingSync is a periodic advertising train the controller is
+// synchronized to. Its SyncHandle identifies the train to BIGCreateSync.
+type PeriodicAdvertisingSync struct {
+	adapter *Adapter
+
+	SyncHandle            uint16
+	AdvertisingSID        uint8
+	AdvertiserAddressType PeerAddressType
+	AdvertiserAddress     BDAddr
+	AdvertiserPHY         PHY
+	// PeriodicAdvertisingInterval is in units of 1.25ms.
+	PeriodicAdvertisingInterval uint16
+	AdvertiserClockAccuracy     CentralClockAccuracy
+}
+
+// LEPeriodicAdvertisingCreateSync synchronizes to a periodic advertising train
+// and blocks until the controller reports the synchronization established.
+// The controller only finds the train while extended scanning is enabled, see
+// LESetExtendedScanEnable. If ctx is done first, the attempt is cancelled
+// with LE Periodic Advertising Create Sync Cancel and ctx.Err() is returned,
+// unless the synchronization was established before the cancellation took
+// effect.
+func (a *Adapter) LEPeriodicAdvertisingCreateSync(ctx context.Context, params *PeriodicAdvertisingCreateSyncParameters) (*PeriodicAdvertisingSync, error) {
+	done := make(chan *LEPeriodicAdvertisingSyncEstablishedEventPacket, 1)
+	errch := make(chan error, 1)
+	// only one synchronization may be pending, so every event is ours.
+	cancel := a.subscribe(func(p Packet, err error) {
+		if err != nil {
+			select {
+			case errch <- err:
+			default:
+			}
+			return
+		}
+		if p, ok := p.(*LEPeriodicAdvertisingSyncEstablishedEventPacket); ok {
+			select {
+			case done <- p:
+			default:
+			}
+		}
+	})
+	defer cancel()
+
+	if err := a.opStatus(&HCILEPeriodicAdvertisingCreateSyncCommandPacket{PeriodicAdvertisingCreateSyncParameters: *params}); err != nil {
+		return nil, err
+	}
+	var p *LEPeriodicAdvertisingSyncEstablishedEventPacket
+	select {
+	case p = <-done:
+	case err := <-errch:
+		return nil, err
+	case <-a.closing:
+		return nil, ErrAdapterClosed
+	case <-ctx.Done():
+		if err := a.LEPeriodicAdvertisingCreateSyncCancel(); err != nil {
+			// the synchronization may have been established already, in
+			// which case its event is on the way.
+			zap.L().Debug("failed to cancel periodic advertising sync", zap.Error(err))
+		}
+		select {
+		case p = <-done:
+		case err := <-errch:
+			return nil, err
+		case <-a.closing:
+			return nil, ErrAdapterClosed
+		}
+		if p.Status != 0 {
+			// the cancelled attempt completes with Operation Cancelled by
+			// Host.
+			return nil, ctx.Err()
+		}
+	}
+	if p.Status != 0 {
+		return nil, fmt.Errorf("periodic advertising sync not established: status 0x%02x", p.Status)
+	}
+	return &PeriodicAdvertisingSync{
+		adapter:                     a,
+		SyncHandle:                  p.SyncHandle,
+		AdvertisingSID:              p.AdvertisingSID,
+		AdvertiserAddressType:       p.AdvertiserAddressType,
+		AdvertiserAddress:           p.AdvertiserAddress,
+		AdvertiserPHY:               p.AdvertiserPHY,
+		PeriodicAdvertisingInterval: p.PeriodicAdvertisingInterval,
+		AdvertiserClockAccuracy:     p.AdvertiserClockAccuracy,
+	}, nil
+}
+
+// LEPeriodicAdvertisingCreateSyncCancel cancels a pending synchronization,
+// which then completes with status Operation Cancelled by Host.
+func (a *Adapter) LEPeriodicAdvertisingCreateSyncCancel() error {
+	buf, err := a.op(NewGenericCommandPacket(OpcodeLEPeriodicAdvertisingCreateSyncCancel))
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+// Terminate stops synchronizing to the periodic advertising train.
+func (s *PeriodicAdvertisingSync) Terminate() error {
+	buf, err := s.adapter.op(NewHCIConnectionHandleCommandPacket(OpcodeLEPeriodicAdvertisingTerminateSync, s.SyncHandle))
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+// OnPeriodicAdvertisingSyncLost invokes cb with the handle of every periodic
+// advertising train the controller loses synchronization with. The returned
+// function stops delivery.
+func (a *Adapter) OnPeriodicAdvertisingSyncLost(cb func(syncHandle uint16)) func() {
+	return a.subscribe(func(p Packet, err error) {
+		if p, ok := p.(*LEPeriodicAdvertisingSyncLostEventPacket); ok {
+			cb(p.SyncHandle)
+		}
+	})
+}
+
+type LEPeriodicAdvertisingSyncEstablishedEventPacket struct {
+	Status                      uint8
+	SyncHandle                  uint16
+	AdvertisingSID              uint8
+	AdvertiserAddressType       PeerAddressType
+	AdvertiserAddress           BDAddr
+	AdvertiserPHY               PHY
+	PeriodicAdvertisingInterval uint16
+	AdvertiserClockAccuracy     CentralClockAccuracy
+}
+
+func (p *LEPeriodicAdvertisingSyncEstablishedEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 19)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 16
+	buf[3] = byte(LEMetaSubeventCodePeriodicAdvertisingSyncEstablished)
+	buf[4] = p.Status
+	binary.LittleEndian.PutUint16(buf[5:], p.SyncHandle)
+	buf[7] = p.AdvertisingSID
+	buf[8] = byte(p.AdvertiserAddressType)
+	copy(buf[9:15], p.AdvertiserAddress[:])
+	buf[15] = byte(p.AdvertiserPHY)
+	binary.LittleEndian.PutUint16(buf[16:], p.PeriodicAdvertisingInterval)
+	buf[18] = byte(p.AdvertiserClockAccuracy)
+	return buf, nil
+}
+
+func (p *LEPeriodicAdvertisingSyncEstablishedEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 16 || len(buf) != 19 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodePeriodicAdvertisingSyncEstablished) {
+		return errors.New("incorrect subevent")
+	}
+	p.Status = buf[4]
+	p.SyncHandle = binary.LittleEndian.Uint16(buf[5:])
+	p.AdvertisingSID = buf[7]
+	p.AdvertiserAddressType = PeerAddressType(buf[8])
+	copy(p.AdvertiserAddress[:], buf[9:15])
+	p.AdvertiserPHY = PHY(buf[15])
+	p.PeriodicAdvertisingInterval = binary.LittleEndian.Uint16(buf[16:])
+	p.AdvertiserClockAccuracy = CentralClockAccuracy(buf[18])
+	return nil
+}
+
+type LEPeriodicAdvertisingSyncLostEventPacket struct {
+	SyncHandle uint16
+}
+
+func (p *LEPeriodicAdvertisingSyncLostEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 6)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 3
+	buf[3] = byte(LEMetaSubeventCodePeriodicAdvertisingSyncLost)
+	binary.LittleEndian.PutUint16(buf[4:], p.SyncHandle)
+	return buf, nil
+}
+
+func (p *LEPeriodicAdvertisingSyncLostEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 3 || len(buf) != 6 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodePeriodicAdvertisingSyncLost) {
+		return errors.New("incorrect subevent")
+	}
+	p.SyncHandle = binary.LittleEndian.Uint16(buf[4:])
+	return nil
+}
@@ -0,0 +1,706 @@
+package hci
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"go.uber.org/zap"
+)
+
+// Periodic Advertising with Responses, Vol 4, Part E, Sections 7.8.125 to 7.8.129.
+
+type PeriodicAdvertisingProperties uint16
+
+const (
+	PeriodicAdvertisingPropertiesIncludeTxPower PeriodicAdvertisingProperties = (1 << 6)
+)
+
+type HCILESetPeriodicAdvertisingParametersV2CommandPacket struct {
+	AdvertisingHandle              uint8
+	PeriodicAdvertisingIntervalMin uint16
+	PeriodicAdvertisingIntervalMax uint16
+	PeriodicAdvertisingProperties  PeriodicAdvertisingProperties
+	NumSubevents                   uint8
+	SubeventInterval               uint8
+	ResponseSlotDelay              uint8
+	ResponseSlotSpacing            uint8
+	NumResponseSlots               uint8
+}
+
+func (p *HCILESetPeriodicAdvertisingParametersV2CommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 16)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetPeriodicAdvertisingParametersV2))
+	buf[3] = 12
+	buf[4] = p.AdvertisingHandle
+	binary.LittleEndian.PutUint16(buf[5:], p.PeriodicAdvertisingIntervalMin)
+	binary.LittleEndian.PutUint16(buf[7:], p.PeriodicAdvertisingIntervalMax)
+	binary.LittleEndian.PutUint16(buf[9:], uint16(p.PeriodicAdvertisingProperties))
+	buf[11] = p.NumSubevents
+	buf[12] = p.SubeventInterval
+	buf[13] = p.ResponseSlotDelay
+	buf[14] = p.ResponseSlotSpacing
+	buf[15] = p.NumResponseSlots
+	return buf, nil
+}
+
+func (p *HCILESetPeriodicAdvertisingParametersV2CommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetPeriodicAdvertisingParametersV2) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 12 || len(buf) != 16 {
+		return io.ErrShortBuffer
+	}
+	p.AdvertisingHandle = buf[4]
+	p.PeriodicAdvertisingIntervalMin = binary.LittleEndian.Uint16(buf[5:])
+	p.PeriodicAdvertisingIntervalMax = binary.LittleEndian.Uint16(buf[7:])
+	p.PeriodicAdvertisingProperties = PeriodicAdvertisingProperties(binary.LittleEndian.Uint16(buf[9:]))
+	p.NumSubevents = buf[11]
+	p.SubeventInterval = buf[12]
+	p.ResponseSlotDelay = buf[13]
+	p.ResponseSlotSpacing = buf[14]
+	p.NumResponseSlots = buf[15]
+	return nil
+}
+
+func (p *HCILESetPeriodicAdvertisingParametersV2CommandPacket) Opcode() Opcode {
+	return OpcodeLESetPeriodicAdvertisingParametersV2
+}
+
+type SetPeriodicAdvertisingParametersV2Request struct {
+	AdvertisingHandle              uint8
+	PeriodicAdvertisingIntervalMin uint16
+	PeriodicAdvertisingIntervalMax uint16
+	PeriodicAdvertisingProperties  PeriodicAdvertisingProperties
+	NumSubevents                   uint8
+	SubeventInterval               uint8
+	ResponseSlotDelay              uint8
+	ResponseSlotSpacing            uint8
+	NumResponseSlots               uint8
+}
+
+func (a *Adapter) LESetPeriodicAdvertisingParametersV2(request *SetPeriodicAdvertisingParametersV2Request) error {
+	if request.PeriodicAdvertisingIntervalMin < 0x0006 || request.PeriodicAdvertisingIntervalMin > request.PeriodicAdvertisingIntervalMax {
+		return errors.New("invalid periodic advertising interval")
+	}
+	if request.NumSubevents > 0x80 {
+		return errors.New("invalid number of subevents")
+	}
+	if request.NumSubevents > 0 {
+		if request.SubeventInterval < 0x06 {
+			return errors.New("invalid subevent interval")
+		}
+		if request.ResponseSlotSpacing < 0x02 {
+			return errors.New("invalid response slot spacing")
+		}
+	}
+
+	buf, err := a.op(&HCILESetPeriodicAdvertisingParametersV2CommandPacket{
+		AdvertisingHandle:              request.AdvertisingHandle,
+		PeriodicAdvertisingIntervalMin: request.PeriodicAdvertisingIntervalMin,
+		PeriodicAdvertisingIntervalMax: request.PeriodicAdvertisingIntervalMax,
+		PeriodicAdvertisingProperties:  request.PeriodicAdvertisingProperties,
+		NumSubevents:                   request.NumSubevents,
+		SubeventInterval:               request.SubeventInterval,
+		ResponseSlotDelay:              request.ResponseSlotDelay,
+		ResponseSlotSpacing:            request.ResponseSlotSpacing,
+		NumResponseSlots:               request.NumResponseSlots,
+	})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	r := *request
+	a.activityLock.Lock()
+	if s, ok := a.advertisingSets[r.AdvertisingHandle]; ok {
+		s.periodicParameters = &r
+	}
+	a.activityLock.Unlock()
+	return nil
+}
+
+// PeriodicAdvertisingSubeventData is the payload transmitted in one subevent
+// of a PAwR train along with the response slots the addressed nodes may use.
+type PeriodicAdvertisingSubeventData struct {
+	Subevent          uint8
+	ResponseSlotStart uint8
+	ResponseSlotCount uint8
+	SubeventData      []byte
+}
+
+type HCILESetPeriodicAdvertisingSubeventDataCommandPacket struct {
+	AdvertisingHandle uint8
+	Subevents         []PeriodicAdvertisingSubeventData
+}
+
+func (p *HCILESetPeriodicAdvertisingSubeventDataCommandPacket) Marshal() ([]byte, error) {
+	if len(p.Subevents) == 0 || len(p.Subevents) > 0x0F {
+		return nil, errors.New("invalid number of subevents")
+	}
+	buf := make([]byte, 6)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetPeriodicAdvertisingSubeventData))
+	buf[4] = p.AdvertisingHandle
+	buf[5] = uint8(len(p.Subevents))
+	for _, s := range p.Subevents {
+		if len(s.SubeventData) > 251 {
+			return nil, io.ErrShortWrite
+		}
+		buf = append(buf, s.Subevent, s.ResponseSlotStart, s.ResponseSlotCount, uint8(len(s.SubeventData)))
+		buf = append(buf, s.SubeventData...)
+	}
+	if len(buf)-4 > 255 {
+		return nil, io.ErrShortWrite
+	}
+	buf[3] = uint8(len(buf) - 4)
+	return buf, nil
+}
+
+func (p *HCILESetPeriodicAdvertisingSubeventDataCommandPacket) Unmarshal(buf []byte) error {
+	return errors.New("not implemented")
+}
+
+func (p *HCILESetPeriodicAdvertisingSubeventDataCommandPacket) Opcode() Opcode {
+	return OpcodeLESetPeriodicAdvertisingSubeventData
+}
+
+// LESetPeriodicAdvertisingSubeventData queues data for the given subevents of
+// the PAwR train on handle. It is typically called in response to a
+// LEPeriodicAdvertisingSubeventDataRequestEventPacket.
+func (a *Adapter) LESetPeriodicAdvertisingSubeventData(handle uint8, subevents ...PeriodicAdvertisingSubeventData) error {
+	buf, err := a.op(&HCILESetPeriodicAdvertisingSubeventDataCommandPacket{
+		AdvertisingHandle: handle,
+		Subevents:         subevents,
+	})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+type HCILESetPeriodicAdvertisingResponseDataCommandPacket struct {
+	SyncHandle       uint16
+	RequestEvent     uint16
+	RequestSubevent  uint8
+	ResponseSubevent uint8
+	ResponseSlot     uint8
+	ResponseData     []byte
+}
+
+func (p *HCILESetPeriodicAdvertisingResponseDataCommandPacket) Marshal() ([]byte, error) {
+	if len(p.ResponseData) > 247 {
+		return nil, io.ErrShortWrite
+	}
+	buf := make([]byte, 12+len(p.ResponseData))
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetPeriodicAdvertisingResponseData))
+	buf[3] = uint8(8 + len(p.ResponseData))
+	binary.LittleEndian.PutUint16(buf[4:], p.SyncHandle)
+	binary.LittleEndian.PutUint16(buf[6:], p.RequestEvent)
+	buf[8] = p.RequestSubevent
+	buf[9] = p.ResponseSubevent
+	buf[10] = p.ResponseSlot
+	buf[11] = uint8(len(p.ResponseData))
+	copy(buf[12:], p.ResponseData)
+	return buf, nil
+}
+
+func (p *HCILESetPeriodicAdvertisingResponseDataCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetPeriodicAdvertisingResponseData) {
+		return errors.New("incorrect packet")
+	}
+	if len(buf) < 12 || len(buf) != int(buf[3])+4 || len(buf) != int(buf[11])+12 {
+		return io.ErrShortBuffer
+	}
+	p.SyncHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.RequestEvent = binary.LittleEndian.Uint16(buf[6:])
+	p.RequestSubevent = buf[8]
+	p.ResponseSubevent = buf[9]
+	p.ResponseSlot = buf[10]
+	p.ResponseData = buf[12:]
+	return nil
+}
+
+func (p *HCILESetPeriodicAdvertisingResponseDataCommandPacket) Opcode() Opcode {
+	return OpcodeLESetPeriodicAdvertisingResponseData
+}
+
+type SetPeriodicAdvertisingResponseDataRequest struct {
+	SyncHandle       uint16
+	RequestEvent     uint16
+	RequestSubevent  uint8
+	ResponseSubevent uint8
+	ResponseSlot     uint8
+	ResponseData     []byte
+}
+
+// LESetPeriodicAdvertisingResponseData is used by a synchronized receiver to
+// answer a subevent of a PAwR train in its assigned response slot. The
+// RequestEvent and RequestSubevent are the PeriodicEventCounter and Subevent
+// of the report being answered, see OnPeriodicAdvertisingReport.
+func (a *Adapter) LESetPeriodicAdvertisingResponseData(request *SetPeriodicAdvertisingResponseDataRequest) error {
+	buf, err := a.op(&HCILESetPeriodicAdvertisingResponseDataCommandPacket{
+		SyncHandle:       request.SyncHandle,
+		RequestEvent:     request.RequestEvent,
+		RequestSubevent:  request.RequestSubevent,
+		ResponseSubevent: request.ResponseSubevent,
+		ResponseSlot:     request.ResponseSlot,
+		ResponseData:     request.ResponseData,
+	})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+type HCILESetPeriodicSyncSubeventCommandPacket struct {
+	SyncHandle                    uint16
+	PeriodicAdvertisingProperties PeriodicAdvertisingProperties
+	Subevents                     []uint8
+}
+
+func (p *HCILESetPeriodicSyncSubeventCommandPacket) Marshal() ([]byte, error) {
+	if len(p.Subevents) == 0 || len(p.Subevents) > 0x80 {
+		return nil, errors.New("invalid number of subevents")
+	}
+	buf := make([]byte, 9+len(p.Subevents))
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetPeriodicSyncSubevent))
+	buf[3] = uint8(5 + len(p.Subevents))
+	binary.LittleEndian.PutUint16(buf[4:], p.SyncHandle)
+	binary.LittleEndian.PutUint16(buf[6:], uint16(p.PeriodicAdvertisingProperties))
+	buf[8] = uint8(len(p.Subevents))
+	copy(buf[9:], p.Subevents)
+	return buf, nil
+}
+
+func (p *HCILESetPeriodicSyncSubeventCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetPeriodicSyncSubevent) {
+		return errors.New("incorrect packet")
+	}
+	if len(buf) < 9 || len(buf) != int(buf[3])+4 || len(buf) != int(buf[8])+9 {
+		return io.ErrShortBuffer
+	}
+	p.SyncHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.PeriodicAdvertisingProperties = PeriodicAdvertisingProperties(binary.LittleEndian.Uint16(buf[6:]))
+	p.Subevents = buf[9:]
+	return nil
+}
+
+func (p *HCILESetPeriodicSyncSubeventCommandPacket) Opcode() Opcode {
+	return OpcodeLESetPeriodicSyncSubevent
+}
+
+// LESetPeriodicSyncSubevent instructs the controller which subevents of the
+// synchronized PAwR train to listen to. Nodes typically listen to a single
+// subevent so that the advertiser can address groups of them independently.
+func (a *Adapter) LESetPeriodicSyncSubevent(syncHandle uint16, properties PeriodicAdvertisingProperties, subevents ...uint8) error {
+	buf, err := a.op(&HCILESetPeriodicSyncSubeventCommandPacket{
+		SyncHandle:                    syncHandle,
+		PeriodicAdvertisingProperties: properties,
+		Subevents:                     subevents,
+	})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+type InitiatorFilterPolicy uint8
+
+const (
+	InitiatorFilterPolicyPeerAddress      InitiatorFilterPolicy = 0x00
+	InitiatorFilterPolicyFilterAcceptList InitiatorFilterPolicy = 0x01
+)
+
+type PHYs uint8
+
+const (
+	PHYsLE1M    PHYs = (1 << 0)
+	PHYsLE2M    PHYs = (1 << 1)
+	PHYsLECoded PHYs = (1 << 2)
+)
+
+// ConnectionParameters are the per-PHY initiating parameters of an extended
+// create connection command.
+type ConnectionParameters struct {
+	ScanInterval          uint16
+	ScanWindow            uint16
+	ConnectionIntervalMin uint16
+	ConnectionIntervalMax uint16
+	MaxLatency            uint16
+	SupervisionTimeout    uint16
+	MinCELength           uint16
+	MaxCELength           uint16
+}
+
+type HCILEExtendedCreateConnectionV2CommandPacket struct {
+	AdvertisingHandle     uint8
+	Subevent              uint8
+	InitiatorFilterPolicy InitiatorFilterPolicy
+	OwnAddressType        OwnAddressType
+	PeerAddressType       PeerAddressType
+	PeerAddress           BDAddr
+	InitiatingPHYs        PHYs
+	// Parameters holds one entry per bit set in InitiatingPHYs, in order of
+	// increasing bit position.
+	Parameters []ConnectionParameters
+}
+
+func (p *HCILEExtendedCreateConnectionV2CommandPacket) Marshal() ([]byte, error) {
+	n := 0
+	for i := 0; i < 3; i++ {
+		if p.InitiatingPHYs&(1<<i) != 0 {
+			n++
+		}
+	}
+	if n == 0 || n != len(p.Parameters) {
+		return nil, errors.New("invalid initiating phys")
+	}
+	buf := make([]byte, 16+16*n)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLEExtendedCreateConnectionV2))
+	buf[3] = uint8(12 + 16*n)
+	buf[4] = p.AdvertisingHandle
+	buf[5] = p.Subevent
+	buf[6] = byte(p.InitiatorFilterPolicy)
+	buf[7] = byte(p.OwnAddressType)
+	buf[8] = byte(p.PeerAddressType)
+	copy(buf[9:], p.PeerAddress[:])
+	buf[15] = byte(p.InitiatingPHYs)
+	// the per-phy parameters are interleaved, one 16 octet block per phy.
+	for i, c := range p.Parameters {
+		b := buf[16+16*i:]
+		binary.LittleEndian.PutUint16(b[0:], c.ScanInterval)
+		binary.LittleEndian.PutUint16(b[2:], c.ScanWindow)
+		binary.LittleEndian.PutUint16(b[4:], c.ConnectionIntervalMin)
+		binary.LittleEndian.PutUint16(b[6:], c.ConnectionIntervalMax)
+		binary.LittleEndian.PutUint16(b[8:], c.MaxLatency)
+		binary.LittleEndian.PutUint16(b[10:], c.SupervisionTimeout)
+		binary.LittleEndian.PutUint16(b[12:], c.MinCELength)
+		binary.LittleEndian.PutUint16(b[14:], c.MaxCELength)
+	}
+	return buf, nil
+}
+
+func (p *HCILEExtendedCreateConnectionV2CommandPacket) Unmarshal(buf []byte) error {
+	return errors.New("not implemented")
+}
+
+func (p *HCILEExtendedCreateConnectionV2CommandPacket) Opcode() Opcode {
+	return OpcodeLEExtendedCreateConnectionV2
+}
+
+type ExtendedCreateConnectionV2Request struct {
+	// AdvertisingHandle and Subevent identify the PAwR train and subevent in
+	// which the connection request is sent. Set AdvertisingHandle to 0xFF to
+	// initiate without a PAwR train.
+	AdvertisingHandle     uint8
+	Subevent              uint8
+	InitiatorFilterPolicy InitiatorFilterPolicy
+	OwnAddressType        OwnAddressType
+	PeerAddressType       PeerAddressType
+	PeerAddress           BDAddr
+	InitiatingPHYs        PHYs
+	Parameters            []ConnectionParameters
+}
+
+// LEExtendedCreateConnectionV2 connects to a peer as central and blocks until
+// the connection is established. If ctx is done first, the attempt is
+// cancelled with LE Create Connection Cancel and ctx.Err() is returned, unless
+// the connection completed before the cancellation took effect.
+//
+// The random address is not rotated and ApplyFilterPolicy waits while
+// initiating, so ctx should bound the attempt. Initiating fails while a filter
+// policy is being applied.
+func (a *Adapter) LEExtendedCreateConnectionV2(ctx context.Context, request *ExtendedCreateConnectionV2Request) (*Conn, error) {
+	phys := request.InitiatingPHYs
+	if phys == 0 {
+		phys = PHYsLE1M
+	}
+	// neither the random address nor the filter accept list may change
+	// while initiating.
+	a.addressLock.Lock()
+	defer a.addressLock.Unlock()
+	if a.applyingFilterPolicy() {
+		return nil, errors.New("filter policy is being applied")
+	}
+
+	conn := make(chan *Conn, 1)
+	errch := make(chan error, 1)
+	cancel := a.subscribe(func(p Packet, err error) {
+		if err != nil {
+			select {
+			case errch <- err:
+			default:
+			}
+			return
+		}
+		q, ok := p.(*LEEnhancedConnectionCompleteEventPacket)
+		if !ok || q.Role != RoleCentral {
+			return
+		}
+		if request.AdvertisingHandle != 0xFF && q.AdvertisingHandle != request.AdvertisingHandle {
+			return
+		}
+		if q.Status != 0 {
+			select {
+			case errch <- errors.New("connection failed"):
+			default:
+			}
+			return
+		}
+		select {
+		case conn <- q.established:
+		default:
+		}
+	})
+	defer cancel()
+
+	if err := a.opStatus(&HCILEExtendedCreateConnectionV2CommandPacket{
+		AdvertisingHandle:     request.AdvertisingHandle,
+		Subevent:              request.Subevent,
+		InitiatorFilterPolicy: request.InitiatorFilterPolicy,
+		OwnAddressType:        request.OwnAddressType,
+		PeerAddressType:       request.PeerAddressType,
+		PeerAddress:           request.PeerAddress,
+		InitiatingPHYs:        phys,
+		Parameters:            request.Parameters,
+	}); err != nil {
+		return nil, err
+	}
+	select {
+	case c := <-conn:
+		return c, nil
+	case err := <-errch:
+		return nil, err
+	case <-a.closing:
+		return nil, ErrAdapterClosed
+	case <-ctx.Done():
+	}
+	if err := a.LECreateConnectionCancel(); err != nil {
+		// the connection may have completed already, in which case its
+		// event is on the way.
+		zap.L().Debug("failed to cancel connection", zap.Error(err))
+	}
+	select {
+	case c := <-conn:
+		return c, nil
+	case <-errch:
+		// the cancelled attempt completes with Unknown Connection
+		// Identifier.
+		return nil, ctx.Err()
+	case <-a.closing:
+		return nil, ErrAdapterClosed
+	}
+}
+
+// LECreateConnectionCancel cancels a pending create connection command. The
+// initiator is notified by a connection complete event with status Unknown
+// Connection Identifier.
+func (a *Adapter) LECreateConnectionCancel() error {
+	buf, err := a.op(NewGenericCommandPacket(OpcodeLECreateConnectionCancel))
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+type LEPeriodicAdvertisingSubeventDataRequestEventPacket struct {
+	AdvertisingHandle uint8
+	SubeventStart     uint8
+	SubeventDataCount uint8
+}
+
+func (p *LEPeriodicAdvertisingSubeventDataRequestEventPacket) Marshal() ([]byte, error) {
+	return nil, errors.New("unimplemented")
+}
+
+func (p *LEPeriodicAdvertisingSubeventDataRequestEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 4 || len(buf) != 7 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodePeriodicAdvertisingSubeventDataRequest) {
+		return errors.New("incorrect subevent")
+	}
+	p.AdvertisingHandle = buf[4]
+	p.SubeventStart = buf[5]
+	p.SubeventDataCount = buf[6]
+	return nil
+}
+
+type PeriodicAdvertisingResponse struct {
+	TxPower      int8
+	RSSI         int8
+	CTEType      uint8
+	ResponseSlot uint8
+	DataStatus   uint8
+	Data         []byte
+}
+
+type LEPeriodicAdvertisingResponseReportEventPacket struct {
+	AdvertisingHandle uint8
+	Subevent          uint8
+	TxStatus          uint8
+	Responses         []PeriodicAdvertisingResponse
+}
+
+func (p *LEPeriodicAdvertisingResponseReportEventPacket) Marshal() ([]byte, error) {
+	return nil, errors.New("unimplemented")
+}
+
+func (p *LEPeriodicAdvertisingResponseReportEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if len(buf) < 8 || len(buf) != int(buf[2])+3 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodePeriodicAdvertisingResponseReport) {
+		return errors.New("incorrect subevent")
+	}
+	p.AdvertisingHandle = buf[4]
+	p.Subevent = buf[5]
+	p.TxStatus = buf[6]
+	p.Responses = make([]PeriodicAdvertisingResponse, buf[7])
+	buf = buf[8:]
+	for i := range p.Responses {
+		if len(buf) < 6 || len(buf) < 6+int(buf[5]) {
+			return io.ErrShortBuffer
+		}
+		p.Responses[i] = PeriodicAdvertisingResponse{
+			TxPower:      int8(buf[0]),
+			RSSI:         int8(buf[1]),
+			CTEType:      buf[2],
+			ResponseSlot: buf[3],
+			DataStatus:   buf[4],
+			Data:         buf[6 : 6+int(buf[5])],
+		}
+		buf = buf[6+int(buf[5]):]
+	}
+	return nil
+}
+
+// OnPeriodicAdvertisingSubeventDataRequest invokes cb whenever the controller
+// asks for data for upcoming subevents of a PAwR train. The returned function
+// stops delivery.
+func (a *Adapter) OnPeriodicAdvertisingSubeventDataRequest(cb func(*LEPeriodicAdvertisingSubeventDataRequestEventPacket)) func() {
+	return a.subscribe(func(p Packet, err error) {
+		if p, ok := p.(*LEPeriodicAdvertisingSubeventDataRequestEventPacket); ok {
+			cb(p)
+		}
+	})
+}
+
+// OnPeriodicAdvertisingResponseReport invokes cb with the responses received
+// in the response slots of a PAwR subevent. The returned function stops
+// delivery.
+func (a *Adapter) OnPeriodicAdvertisingResponseReport(cb func(*LEPeriodicAdvertisingResponseReportEventPacket)) func() {
+	return a.subscribe(func(p Packet, err error) {
+		if p, ok := p.(*LEPeriodicAdvertisingResponseReportEventPacket); ok {
+			cb(p)
+		}
+	})
+}
+
+// LEPeriodicAdvertisingReportEventPacket decodes both the v1 and v2 LE
+// Periodic Advertising Report events. PeriodicEventCounter and Subevent are
+// only reported by v2, which identifies the PAwR subevent a receiver answers
+// with LESetPeriodicAdvertisingResponseData.
+type LEPeriodicAdvertisingReportEventPacket struct {
+	SyncHandle uint16
+	// TxPower and RSSI are in dBm, 127 if unavailable.
+	TxPower              int8
+	RSSI                 int8
+	CTEType              uint8
+	PeriodicEventCounter uint16
+	// Subevent is 0xFF if the train has no subevents.
+	Subevent   uint8
+	DataStatus uint8
+	Data       []byte
+}
+
+func (p *LEPeriodicAdvertisingReportEventPacket) Marshal() ([]byte, error) {
+	if len(p.Data) > 247 {
+		return nil, io.ErrShortWrite
+	}
+	buf := make([]byte, 14+len(p.Data))
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = uint8(11 + len(p.Data))
+	buf[3] = byte(LEMetaSubeventCodePeriodicAdvertisingReportV2)
+	binary.LittleEndian.PutUint16(buf[4:], p.SyncHandle)
+	buf[6] = byte(p.TxPower)
+	buf[7] = byte(p.RSSI)
+	buf[8] = p.CTEType
+	binary.LittleEndian.PutUint16(buf[9:], p.PeriodicEventCounter)
+	buf[11] = p.Subevent
+	buf[12] = p.DataStatus
+	buf[13] = uint8(len(p.Data))
+	copy(buf[14:], p.Data)
+	return buf, nil
+}
+
+func (p *LEPeriodicAdvertisingReportEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if len(buf) < 4 || len(buf) != int(buf[2])+3 {
+		return io.ErrShortBuffer
+	}
+	switch LEMetaSubeventCode(buf[3]) {
+	case LEMetaSubeventCodePeriodicAdvertisingReport:
+		if len(buf) < 11 || len(buf) != 11+int(buf[10]) {
+			return io.ErrShortBuffer
+		}
+		p.PeriodicEventCounter, p.Subevent = 0, 0xFF
+		p.DataStatus = buf[9]
+		p.Data = buf[11:]
+	case LEMetaSubeventCodePeriodicAdvertisingReportV2:
+		if len(buf) < 14 || len(buf) != 14+int(buf[13]) {
+			return io.ErrShortBuffer
+		}
+		p.PeriodicEventCounter = binary.LittleEndian.Uint16(buf[9:])
+		p.Subevent = buf[11]
+		p.DataStatus = buf[12]
+		p.Data = buf[14:]
+	default:
+		return errors.New("incorrect subevent")
+	}
+	p.SyncHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.TxPower = int8(buf[6])
+	p.RSSI = int8(buf[7])
+	p.CTEType = buf[8]
+	return nil
+}
+
+// OnPeriodicAdvertisingReport invokes cb with the data received from the
+// periodic advertising trains the controller is synchronized to, including
+// the subevents of PAwR trains selected with LESetPeriodicSyncSubevent. The
+// returned function stops delivery.
+func (a *Adapter) OnPeriodicAdvertisingReport(cb func(*LEPeriodicAdvertisingReportEventPacket)) func() {
+	return a.subscribe(func(p Packet, err error) {
+		if p, ok := p.(*LEPeriodicAdvertisingReportEventPacket); ok {
+			cb(p)
+		}
+	})
+}
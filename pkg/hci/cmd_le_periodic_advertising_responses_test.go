@@ -0,0 +1,75 @@
+package hci
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExtendedCreateConnectionV2Marshal(t *testing.T) {
+	p := &HCILEExtendedCreateConnectionV2CommandPacket{
+		AdvertisingHandle: 0xFF,
+		InitiatingPHYs:    PHYsLE1M | PHYsLECoded,
+		Parameters: []ConnectionParameters{
+			{0x0101, 0x0102, 0x0103, 0x0104, 0x0105, 0x0106, 0x0107, 0x0108},
+			{0x0201, 0x0202, 0x0203, 0x0204, 0x0205, 0x0206, 0x0207, 0x0208},
+		},
+	}
+	buf, err := p.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != 48 || buf[3] != 44 {
+		t.Fatalf("length = %d, parameter length %d", len(buf), buf[3])
+	}
+	// each phy's parameters form a contiguous block.
+	want := []byte{
+		0x01, 0x01, 0x02, 0x01, 0x03, 0x01, 0x04, 0x01, 0x05, 0x01, 0x06, 0x01, 0x07, 0x01, 0x08, 0x01,
+		0x01, 0x02, 0x02, 0x02, 0x03, 0x02, 0x04, 0x02, 0x05, 0x02, 0x06, 0x02, 0x07, 0x02, 0x08, 0x02,
+	}
+	if !bytes.Equal(buf[16:], want) {
+		t.Fatalf("parameters = %x, want %x", buf[16:], want)
+	}
+}
+
+func TestPeriodicAdvertisingReportUnmarshal(t *testing.T) {
+	v2, err := (&LEPeriodicAdvertisingReportEventPacket{
+		SyncHandle:           0x0102,
+		TxPower:              -4,
+		RSSI:                 -60,
+		CTEType:              0xFF,
+		PeriodicEventCounter: 0x0304,
+		Subevent:             5,
+		Data:                 []byte{0x02, 0x01, 0x06},
+	}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := []byte{byte(PacketTypeEvent), byte(EventCodeLEMeta), 11, byte(LEMetaSubeventCodePeriodicAdvertisingReport),
+		0x02, 0x01, 0xFC, 0xC4, 0xFF, 0x00, 0x03, 0x02, 0x01, 0x06}
+	for _, tc := range []struct {
+		name                 string
+		buf                  []byte
+		periodicEventCounter uint16
+		subevent             uint8
+	}{
+		{name: "v1", buf: v1, subevent: 0xFF},
+		{name: "v2", buf: v2, periodicEventCounter: 0x0304, subevent: 5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := Unmarshal(tc.buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, ok := p.(*LEPeriodicAdvertisingReportEventPacket)
+			if !ok {
+				t.Fatalf("decoded %T", p)
+			}
+			if r.SyncHandle != 0x0102 || r.TxPower != -4 || r.RSSI != -60 || r.CTEType != 0xFF || !bytes.Equal(r.Data, []byte{0x02, 0x01, 0x06}) {
+				t.Errorf("report = %+v", r)
+			}
+			if r.PeriodicEventCounter != tc.periodicEventCounter || r.Subevent != tc.subevent {
+				t.Errorf("event counter, subevent = %d, %d, want %d, %d", r.PeriodicEventCounter, r.Subevent, tc.periodicEventCounter, tc.subevent)
+			}
+		})
+	}
+}
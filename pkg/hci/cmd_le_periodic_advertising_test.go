@@ -0,0 +1,88 @@
+package hci_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/muxable/bluetooth/pkg/hci"
+	"github.com/muxable/bluetooth/pkg/hci/hcitest"
+)
+
+func TestPeriodicAdvertisingCreateSync(t *testing.T) {
+	s, c, err := hcitest.NewController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	advertiser := hci.BDAddr{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	c.HandleCommand = func(opcode hci.Opcode, params []byte) []hci.Packet {
+		if opcode != hci.OpcodeLEPeriodicAdvertisingCreateSync {
+			return nil
+		}
+		return []hci.Packet{
+			&hci.CommandStatusEventPacket{NumCommandPackets: 1, CommandOpcode: opcode},
+			&hci.LEPeriodicAdvertisingSyncEstablishedEventPacket{
+				SyncHandle:                  0x0042,
+				AdvertisingSID:              params[1],
+				AdvertiserAddressType:       hci.PeerAddressType(params[2]),
+				AdvertiserAddress:           advertiser,
+				AdvertiserPHY:               hci.PHYLE2M,
+				PeriodicAdvertisingInterval: 0x0050,
+			},
+		}
+	}
+	a := hci.NewConn(s)
+	defer c.Close()
+	defer a.Close()
+
+	sync, err := a.LEPeriodicAdvertisingCreateSync(context.Background(), &hci.PeriodicAdvertisingCreateSyncParameters{
+		AdvertisingSID:        3,
+		AdvertiserAddressType: hci.PeerAddressTypeRandomDeviceAddress,
+		AdvertiserAddress:     advertiser,
+		SyncTimeout:           100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sync.SyncHandle != 0x0042 || sync.AdvertisingSID != 3 || sync.AdvertiserAddress != advertiser || sync.AdvertiserPHY != hci.PHYLE2M {
+		t.Errorf("sync = %+v", sync)
+	}
+}
+
+func TestPeriodicAdvertisingCreateSyncCancel(t *testing.T) {
+	s, c, err := hcitest.NewController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelled := make(chan struct{}, 1)
+	c.HandleCommand = func(opcode hci.Opcode, params []byte) []hci.Packet {
+		switch opcode {
+		case hci.OpcodeLEPeriodicAdvertisingCreateSync:
+			// the train is never found.
+			return []hci.Packet{&hci.CommandStatusEventPacket{NumCommandPackets: 1, CommandOpcode: opcode}}
+		case hci.OpcodeLEPeriodicAdvertisingCreateSyncCancel:
+			cancelled <- struct{}{}
+			return []hci.Packet{
+				&hci.CommandCompleteEventPacket{NumCommandPackets: 1, CommandOpcode: opcode, ReturnParameters: []byte{0}},
+				// Operation Cancelled by Host.
+				&hci.LEPeriodicAdvertisingSyncEstablishedEventPacket{Status: 0x44},
+			}
+		}
+		return nil
+	}
+	a := hci.NewConn(s)
+	defer c.Close()
+	defer a.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := a.LEPeriodicAdvertisingCreateSync(ctx, &hci.PeriodicAdvertisingCreateSyncParameters{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("LEPeriodicAdvertisingCreateSync() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Error("the pending sync was not cancelled")
+	}
+}
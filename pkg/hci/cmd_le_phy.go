@@ -0,0 +1,273 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// PHY management, Vol 4, Part E, Sections 7.8.47 to 7.8.49 and 7.7.65.12.
+
+type PHY uint8
+
+const (
+	PHYLE1M    PHY = 0x01
+	PHYLE2M    PHY = 0x02
+	PHYLECoded PHY = 0x03
+)
+
+type AllPHYs uint8
+
+const (
+	AllPHYsNoTxPreference AllPHYs = (1 << 0)
+	AllPHYsNoRxPreference AllPHYs = (1 << 1)
+)
+
+type PHYOptions uint16
+
+const (
+	PHYOptionsNoPreference PHYOptions = 0x0000
+	PHYOptionsCodedS2      PHYOptions = 0x0001
+	PHYOptionsCodedS8      PHYOptions = 0x0002
+)
+
+type HCIConnectionHandleCommandPacket struct {
+	opcode           Opcode
+	ConnectionHandle uint16
+}
+
+// NewHCIConnectionHandleCommandPacket encompasses the commands whose only
+// parameter is a connection handle.
+func NewHCIConnectionHandleCommandPacket(opcode Opcode, handle uint16) *HCIConnectionHandleCommandPacket {
+	return &HCIConnectionHandleCommandPacket{opcode: opcode, ConnectionHandle: handle}
+}
+
+func (p *HCIConnectionHandleCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 6)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(p.opcode))
+	buf[3] = 2
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	return buf, nil
+}
+
+func (p *HCIConnectionHandleCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 2 || len(buf) != 6 {
+		return io.ErrShortBuffer
+	}
+	p.opcode = Opcode(binary.LittleEndian.Uint16(buf[1:]))
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	return nil
+}
+
+func (p *HCIConnectionHandleCommandPacket) Opcode() Opcode {
+	return p.opcode
+}
+
+// ReadPHY reads the current transmitter and receiver PHY of the connection
+// from the controller, see PHY.
+func (c *Conn) ReadPHY() (PHY, PHY, error) {
+	buf, err := c.op(NewHCIConnectionHandleCommandPacket(OpcodeLEReadPHY, c.ConnectionHandle))
+	if err != nil {
+		return 0, 0, err
+	}
+	if buf[0] != 0 {
+		return 0, 0, errors.New("command failed")
+	}
+	if len(buf) < 5 {
+		return 0, 0, io.ErrShortBuffer
+	}
+	tx, rx := PHY(buf[3]), PHY(buf[4])
+	c.linkLock.Lock()
+	c.txPHY, c.rxPHY = tx, rx
+	c.linkLock.Unlock()
+	return tx, rx, nil
+}
+
+// PHY returns the transmitter and receiver PHY of the connection as last
+// reported by the controller.
+func (c *Conn) PHY() (tx, rx PHY) {
+	c.linkLock.Lock()
+	defer c.linkLock.Unlock()
+	return c.txPHY, c.rxPHY
+}
+
+type HCILESetDefaultPHYCommandPacket struct {
+	AllPHYs AllPHYs
+	TxPHYs  PHYs
+	RxPHYs  PHYs
+}
+
+func (p *HCILESetDefaultPHYCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 7)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetDefaultPHY))
+	buf[3] = 3
+	buf[4] = byte(p.AllPHYs)
+	buf[5] = byte(p.TxPHYs)
+	buf[6] = byte(p.RxPHYs)
+	return buf, nil
+}
+
+func (p *HCILESetDefaultPHYCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetDefaultPHY) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 3 || len(buf) != 7 {
+		return io.ErrShortBuffer
+	}
+	p.AllPHYs = AllPHYs(buf[4])
+	p.TxPHYs = PHYs(buf[5])
+	p.RxPHYs = PHYs(buf[6])
+	return nil
+}
+
+func (p *HCILESetDefaultPHYCommandPacket) Opcode() Opcode {
+	return OpcodeLESetDefaultPHY
+}
+
+// LESetDefaultPHY sets the PHYs the controller prefers for all subsequent
+// connections.
+func (a *Adapter) LESetDefaultPHY(all AllPHYs, tx, rx PHYs) error {
+	buf, err := a.op(&HCILESetDefaultPHYCommandPacket{AllPHYs: all, TxPHYs: tx, RxPHYs: rx})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+type HCILESetPHYCommandPacket struct {
+	ConnectionHandle uint16
+	AllPHYs          AllPHYs
+	TxPHYs           PHYs
+	RxPHYs           PHYs
+	PHYOptions       PHYOptions
+}
+
+func (p *HCILESetPHYCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 11)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetPHY))
+	buf[3] = 7
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	buf[6] = byte(p.AllPHYs)
+	buf[7] = byte(p.TxPHYs)
+	buf[8] = byte(p.RxPHYs)
+	binary.LittleEndian.PutUint16(buf[9:], uint16(p.PHYOptions))
+	return buf, nil
+}
+
+func (p *HCILESetPHYCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetPHY) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 7 || len(buf) != 11 {
+		return io.ErrShortBuffer
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.AllPHYs = AllPHYs(buf[6])
+	p.TxPHYs = PHYs(buf[7])
+	p.RxPHYs = PHYs(buf[8])
+	p.PHYOptions = PHYOptions(binary.LittleEndian.Uint16(buf[9:]))
+	return nil
+}
+
+func (p *HCILESetPHYCommandPacket) Opcode() Opcode {
+	return OpcodeLESetPHY
+}
+
+// SetPHY requests a PHY change on the connection and blocks until the
+// controller reports the outcome of the PHY update procedure. The peer may
+// choose not to switch, so the resulting PHYs are returned.
+func (c *Conn) SetPHY(all AllPHYs, tx, rx PHYs, options PHYOptions) (PHY, PHY, error) {
+	done := make(chan *LEPHYUpdateCompleteEventPacket, 1)
+	errch := make(chan error, 1)
+	cancel := c.subscribe(func(p Packet, err error) {
+		if err != nil {
+			select {
+			case errch <- err:
+			default:
+			}
+			return
+		}
+		if p, ok := p.(*LEPHYUpdateCompleteEventPacket); ok && p.ConnectionHandle == c.ConnectionHandle {
+			select {
+			case done <- p:
+			default:
+			}
+		}
+	})
+	defer cancel()
+
+	if err := c.opStatus(&HCILESetPHYCommandPacket{
+		ConnectionHandle: c.ConnectionHandle,
+		AllPHYs:          all,
+		TxPHYs:           tx,
+		RxPHYs:           rx,
+		PHYOptions:       options,
+	}); err != nil {
+		return 0, 0, err
+	}
+	select {
+	case p := <-done:
+		if p.Status != 0 {
+			return 0, 0, errors.New("phy update failed")
+		}
+		return p.TxPHY, p.RxPHY, nil
+	case err := <-errch:
+		return 0, 0, err
+	case <-c.closed:
+		return 0, 0, c.closeErr
+	}
+}
+
+// OnPHYUpdate invokes cb whenever the PHY of the connection changes, whether
+// the change was requested locally or by the peer.
+func (c *Conn) OnPHYUpdate(cb func(tx, rx PHY)) {
+	c.linkLock.Lock()
+	c.onPHYUpdate = cb
+	c.linkLock.Unlock()
+}
+
+type LEPHYUpdateCompleteEventPacket struct {
+	Status           uint8
+	ConnectionHandle uint16
+	TxPHY            PHY
+	RxPHY            PHY
+}
+
+func (p *LEPHYUpdateCompleteEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 9)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 6
+	buf[3] = byte(LEMetaSubeventCodePHYUpdateComplete)
+	buf[4] = p.Status
+	binary.LittleEndian.PutUint16(buf[5:], p.ConnectionHandle)
+	buf[7] = byte(p.TxPHY)
+	buf[8] = byte(p.RxPHY)
+	return buf, nil
+}
+
+func (p *LEPHYUpdateCompleteEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 6 || len(buf) != 9 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodePHYUpdateComplete) {
+		return errors.New("incorrect subevent")
+	}
+	p.Status = buf[4]
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[5:])
+	p.TxPHY = PHY(buf[7])
+	p.RxPHY = PHY(buf[8])
+	return nil
+}
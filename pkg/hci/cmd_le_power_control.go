@@ -0,0 +1,243 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// LE Power Control and transmit power configuration, Vol 4, Part E, Sections
+// 7.8.53, 7.8.74 to 7.8.76 and 7.8.121.
+
+type HCILESetTransmitPowerReportingEnableCommandPacket struct {
+	ConnectionHandle uint16
+	LocalEnable      bool
+	RemoteEnable     bool
+}
+
+func (p *HCILESetTransmitPowerReportingEnableCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 8)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetTransmitPowerReportingEnable))
+	buf[3] = 4
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	if p.LocalEnable {
+		buf[6] = 1
+	}
+	if p.RemoteEnable {
+		buf[7] = 1
+	}
+	return buf, nil
+}
+
+func (p *HCILESetTransmitPowerReportingEnableCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetTransmitPowerReportingEnable) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 4 || len(buf) != 8 {
+		return io.ErrShortBuffer
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.LocalEnable = buf[6] == 1
+	p.RemoteEnable = buf[7] == 1
+	return nil
+}
+
+func (p *HCILESetTransmitPowerReportingEnableCommandPacket) Opcode() Opcode {
+	return OpcodeLESetTransmitPowerReportingEnable
+}
+
+// SetTransmitPowerReportingEnable enables LETransmitPowerReportingEventPacket
+// events when the local or remote transmit power of the connection changes.
+func (c *Conn) SetTransmitPowerReportingEnable(local, remote bool) error {
+	buf, err := c.op(&HCILESetTransmitPowerReportingEnableCommandPacket{
+		ConnectionHandle: c.ConnectionHandle,
+		LocalEnable:      local,
+		RemoteEnable:     remote,
+	})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+// LEReadTransmitPower returns the minimum and maximum transmit power levels
+// supported by the controller in dBm.
+func (a *Adapter) LEReadTransmitPower() (int8, int8, error) {
+	buf, err := a.op(NewGenericCommandPacket(OpcodeLEReadTransmitPower))
+	if err != nil {
+		return 0, 0, err
+	}
+	if buf[0] != 0 {
+		return 0, 0, errors.New("command failed")
+	}
+	if len(buf) < 3 {
+		return 0, 0, io.ErrShortBuffer
+	}
+	return int8(buf[1]), int8(buf[2]), nil
+}
+
+// LEReadAdvertisingPhysicalChannelTxPower returns the transmit power level
+// used for legacy advertising in dBm.
+func (a *Adapter) LEReadAdvertisingPhysicalChannelTxPower() (int8, error) {
+	buf, err := a.op(NewGenericCommandPacket(OpcodeLEReadAdvertisingPhysicalChannelTxPower))
+	if err != nil {
+		return 0, err
+	}
+	if buf[0] != 0 {
+		return 0, errors.New("command failed")
+	}
+	if len(buf) < 2 {
+		return 0, io.ErrShortBuffer
+	}
+	return int8(buf[1]), nil
+}
+
+// RFPathCompensation values are in units of 0.1 dB.
+type RFPathCompensation struct {
+	TxPathCompensation int16
+	RxPathCompensation int16
+}
+
+func (a *Adapter) LEReadRFPathCompensation() (*RFPathCompensation, error) {
+	buf, err := a.op(NewGenericCommandPacket(OpcodeLEReadRFPathCompensation))
+	if err != nil {
+		return nil, err
+	}
+	if buf[0] != 0 {
+		return nil, errors.New("command failed")
+	}
+	if len(buf) < 5 {
+		return nil, io.ErrShortBuffer
+	}
+	return &RFPathCompensation{
+		TxPathCompensation: int16(binary.LittleEndian.Uint16(buf[1:3])),
+		RxPathCompensation: int16(binary.LittleEndian.Uint16(buf[3:5])),
+	}, nil
+}
+
+type HCILEWriteRFPathCompensationCommandPacket struct {
+	RFPathCompensation
+}
+
+func (p *HCILEWriteRFPathCompensationCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 8)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLEWriteRFPathCompensation))
+	buf[3] = 4
+	binary.LittleEndian.PutUint16(buf[4:], uint16(p.TxPathCompensation))
+	binary.LittleEndian.PutUint16(buf[6:], uint16(p.RxPathCompensation))
+	return buf, nil
+}
+
+func (p *HCILEWriteRFPathCompensationCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLEWriteRFPathCompensation) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 4 || len(buf) != 8 {
+		return io.ErrShortBuffer
+	}
+	p.TxPathCompensation = int16(binary.LittleEndian.Uint16(buf[4:]))
+	p.RxPathCompensation = int16(binary.LittleEndian.Uint16(buf[6:]))
+	return nil
+}
+
+func (p *HCILEWriteRFPathCompensationCommandPacket) Opcode() Opcode {
+	return OpcodeLEWriteRFPathCompensation
+}
+
+func (a *Adapter) LEWriteRFPathCompensation(c *RFPathCompensation) error {
+	if c.TxPathCompensation < -1280 || c.TxPathCompensation > 1280 || c.RxPathCompensation < -1280 || c.RxPathCompensation > 1280 {
+		return errors.New("invalid rf path compensation")
+	}
+	buf, err := a.op(&HCILEWriteRFPathCompensationCommandPacket{RFPathCompensation: *c})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+// TransmitPowerSetter applies a transmit power level in dBm to a connection
+// and returns the level the controller selected. The HCI specification has no
+// command for this, so it is implemented with vendor-specific commands.
+type TransmitPowerSetter func(c *Conn, level int8) (int8, error)
+
+// PathLossPowerPolicy lowers the transmit power of a connection by Step dB
+// whenever its path loss enters the low zone and raises it when it enters the
+// high zone, within [Min, Max].
+type PathLossPowerPolicy struct {
+	PathLossReportingParameters
+	Step     int8
+	Min, Max int8
+	Set      TransmitPowerSetter
+}
+
+// ApplyPathLossPowerPolicy enables path loss monitoring on the connection and
+// adjusts its transmit power according to policy until the returned function
+// is called.
+func (c *Conn) ApplyPathLossPowerPolicy(policy *PathLossPowerPolicy) (func() error, error) {
+	if policy.Set == nil {
+		return nil, errors.New("no transmit power setter")
+	}
+	if policy.Step <= 0 || policy.Min > policy.Max {
+		return nil, errors.New("invalid power policy")
+	}
+	level, err := c.ReadTransmitPowerLevel(TransmitPowerLevelTypeCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SetPathLossReportingParameters(&policy.PathLossReportingParameters); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	cancel := c.subscribe(func(p Packet, err error) {
+		q, ok := p.(*LEPathLossThresholdEventPacket)
+		if !ok || q.ConnectionHandle != c.ConnectionHandle {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		target := int(level)
+		switch q.ZoneEntered {
+		case PathLossZoneLow:
+			target -= int(policy.Step)
+		case PathLossZoneHigh:
+			target += int(policy.Step)
+		default:
+			return
+		}
+		if target < int(policy.Min) {
+			target = int(policy.Min)
+		}
+		if target > int(policy.Max) {
+			target = int(policy.Max)
+		}
+		if target == int(level) {
+			return
+		}
+		selected, err := policy.Set(c, int8(target))
+		if err != nil {
+			zap.L().Warn("failed to set transmit power", zap.Uint16("handle", c.ConnectionHandle), zap.Error(err))
+			return
+		}
+		level = selected
+	})
+	if err := c.SetPathLossReportingEnable(true); err != nil {
+		cancel()
+		return nil, err
+	}
+	return func() error {
+		cancel()
+		return c.SetPathLossReportingEnable(false)
+	}, nil
+}
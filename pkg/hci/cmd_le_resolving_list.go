@@ -0,0 +1,356 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// Controller-based privacy, Vol 4, Part E, Sections 7.8.38 to 7.8.45 and 7.8.77.
+
+type HCILEAddDeviceToResolvingListCommandPacket struct {
+	PeerIdentityAddressType PeerAddressType
+	PeerIdentityAddress     BDAddr
+	PeerIRK                 IRK
+	LocalIRK                IRK
+}
+
+func (p *HCILEAddDeviceToResolvingListCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 43)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLEAddDeviceToResolvingList))
+	buf[3] = 39
+	buf[4] = byte(p.PeerIdentityAddressType)
+	copy(buf[5:], p.PeerIdentityAddress[:])
+	copy(buf[11:], p.PeerIRK[:])
+	copy(buf[27:], p.LocalIRK[:])
+	return buf, nil
+}
+
+func (p *HCILEAddDeviceToResolvingListCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLEAddDeviceToResolvingList) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 39 || len(buf) != 43 {
+		return io.ErrShortBuffer
+	}
+	p.PeerIdentityAddressType = PeerAddressType(buf[4])
+	copy(p.PeerIdentityAddress[:], buf[5:11])
+	copy(p.PeerIRK[:], buf[11:27])
+	copy(p.LocalIRK[:], buf[27:43])
+	return nil
+}
+
+func (p *HCILEAddDeviceToResolvingListCommandPacket) Opcode() Opcode {
+	return OpcodeLEAddDeviceToResolvingList
+}
+
+// resolvingListEntry is the host's copy of a device on the resolving list.
+type resolvingListEntry struct {
+	peerType          PeerAddressType
+	peer              BDAddr
+	peerIRK, localIRK IRK
+	privacyMode       PrivacyMode
+}
+
+func (a *Adapter) LEAddDeviceToResolvingList(peerType PeerAddressType, peer BDAddr, peerIRK, localIRK IRK) error {
+	a.resolvingListLock.Lock()
+	defer a.resolvingListLock.Unlock()
+	buf, err := a.op(&HCILEAddDeviceToResolvingListCommandPacket{
+		PeerIdentityAddressType: peerType,
+		PeerIdentityAddress:     peer,
+		PeerIRK:                 peerIRK,
+		LocalIRK:                localIRK,
+	})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	a.resolvingList = append(a.resolvingList, resolvingListEntry{
+		peerType: peerType,
+		peer:     peer,
+		peerIRK:  peerIRK,
+		localIRK: localIRK,
+	})
+	return nil
+}
+
+// resolvingListEntryLocked returns the entry of a peer on the resolving list.
+// The caller must hold resolvingListLock.
+func (a *Adapter) resolvingListEntryLocked(peerType PeerAddressType, peer BDAddr) (int, bool) {
+	for i, e := range a.resolvingList {
+		if e.peerType == peerType && e.peer == peer {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// HCIPeerAddressCommandPacket encompasses the commands whose only parameters
+// are a peer identity address.
+type HCIPeerAddressCommandPacket struct {
+	opcode          Opcode
+	PeerAddressType PeerAddressType
+	PeerAddress     BDAddr
+}
+
+func NewHCIPeerAddressCommandPacket(opcode Opcode, peerType PeerAddressType, peer BDAddr) *HCIPeerAddressCommandPacket {
+	return &HCIPeerAddressCommandPacket{opcode: opcode, PeerAddressType: peerType, PeerAddress: peer}
+}
+
+func (p *HCIPeerAddressCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 11)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(p.opcode))
+	buf[3] = 7
+	buf[4] = byte(p.PeerAddressType)
+	copy(buf[5:], p.PeerAddress[:])
+	return buf, nil
+}
+
+func (p *HCIPeerAddressCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 7 || len(buf) != 11 {
+		return io.ErrShortBuffer
+	}
+	p.opcode = Opcode(binary.LittleEndian.Uint16(buf[1:]))
+	p.PeerAddressType = PeerAddressType(buf[4])
+	copy(p.PeerAddress[:], buf[5:11])
+	return nil
+}
+
+func (p *HCIPeerAddressCommandPacket) Opcode() Opcode {
+	return p.opcode
+}
+
+func (a *Adapter) LERemoveDeviceFromResolvingList(peerType PeerAddressType, peer BDAddr) error {
+	a.resolvingListLock.Lock()
+	defer a.resolvingListLock.Unlock()
+	buf, err := a.op(NewHCIPeerAddressCommandPacket(OpcodeLERemoveDeviceFromResolvingList, peerType, peer))
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	if i, ok := a.resolvingListEntryLocked(peerType, peer); ok {
+		a.resolvingList = append(a.resolvingList[:i], a.resolvingList[i+1:]...)
+	}
+	return nil
+}
+
+func (a *Adapter) LEClearResolvingList() error {
+	a.resolvingListLock.Lock()
+	defer a.resolvingListLock.Unlock()
+	buf, err := a.op(NewGenericCommandPacket(OpcodeLEClearResolvingList))
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	a.resolvingList = nil
+	return nil
+}
+
+func (a *Adapter) LEReadResolvingListSize() (uint8, error) {
+	buf, err := a.op(NewGenericCommandPacket(OpcodeLEReadResolvingListSize))
+	if err != nil {
+		return 0, err
+	}
+	if buf[0] != 0 {
+		return 0, errors.New("command failed")
+	}
+	return buf[1], nil
+}
+
+// LEReadPeerResolvableAddress returns the resolvable private address the
+// controller currently uses for the peer identity.
+func (a *Adapter) LEReadPeerResolvableAddress(peerType PeerAddressType, peer BDAddr) (BDAddr, error) {
+	var addr BDAddr
+	buf, err := a.op(NewHCIPeerAddressCommandPacket(OpcodeLEReadPeerResolvableAddress, peerType, peer))
+	if err != nil {
+		return addr, err
+	}
+	if buf[0] != 0 {
+		return addr, errors.New("command failed")
+	}
+	if copy(addr[:], buf[1:]) != 6 {
+		return addr, io.ErrShortWrite
+	}
+	return addr, nil
+}
+
+// LEReadLocalResolvableAddress returns the resolvable private address the
+// controller currently uses as the local address towards the peer identity.
+func (a *Adapter) LEReadLocalResolvableAddress(peerType PeerAddressType, peer BDAddr) (BDAddr, error) {
+	var addr BDAddr
+	buf, err := a.op(NewHCIPeerAddressCommandPacket(OpcodeLEReadLocalResolvableAddress, peerType, peer))
+	if err != nil {
+		return addr, err
+	}
+	if buf[0] != 0 {
+		return addr, errors.New("command failed")
+	}
+	if copy(addr[:], buf[1:]) != 6 {
+		return addr, io.ErrShortWrite
+	}
+	return addr, nil
+}
+
+type HCILESetAddressResolutionEnableCommandPacket struct {
+	AddressResolutionEnable bool
+}
+
+func (p *HCILESetAddressResolutionEnableCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 5)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetAddressResolutionEnable))
+	buf[3] = 1
+	if p.AddressResolutionEnable {
+		buf[4] = 1
+	}
+	return buf, nil
+}
+
+func (p *HCILESetAddressResolutionEnableCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetAddressResolutionEnable) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 1 || len(buf) != 5 {
+		return io.ErrShortBuffer
+	}
+	p.AddressResolutionEnable = buf[4] == 1
+	return nil
+}
+
+func (p *HCILESetAddressResolutionEnableCommandPacket) Opcode() Opcode {
+	return OpcodeLESetAddressResolutionEnable
+}
+
+func (a *Adapter) LESetAddressResolutionEnable(enable bool) error {
+	a.resolvingListLock.Lock()
+	defer a.resolvingListLock.Unlock()
+	buf, err := a.op(&HCILESetAddressResolutionEnableCommandPacket{AddressResolutionEnable: enable})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	a.addressResolution = enable
+	return nil
+}
+
+type HCILESetResolvablePrivateAddressTimeoutCommandPacket struct {
+	RPATimeout uint16 // in seconds.
+}
+
+func (p *HCILESetResolvablePrivateAddressTimeoutCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 6)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetResolvablePrivateAddressTimeout))
+	buf[3] = 2
+	binary.LittleEndian.PutUint16(buf[4:], p.RPATimeout)
+	return buf, nil
+}
+
+func (p *HCILESetResolvablePrivateAddressTimeoutCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetResolvablePrivateAddressTimeout) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 2 || len(buf) != 6 {
+		return io.ErrShortBuffer
+	}
+	p.RPATimeout = binary.LittleEndian.Uint16(buf[4:])
+	return nil
+}
+
+func (p *HCILESetResolvablePrivateAddressTimeoutCommandPacket) Opcode() Opcode {
+	return OpcodeLESetResolvablePrivateAddressTimeout
+}
+
+// LESetResolvablePrivateAddressTimeout sets how often the controller rotates
+// the resolvable private addresses it generates.
+func (a *Adapter) LESetResolvablePrivateAddressTimeout(timeout time.Duration) error {
+	if timeout < time.Second || timeout > 0x0E10*time.Second {
+		return errors.New("invalid rpa timeout")
+	}
+	a.resolvingListLock.Lock()
+	defer a.resolvingListLock.Unlock()
+	buf, err := a.op(&HCILESetResolvablePrivateAddressTimeoutCommandPacket{RPATimeout: uint16(timeout / time.Second)})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	a.rpaTimeout = timeout
+	return nil
+}
+
+type PrivacyMode uint8
+
+const (
+	PrivacyModeNetwork PrivacyMode = 0x00
+	PrivacyModeDevice  PrivacyMode = 0x01
+)
+
+type HCILESetPrivacyModeCommandPacket struct {
+	PeerIdentityAddressType PeerAddressType
+	PeerIdentityAddress     BDAddr
+	PrivacyMode             PrivacyMode
+}
+
+func (p *HCILESetPrivacyModeCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 12)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetPrivacyMode))
+	buf[3] = 8
+	buf[4] = byte(p.PeerIdentityAddressType)
+	copy(buf[5:], p.PeerIdentityAddress[:])
+	buf[11] = byte(p.PrivacyMode)
+	return buf, nil
+}
+
+func (p *HCILESetPrivacyModeCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetPrivacyMode) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 8 || len(buf) != 12 {
+		return io.ErrShortBuffer
+	}
+	p.PeerIdentityAddressType = PeerAddressType(buf[4])
+	copy(p.PeerIdentityAddress[:], buf[5:11])
+	p.PrivacyMode = PrivacyMode(buf[11])
+	return nil
+}
+
+func (p *HCILESetPrivacyModeCommandPacket) Opcode() Opcode {
+	return OpcodeLESetPrivacyMode
+}
+
+func (a *Adapter) LESetPrivacyMode(peerType PeerAddressType, peer BDAddr, mode PrivacyMode) error {
+	a.resolvingListLock.Lock()
+	defer a.resolvingListLock.Unlock()
+	buf, err := a.op(&HCILESetPrivacyModeCommandPacket{
+		PeerIdentityAddressType: peerType,
+		PeerIdentityAddress:     peer,
+		PrivacyMode:             mode,
+	})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	if i, ok := a.resolvingListEntryLocked(peerType, peer); ok {
+		a.resolvingList[i].privacyMode = mode
+	}
+	return nil
+}
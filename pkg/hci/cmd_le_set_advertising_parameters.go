@@ -108,6 +108,9 @@ func (a *Adapter) LESetAdvertisingParameters(request *SetAdvertisingParametersRe
 	if request.AdvertisingChannelMap == 0 {
 		request.AdvertisingChannelMap = AdvertisingChannelMapDefault
 	}
+	if request.OwnAddressType == OwnAddressTypeRandomDeviceAddress && a.RandomAddress() == (BDAddr{}) {
+		return errors.New("random address not configured")
+	}
 
 	buf, err := a.op(&HCILESetAdvertisingParametersCommandPacket{
 		AdvertisingIntervalMin:  request.AdvertisingIntervalMin,
@@ -125,5 +128,9 @@ func (a *Adapter) LESetAdvertisingParameters(request *SetAdvertisingParametersRe
 	if buf[0] != 0 {
 		return errors.New("command failed")
 	}
+	r := *request
+	a.addressLock.Lock()
+	a.advertisingParameters = &r
+	a.addressLock.Unlock()
 	return nil
 }
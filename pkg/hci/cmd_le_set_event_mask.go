@@ -10,11 +10,36 @@ import (
 type LEEventMask uint64
 
 const (
-	LEEventMaskConnectionCompleteEvent             LEEventMask = (1 << 0)
-	LEEventMaskAdvertisingReportEvent              LEEventMask = (1 << 1)
-	LEEventMaskConnectionUpdateCompleteEvent       LEEventMask = (1 << 2)
-	LEEventMaskReadRemoteUsedFeaturesCompleteEvent LEEventMask = (1 << 3)
-	LEEventMaskLongTermKeyRequestEvent             LEEventMask = (1 << 4)
+	LEEventMaskConnectionCompleteEvent                     LEEventMask = (1 << 0)
+	LEEventMaskAdvertisingReportEvent                      LEEventMask = (1 << 1)
+	LEEventMaskConnectionUpdateCompleteEvent               LEEventMask = (1 << 2)
+	LEEventMaskReadRemoteUsedFeaturesCompleteEvent         LEEventMask = (1 << 3)
+	LEEventMaskLongTermKeyRequestEvent                     LEEventMask = (1 << 4)
+	LEEventMaskRemoteConnectionParameterRequestEvent       LEEventMask = (1 << 5)
+	LEEventMaskDataLengthChangeEvent                       LEEventMask = (1 << 6)
+	LEEventMaskReadLocalP256PublicKeyCompleteEvent         LEEventMask = (1 << 7)
+	LEEventMaskGenerateDHKeyCompleteEvent                  LEEventMask = (1 << 8)
+	LEEventMaskEnhancedConnectionCompleteEvent             LEEventMask = (1 << 9)
+	LEEventMaskPHYUpdateCompleteEvent                      LEEventMask = (1 << 11)
+	LEEventMaskExtendedAdvertisingReportEvent              LEEventMask = (1 << 12)
+	LEEventMaskPeriodicAdvertisingSyncEstablishedEvent     LEEventMask = (1 << 13)
+	LEEventMaskPeriodicAdvertisingReportEvent              LEEventMask = (1 << 14)
+	LEEventMaskPeriodicAdvertisingSyncLostEvent            LEEventMask = (1 << 15)
+	LEEventMaskScanTimeoutEvent                            LEEventMask = (1 << 16)
+	LEEventMaskAdvertisingSetTerminatedEvent               LEEventMask = (1 << 17)
+	LEEventMaskCISEstablishedEvent                         LEEventMask = (1 << 24)
+	LEEventMaskCISRequestEvent                             LEEventMask = (1 << 25)
+	LEEventMaskCreateBIGCompleteEvent                      LEEventMask = (1 << 26)
+	LEEventMaskTerminateBIGCompleteEvent                   LEEventMask = (1 << 27)
+	LEEventMaskBIGSyncEstablishedEvent                     LEEventMask = (1 << 28)
+	LEEventMaskBIGSyncLostEvent                            LEEventMask = (1 << 29)
+	LEEventMaskPathLossThresholdEvent                      LEEventMask = (1 << 31)
+	LEEventMaskTransmitPowerReportingEvent                 LEEventMask = (1 << 32)
+	LEEventMaskBIGInfoAdvertisingReportEvent               LEEventMask = (1 << 33)
+	LEEventMaskPeriodicAdvertisingReportV2Event            LEEventMask = (1 << 36)
+	LEEventMaskPeriodicAdvertisingSubeventDataRequestEvent LEEventMask = (1 << 38)
+	LEEventMaskPeriodicAdvertisingResponseReportEvent      LEEventMask = (1 << 39)
+	LEEventMaskEnhancedConnectionCompleteV2Event           LEEventMask = (1 << 40)
 )
 
 type HCILESetEventMaskCommandPacket struct {
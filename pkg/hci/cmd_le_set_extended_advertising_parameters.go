@@ -0,0 +1,369 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Section 7.8.53
+type AdvertisingEventProperties uint16
+
+const (
+	AdvertisingEventPropertiesConnectable           AdvertisingEventProperties = (1 << 0)
+	AdvertisingEventPropertiesScannable             AdvertisingEventProperties = (1 << 1)
+	AdvertisingEventPropertiesDirected              AdvertisingEventProperties = (1 << 2)
+	AdvertisingEventPropertiesHighDutyCycleDirected AdvertisingEventProperties = (1 << 3)
+	AdvertisingEventPropertiesLegacy                AdvertisingEventProperties = (1 << 4)
+	AdvertisingEventPropertiesOmitAdvertiserAddress AdvertisingEventProperties = (1 << 5)
+	AdvertisingEventPropertiesIncludeTxPower        AdvertisingEventProperties = (1 << 6)
+)
+
+// AdvertisingTxPowerNoPreference lets the controller choose the advertising
+// transmit power.
+const AdvertisingTxPowerNoPreference int8 = 0x7F
+
+type HCILESetExtendedAdvertisingParametersCommandPacket struct {
+	AdvertisingHandle             uint8
+	AdvertisingEventProperties    AdvertisingEventProperties
+	PrimaryAdvertisingIntervalMin uint32
+	PrimaryAdvertisingIntervalMax uint32
+	PrimaryAdvertisingChannelMap  AdvertisingChannelMap
+	OwnAddressType                OwnAddressType
+	PeerAddressType               PeerAddressType
+	PeerAddress                   BDAddr
+	AdvertisingFilterPolicy       AdvertisingFilterPolicy
+	AdvertisingTxPower            int8
+	PrimaryAdvertisingPHY         PHY
+	SecondaryAdvertisingMaxSkip   uint8
+	SecondaryAdvertisingPHY       PHY
+	AdvertisingSID                uint8
+	ScanRequestNotificationEnable bool
+}
+
+func (p *HCILESetExtendedAdvertisingParametersCommandPacket) Marshal() ([]byte, error) {
+	if p.PrimaryAdvertisingIntervalMin > 0xFFFFFF || p.PrimaryAdvertisingIntervalMax > 0xFFFFFF {
+		return nil, errors.New("invalid primary advertising interval")
+	}
+	buf := make([]byte, 29)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetExtendedAdvertisingParameters))
+	buf[3] = 25
+	buf[4] = p.AdvertisingHandle
+	binary.LittleEndian.PutUint16(buf[5:], uint16(p.AdvertisingEventProperties))
+	binary.LittleEndian.PutUint32(buf[7:], p.PrimaryAdvertisingIntervalMin)
+	// the interval max overwrites the unused most significant byte of min.
+	binary.LittleEndian.PutUint32(buf[10:], p.PrimaryAdvertisingIntervalMax)
+	buf[13] = byte(p.PrimaryAdvertisingChannelMap)
+	buf[14] = byte(p.OwnAddressType)
+	buf[15] = byte(p.PeerAddressType)
+	copy(buf[16:], p.PeerAddress[:])
+	buf[22] = byte(p.AdvertisingFilterPolicy)
+	buf[23] = byte(p.AdvertisingTxPower)
+	buf[24] = byte(p.PrimaryAdvertisingPHY)
+	buf[25] = p.SecondaryAdvertisingMaxSkip
+	buf[26] = byte(p.SecondaryAdvertisingPHY)
+	buf[27] = p.AdvertisingSID
+	if p.ScanRequestNotificationEnable {
+		buf[28] = 1
+	}
+	return buf, nil
+}
+
+func (p *HCILESetExtendedAdvertisingParametersCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetExtendedAdvertisingParameters) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 25 || len(buf) != 29 {
+		return io.ErrShortBuffer
+	}
+	p.AdvertisingHandle = buf[4]
+	p.AdvertisingEventProperties = AdvertisingEventProperties(binary.LittleEndian.Uint16(buf[5:]))
+	p.PrimaryAdvertisingIntervalMin = binary.LittleEndian.Uint32(buf[7:]) & 0xFFFFFF
+	p.PrimaryAdvertisingIntervalMax = binary.LittleEndian.Uint32(buf[10:]) & 0xFFFFFF
+	p.PrimaryAdvertisingChannelMap = AdvertisingChannelMap(buf[13])
+	p.OwnAddressType = OwnAddressType(buf[14])
+	p.PeerAddressType = PeerAddressType(buf[15])
+	copy(p.PeerAddress[:], buf[16:22])
+	p.AdvertisingFilterPolicy = AdvertisingFilterPolicy(buf[22])
+	p.AdvertisingTxPower = int8(buf[23])
+	p.PrimaryAdvertisingPHY = PHY(buf[24])
+	p.SecondaryAdvertisingMaxSkip = buf[25]
+	p.SecondaryAdvertisingPHY = PHY(buf[26])
+	p.AdvertisingSID = buf[27]
+	p.ScanRequestNotificationEnable = buf[28] == 1
+	return nil
+}
+
+func (p *HCILESetExtendedAdvertisingParametersCommandPacket) Opcode() Opcode {
+	return OpcodeLESetExtendedAdvertisingParameters
+}
+
+type SetExtendedAdvertisingParametersRequest struct {
+	AdvertisingHandle             uint8
+	AdvertisingEventProperties    AdvertisingEventProperties
+	PrimaryAdvertisingIntervalMin uint32
+	PrimaryAdvertisingIntervalMax uint32
+	PrimaryAdvertisingChannelMap  AdvertisingChannelMap
+	OwnAddressType                OwnAddressType
+	PeerAddressType               PeerAddressType
+	PeerAddress                   BDAddr
+	AdvertisingFilterPolicy       AdvertisingFilterPolicy
+	// AdvertisingTxPower is the requested transmit power in dBm. Use
+	// AdvertisingTxPowerNoPreference to let the controller choose.
+	AdvertisingTxPower            int8
+	PrimaryAdvertisingPHY         PHY
+	SecondaryAdvertisingMaxSkip   uint8
+	SecondaryAdvertisingPHY       PHY
+	AdvertisingSID                uint8
+	ScanRequestNotificationEnable bool
+}
+
+// LESetExtendedAdvertisingParameters configures an advertising set and
+// returns the transmit power in dBm the controller selected for it. A set
+// with a random own address is given the adapter's random address, if one is
+// configured, and follows it as it rotates.
+func (a *Adapter) LESetExtendedAdvertisingParameters(request *SetExtendedAdvertisingParametersRequest) (int8, error) {
+	if request.PrimaryAdvertisingIntervalMin == 0 {
+		request.PrimaryAdvertisingIntervalMin = 0x000800
+	}
+	if request.PrimaryAdvertisingIntervalMax == 0 {
+		request.PrimaryAdvertisingIntervalMax = 0x000800
+	}
+	if request.PrimaryAdvertisingIntervalMin < 0x000020 || request.PrimaryAdvertisingIntervalMin > request.PrimaryAdvertisingIntervalMax {
+		return 0, errors.New("invalid primary advertising interval")
+	}
+	if request.PrimaryAdvertisingChannelMap == 0 {
+		request.PrimaryAdvertisingChannelMap = AdvertisingChannelMapDefault
+	}
+	if request.PrimaryAdvertisingPHY == 0 {
+		request.PrimaryAdvertisingPHY = PHYLE1M
+	}
+	if request.SecondaryAdvertisingPHY == 0 {
+		request.SecondaryAdvertisingPHY = PHYLE1M
+	}
+	if request.AdvertisingTxPower != AdvertisingTxPowerNoPreference && request.AdvertisingTxPower > 20 {
+		return 0, errors.New("invalid advertising tx power")
+	}
+
+	a.addressLock.Lock()
+	defer a.addressLock.Unlock()
+	buf, err := a.op(&HCILESetExtendedAdvertisingParametersCommandPacket{
+		AdvertisingHandle:             request.AdvertisingHandle,
+		AdvertisingEventProperties:    request.AdvertisingEventProperties,
+		PrimaryAdvertisingIntervalMin: request.PrimaryAdvertisingIntervalMin,
+		PrimaryAdvertisingIntervalMax: request.PrimaryAdvertisingIntervalMax,
+		PrimaryAdvertisingChannelMap:  request.PrimaryAdvertisingChannelMap,
+		OwnAddressType:                request.OwnAddressType,
+		PeerAddressType:               request.PeerAddressType,
+		PeerAddress:                   request.PeerAddress,
+		AdvertisingFilterPolicy:       request.AdvertisingFilterPolicy,
+		AdvertisingTxPower:            request.AdvertisingTxPower,
+		PrimaryAdvertisingPHY:         request.PrimaryAdvertisingPHY,
+		SecondaryAdvertisingMaxSkip:   request.SecondaryAdvertisingMaxSkip,
+		SecondaryAdvertisingPHY:       request.SecondaryAdvertisingPHY,
+		AdvertisingSID:                request.AdvertisingSID,
+		ScanRequestNotificationEnable: request.ScanRequestNotificationEnable,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if buf[0] != 0 {
+		return 0, errors.New("command failed")
+	}
+	if len(buf) < 2 {
+		return 0, io.ErrShortBuffer
+	}
+	handle := request.AdvertisingHandle
+	a.activityLock.Lock()
+	s, ok := a.advertisingSets[handle]
+	if !ok {
+		s = &advertisingSet{}
+		a.advertisingSets[handle] = s
+	}
+	s.parameters = *request
+	a.activityLock.Unlock()
+	if addr := a.RandomAddress(); s.parameters.usesRandomAddress() && addr != (BDAddr{}) {
+		buf, err := a.op(&HCILESetAdvertisingSetRandomAddressCommandPacket{AdvertisingHandle: handle, RandomAddress: addr})
+		if err != nil {
+			return 0, err
+		}
+		if buf[0] != 0 {
+			return 0, errors.New("command failed")
+		}
+	}
+	return int8(buf[1]), nil
+}
+
+func (r *SetExtendedAdvertisingParametersRequest) usesRandomAddress() bool {
+	return r.OwnAddressType == OwnAddressTypeRandomDeviceAddress || r.OwnAddressType == OwnAddressTypeControllerGeneratedOrRandom
+}
+
+// advertisingSet is the host's copy of the configuration of an advertising
+// set.
+type advertisingSet struct {
+	parameters SetExtendedAdvertisingParametersRequest
+	// enabled is how the set was last enabled, nil while it is disabled.
+	enabled *ExtendedAdvertisingSet
+	// periodicParameters and periodic configure the set's periodic
+	// advertising train, if any.
+	periodicParameters *SetPeriodicAdvertisingParametersV2Request
+	periodic           PeriodicAdvertisingEnable
+}
+
+// ExtendedAdvertisingSet selects an advertising set to enable or disable.
+type ExtendedAdvertisingSet struct {
+	AdvertisingHandle uint8
+	// Duration, in units of 10 ms, and MaxExtendedAdvertisingEvents stop
+	// advertising after that time or number of events. Zero means no limit.
+	Duration                     uint16
+	MaxExtendedAdvertisingEvents uint8
+}
+
+// Section 7.8.56
+type HCILESetExtendedAdvertisingEnableCommandPacket struct {
+	Enable bool
+	// Sets may be empty when disabling, which disables every set.
+	Sets []ExtendedAdvertisingSet
+}
+
+func (p *HCILESetExtendedAdvertisingEnableCommandPacket) Marshal() ([]byte, error) {
+	if len(p.Sets) > 0x3F || (p.Enable && len(p.Sets) == 0) {
+		return nil, errors.New("invalid number of sets")
+	}
+	buf := make([]byte, 6+4*len(p.Sets))
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetExtendedAdvertisingEnable))
+	buf[3] = uint8(2 + 4*len(p.Sets))
+	if p.Enable {
+		buf[4] = 1
+	}
+	buf[5] = uint8(len(p.Sets))
+	for i, s := range p.Sets {
+		b := buf[6+4*i:]
+		b[0] = s.AdvertisingHandle
+		binary.LittleEndian.PutUint16(b[1:], s.Duration)
+		b[3] = s.MaxExtendedAdvertisingEvents
+	}
+	return buf, nil
+}
+
+func (p *HCILESetExtendedAdvertisingEnableCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetExtendedAdvertisingEnable) {
+		return errors.New("incorrect packet")
+	}
+	if len(buf) < 6 || len(buf) != int(buf[3])+4 || len(buf) != 6+4*int(buf[5]) {
+		return io.ErrShortBuffer
+	}
+	p.Enable = buf[4] == 1
+	p.Sets = make([]ExtendedAdvertisingSet, buf[5])
+	for i := range p.Sets {
+		b := buf[6+4*i:]
+		p.Sets[i] = ExtendedAdvertisingSet{
+			AdvertisingHandle:            b[0],
+			Duration:                     binary.LittleEndian.Uint16(b[1:]),
+			MaxExtendedAdvertisingEvents: b[3],
+		}
+	}
+	return nil
+}
+
+func (p *HCILESetExtendedAdvertisingEnableCommandPacket) Opcode() Opcode {
+	return OpcodeLESetExtendedAdvertisingEnable
+}
+
+// LESetExtendedAdvertisingEnable starts or stops advertising on the given
+// sets. Disabling with no sets stops every set.
+func (a *Adapter) LESetExtendedAdvertisingEnable(enable bool, sets ...ExtendedAdvertisingSet) error {
+	a.addressLock.Lock()
+	defer a.addressLock.Unlock()
+	if err := a.extendedAdvertisingEnable(&HCILESetExtendedAdvertisingEnableCommandPacket{Enable: enable, Sets: sets}); err != nil {
+		return err
+	}
+	a.activityLock.Lock()
+	defer a.activityLock.Unlock()
+	if !enable && len(sets) == 0 {
+		for _, s := range a.advertisingSets {
+			s.enabled = nil
+		}
+	}
+	for _, set := range sets {
+		s, ok := a.advertisingSets[set.AdvertisingHandle]
+		if !ok {
+			continue
+		}
+		s.enabled = nil
+		if enable {
+			// kept so that a set restarted for an address change or
+			// after a reset keeps its duration.
+			e := set
+			s.enabled = &e
+		}
+	}
+	return nil
+}
+
+// extendedAdvertisingEnable sends p without recording how the sets were
+// enabled.
+func (a *Adapter) extendedAdvertisingEnable(p *HCILESetExtendedAdvertisingEnableCommandPacket) error {
+	buf, err := a.op(p)
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+// Section 7.7.65.18
+type LEAdvertisingSetTerminatedEventPacket struct {
+	// Status is zero if a connection ended advertising, in which case
+	// ConnectionHandle identifies it, or the reason advertising stopped,
+	// such as 0x3C when its duration or number of events ran out.
+	Status                                uint8
+	AdvertisingHandle                     uint8
+	ConnectionHandle                      uint16
+	NumCompletedExtendedAdvertisingEvents uint8
+}
+
+func (p *LEAdvertisingSetTerminatedEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 9)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 6
+	buf[3] = byte(LEMetaSubeventCodeAdvertisingSetTerminated)
+	buf[4] = p.Status
+	buf[5] = p.AdvertisingHandle
+	binary.LittleEndian.PutUint16(buf[6:], p.ConnectionHandle)
+	buf[8] = p.NumCompletedExtendedAdvertisingEvents
+	return buf, nil
+}
+
+func (p *LEAdvertisingSetTerminatedEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 6 || len(buf) != 9 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeAdvertisingSetTerminated) {
+		return errors.New("incorrect subevent")
+	}
+	p.Status = buf[4]
+	p.AdvertisingHandle = buf[5]
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[6:])
+	p.NumCompletedExtendedAdvertisingEvents = buf[8]
+	return nil
+}
+
+// OnAdvertisingSetTerminated invokes cb when the controller stops advertising
+// on a set by itself, because a connection was made or its duration or number
+// of events ran out. The returned function stops delivery.
+func (a *Adapter) OnAdvertisingSetTerminated(cb func(*LEAdvertisingSetTerminatedEventPacket)) func() {
+	return a.subscribe(func(p Packet, err error) {
+		if p, ok := p.(*LEAdvertisingSetTerminatedEventPacket); ok {
+			cb(p)
+		}
+	})
+}
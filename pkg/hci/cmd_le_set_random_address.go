@@ -0,0 +1,254 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type HCILESetRandomAddressCommandPacket struct {
+	RandomAddress BDAddr
+}
+
+func (p *HCILESetRandomAddressCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 10)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetRandomAddress))
+	buf[3] = 6
+	copy(buf[4:], p.RandomAddress[:])
+	return buf, nil
+}
+
+func (p *HCILESetRandomAddressCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetRandomAddress) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 6 || len(buf) != 10 {
+		return io.ErrShortBuffer
+	}
+	copy(p.RandomAddress[:], buf[4:10])
+	return nil
+}
+
+func (p *HCILESetRandomAddressCommandPacket) Opcode() Opcode {
+	return OpcodeLESetRandomAddress
+}
+
+// LESetRandomAddress sets the random device address used when OwnAddressType
+// is random, pausing advertising and scanning around the change. Advertising
+// sets configured with a random own address are moved to it too. A rotation
+// started by ConfigureRandomAddress replaces it at its next interval.
+func (a *Adapter) LESetRandomAddress(addr BDAddr) error {
+	a.addressLock.Lock()
+	defer a.addressLock.Unlock()
+	return a.setRandomAddressLocked(addr)
+}
+
+// RandomAddress returns the random device address last programmed into the
+// controller, or the zero address if none was.
+func (a *Adapter) RandomAddress() BDAddr {
+	a.randomAddressLock.Lock()
+	defer a.randomAddressLock.Unlock()
+	return a.randomAddress
+}
+
+// Section 7.8.52
+type HCILESetAdvertisingSetRandomAddressCommandPacket struct {
+	AdvertisingHandle uint8
+	RandomAddress     BDAddr
+}
+
+func (p *HCILESetAdvertisingSetRandomAddressCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 11)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetAdvertisingSetRandomAddress))
+	buf[3] = 7
+	buf[4] = p.AdvertisingHandle
+	copy(buf[5:], p.RandomAddress[:])
+	return buf, nil
+}
+
+func (p *HCILESetAdvertisingSetRandomAddressCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetAdvertisingSetRandomAddress) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 7 || len(buf) != 11 {
+		return io.ErrShortBuffer
+	}
+	p.AdvertisingHandle = buf[4]
+	copy(p.RandomAddress[:], buf[5:11])
+	return nil
+}
+
+func (p *HCILESetAdvertisingSetRandomAddressCommandPacket) Opcode() Opcode {
+	return OpcodeLESetAdvertisingSetRandomAddress
+}
+
+// statusCommandDisallowed is returned by the controller for commands it
+// cannot accept in its current state.
+const statusCommandDisallowed = 0x0C
+
+// setAdvertisingSetsRandomAddressLocked moves the advertising sets that use
+// the random address to addr. The controller refuses the change while a
+// connectable set is enabled, so such a set is disabled around it and then
+// enabled again, which restarts its duration. The caller must hold
+// addressLock.
+func (a *Adapter) setAdvertisingSetsRandomAddressLocked(addr BDAddr) error {
+	for _, set := range a.randomAdvertisingSets() {
+		handle := set.AdvertisingHandle
+		p := &HCILESetAdvertisingSetRandomAddressCommandPacket{AdvertisingHandle: handle, RandomAddress: addr}
+		buf, err := a.op(p)
+		if err != nil {
+			return err
+		}
+		if buf[0] == 0 {
+			continue
+		}
+		if buf[0] != statusCommandDisallowed {
+			return errors.New("command failed")
+		}
+		disable := &HCILESetExtendedAdvertisingEnableCommandPacket{Sets: []ExtendedAdvertisingSet{{AdvertisingHandle: handle}}}
+		if err := a.extendedAdvertisingEnable(disable); err != nil {
+			return err
+		}
+		buf, err = a.op(p)
+		if err == nil && buf[0] != 0 {
+			err = errors.New("command failed")
+		}
+		enable := &HCILESetExtendedAdvertisingEnableCommandPacket{Enable: true, Sets: []ExtendedAdvertisingSet{set}}
+		if eerr := a.extendedAdvertisingEnable(enable); err == nil {
+			err = eerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RandomAddressConfig describes the random address the adapter should use for
+// advertising, scanning and initiating.
+type RandomAddressConfig struct {
+	Type RandomAddressType
+	// IRK is the local identity resolving key, only used for resolvable
+	// private addresses.
+	IRK IRK
+	// RotationInterval is how often private addresses are regenerated. The
+	// specification recommends 15 minutes, which is the default.
+	RotationInterval time.Duration
+}
+
+// ConfigureRandomAddress generates a random address of the requested type and
+// programs it into the controller. Private addresses are then rotated every
+// RotationInterval until the configuration is replaced.
+func (a *Adapter) ConfigureRandomAddress(config *RandomAddressConfig) error {
+	if config.RotationInterval == 0 {
+		config.RotationInterval = 15 * time.Minute
+	}
+	generate := func() (BDAddr, error) {
+		switch config.Type {
+		case RandomAddressTypeStatic:
+			return NewStaticRandomAddress()
+		case RandomAddressTypeNonResolvablePrivate:
+			return NewNonResolvablePrivateAddress()
+		case RandomAddressTypeResolvablePrivate:
+			return NewResolvablePrivateAddress(config.IRK)
+		}
+		return BDAddr{}, errors.New("invalid random address type")
+	}
+
+	a.addressLock.Lock()
+	if a.stopRotation != nil {
+		close(a.stopRotation)
+		a.stopRotation = nil
+	}
+	addr, err := generate()
+	if err == nil {
+		err = a.setRandomAddressLocked(addr)
+	}
+	if err != nil || config.Type == RandomAddressTypeStatic {
+		a.addressLock.Unlock()
+		return err
+	}
+	stop := make(chan struct{})
+	a.stopRotation = stop
+	a.IRK = config.IRK
+	a.addressLock.Unlock()
+
+	go func() {
+		t := time.NewTicker(config.RotationInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+			}
+			addr, err := generate()
+			if err != nil {
+				continue
+			}
+			a.addressLock.Lock()
+			select {
+			case <-stop:
+				a.addressLock.Unlock()
+				return
+			default:
+			}
+			if err := a.setRandomAddressLocked(addr); err != nil {
+				zap.L().Warn("failed to rotate random address", zap.Error(err))
+			}
+			a.addressLock.Unlock()
+		}
+	}()
+	return nil
+}
+
+// randomAdvertisingSets returns the advertising sets that use the random
+// address, as they were last enabled.
+func (a *Adapter) randomAdvertisingSets() []ExtendedAdvertisingSet {
+	a.activityLock.Lock()
+	defer a.activityLock.Unlock()
+	var sets []ExtendedAdvertisingSet
+	for handle, s := range a.advertisingSets {
+		if !s.parameters.usesRandomAddress() {
+			continue
+		}
+		set := ExtendedAdvertisingSet{AdvertisingHandle: handle}
+		if s.enabled != nil {
+			set = *s.enabled
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+// setRandomAddressLocked changes the random address, pausing advertising and
+// scanning around the change if necessary, and then moves the advertising
+// sets that use it. The caller must hold addressLock, which also keeps
+// initiators from running concurrently. If advertising or scanning cannot be
+// resumed, the error is returned even though the address was changed.
+func (a *Adapter) setRandomAddressLocked(addr BDAddr) (err error) {
+	if err := a.pauseLocked(); err != nil {
+		return err
+	}
+	defer func() {
+		if rerr := a.resumeLocked(); err == nil {
+			err = rerr
+		}
+	}()
+	buf, err := a.op(&HCILESetRandomAddressCommandPacket{RandomAddress: addr})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	a.randomAddressLock.Lock()
+	a.randomAddress = addr
+	a.randomAddressLock.Unlock()
+	return a.setAdvertisingSetsRandomAddressLocked(addr)
+}
@@ -0,0 +1,144 @@
+package hci_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/muxable/bluetooth/pkg/hci"
+	"github.com/muxable/bluetooth/pkg/hci/hcitest"
+)
+
+func TestRotationAfterPeripheralConnection(t *testing.T) {
+	s, c, err := hcitest.NewController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := make(chan struct{}, 16)
+	enabled := make(chan bool, 16)
+	c.HandleCommand = func(opcode hci.Opcode, params []byte) []hci.Packet {
+		switch opcode {
+		case hci.OpcodeLESetRandomAddress:
+			select {
+			case rotated <- struct{}{}:
+			default:
+			}
+		case hci.OpcodeLESetAdvertisingEnable:
+			enabled <- params[0] == 1
+		}
+		return nil
+	}
+	a := hci.NewConn(s)
+	defer c.Close()
+	defer a.Close()
+
+	if err := a.LESetAdvertisingEnable(true); err != nil {
+		t.Fatal(err)
+	}
+	<-enabled
+	config := &hci.RandomAddressConfig{
+		Type:             hci.RandomAddressTypeNonResolvablePrivate,
+		RotationInterval: 10 * time.Millisecond,
+	}
+	if err := a.ConfigureRandomAddress(config); err != nil {
+		t.Fatal(err)
+	}
+
+	// the controller stops advertising once a central connects.
+	hcitest.Connect(t, a, c, 1, hci.RolePeripheral)
+	// reconfiguring waits for a rotation that raced with the connection.
+	if err := a.ConfigureRandomAddress(config); err != nil {
+		t.Fatal(err)
+	}
+	for len(enabled) > 0 {
+		<-enabled
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-rotated:
+		case <-time.After(time.Second):
+			t.Fatal("the address was not rotated")
+		}
+	}
+	a.ConfigureRandomAddress(&hci.RandomAddressConfig{Type: hci.RandomAddressTypeStatic})
+	close(enabled)
+	for enable := range enabled {
+		if enable {
+			t.Fatal("advertising was enabled after the connection")
+		}
+	}
+}
+
+func TestRandomAddressAdvertisingSets(t *testing.T) {
+	s, c, err := hcitest.NewController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lock sync.Mutex
+	var commands []string
+	enabled := false
+	c.HandleCommand = func(opcode hci.Opcode, params []byte) []hci.Packet {
+		lock.Lock()
+		defer lock.Unlock()
+		switch opcode {
+		case hci.OpcodeLESetRandomAddress:
+			commands = append(commands, "random")
+		case hci.OpcodeLESetAdvertisingSetRandomAddress:
+			if enabled {
+				// connectable sets cannot change address while enabled.
+				commands = append(commands, fmt.Sprintf("set %d disallowed", params[0]))
+				return []hci.Packet{
+					&hci.CommandCompleteEventPacket{NumCommandPackets: 1, CommandOpcode: opcode, ReturnParameters: []byte{0x0C}},
+				}
+			}
+			commands = append(commands, fmt.Sprintf("set %d", params[0]))
+		case hci.OpcodeLESetExtendedAdvertisingEnable:
+			enabled = params[0] == 1
+			commands = append(commands, fmt.Sprintf("enable %d duration %d", params[0], binary.LittleEndian.Uint16(params[3:])))
+		}
+		return nil
+	}
+	a := hci.NewConn(s)
+	defer c.Close()
+	defer a.Close()
+
+	expect := func(want ...string) {
+		t.Helper()
+		lock.Lock()
+		defer lock.Unlock()
+		if !reflect.DeepEqual(commands, want) {
+			t.Fatalf("got commands %q, want %q", commands, want)
+		}
+		commands = nil
+	}
+
+	if err := a.LESetRandomAddress(hci.BDAddr{1, 0, 0, 0, 0, 0xC0}); err != nil {
+		t.Fatal(err)
+	}
+	expect("random")
+	for handle, ownAddressType := range []hci.OwnAddressType{hci.OwnAddressTypePublicDeviceAddress, hci.OwnAddressTypeRandomDeviceAddress} {
+		if _, err := a.LESetExtendedAdvertisingParameters(&hci.SetExtendedAdvertisingParametersRequest{
+			AdvertisingHandle:          uint8(handle),
+			AdvertisingEventProperties: hci.AdvertisingEventPropertiesConnectable,
+			OwnAddressType:             ownAddressType,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect("set 1")
+	if err := a.LESetExtendedAdvertisingEnable(true, hci.ExtendedAdvertisingSet{AdvertisingHandle: 1, Duration: 500}); err != nil {
+		t.Fatal(err)
+	}
+	expect("enable 1 duration 500")
+
+	if err := a.LESetRandomAddress(hci.BDAddr{2, 0, 0, 0, 0, 0xC0}); err != nil {
+		t.Fatal(err)
+	}
+	expect("random", "set 1 disallowed", "enable 0 duration 0", "set 1", "enable 1 duration 500")
+	if got := a.RandomAddress(); got != (hci.BDAddr{2, 0, 0, 0, 0, 0xC0}) {
+		t.Fatalf("got random address %v", got)
+	}
+}
@@ -0,0 +1,534 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Link quality, Vol 4, Part E, Sections 7.5.4, 7.3.35, 7.8.117 to 7.8.120,
+// 7.7.65.32 and 7.7.65.33.
+
+// TransmitPowerPHY identifies a PHY in the LE Power Control commands, which
+// distinguish between the two coded PHY modulations.
+type TransmitPowerPHY uint8
+
+const (
+	TransmitPowerPHYLE1M      TransmitPowerPHY = 0x01
+	TransmitPowerPHYLE2M      TransmitPowerPHY = 0x02
+	TransmitPowerPHYLECodedS8 TransmitPowerPHY = 0x03
+	TransmitPowerPHYLECodedS2 TransmitPowerPHY = 0x04
+)
+
+// TransmitPowerLevelUnavailable is reported when a transmit power level is
+// not available.
+const TransmitPowerLevelUnavailable int8 = 0x7F
+
+// RSSIUnavailable stands for a received signal strength that is not
+// available.
+const RSSIUnavailable int8 = 0x7F
+
+// ReadRSSI returns the received signal strength of the connection in dBm.
+func (c *Conn) ReadRSSI() (int8, error) {
+	buf, err := c.op(NewHCIConnectionHandleCommandPacket(OpcodeReadRSSI, c.ConnectionHandle))
+	if err != nil {
+		return 0, err
+	}
+	if buf[0] != 0 {
+		return 0, errors.New("command failed")
+	}
+	if len(buf) < 4 {
+		return 0, io.ErrShortBuffer
+	}
+	return int8(buf[3]), nil
+}
+
+type TransmitPowerLevelType uint8
+
+const (
+	TransmitPowerLevelTypeCurrent TransmitPowerLevelType = 0x00
+	TransmitPowerLevelTypeMaximum TransmitPowerLevelType = 0x01
+)
+
+type HCIReadTransmitPowerLevelCommandPacket struct {
+	ConnectionHandle uint16
+	Type             TransmitPowerLevelType
+}
+
+func (p *HCIReadTransmitPowerLevelCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 7)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeReadTransmitPowerLevel))
+	buf[3] = 3
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	buf[6] = byte(p.Type)
+	return buf, nil
+}
+
+func (p *HCIReadTransmitPowerLevelCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeReadTransmitPowerLevel) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 3 || len(buf) != 7 {
+		return io.ErrShortBuffer
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.Type = TransmitPowerLevelType(buf[6])
+	return nil
+}
+
+func (p *HCIReadTransmitPowerLevelCommandPacket) Opcode() Opcode {
+	return OpcodeReadTransmitPowerLevel
+}
+
+// ReadTransmitPowerLevel returns the current or maximum transmit power level
+// of the connection in dBm.
+func (c *Conn) ReadTransmitPowerLevel(t TransmitPowerLevelType) (int8, error) {
+	buf, err := c.op(&HCIReadTransmitPowerLevelCommandPacket{ConnectionHandle: c.ConnectionHandle, Type: t})
+	if err != nil {
+		return 0, err
+	}
+	if buf[0] != 0 {
+		return 0, errors.New("command failed")
+	}
+	if len(buf) < 4 {
+		return 0, io.ErrShortBuffer
+	}
+	return int8(buf[3]), nil
+}
+
+// HCIConnectionHandlePHYCommandPacket encompasses the power control commands
+// whose parameters are a connection handle and a PHY.
+type HCIConnectionHandlePHYCommandPacket struct {
+	opcode           Opcode
+	ConnectionHandle uint16
+	PHY              TransmitPowerPHY
+}
+
+func (p *HCIConnectionHandlePHYCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 7)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(p.opcode))
+	buf[3] = 3
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	buf[6] = byte(p.PHY)
+	return buf, nil
+}
+
+func (p *HCIConnectionHandlePHYCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 3 || len(buf) != 7 {
+		return io.ErrShortBuffer
+	}
+	p.opcode = Opcode(binary.LittleEndian.Uint16(buf[1:]))
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.PHY = TransmitPowerPHY(buf[6])
+	return nil
+}
+
+func (p *HCIConnectionHandlePHYCommandPacket) Opcode() Opcode {
+	return p.opcode
+}
+
+// EnhancedReadTransmitPowerLevel returns the current and maximum transmit
+// power levels of the connection on the given PHY in dBm.
+func (c *Conn) EnhancedReadTransmitPowerLevel(phy TransmitPowerPHY) (int8, int8, error) {
+	buf, err := c.op(&HCIConnectionHandlePHYCommandPacket{
+		opcode:           OpcodeLEEnhancedReadTransmitPowerLevel,
+		ConnectionHandle: c.ConnectionHandle,
+		PHY:              phy,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if buf[0] != 0 {
+		return 0, 0, errors.New("command failed")
+	}
+	if len(buf) < 6 {
+		return 0, 0, io.ErrShortBuffer
+	}
+	return int8(buf[4]), int8(buf[5]), nil
+}
+
+// ReadRemoteTransmitPowerLevel returns the peer's transmit power level on the
+// given PHY in dBm, as reported through the LE Power Control procedure.
+func (c *Conn) ReadRemoteTransmitPowerLevel(phy TransmitPowerPHY) (int8, error) {
+	done := make(chan *LETransmitPowerReportingEventPacket, 1)
+	errch := make(chan error, 1)
+	cancel := c.subscribe(func(p Packet, err error) {
+		if err != nil {
+			select {
+			case errch <- err:
+			default:
+			}
+			return
+		}
+		if p, ok := p.(*LETransmitPowerReportingEventPacket); ok && p.ConnectionHandle == c.ConnectionHandle && p.Reason == TransmitPowerReportingReasonReadRemote {
+			select {
+			case done <- p:
+			default:
+			}
+		}
+	})
+	defer cancel()
+
+	if err := c.opStatus(&HCIConnectionHandlePHYCommandPacket{
+		opcode:           OpcodeLEReadRemoteTransmitPowerLevel,
+		ConnectionHandle: c.ConnectionHandle,
+		PHY:              phy,
+	}); err != nil {
+		return 0, err
+	}
+	select {
+	case p := <-done:
+		if p.Status != 0 {
+			return 0, errors.New("read remote transmit power level failed")
+		}
+		return p.TxPowerLevel, nil
+	case err := <-errch:
+		return 0, err
+	case <-c.closed:
+		return 0, c.closeErr
+	}
+}
+
+type HCILESetPathLossReportingParametersCommandPacket struct {
+	ConnectionHandle uint16
+	HighThreshold    uint8
+	HighHysteresis   uint8
+	LowThreshold     uint8
+	LowHysteresis    uint8
+	MinTimeSpent     uint16
+}
+
+func (p *HCILESetPathLossReportingParametersCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 12)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetPathLossReportingParameters))
+	buf[3] = 8
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	buf[6] = p.HighThreshold
+	buf[7] = p.HighHysteresis
+	buf[8] = p.LowThreshold
+	buf[9] = p.LowHysteresis
+	binary.LittleEndian.PutUint16(buf[10:], p.MinTimeSpent)
+	return buf, nil
+}
+
+func (p *HCILESetPathLossReportingParametersCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetPathLossReportingParameters) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 8 || len(buf) != 12 {
+		return io.ErrShortBuffer
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.HighThreshold = buf[6]
+	p.HighHysteresis = buf[7]
+	p.LowThreshold = buf[8]
+	p.LowHysteresis = buf[9]
+	p.MinTimeSpent = binary.LittleEndian.Uint16(buf[10:])
+	return nil
+}
+
+func (p *HCILESetPathLossReportingParametersCommandPacket) Opcode() Opcode {
+	return OpcodeLESetPathLossReportingParameters
+}
+
+// PathLossReportingParameters configures the path loss zones in dB. The
+// minimum time spent is in connection events.
+type PathLossReportingParameters struct {
+	HighThreshold  uint8
+	HighHysteresis uint8
+	LowThreshold   uint8
+	LowHysteresis  uint8
+	MinTimeSpent   uint16
+}
+
+func (c *Conn) SetPathLossReportingParameters(params *PathLossReportingParameters) error {
+	buf, err := c.op(&HCILESetPathLossReportingParametersCommandPacket{
+		ConnectionHandle: c.ConnectionHandle,
+		HighThreshold:    params.HighThreshold,
+		HighHysteresis:   params.HighHysteresis,
+		LowThreshold:     params.LowThreshold,
+		LowHysteresis:    params.LowHysteresis,
+		MinTimeSpent:     params.MinTimeSpent,
+	})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+type HCILESetPathLossReportingEnableCommandPacket struct {
+	ConnectionHandle uint16
+	Enable           bool
+}
+
+func (p *HCILESetPathLossReportingEnableCommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 7)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeLESetPathLossReportingEnable))
+	buf[3] = 3
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	if p.Enable {
+		buf[6] = 1
+	}
+	return buf, nil
+}
+
+func (p *HCILESetPathLossReportingEnableCommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeLESetPathLossReportingEnable) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 3 || len(buf) != 7 {
+		return io.ErrShortBuffer
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.Enable = buf[6] == 1
+	return nil
+}
+
+func (p *HCILESetPathLossReportingEnableCommandPacket) Opcode() Opcode {
+	return OpcodeLESetPathLossReportingEnable
+}
+
+func (c *Conn) SetPathLossReportingEnable(enable bool) error {
+	buf, err := c.op(&HCILESetPathLossReportingEnableCommandPacket{ConnectionHandle: c.ConnectionHandle, Enable: enable})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
+
+type PathLossZone uint8
+
+const (
+	PathLossZoneLow    PathLossZone = 0x00
+	PathLossZoneMiddle PathLossZone = 0x01
+	PathLossZoneHigh   PathLossZone = 0x02
+)
+
+// PathLossUnavailable is reported when the path loss cannot be computed.
+const PathLossUnavailable uint8 = 0xFF
+
+type LEPathLossThresholdEventPacket struct {
+	ConnectionHandle uint16
+	CurrentPathLoss  uint8
+	ZoneEntered      PathLossZone
+}
+
+func (p *LEPathLossThresholdEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 8)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 5
+	buf[3] = byte(LEMetaSubeventCodePathLossThreshold)
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	buf[6] = p.CurrentPathLoss
+	buf[7] = byte(p.ZoneEntered)
+	return buf, nil
+}
+
+func (p *LEPathLossThresholdEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 5 || len(buf) != 8 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodePathLossThreshold) {
+		return errors.New("incorrect subevent")
+	}
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.CurrentPathLoss = buf[6]
+	p.ZoneEntered = PathLossZone(buf[7])
+	return nil
+}
+
+type TransmitPowerReportingReason uint8
+
+const (
+	TransmitPowerReportingReasonLocalChanged  TransmitPowerReportingReason = 0x00
+	TransmitPowerReportingReasonRemoteChanged TransmitPowerReportingReason = 0x01
+	TransmitPowerReportingReasonReadRemote    TransmitPowerReportingReason = 0x02
+)
+
+type LETransmitPowerReportingEventPacket struct {
+	Status           uint8
+	ConnectionHandle uint16
+	Reason           TransmitPowerReportingReason
+	PHY              TransmitPowerPHY
+	TxPowerLevel     int8
+	TxPowerLevelFlag uint8
+	Delta            int8
+}
+
+func (p *LETransmitPowerReportingEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 12)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 9
+	buf[3] = byte(LEMetaSubeventCodeTransmitPowerReporting)
+	buf[4] = p.Status
+	binary.LittleEndian.PutUint16(buf[5:], p.ConnectionHandle)
+	buf[7] = byte(p.Reason)
+	buf[8] = byte(p.PHY)
+	buf[9] = byte(p.TxPowerLevel)
+	buf[10] = p.TxPowerLevelFlag
+	buf[11] = byte(p.Delta)
+	return buf, nil
+}
+
+func (p *LETransmitPowerReportingEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 9 || len(buf) != 12 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeTransmitPowerReporting) {
+		return errors.New("incorrect subevent")
+	}
+	p.Status = buf[4]
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[5:])
+	p.Reason = TransmitPowerReportingReason(buf[7])
+	p.PHY = TransmitPowerPHY(buf[8])
+	p.TxPowerLevel = int8(buf[9])
+	p.TxPowerLevelFlag = buf[10]
+	p.Delta = int8(buf[11])
+	return nil
+}
+
+// LinkQuality is a snapshot of the quality of a connection.
+type LinkQuality struct {
+	Time time.Time
+	// RSSI and TxPowerLevel are in dBm, RSSIUnavailable and
+	// TransmitPowerLevelUnavailable until they have been read.
+	RSSI         int8
+	TxPowerLevel int8
+	// RemoteTxPowerLevel is the peer's transmit power level in dBm as last
+	// reported by LE Power Control, or TransmitPowerLevelUnavailable.
+	RemoteTxPowerLevel int8
+	// PathLoss is the path loss in dB as last reported by path loss
+	// monitoring, or PathLossUnavailable.
+	PathLoss     uint8
+	PathLossZone PathLossZone
+}
+
+// MonitorLinkQuality samples the link quality of the connection every
+// interval. Path loss and transmit power reports from the controller are
+// merged into the samples and also trigger an immediate sample. Once the
+// controller reports the local transmit power level, it is no longer polled.
+// A value that cannot be read keeps its previous value. Samples are dropped if
+// the receiver falls behind. The returned function stops monitoring and
+// closes the channel.
+func (c *Conn) MonitorLinkQuality(interval time.Duration) (<-chan *LinkQuality, func(), error) {
+	if interval <= 0 {
+		return nil, nil, errors.New("invalid link quality interval")
+	}
+	ch := make(chan *LinkQuality, 1)
+	trigger := make(chan struct{}, 1)
+	stop := make(chan struct{})
+
+	q := LinkQuality{
+		RSSI:               RSSIUnavailable,
+		TxPowerLevel:       TransmitPowerLevelUnavailable,
+		RemoteTxPowerLevel: TransmitPowerLevelUnavailable,
+		PathLoss:           PathLossUnavailable,
+	}
+	// txReported is set once the controller reports the local transmit
+	// power level, which is then more current than a polled one.
+	txReported := false
+	var mu sync.Mutex
+	cancel := c.subscribe(func(p Packet, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch p := p.(type) {
+		case *LEPathLossThresholdEventPacket:
+			if p.ConnectionHandle != c.ConnectionHandle {
+				return
+			}
+			q.PathLoss, q.PathLossZone = p.CurrentPathLoss, p.ZoneEntered
+		case *LETransmitPowerReportingEventPacket:
+			if p.ConnectionHandle != c.ConnectionHandle || p.Status != 0 {
+				return
+			}
+			switch p.Reason {
+			case TransmitPowerReportingReasonLocalChanged:
+				q.TxPowerLevel, txReported = p.TxPowerLevel, true
+			default:
+				q.RemoteTxPowerLevel = p.TxPowerLevel
+			}
+		default:
+			return
+		}
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	})
+
+	go func() {
+		defer close(ch)
+		defer cancel()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		// failures are logged once until a read succeeds again.
+		var rssiFailing, txFailing bool
+		for {
+			rssi, err := c.ReadRSSI()
+			if err != nil && !rssiFailing {
+				zap.L().Warn("failed to read rssi", zap.Uint16("handle", c.ConnectionHandle), zap.Error(err))
+			}
+			rssiFailing = err != nil
+			mu.Lock()
+			poll := !txReported
+			mu.Unlock()
+			var tx int8
+			if poll {
+				tx, err = c.ReadTransmitPowerLevel(TransmitPowerLevelTypeCurrent)
+				if err != nil && !txFailing {
+					zap.L().Warn("failed to read transmit power level", zap.Uint16("handle", c.ConnectionHandle), zap.Error(err))
+				}
+				txFailing = err != nil
+			}
+			mu.Lock()
+			q.Time = time.Now()
+			if !rssiFailing {
+				q.RSSI = rssi
+			}
+			if poll && !txFailing && !txReported {
+				q.TxPowerLevel = tx
+			}
+			sample := q
+			mu.Unlock()
+			select {
+			case ch <- &sample:
+			default:
+			}
+			select {
+			case <-stop:
+				return
+			case <-c.closed:
+				return
+			case <-t.C:
+			case <-trigger:
+			}
+		}
+	}()
+	var stopOnce sync.Once
+	return ch, func() { stopOnce.Do(func() { close(stop) }) }, nil
+}
@@ -0,0 +1,66 @@
+package hci_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/muxable/bluetooth/pkg/hci"
+	"github.com/muxable/bluetooth/pkg/hci/hcitest"
+)
+
+func TestMonitorLinkQuality(t *testing.T) {
+	a, c, err := hcitest.NewAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.HandleCommand = func(opcode hci.Opcode, params []byte) []hci.Packet {
+		var ret []byte
+		switch opcode {
+		case hci.OpcodeReadRSSI:
+			// unknown connection identifier.
+			ret = []byte{0x02}
+		case hci.OpcodeReadTransmitPowerLevel:
+			ret = []byte{0, params[0], params[1], 5}
+		default:
+			return nil
+		}
+		return []hci.Packet{&hci.CommandCompleteEventPacket{NumCommandPackets: 1, CommandOpcode: opcode, ReturnParameters: ret}}
+	}
+	defer c.Close()
+	defer a.Close()
+	conn := hcitest.Connect(t, a, c, 1, hci.RolePeripheral)
+
+	if _, _, err := conn.MonitorLinkQuality(0); err == nil {
+		t.Error("MonitorLinkQuality(0) succeeded")
+	}
+	samples, stop, err := conn.MonitorLinkQuality(10 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := <-samples
+	if q.RSSI != hci.RSSIUnavailable || q.TxPowerLevel != 5 {
+		t.Errorf("got rssi %d and tx power level %d, want %d and 5", q.RSSI, q.TxPowerLevel, hci.RSSIUnavailable)
+	}
+
+	if err := c.WritePacket(&hci.LETransmitPowerReportingEventPacket{
+		ConnectionHandle: 1,
+		Reason:           hci.TransmitPowerReportingReasonLocalChanged,
+		TxPowerLevel:     10,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for q.TxPowerLevel != 10 {
+		q = <-samples
+	}
+	// the reported level is not replaced by a polled one.
+	for i := 0; i < 3; i++ {
+		if q = <-samples; q.TxPowerLevel != 10 {
+			t.Fatalf("got tx power level %d after the report, want 10", q.TxPowerLevel)
+		}
+	}
+
+	stop()
+	stop()
+	for range samples {
+	}
+}
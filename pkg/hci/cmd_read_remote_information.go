@@ -0,0 +1,199 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Remote device information, Vol 4, Part E, Sections 7.1.23, 7.8.21, 7.7.12
+// and 7.7.65.4.
+
+type RemoteVersionInformation struct {
+	Version    uint8
+	CompanyID  uint16
+	Subversion uint16
+}
+
+// ReadRemoteVersionInformation returns the link layer version of the peer. The
+// result is cached on the connection since it cannot change.
+func (c *Conn) ReadRemoteVersionInformation() (*RemoteVersionInformation, error) {
+	c.remoteLock.Lock()
+	v := c.remoteVersion
+	c.remoteLock.Unlock()
+	if v != nil {
+		return v, nil
+	}
+	done := make(chan *ReadRemoteVersionInformationCompleteEventPacket, 1)
+	errch := make(chan error, 1)
+	cancel := c.subscribe(func(p Packet, err error) {
+		if err != nil {
+			select {
+			case errch <- err:
+			default:
+			}
+			return
+		}
+		if p, ok := p.(*ReadRemoteVersionInformationCompleteEventPacket); ok && p.ConnectionHandle == c.ConnectionHandle {
+			select {
+			case done <- p:
+			default:
+			}
+		}
+	})
+	defer cancel()
+
+	if err := c.opStatus(NewHCIConnectionHandleCommandPacket(OpcodeReadRemoteVersionInformation, c.ConnectionHandle)); err != nil {
+		return nil, err
+	}
+	var p *ReadRemoteVersionInformationCompleteEventPacket
+	select {
+	case p = <-done:
+	case err := <-errch:
+		return nil, err
+	case <-c.closed:
+		return nil, c.closeErr
+	}
+	if p.Status != 0 {
+		return nil, errors.New("read remote version information failed")
+	}
+	v = &RemoteVersionInformation{
+		Version:    p.Version,
+		CompanyID:  p.CompanyID,
+		Subversion: p.Subversion,
+	}
+	c.remoteLock.Lock()
+	c.remoteVersion = v
+	c.remoteLock.Unlock()
+	return v, nil
+}
+
+// ReadRemoteFeatures returns the LE features supported by the peer. The result
+// is cached on the connection, including when the controller exchanges
+// features on its own after the connection is established.
+func (c *Conn) ReadRemoteFeatures() (LEFeatures, error) {
+	c.remoteLock.Lock()
+	features, ok := c.remoteFeatures, c.remoteFeaturesValid
+	c.remoteLock.Unlock()
+	if ok {
+		return features, nil
+	}
+	done := make(chan *LEReadRemoteFeaturesCompleteEventPacket, 1)
+	errch := make(chan error, 1)
+	cancel := c.subscribe(func(p Packet, err error) {
+		if err != nil {
+			select {
+			case errch <- err:
+			default:
+			}
+			return
+		}
+		if p, ok := p.(*LEReadRemoteFeaturesCompleteEventPacket); ok && p.ConnectionHandle == c.ConnectionHandle {
+			select {
+			case done <- p:
+			default:
+			}
+		}
+	})
+	defer cancel()
+
+	if err := c.opStatus(NewHCIConnectionHandleCommandPacket(OpcodeLEReadRemoteFeatures, c.ConnectionHandle)); err != nil {
+		return 0, err
+	}
+	var p *LEReadRemoteFeaturesCompleteEventPacket
+	select {
+	case p = <-done:
+	case err := <-errch:
+		return 0, err
+	case <-c.closed:
+		return 0, c.closeErr
+	}
+	if p.Status != 0 {
+		return 0, errors.New("read remote features failed")
+	}
+	// the reader caches the features too, see Conn.handle.
+	c.remoteLock.Lock()
+	c.remoteFeatures, c.remoteFeaturesValid = p.LEFeatures, true
+	c.remoteLock.Unlock()
+	return p.LEFeatures, nil
+}
+
+// RemoteSupports reports whether the peer supports all of the features in f,
+// reading them from the peer if they are not yet known.
+func (c *Conn) RemoteSupports(f LEFeatures) (bool, error) {
+	features, err := c.ReadRemoteFeatures()
+	if err != nil {
+		return false, err
+	}
+	return features.Has(f), nil
+}
+
+type ReadRemoteVersionInformationCompleteEventPacket struct {
+	Status           uint8
+	ConnectionHandle uint16
+	Version          uint8
+	CompanyID        uint16
+	Subversion       uint16
+}
+
+func (p *ReadRemoteVersionInformationCompleteEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeReadRemoteVersionInformationComplete) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 8 || len(buf) != 11 {
+		return io.ErrShortBuffer
+	}
+	p.Status = buf[3]
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.Version = buf[6]
+	p.CompanyID = binary.LittleEndian.Uint16(buf[7:])
+	p.Subversion = binary.LittleEndian.Uint16(buf[9:])
+	return nil
+}
+
+func (p *ReadRemoteVersionInformationCompleteEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 11)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeReadRemoteVersionInformationComplete)
+	buf[2] = 8
+	buf[3] = p.Status
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	buf[6] = p.Version
+	binary.LittleEndian.PutUint16(buf[7:], p.CompanyID)
+	binary.LittleEndian.PutUint16(buf[9:], p.Subversion)
+	return buf, nil
+}
+
+type LEReadRemoteFeaturesCompleteEventPacket struct {
+	Status           uint8
+	ConnectionHandle uint16
+	LEFeatures
+}
+
+func (p *LEReadRemoteFeaturesCompleteEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 15)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 12
+	buf[3] = byte(LEMetaSubeventCodeReadRemoteUsedFeaturesComplete)
+	buf[4] = p.Status
+	binary.LittleEndian.PutUint16(buf[5:], p.ConnectionHandle)
+	binary.LittleEndian.PutUint64(buf[7:], uint64(p.LEFeatures))
+	return buf, nil
+}
+
+func (p *LEReadRemoteFeaturesCompleteEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 12 || len(buf) != 15 {
+		return io.ErrShortBuffer
+	}
+	if buf[3] != byte(LEMetaSubeventCodeReadRemoteUsedFeaturesComplete) {
+		return errors.New("incorrect subevent")
+	}
+	p.Status = buf[4]
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[5:])
+	p.LEFeatures = LEFeatures(binary.LittleEndian.Uint64(buf[7:]))
+	return nil
+}
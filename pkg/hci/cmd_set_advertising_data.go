@@ -49,5 +49,8 @@ func (a *Adapter) SetAdvertisingData(data ...DataType) error {
 	if buf1[0] != 0 {
 		return errors.New("command failed")
 	}
+	a.addressLock.Lock()
+	a.advertisingData = data
+	a.addressLock.Unlock()
 	return nil
 }
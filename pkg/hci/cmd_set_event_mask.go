@@ -10,11 +10,12 @@ import (
 type EventMask uint64
 
 const (
-	EventMaskDisconnectionCompleteEvent        EventMask = (1 << 4)
-	EventMaskEncryptionChangeEvent             EventMask = (1 << 7)
-	EventMaskHardwareErrorEvent                EventMask = (1 << 15)
-	EventMaskEncryptionKeyRefreshCompleteEvent EventMask = (1 << 47)
-	EventMaskLEMetaEvent                       EventMask = (1 << 61)
+	EventMaskDisconnectionCompleteEvent                EventMask = (1 << 4)
+	EventMaskEncryptionChangeEvent                     EventMask = (1 << 7)
+	EventMaskReadRemoteVersionInformationCompleteEvent EventMask = (1 << 11)
+	EventMaskHardwareErrorEvent                        EventMask = (1 << 15)
+	EventMaskEncryptionKeyRefreshCompleteEvent         EventMask = (1 << 47)
+	EventMaskLEMetaEvent                               EventMask = (1 << 61)
 )
 
 type HCISetEventMaskCommandPacket struct {
@@ -55,3 +56,49 @@ func (a *Adapter) SetEventMask(mask EventMask) error {
 	}
 	return nil
 }
+
+// EventMaskPage2 is the second page of the event mask, Section 7.3.69.
+type EventMaskPage2 uint64
+
+const (
+	EventMaskPage2EncryptionChangeV2Event EventMaskPage2 = (1 << 25)
+)
+
+type HCISetEventMaskPage2CommandPacket struct {
+	EventMaskPage2
+}
+
+func (p *HCISetEventMaskPage2CommandPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 12)
+	buf[0] = byte(PacketTypeCommand)
+	binary.LittleEndian.PutUint16(buf[1:], uint16(OpcodeSetEventMaskPage2))
+	buf[3] = 8
+	binary.LittleEndian.PutUint64(buf[4:], uint64(p.EventMaskPage2))
+	return buf, nil
+}
+
+func (p *HCISetEventMaskPage2CommandPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeCommand) || binary.LittleEndian.Uint16(buf[1:]) != uint16(OpcodeSetEventMaskPage2) {
+		return errors.New("incorrect packet")
+	}
+	if buf[3] != 8 || len(buf) != 12 {
+		return io.ErrShortBuffer
+	}
+	p.EventMaskPage2 = EventMaskPage2(binary.LittleEndian.Uint64(buf[4:]))
+	return nil
+}
+
+func (p *HCISetEventMaskPage2CommandPacket) Opcode() Opcode {
+	return OpcodeSetEventMaskPage2
+}
+
+func (a *Adapter) SetEventMaskPage2(mask EventMaskPage2) error {
+	buf, err := a.op(&HCISetEventMaskPage2CommandPacket{EventMaskPage2: mask})
+	if err != nil {
+		return err
+	}
+	if buf[0] != 0 {
+		return errors.New("command failed")
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package hci
+
+import "sort"
+
+// Connections returns the open connections ordered by handle.
+func (a *Adapter) Connections() []*Conn {
+	a.connsLock.Lock()
+	conns := make([]*Conn, 0, len(a.conns))
+	for _, c := range a.conns {
+		conns = append(conns, c)
+	}
+	a.connsLock.Unlock()
+	sort.Slice(conns, func(i, j int) bool { return conns[i].ConnectionHandle < conns[j].ConnectionHandle })
+	return conns
+}
+
+// Connection returns the open connection with the given handle.
+func (a *Adapter) Connection(handle uint16) (*Conn, bool) {
+	a.connsLock.Lock()
+	defer a.connsLock.Unlock()
+	c, ok := a.conns[handle]
+	return c, ok
+}
+
+// ConnectionByAddress returns the open connection to a peer, matching either
+// the address it connected with or its resolved identity address.
+func (a *Adapter) ConnectionByAddress(addrType PeerAddressType, addr BDAddr) (*Conn, bool) {
+	switch addrType {
+	case PeerAddressTypePublicIdentityAddress:
+		addrType = PeerAddressTypePublicDeviceAddress
+	case PeerAddressTypeRandomIdentityAddress:
+		addrType = PeerAddressTypeRandomDeviceAddress
+	}
+	a.connsLock.Lock()
+	defer a.connsLock.Unlock()
+	for _, c := range a.conns {
+		if c.PeerAddress == addr && c.PeerAddressType == addrType {
+			return c, true
+		}
+		if c.PeerIdentityAddress == addr && c.PeerIdentityAddressType == addrType {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// route hands connection-scoped events to the connection they belong to
+// before they are broadcast.
+func (a *Adapter) route(p Packet) {
+	var handle uint16
+	switch p := p.(type) {
+	case *DisconnectionCompleteEventPacket:
+		handle = p.ConnectionHandle
+	case *LEPHYUpdateCompleteEventPacket:
+		handle = p.ConnectionHandle
+	case *LEConnectionUpdateCompleteEventPacket:
+		handle = p.ConnectionHandle
+	case *LERemoteConnectionParameterRequestEventPacket:
+		handle = p.ConnectionHandle
+	case *LEReadRemoteFeaturesCompleteEventPacket:
+		handle = p.ConnectionHandle
+	case *LEDataLengthChangeEventPacket:
+		handle = p.ConnectionHandle
+	case *LELongTermKeyRequestEventPacket:
+		handle = p.ConnectionHandle
+	case *EncryptionChangeEventPacket:
+		handle = p.ConnectionHandle
+	case *LECISRequestEventPacket:
+		handle = p.ACLConnectionHandle
+	default:
+		return
+	}
+	if c, ok := a.Connection(handle); ok {
+		c.handle(p)
+	}
+}
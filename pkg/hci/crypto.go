@@ -0,0 +1,171 @@
+package hci
+
+import (
+	"crypto/aes"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"sync"
+)
+
+// P256PublicKey is a P-256 public key, its X and then its Y coordinate, each
+// in little endian order as sent over HCI and SMP.
+type P256PublicKey [64]byte
+
+// DHKey is a P-256 Diffie-Hellman key in little endian order.
+type DHKey [32]byte
+
+// CryptoProvider supplies the primitives of the security toolbox, Vol 3,
+// Part H, Section 2.2. It is implemented by the controller, see
+// ControllerCrypto, and in pure Go by SoftwareCrypto, so that security code
+// runs against either. Keys and data are in little endian order.
+type CryptoProvider interface {
+	// Rand returns a random number.
+	Rand() (uint64, error)
+	// Encrypt is the security function e, AES-128.
+	Encrypt(key, plaintext [16]byte) ([16]byte, error)
+	// P256PublicKey generates a new P-256 key pair and returns its public
+	// key.
+	P256PublicKey() (P256PublicKey, error)
+	// DHKey computes the Diffie-Hellman key of a remote public key and the
+	// private key of the last key pair generated.
+	DHKey(remote P256PublicKey) (DHKey, error)
+}
+
+// debugPrivateKey and debugPublicKey are the P-256 debug key pair, Vol 3,
+// Part H, Section 2.3.5.6.1, in big endian order.
+var (
+	debugPrivateKey = [32]byte{
+		0x3f, 0x49, 0xf6, 0xd4, 0xa3, 0xc5, 0x5f, 0x38, 0x74, 0xc9, 0xb3, 0xe3, 0xd2, 0x10, 0x3f, 0x50,
+		0x4a, 0xff, 0x60, 0x7b, 0xeb, 0x40, 0xb7, 0x99, 0x58, 0x99, 0xb8, 0xa6, 0xcd, 0x3c, 0x1a, 0xbd,
+	}
+	debugPublicKeyX = [32]byte{
+		0x20, 0xb0, 0x03, 0xd2, 0xf2, 0x97, 0xbe, 0x2c, 0x5e, 0x2c, 0x83, 0xa7, 0xe9, 0xf9, 0xa5, 0xb9,
+		0xef, 0xf4, 0x91, 0x11, 0xac, 0xf4, 0xfd, 0xdb, 0xcc, 0x03, 0x01, 0x48, 0x0e, 0x35, 0x9d, 0xe6,
+	}
+	debugPublicKeyY = [32]byte{
+		0xdc, 0x80, 0x9c, 0x49, 0x65, 0x2a, 0xeb, 0x6d, 0x63, 0x32, 0x9a, 0xbf, 0x5a, 0x52, 0x15, 0x5c,
+		0x76, 0x63, 0x45, 0xc2, 0x8f, 0xed, 0x30, 0x24, 0x74, 0x1c, 0x8e, 0xd0, 0x15, 0x89, 0xd2, 0x8b,
+	}
+)
+
+// reverse returns b in the opposite byte order.
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
+
+// DebugP256PublicKey returns the public key of the P-256 debug key pair.
+func DebugP256PublicKey() P256PublicKey {
+	var k P256PublicKey
+	copy(k[:32], reverse(debugPublicKeyX[:]))
+	copy(k[32:], reverse(debugPublicKeyY[:]))
+	return k
+}
+
+// ControllerCrypto implements CryptoProvider with the controller's LE Rand,
+// LE Encrypt, LE Read Local P-256 Public Key and LE Generate DHKey commands.
+type ControllerCrypto struct {
+	*Adapter
+
+	// UseDebugKey makes DHKey use the debug private key, which requires
+	// LE Generate DHKey [v2]. P256PublicKey then returns the debug public
+	// key.
+	UseDebugKey bool
+}
+
+func (c *ControllerCrypto) Rand() (uint64, error) {
+	return c.LERand()
+}
+
+func (c *ControllerCrypto) Encrypt(key, plaintext [16]byte) ([16]byte, error) {
+	return c.LEEncrypt(key, plaintext)
+}
+
+func (c *ControllerCrypto) P256PublicKey() (P256PublicKey, error) {
+	if c.UseDebugKey {
+		return DebugP256PublicKey(), nil
+	}
+	return c.LEReadLocalP256PublicKey()
+}
+
+func (c *ControllerCrypto) DHKey(remote P256PublicKey) (DHKey, error) {
+	if c.UseDebugKey {
+		return c.LEGenerateDHKeyV2(remote, DHKeyTypeDebug)
+	}
+	return c.LEGenerateDHKey(remote)
+}
+
+// SoftwareCrypto implements CryptoProvider in pure Go, for hosts whose
+// controller lacks the commands or to keep the work off the controller.
+type SoftwareCrypto struct {
+	// UseDebugKey makes the debug key pair stand in for generated ones.
+	UseDebugKey bool
+
+	mu         sync.Mutex
+	privateKey []byte
+}
+
+func (c *SoftwareCrypto) Rand() (uint64, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b[:]), nil
+}
+
+func (c *SoftwareCrypto) Encrypt(key, plaintext [16]byte) ([16]byte, error) {
+	var data [16]byte
+	b, err := aes.NewCipher(reverse(key[:]))
+	if err != nil {
+		return data, err
+	}
+	out := make([]byte, 16)
+	b.Encrypt(out, reverse(plaintext[:]))
+	copy(data[:], reverse(out))
+	return data, nil
+}
+
+func (c *SoftwareCrypto) P256PublicKey() (P256PublicKey, error) {
+	if c.UseDebugKey {
+		return DebugP256PublicKey(), nil
+	}
+	d, x, y, err := elliptic.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return P256PublicKey{}, err
+	}
+	c.mu.Lock()
+	c.privateKey = d
+	c.mu.Unlock()
+	var k P256PublicKey
+	copy(k[:32], reverse(x.FillBytes(make([]byte, 32))))
+	copy(k[32:], reverse(y.FillBytes(make([]byte, 32))))
+	return k, nil
+}
+
+func (c *SoftwareCrypto) DHKey(remote P256PublicKey) (DHKey, error) {
+	d := debugPrivateKey[:]
+	if !c.UseDebugKey {
+		c.mu.Lock()
+		d = c.privateKey
+		c.mu.Unlock()
+		if d == nil {
+			return DHKey{}, errors.New("no local p-256 key pair")
+		}
+	}
+	curve := elliptic.P256()
+	x := new(big.Int).SetBytes(reverse(remote[:32]))
+	y := new(big.Int).SetBytes(reverse(remote[32:]))
+	if !curve.IsOnCurve(x, y) {
+		return DHKey{}, errors.New("invalid public key")
+	}
+	k, _ := curve.ScalarMult(x, y, d)
+	var key DHKey
+	copy(key[:], reverse(k.FillBytes(make([]byte, 32))))
+	return key, nil
+}
@@ -0,0 +1,123 @@
+package hci_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/muxable/bluetooth/pkg/hci"
+)
+
+// le decodes a hex string written most significant byte first, as in the
+// specification's sample data, into little endian order.
+func le(tb testing.TB, s string) []byte {
+	tb.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b
+}
+
+func publicKey(tb testing.TB, x, y string) hci.P256PublicKey {
+	var k hci.P256PublicKey
+	copy(k[:32], le(tb, x))
+	copy(k[32:], le(tb, y))
+	return k
+}
+
+func TestSoftwareCryptoEncrypt(t *testing.T) {
+	for _, tc := range []struct {
+		name                 string
+		key, plaintext, want string
+	}{
+		// FIPS-197, Appendix C.1.
+		{"fips-197", "000102030405060708090a0b0c0d0e0f", "00112233445566778899aabbccddeeff", "69c4e0d86a7b0430d8cdb78070b4c55a"},
+		// the random address hash function ah, Vol 3, Part H, Appendix D.7.
+		{"ah", "ec0234a357c8ad05341010a60a397d9b", "00000000000000000000000000708194", "159d5fb72ebe2311a48c1bdcc40dfbaa"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var key, plaintext [16]byte
+			copy(key[:], le(t, tc.key))
+			copy(plaintext[:], le(t, tc.plaintext))
+			got, err := (&hci.SoftwareCrypto{}).Encrypt(key, plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := le(t, tc.want); !bytes.Equal(got[:], want) {
+				t.Errorf("e = %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestSoftwareCryptoDebugKey(t *testing.T) {
+	c := &hci.SoftwareCrypto{UseDebugKey: true}
+	k, err := c.P256PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k != hci.DebugP256PublicKey() {
+		t.Errorf("public key = %x, want the debug public key", k)
+	}
+
+	// the debug private key times the generator is the debug public key.
+	g := publicKey(t,
+		"6b17d1f2e12c4247f8bce6e563a440f277037d812deb33a0f4a13945d898c296",
+		"4fe342e2fe1a7f9b8ee7eb4a7c0f9e162bce33576b315ececbb6406837bf51f5")
+	dh, err := c.DHKey(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := hci.DebugP256PublicKey(); !bytes.Equal(dh[:], want[:32]) {
+		t.Errorf("DHKey(G) = %x, want %x", dh, want[:32])
+	}
+
+	// the P-256 sample data, Vol 3, Part H, Section 2.3.5.6.1, whose
+	// private key A is the debug private key.
+	b := publicKey(t,
+		"1ea1f0f01faf1d9609592284f19e4c0047b58afd8615a69f559077b22faaa190",
+		"4c55f33e429dad377356703a9ab85160472d1130e28e36765f89aff915b1214a")
+	dh, err = c.DHKey(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := le(t, "ec0234a357c8ad05341010a60a397d9b99796b13b4f866f1868d34f373bfa698"); !bytes.Equal(dh[:], want) {
+		t.Errorf("DHKey(B) = %x, want %x", dh, want)
+	}
+}
+
+func TestSoftwareCryptoDHKey(t *testing.T) {
+	a, b := &hci.SoftwareCrypto{}, &hci.SoftwareCrypto{}
+	if _, err := a.DHKey(hci.DebugP256PublicKey()); err == nil {
+		t.Error("DHKey() without a key pair succeeded")
+	}
+	pa, err := a.P256PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err := b.P256PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ka, err := a.DHKey(pb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := b.DHKey(pa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ka != kb {
+		t.Errorf("DHKey() = %x and %x, want equal keys", ka, kb)
+	}
+
+	invalid := pb
+	invalid[0] ^= 1
+	if _, err := a.DHKey(invalid); err == nil {
+		t.Error("DHKey() with a point off the curve succeeded")
+	}
+}
@@ -0,0 +1,163 @@
+package hci
+
+// LEFeatures is the LE feature mask, Vol 6, Part B, Section 4.6.
+type LEFeatures uint64
+
+const (
+	LEFeaturesEncryption                                 LEFeatures = (1 << 0)
+	LEFeaturesConnectionParametersRequestProcedure       LEFeatures = (1 << 1)
+	LEFeaturesExtendedRejectIndication                   LEFeatures = (1 << 2)
+	LEFeaturesPeripheralInitiatedFeaturesExchange        LEFeatures = (1 << 3)
+	LEFeaturesPing                                       LEFeatures = (1 << 4)
+	LEFeaturesDataPacketLengthExtension                  LEFeatures = (1 << 5)
+	LEFeaturesLLPrivacy                                  LEFeatures = (1 << 6)
+	LEFeaturesExtendedScanningFilterPolicies             LEFeatures = (1 << 7)
+	LEFeatures2MPHY                                      LEFeatures = (1 << 8)
+	LEFeaturesStableModulationIndexTransmitter           LEFeatures = (1 << 9)
+	LEFeaturesStableModulationIndexReceiver              LEFeatures = (1 << 10)
+	LEFeaturesCodedPHY                                   LEFeatures = (1 << 11)
+	LEFeaturesExtendedAdvertising                        LEFeatures = (1 << 12)
+	LEFeaturesPeriodicAdvertising                        LEFeatures = (1 << 13)
+	LEFeaturesChannelSelectionAlgorithm2                 LEFeatures = (1 << 14)
+	LEFeaturesPowerClass1                                LEFeatures = (1 << 15)
+	LEFeaturesMinimumNumberOfUsedChannelsProcedure       LEFeatures = (1 << 16)
+	LEFeaturesConnectionCTERequest                       LEFeatures = (1 << 17)
+	LEFeaturesConnectionCTEResponse                      LEFeatures = (1 << 18)
+	LEFeaturesConnectionlessCTETransmitter               LEFeatures = (1 << 19)
+	LEFeaturesConnectionlessCTEReceiver                  LEFeatures = (1 << 20)
+	LEFeaturesAntennaSwitchingDuringCTETransmission      LEFeatures = (1 << 21)
+	LEFeaturesAntennaSwitchingDuringCTEReception         LEFeatures = (1 << 22)
+	LEFeaturesReceivingConstantToneExtensions            LEFeatures = (1 << 23)
+	LEFeaturesPeriodicAdvertisingSyncTransferSender      LEFeatures = (1 << 24)
+	LEFeaturesPeriodicAdvertisingSyncTransferRecipient   LEFeatures = (1 << 25)
+	LEFeaturesSleepClockAccuracyUpdates                  LEFeatures = (1 << 26)
+	LEFeaturesRemotePublicKeyValidation                  LEFeatures = (1 << 27)
+	LEFeaturesConnectedIsochronousStreamCentral          LEFeatures = (1 << 28)
+	LEFeaturesConnectedIsochronousStreamPeripheral       LEFeatures = (1 << 29)
+	LEFeaturesIsochronousBroadcaster                     LEFeatures = (1 << 30)
+	LEFeaturesSynchronizedReceiver                       LEFeatures = (1 << 31)
+	LEFeaturesConnectedIsochronousStreamHostSupport      LEFeatures = (1 << 32)
+	LEFeaturesPowerControlRequest                        LEFeatures = (1 << 33)
+	LEFeaturesPathLossMonitoring                         LEFeatures = (1 << 35)
+	LEFeaturesPeriodicAdvertisingADISupport              LEFeatures = (1 << 36)
+	LEFeaturesConnectionSubrating                        LEFeatures = (1 << 37)
+	LEFeaturesConnectionSubratingHostSupport             LEFeatures = (1 << 38)
+	LEFeaturesChannelClassification                      LEFeatures = (1 << 39)
+	LEFeaturesPeriodicAdvertisingWithResponsesAdvertiser LEFeatures = (1 << 43)
+	LEFeaturesPeriodicAdvertisingWithResponsesScanner    LEFeatures = (1 << 44)
+)
+
+// Has reports whether all of the features in f are set.
+func (l LEFeatures) Has(f LEFeatures) bool {
+	return l&f == f
+}
+
+// LESupportedStates is the mask of states and state combinations supported by
+// the link layer, Vol 4, Part E, Section 7.8.27.
+type LESupportedStates uint64
+
+const (
+	LESupportedStatesNonConnectableAdvertising                          LESupportedStates = (1 << 0)
+	LESupportedStatesScannableAdvertising                               LESupportedStates = (1 << 1)
+	LESupportedStatesConnectableAdvertising                             LESupportedStates = (1 << 2)
+	LESupportedStatesHighDutyCycleDirectedAdvertising                   LESupportedStates = (1 << 3)
+	LESupportedStatesPassiveScanning                                    LESupportedStates = (1 << 4)
+	LESupportedStatesActiveScanning                                     LESupportedStates = (1 << 5)
+	LESupportedStatesInitiating                                         LESupportedStates = (1 << 6)
+	LESupportedStatesPeripheral                                         LESupportedStates = (1 << 7)
+	LESupportedStatesNonConnectableAdvertisingAndPassiveScanning        LESupportedStates = (1 << 8)
+	LESupportedStatesScannableAdvertisingAndPassiveScanning             LESupportedStates = (1 << 9)
+	LESupportedStatesConnectableAdvertisingAndPassiveScanning           LESupportedStates = (1 << 10)
+	LESupportedStatesHighDutyCycleDirectedAdvertisingAndPassiveScanning LESupportedStates = (1 << 11)
+	LESupportedStatesNonConnectableAdvertisingAndActiveScanning         LESupportedStates = (1 << 12)
+	LESupportedStatesScannableAdvertisingAndActiveScanning              LESupportedStates = (1 << 13)
+	LESupportedStatesConnectableAdvertisingAndActiveScanning            LESupportedStates = (1 << 14)
+	LESupportedStatesHighDutyCycleDirectedAdvertisingAndActiveScanning  LESupportedStates = (1 << 15)
+	LESupportedStatesNonConnectableAdvertisingAndInitiating             LESupportedStates = (1 << 16)
+	LESupportedStatesScannableAdvertisingAndInitiating                  LESupportedStates = (1 << 17)
+	LESupportedStatesNonConnectableAdvertisingAndCentral                LESupportedStates = (1 << 18)
+	LESupportedStatesScannableAdvertisingAndCentral                     LESupportedStates = (1 << 19)
+	LESupportedStatesNonConnectableAdvertisingAndPeripheral             LESupportedStates = (1 << 20)
+	LESupportedStatesScannableAdvertisingAndPeripheral                  LESupportedStates = (1 << 21)
+	LESupportedStatesPassiveScanningAndInitiating                       LESupportedStates = (1 << 22)
+	LESupportedStatesActiveScanningAndInitiating                        LESupportedStates = (1 << 23)
+	LESupportedStatesPassiveScanningAndCentral                          LESupportedStates = (1 << 24)
+	LESupportedStatesActiveScanningAndCentral                           LESupportedStates = (1 << 25)
+	LESupportedStatesPassiveScanningAndPeripheral                       LESupportedStates = (1 << 26)
+	LESupportedStatesActiveScanningAndPeripheral                        LESupportedStates = (1 << 27)
+	LESupportedStatesInitiatingAndCentral                               LESupportedStates = (1 << 28)
+	LESupportedStatesLowDutyCycleDirectedAdvertising                    LESupportedStates = (1 << 29)
+	LESupportedStatesLowDutyCycleDirectedAdvertisingAndPassiveScanning  LESupportedStates = (1 << 30)
+	LESupportedStatesLowDutyCycleDirectedAdvertisingAndActiveScanning   LESupportedStates = (1 << 31)
+	LESupportedStatesConnectableAdvertisingAndInitiating                LESupportedStates = (1 << 32)
+	LESupportedStatesHighDutyCycleDirectedAdvertisingAndInitiating      LESupportedStates = (1 << 33)
+	LESupportedStatesLowDutyCycleDirectedAdvertisingAndInitiating       LESupportedStates = (1 << 34)
+	LESupportedStatesConnectableAdvertisingAndCentral                   LESupportedStates = (1 << 35)
+	LESupportedStatesHighDutyCycleDirectedAdvertisingAndCentral         LESupportedStates = (1 << 36)
+	LESupportedStatesLowDutyCycleDirectedAdvertisingAndCentral          LESupportedStates = (1 << 37)
+	LESupportedStatesConnectableAdvertisingAndPeripheral                LESupportedStates = (1 << 38)
+	LESupportedStatesHighDutyCycleDirectedAdvertisingAndPeripheral      LESupportedStates = (1 << 39)
+	LESupportedStatesLowDutyCycleDirectedAdvertisingAndPeripheral       LESupportedStates = (1 << 40)
+	LESupportedStatesInitiatingAndPeripheral                            LESupportedStates = (1 << 41)
+)
+
+var leSupportedStatesNames = [...]string{
+	"non-connectable advertising",
+	"scannable advertising",
+	"connectable advertising",
+	"high duty cycle directed advertising",
+	"passive scanning",
+	"active scanning",
+	"initiating",
+	"peripheral",
+	"non-connectable advertising and passive scanning",
+	"scannable advertising and passive scanning",
+	"connectable advertising and passive scanning",
+	"high duty cycle directed advertising and passive scanning",
+	"non-connectable advertising and active scanning",
+	"scannable advertising and active scanning",
+	"connectable advertising and active scanning",
+	"high duty cycle directed advertising and active scanning",
+	"non-connectable advertising and initiating",
+	"scannable advertising and initiating",
+	"non-connectable advertising and central",
+	"scannable advertising and central",
+	"non-connectable advertising and peripheral",
+	"scannable advertising and peripheral",
+	"passive scanning and initiating",
+	"active scanning and initiating",
+	"passive scanning and central",
+	"active scanning and central",
+	"passive scanning and peripheral",
+	"active scanning and peripheral",
+	"initiating and central",
+	"low duty cycle directed advertising",
+	"low duty cycle directed advertising and passive scanning",
+	"low duty cycle directed advertising and active scanning",
+	"connectable advertising and initiating",
+	"high duty cycle directed advertising and initiating",
+	"low duty cycle directed advertising and initiating",
+	"connectable advertising and central",
+	"high duty cycle directed advertising and central",
+	"low duty cycle directed advertising and central",
+	"connectable advertising and peripheral",
+	"high duty cycle directed advertising and peripheral",
+	"low duty cycle directed advertising and peripheral",
+	"initiating and peripheral",
+}
+
+// Has reports whether all of the states in s are supported.
+func (l LESupportedStates) Has(s LESupportedStates) bool {
+	return l&s == s
+}
+
+// Names returns the names of the supported states and state combinations.
+func (l LESupportedStates) Names() []string {
+	var names []string
+	for i, name := range leSupportedStatesNames {
+		if l&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
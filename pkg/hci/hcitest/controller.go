@@ -0,0 +1,236 @@
+// Package hcitest provides an in-memory controller for testing and
+// benchmarking code built on hci.Adapter without a Bluetooth device.
+package hcitest
+
+import (
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/muxable/bluetooth/pkg/hci"
+)
+
+// ACLPackets is the number of ACL buffers the controller lends the adapter.
+const ACLPackets = 8
+
+// Controller is the far end of an adapter's socket. It acknowledges the ACL
+// data it receives with Number Of Completed Packets, completes disconnections,
+// describes an LE controller supporting every command to the reads of
+// Adapter.Init and answers every other command with a successful Command
+// Complete event.
+type Controller struct {
+	// HandleCommand, if set, answers commands in place of the defaults. It
+	// returns the events to send, or nil to use the default answer. It must be
+	// set before the adapter sends its first command.
+	HandleCommand func(opcode hci.Opcode, params []byte) []hci.Packet
+	// HandleACL, if set, is called with every ACL data packet received,
+	// before it is acknowledged.
+	HandleACL func(handle uint16, payload []byte)
+
+	socket *hci.Socket
+	done   chan struct{}
+
+	lock sync.Mutex
+	err  error
+}
+
+// NewController returns a running controller and the socket an adapter uses
+// to reach it.
+func NewController() (*hci.Socket, *Controller, error) {
+	host, peer, err := hci.NewSocketPair()
+	if err != nil {
+		return nil, nil, err
+	}
+	c := &Controller{socket: peer, done: make(chan struct{})}
+	go c.serve()
+	return host, c, nil
+}
+
+// NewAdapter returns an adapter connected to a new controller. The adapter
+// owns ACLPackets controller buffers but is otherwise uninitialized.
+func NewAdapter() (*hci.Adapter, *Controller, error) {
+	s, c, err := NewController()
+	if err != nil {
+		return nil, nil, err
+	}
+	a := hci.NewConn(s)
+	a.ACLPacketsRemainingCond.L.Lock()
+	a.ACLPacketsRemaining = ACLPackets
+	a.ACLPacketsRemainingCond.L.Unlock()
+	return a, c, nil
+}
+
+// Connect reports a new connection to the adapter.
+func (c *Controller) Connect(handle uint16, role hci.Role) error {
+	return c.WritePacket(&hci.LEConnectionCompleteEventPacket{
+		ConnectionHandle:   handle,
+		Role:               role,
+		ConnectionInterval: 0x0018,
+		SupervisionTimeout: 0x0048,
+	})
+}
+
+// Connect reports a connection to a from c and returns it once the adapter
+// has registered it.
+func Connect(tb testing.TB, a *hci.Adapter, c *Controller, handle uint16, role hci.Role) *hci.Conn {
+	tb.Helper()
+	if err := c.Connect(handle, role); err != nil {
+		tb.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, conn := range a.Connections() {
+			if conn.ConnectionHandle == handle {
+				return conn
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	tb.Fatalf("connection 0x%04x was not registered", handle)
+	return nil
+}
+
+// WritePacket sends a packet to the adapter.
+func (c *Controller) WritePacket(p hci.Packet) error {
+	return c.socket.WritePacket(p)
+}
+
+// Write sends a marshalled packet to the adapter.
+func (c *Controller) Write(buf []byte) (int, error) {
+	return c.socket.Write(buf)
+}
+
+// Close disconnects the controller from the adapter, whose reads then fail
+// with io.EOF, and waits for the controller to stop.
+func (c *Controller) Close() error {
+	err := c.socket.Close()
+	<-c.done
+	return err
+}
+
+// Err returns the error that stopped the controller, if any.
+func (c *Controller) Err() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.err
+}
+
+func (c *Controller) serve() {
+	defer close(c.done)
+	buf := make([]byte, 0xFFFF+5)
+	for {
+		n, err := c.socket.Read(buf)
+		if err == nil && n > 0 {
+			err = c.handle(buf[:n])
+		}
+		if err != nil {
+			c.lock.Lock()
+			c.err = err
+			c.lock.Unlock()
+			return
+		}
+	}
+}
+
+func (c *Controller) handle(buf []byte) error {
+	switch hci.PacketType(buf[0]) {
+	case hci.PacketTypeACLData:
+		if len(buf) < 5 {
+			return nil
+		}
+		handle := binary.LittleEndian.Uint16(buf[1:]) & 0x0FFF
+		if c.HandleACL != nil {
+			c.HandleACL(handle, buf[5:])
+		}
+		return c.WritePacket(&hci.NumberOfCompletedPacketsEventPacket{
+			NumHandles:          1,
+			ConnectionHandles:   []uint16{handle},
+			NumCompletedPackets: []uint16{1},
+		})
+	case hci.PacketTypeCommand:
+		if len(buf) < 4 {
+			return nil
+		}
+		opcode := hci.Opcode(binary.LittleEndian.Uint16(buf[1:]))
+		params := buf[4:]
+		var events []hci.Packet
+		if c.HandleCommand != nil {
+			events = c.HandleCommand(opcode, params)
+		}
+		if events == nil {
+			events = answer(opcode, params)
+		}
+		for _, p := range events {
+			if err := c.WritePacket(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// answer returns the default events for a command.
+func answer(opcode hci.Opcode, params []byte) []hci.Packet {
+	switch opcode {
+	case hci.OpcodeDisconnect:
+		if len(params) < 3 {
+			break
+		}
+		return []hci.Packet{
+			&hci.CommandStatusEventPacket{NumCommandPackets: 1, CommandOpcode: opcode},
+			&hci.DisconnectionCompleteEventPacket{
+				ConnectionHandle: binary.LittleEndian.Uint16(params),
+				// the local host terminated the connection.
+				Reason: 0x16,
+			},
+		}
+	case hci.OpcodeHostNumberOfCompletedPackets:
+		// the command has no response.
+		return []hci.Packet{}
+	}
+	return []hci.Packet{&hci.CommandCompleteEventPacket{
+		NumCommandPackets: 1,
+		CommandOpcode:     opcode,
+		ReturnParameters:  append([]byte{0}, returnParameters(opcode)...),
+	}}
+}
+
+// BDAddr is the public address of the controller.
+var BDAddr = hci.BDAddr{0x01, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+// returnParameters returns the parameters following the status in the
+// answer to the commands that read the controller's capabilities or return
+// more than a status.
+func returnParameters(opcode hci.Opcode) []byte {
+	switch opcode {
+	case hci.OpcodeReadLocalVersionInformation:
+		// Bluetooth 5.4 by an unassigned company.
+		return []byte{0x0D, 0x00, 0x00, 0x0D, 0xFF, 0xFF, 0x00, 0x00}
+	case hci.OpcodeReadLocalSupportedCommands:
+		commands := make([]byte, 64)
+		for i := range commands {
+			commands[i] = 0xFF
+		}
+		return commands
+	case hci.OpcodeReadLocalSupportedFeatures:
+		features := make([]byte, 8)
+		binary.LittleEndian.PutUint64(features, uint64(hci.LMPFeaturesLESupportedController|hci.LMPFeaturesBREDRNotSupported))
+		return features
+	case hci.OpcodeLEReadLocalSupportedFeatures, hci.OpcodeLEReadSupportedStates:
+		return make([]byte, 8)
+	case hci.OpcodeReadBDAddr:
+		return BDAddr[:]
+	case hci.OpcodeLEReadBufferSize:
+		return []byte{0xFB, 0x00, ACLPackets}
+	case hci.OpcodeLEReadBufferSizeV2:
+		// no ISO buffers.
+		return []byte{0xFB, 0x00, ACLPackets, 0x00, 0x00, 0x00}
+	case hci.OpcodeReadFilterAcceptListSize:
+		return []byte{16}
+	case hci.OpcodeLESetExtendedAdvertisingParameters:
+		// the selected transmit power.
+		return []byte{0}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package hcitest
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// CheckLeaks fails tb if goroutines running code of this module, other than
+// those of tests, are still alive after a grace period. Tests that use it must
+// not run in parallel.
+func CheckLeaks(tb testing.TB) {
+	tb.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		leaked := leakedGoroutines()
+		if len(leaked) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			tb.Errorf("%d goroutines leaked:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func leakedGoroutines() []string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	var leaked []string
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		// the test's own goroutine runs under tRunner.
+		if strings.Contains(g, "github.com/muxable/bluetooth/") && !strings.Contains(g, "testing.tRunner") {
+			leaked = append(leaked, g)
+		}
+	}
+	return leaked
+}
@@ -0,0 +1,307 @@
+package hci
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// DefaultEventMask enables the events handled by this package.
+const DefaultEventMask = EventMaskDisconnectionCompleteEvent |
+	EventMaskEncryptionChangeEvent |
+	EventMaskReadRemoteVersionInformationCompleteEvent |
+	EventMaskHardwareErrorEvent |
+	EventMaskEncryptionKeyRefreshCompleteEvent |
+	EventMaskLEMetaEvent
+
+// DefaultLEEventMask enables the LE events handled by this package.
+const DefaultLEEventMask = LEEventMaskConnectionCompleteEvent |
+	LEEventMaskAdvertisingReportEvent |
+	LEEventMaskConnectionUpdateCompleteEvent |
+	LEEventMaskReadRemoteUsedFeaturesCompleteEvent |
+	LEEventMaskLongTermKeyRequestEvent |
+	LEEventMaskRemoteConnectionParameterRequestEvent |
+	LEEventMaskDataLengthChangeEvent |
+	LEEventMaskReadLocalP256PublicKeyCompleteEvent |
+	LEEventMaskGenerateDHKeyCompleteEvent |
+	LEEventMaskEnhancedConnectionCompleteEvent |
+	LEEventMaskPHYUpdateCompleteEvent |
+	LEEventMaskExtendedAdvertisingReportEvent |
+	LEEventMaskPeriodicAdvertisingSyncEstablishedEvent |
+	LEEventMaskPeriodicAdvertisingReportEvent |
+	LEEventMaskPeriodicAdvertisingSyncLostEvent |
+	LEEventMaskScanTimeoutEvent |
+	LEEventMaskAdvertisingSetTerminatedEvent |
+	LEEventMaskCISEstablishedEvent |
+	LEEventMaskCISRequestEvent |
+	LEEventMaskCreateBIGCompleteEvent |
+	LEEventMaskTerminateBIGCompleteEvent |
+	LEEventMaskBIGSyncEstablishedEvent |
+	LEEventMaskBIGSyncLostEvent |
+	LEEventMaskPathLossThresholdEvent |
+	LEEventMaskTransmitPowerReportingEvent |
+	LEEventMaskBIGInfoAdvertisingReportEvent |
+	LEEventMaskPeriodicAdvertisingReportV2Event |
+	LEEventMaskPeriodicAdvertisingSubeventDataRequestEvent |
+	LEEventMaskPeriodicAdvertisingResponseReportEvent |
+	LEEventMaskEnhancedConnectionCompleteV2Event
+
+type InitOptions struct {
+	// EventMask and LEEventMask default to DefaultEventMask and
+	// DefaultLEEventMask.
+	EventMask   EventMask
+	LEEventMask LEEventMask
+	// EventMaskPage2, if set, enables further events such as Encryption
+	// Change v2, which reports the key size along with the change.
+	EventMaskPage2 EventMaskPage2
+
+	// ConnectedIsochronousStreams sets the host support bit for CISes,
+	// which peers check before requesting one.
+	ConnectedIsochronousStreams bool
+
+	// HostACLDataPacketLength and HostTotalNumACLDataPackets, if set, enable
+	// controller to host flow control with that many buffers of that size.
+	HostACLDataPacketLength    uint16
+	HostTotalNumACLDataPackets uint16
+
+	// AdvertisingData and AdvertisingParameters, if set, configure
+	// advertising, which is then enabled if Advertise is true.
+	AdvertisingData       []DataType
+	AdvertisingParameters *SetAdvertisingParametersRequest
+	Advertise             bool
+}
+
+// InitSummary describes the controller after Init.
+type InitSummary struct {
+	BDAddr               BDAddr
+	FilterAcceptListSize uint8
+
+	// ACLMTU and ACLPackets are the size and number of the controller's ACL
+	// buffers, which are shared with BR/EDR if SharedACLBuffers is set.
+	ACLMTU           uint16
+	ACLPackets       uint16
+	SharedACLBuffers bool
+
+	ISODataPacketLength    uint16
+	TotalNumISODataPackets uint8
+
+	Capabilities *Capabilities
+}
+
+type ReadBufferSizeResponse struct {
+	ACLDataPacketLength            uint16
+	SynchronousDataPacketLength    uint8
+	TotalNumACLDataPackets         uint16
+	TotalNumSynchronousDataPackets uint16
+}
+
+// ReadBufferSize reads the size of the controller's shared BR/EDR and LE
+// buffers. It is only needed when LEReadBufferSize reports zero.
+func (a *Adapter) ReadBufferSize() (*ReadBufferSizeResponse, error) {
+	buf, err := a.op(NewGenericCommandPacket(OpcodeReadBufferSize))
+	if err != nil {
+		return nil, err
+	}
+	if buf[0] != 0 {
+		return nil, errors.New("command failed")
+	}
+	if len(buf) < 8 {
+		return nil, io.ErrShortBuffer
+	}
+	return &ReadBufferSizeResponse{
+		ACLDataPacketLength:            binary.LittleEndian.Uint16(buf[1:3]),
+		SynchronousDataPacketLength:    buf[3],
+		TotalNumACLDataPackets:         binary.LittleEndian.Uint16(buf[4:6]),
+		TotalNumSynchronousDataPackets: binary.LittleEndian.Uint16(buf[6:8]),
+	}, nil
+}
+
+// Init performs the initialization recommended by Vol 6, Part D, Section 2.1:
+// it resets the controller, reads its capabilities, address and buffer sizes,
+// enables events, clears the filter accept list and optionally starts
+// advertising. The reset closes every connection and ISO stream with a
+// *DisconnectError and forgets the random address and the advertising and
+// scanning state.
+//
+// If ctx is done before the sequence completes, Init returns ctx.Err() once
+// the outstanding command has completed, without sending the remaining ones.
+// A command timeout, see SetCommandTimeout, bounds that wait.
+func (a *Adapter) Init(ctx context.Context, opts *InitOptions) (*InitSummary, error) {
+	if opts == nil {
+		opts = &InitOptions{}
+	}
+	a.faultLock.Lock()
+	a.initOptions = opts
+	a.faultLock.Unlock()
+	return a.init(ctx, opts, DisconnectReasonConnectionTerminatedByLocalHost)
+}
+
+// init runs the sequence of Init. The connections ended by the reset are
+// closed with reason.
+func (a *Adapter) init(ctx context.Context, opts *InitOptions, reason DisconnectReason) (*InitSummary, error) {
+	s := &InitSummary{}
+	steps := []func() error{
+		func() error {
+			a.resetHostState(reason)
+			return a.Reset()
+		},
+		func() (err error) {
+			s.Capabilities, err = a.ReadCapabilities()
+			return err
+		},
+		func() (err error) {
+			s.BDAddr, err = a.ReadBDAddr()
+			return err
+		},
+		func() error {
+			mask := opts.EventMask
+			if mask == 0 {
+				mask = DefaultEventMask
+			}
+			return a.SetEventMask(mask)
+		},
+		func() error {
+			if opts.EventMaskPage2 == 0 {
+				return nil
+			}
+			return a.SetEventMaskPage2(opts.EventMaskPage2)
+		},
+		func() error {
+			mask := opts.LEEventMask
+			if mask == 0 {
+				mask = DefaultLEEventMask
+			}
+			return a.LESetEventMask(mask)
+		},
+		func() error {
+			if !opts.ConnectedIsochronousStreams {
+				return nil
+			}
+			return a.LESetHostFeature(LEHostFeatureConnectedIsochronousStreams, true)
+		},
+		func() error {
+			r, err := a.LEReadBufferSize()
+			if err != nil {
+				return err
+			}
+			s.ACLMTU, s.ACLPackets = r.LEACLDataPacketLength, uint16(r.TotalNumLEACLDataPackets)
+			s.ISODataPacketLength, s.TotalNumISODataPackets = r.ISODataPacketLength, r.TotalNumISODataPackets
+			if s.ACLMTU != 0 && s.ACLPackets != 0 {
+				return nil
+			}
+			// the controller shares its BR/EDR buffers with LE.
+			b, err := a.ReadBufferSize()
+			if err != nil {
+				return err
+			}
+			if b.ACLDataPacketLength == 0 || b.TotalNumACLDataPackets == 0 {
+				return errors.New("controller reported no ACL buffers")
+			}
+			s.ACLMTU, s.ACLPackets, s.SharedACLBuffers = b.ACLDataPacketLength, b.TotalNumACLDataPackets, true
+			a.ACLMTU = s.ACLMTU
+			a.ACLPacketsRemainingCond.L.Lock()
+			a.ACLPacketsRemaining = s.ACLPackets
+			a.ACLPacketsRemainingCond.Broadcast()
+			a.ACLPacketsRemainingCond.L.Unlock()
+			return nil
+		},
+		func() error {
+			if opts.HostTotalNumACLDataPackets == 0 {
+				return nil
+			}
+			return a.EnableHostFlowControl(opts.HostACLDataPacketLength, opts.HostTotalNumACLDataPackets)
+		},
+		a.ClearFilterAcceptList,
+		func() (err error) {
+			s.FilterAcceptListSize, err = a.ReadFilterAcceptListSize()
+			return err
+		},
+		func() error {
+			if opts.AdvertisingData == nil {
+				return nil
+			}
+			return a.SetAdvertisingData(opts.AdvertisingData...)
+		},
+		func() error {
+			if opts.AdvertisingParameters == nil {
+				return nil
+			}
+			return a.LESetAdvertisingParameters(opts.AdvertisingParameters)
+		},
+		func() error {
+			if !opts.Advertise {
+				return nil
+			}
+			return a.LESetAdvertisingEnable(true)
+		},
+	}
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := step(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// resetHostState forgets what the host knows of the controller's state, all
+// of which a reset clears, and closes the connections and ISO streams with
+// reason. It returns the closed connections.
+func (a *Adapter) resetHostState(reason DisconnectReason) []*Conn {
+	a.connsLock.Lock()
+	conns := make([]*Conn, 0, len(a.conns))
+	for _, c := range a.conns {
+		conns = append(conns, c)
+	}
+	a.connsLock.Unlock()
+	for _, c := range conns {
+		c.teardown(&DisconnectError{ConnectionHandle: c.ConnectionHandle, Reason: reason})
+	}
+	a.isoLock.Lock()
+	streams := make([]*ISOStream, 0, len(a.isoStreams))
+	for _, s := range a.isoStreams {
+		streams = append(streams, s)
+	}
+	a.bigStreams = make(map[uint8][]*ISOStream)
+	a.isoLock.Unlock()
+	for _, s := range streams {
+		s.teardown(&DisconnectError{ConnectionHandle: s.ConnectionHandle, Reason: reason})
+	}
+
+	// the controller's buffers are emptied too.
+	a.ACLPacketsRemainingCond.L.Lock()
+	a.ACLPacketsRemaining = 0
+	a.ACLPacketsPending = make(map[uint16]uint16)
+	a.isoPacketsRemaining = 0
+	a.isoPacketsPending = make(map[uint16]uint16)
+	a.ACLPacketsRemainingCond.L.Unlock()
+
+	// the previous capabilities may not describe the controller after a
+	// reset.
+	a.setCapabilities(nil)
+	a.hostFlowControlLock.Lock()
+	a.hostFlowControl = false
+	a.hostFlowControlLock.Unlock()
+
+	a.addressLock.Lock()
+	a.randomAddressLock.Lock()
+	a.randomAddress = BDAddr{}
+	a.randomAddressLock.Unlock()
+	a.advertisingParameters, a.advertisingData = nil, nil
+	a.activityLock.Lock()
+	a.advertising, a.scanParameters, a.scan = false, nil, nil
+	a.advertisingSets = make(map[uint8]*advertisingSet)
+	a.activityLock.Unlock()
+	a.addressLock.Unlock()
+
+	a.filterAcceptListLock.Lock()
+	a.filterAcceptList = nil
+	a.filterAcceptListLock.Unlock()
+	a.resolvingListLock.Lock()
+	a.resolvingList, a.addressResolution, a.rpaTimeout = nil, false, 0
+	a.resolvingListLock.Unlock()
+	return conns
+}
@@ -0,0 +1,95 @@
+package hci_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/muxable/bluetooth/pkg/hci"
+	"github.com/muxable/bluetooth/pkg/hci/hcitest"
+)
+
+func TestInitCancel(t *testing.T) {
+	s, c, err := hcitest.NewController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	after := make(chan hci.Opcode, 16)
+	c.HandleCommand = func(opcode hci.Opcode, params []byte) []hci.Packet {
+		select {
+		case <-ctx.Done():
+			after <- opcode
+			return nil
+		default:
+		}
+		if opcode == hci.OpcodeReadBDAddr {
+			// cancelled while the command is outstanding.
+			cancel()
+			<-release
+		}
+		return nil
+	}
+	a := hci.NewConn(s)
+	defer c.Close()
+	defer a.Close()
+	var releaseOnce sync.Once
+	defer releaseOnce.Do(func() { close(release) })
+
+	results := make(chan error, 1)
+	go func() {
+		_, err := a.Init(ctx, nil)
+		results <- err
+	}()
+	<-ctx.Done()
+	select {
+	case err := <-results:
+		t.Fatalf("Init() returned %v before its command completed", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	releaseOnce.Do(func() { close(release) })
+	returns(t, results, 1, func(err error) bool { return errors.Is(err, context.Canceled) })
+	// a command sent after the cancellation would be answered before this
+	// one.
+	if _, err := a.ReadBDAddr(); err != nil {
+		t.Fatal(err)
+	}
+	if opcode := <-after; opcode != hci.OpcodeReadBDAddr {
+		t.Errorf("Init sent opcode 0x%04x after it was cancelled", uint16(opcode))
+	}
+}
+
+func TestInitResetsHostState(t *testing.T) {
+	a, c, err := hcitest.NewAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	defer a.Close()
+	conn := hcitest.Connect(t, a, c, 1, hci.RolePeripheral)
+	if err := a.LESetRandomAddress(hci.BDAddr{1, 0, 0, 0, 0, 0xC0}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Init(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-conn.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the connection was not closed by the reset")
+	}
+	var disconnectErr *hci.DisconnectError
+	if err := conn.Err(); !errors.As(err, &disconnectErr) || disconnectErr.Reason != hci.DisconnectReasonConnectionTerminatedByLocalHost {
+		t.Errorf("connection closed with %v, want a *DisconnectError by the local host", err)
+	}
+	if n := len(a.Connections()); n != 0 {
+		t.Errorf("%d connections survived the reset", n)
+	}
+	if addr := a.RandomAddress(); addr != (hci.BDAddr{}) {
+		t.Errorf("random address %v survived the reset", addr)
+	}
+}
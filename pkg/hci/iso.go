@@ -0,0 +1,503 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// ISO data packets, Vol 4, Part E, Section 5.4.5.
+
+// ISO data packet boundary flags.
+const (
+	ISOPacketBoundaryFirst        uint8 = 0b00
+	ISOPacketBoundaryContinuation uint8 = 0b01
+	ISOPacketBoundaryComplete     uint8 = 0b10
+	ISOPacketBoundaryLast         uint8 = 0b11
+)
+
+// ISOPacketStatus is the controller's assessment of a received SDU.
+type ISOPacketStatus uint8
+
+const (
+	ISOPacketStatusValid           ISOPacketStatus = 0b00
+	ISOPacketStatusPossiblyInvalid ISOPacketStatus = 0b01
+	ISOPacketStatusLost            ISOPacketStatus = 0b10
+)
+
+// maxISOSDULength is the largest SDU an ISO data packet can describe.
+const maxISOSDULength = 0x0FFF
+
+type ISODataPacket struct {
+	ConnectionHandle   uint16
+	PacketBoundaryFlag uint8
+	HasTimestamp       bool
+	Timestamp          uint32
+	// PacketSequenceNumber, ISOSDULength and PacketStatusFlag are only
+	// present in the first fragment of an SDU.
+	PacketSequenceNumber uint16
+	ISOSDULength         uint16
+	PacketStatusFlag     ISOPacketStatus
+	Payload              []byte
+}
+
+// hasSDUHeader reports whether the packet starts an SDU.
+func (p *ISODataPacket) hasSDUHeader() bool {
+	return p.PacketBoundaryFlag == ISOPacketBoundaryFirst || p.PacketBoundaryFlag == ISOPacketBoundaryComplete
+}
+
+func (p *ISODataPacket) Marshal() ([]byte, error) {
+	n := len(p.Payload)
+	if p.HasTimestamp {
+		n += 4
+	}
+	if p.hasSDUHeader() {
+		n += 4
+	}
+	if n > 0x3FFF {
+		return nil, errors.New("payload too large")
+	}
+	buf := make([]byte, 5, 5+n)
+	buf[0] = byte(PacketTypeISOData)
+	h := p.ConnectionHandle | uint16(p.PacketBoundaryFlag)<<12
+	if p.HasTimestamp {
+		h |= 1 << 14
+	}
+	binary.LittleEndian.PutUint16(buf[1:], h)
+	binary.LittleEndian.PutUint16(buf[3:], uint16(n))
+	if p.HasTimestamp {
+		buf = buf[:len(buf)+4]
+		binary.LittleEndian.PutUint32(buf[len(buf)-4:], p.Timestamp)
+	}
+	if p.hasSDUHeader() {
+		buf = buf[:len(buf)+4]
+		binary.LittleEndian.PutUint16(buf[len(buf)-4:], p.PacketSequenceNumber)
+		binary.LittleEndian.PutUint16(buf[len(buf)-2:], p.ISOSDULength|uint16(p.PacketStatusFlag)<<14)
+	}
+	return append(buf, p.Payload...), nil
+}
+
+func (p *ISODataPacket) Unmarshal(buf []byte) error {
+	if len(buf) < 5 {
+		return io.ErrShortBuffer
+	}
+	if buf[0] != byte(PacketTypeISOData) {
+		return errors.New("incorrect packet")
+	}
+	h := binary.LittleEndian.Uint16(buf[1:])
+	p.ConnectionHandle = h & 0x0FFF
+	p.PacketBoundaryFlag = uint8(h>>12) & 0x03
+	p.HasTimestamp = h&(1<<14) != 0
+	if len(buf) != int(binary.LittleEndian.Uint16(buf[3:])&0x3FFF)+5 {
+		return io.ErrShortBuffer
+	}
+	b := buf[5:]
+	if p.HasTimestamp {
+		if len(b) < 4 {
+			return io.ErrShortBuffer
+		}
+		p.Timestamp = binary.LittleEndian.Uint32(b)
+		b = b[4:]
+	}
+	if p.hasSDUHeader() {
+		if len(b) < 4 {
+			return io.ErrShortBuffer
+		}
+		p.PacketSequenceNumber = binary.LittleEndian.Uint16(b)
+		l := binary.LittleEndian.Uint16(b[2:])
+		p.ISOSDULength = l & 0x0FFF
+		p.PacketStatusFlag = ISOPacketStatus(l >> 14)
+		b = b[4:]
+	}
+	p.Payload = b
+	return nil
+}
+
+// ISOSDU is an SDU of an isochronous stream.
+type ISOSDU struct {
+	// HasTimestamp is set if Timestamp, the SDU's synchronization reference
+	// in microseconds of the controller's clock, is valid.
+	HasTimestamp   bool
+	Timestamp      uint32
+	SequenceNumber uint16
+	// Status is only set for received SDUs.
+	Status ISOPacketStatus
+	Data   []byte
+}
+
+// isoRxQueueLength is the number of received SDUs an ISOStream buffers. The
+// oldest are dropped if the reader falls behind, isochronous data being only
+// of use while it is current.
+const isoRxQueueLength = 16
+
+// ISOStream carries the SDUs of a connected or broadcast isochronous stream
+// over HCI. A data path must be set up for each direction used, see
+// SetupDataPath.
+type ISOStream struct {
+	adapter          *Adapter
+	ConnectionHandle uint16
+
+	rx    chan *ISOSDU
+	rxSDU *ISOSDU // the SDU being reassembled, owned by the reader.
+	// rxSDULength is the length the first fragment announced for rxSDU.
+	rxSDULength int
+	// rxDiscarding is set while skipping the rest of an oversized SDU, which
+	// is only counted once.
+	rxDiscarding bool
+	dropped      uint64
+
+	writeLock          sync.Mutex
+	nextSequenceNumber uint16
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	closeErr  error
+}
+
+// newISOStream registers a stream for handle, replacing any previous one.
+func (a *Adapter) newISOStream(handle uint16) *ISOStream {
+	s := &ISOStream{
+		adapter:          a,
+		ConnectionHandle: handle,
+		rx:               make(chan *ISOSDU, isoRxQueueLength),
+		closed:           make(chan struct{}),
+	}
+	a.isoLock.Lock()
+	old := a.isoStreams[handle]
+	a.isoStreams[handle] = s
+	a.isoLock.Unlock()
+	if old != nil {
+		old.teardown(errors.New("stream replaced"))
+	}
+	return s
+}
+
+// isoStream returns the stream registered for handle.
+func (a *Adapter) isoStream(handle uint16) (*ISOStream, bool) {
+	a.isoLock.Lock()
+	defer a.isoLock.Unlock()
+	s, ok := a.isoStreams[handle]
+	return s, ok
+}
+
+// teardownISOStreams closes every stream with err.
+func (a *Adapter) teardownISOStreams(err error) {
+	a.isoLock.Lock()
+	streams := make([]*ISOStream, 0, len(a.isoStreams))
+	for _, s := range a.isoStreams {
+		streams = append(streams, s)
+	}
+	a.isoLock.Unlock()
+	for _, s := range streams {
+		s.teardown(err)
+	}
+}
+
+// teardown marks the stream closed with err, waking pending reads and
+// writes. Only the first call has an effect.
+func (s *ISOStream) teardown(err error) {
+	s.closeOnce.Do(func() {
+		s.closeErr = err
+		close(s.closed)
+		a := s.adapter
+		a.isoLock.Lock()
+		if a.isoStreams[s.ConnectionHandle] == s {
+			delete(a.isoStreams, s.ConnectionHandle)
+		}
+		a.isoLock.Unlock()
+		a.ACLPacketsRemainingCond.L.Lock()
+		a.ACLPacketsRemainingCond.Broadcast()
+		a.ACLPacketsRemainingCond.L.Unlock()
+	})
+}
+
+func (s *ISOStream) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Done returns a channel that is closed once the stream is closed.
+func (s *ISOStream) Done() <-chan struct{} {
+	return s.closed
+}
+
+// Dropped returns the number of received SDUs dropped because the reader
+// fell behind or their fragments were inconsistent.
+func (s *ISOStream) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// SetupDataPath routes the stream's SDUs in direction over HCI without
+// encoding them.
+func (s *ISOStream) SetupDataPath(direction ISODataPathDirection) error {
+	return s.adapter.LESetupISODataPath(&ISODataPath{
+		ConnectionHandle: s.ConnectionHandle,
+		Direction:        direction,
+		DataPathID:       ISODataPathIDHCI,
+		CodecID:          CodecIDTransparent,
+	})
+}
+
+// receive adds an ISO data packet read for the stream. SDUs whose fragments
+// do not add up to the length announced by the first are dropped.
+func (s *ISOStream) receive(p *ISODataPacket) {
+	switch p.PacketBoundaryFlag {
+	case ISOPacketBoundaryComplete:
+		if s.rxSDU != nil {
+			s.drop("unexpected start")
+		}
+		s.rxDiscarding = false
+		if len(p.Payload) != int(p.ISOSDULength) {
+			atomic.AddUint64(&s.dropped, 1)
+			zap.L().Debug("dropping iso sdu", zap.Uint16("handle", s.ConnectionHandle), zap.String("reason", "length mismatch"))
+			return
+		}
+		s.deliver(&ISOSDU{
+			HasTimestamp:   p.HasTimestamp,
+			Timestamp:      p.Timestamp,
+			SequenceNumber: p.PacketSequenceNumber,
+			Status:         p.PacketStatusFlag,
+			Data:           p.Payload,
+		})
+	case ISOPacketBoundaryFirst:
+		if s.rxSDU != nil {
+			s.drop("unexpected start")
+		}
+		s.rxDiscarding = false
+		s.rxSDU = &ISOSDU{
+			HasTimestamp:   p.HasTimestamp,
+			Timestamp:      p.Timestamp,
+			SequenceNumber: p.PacketSequenceNumber,
+			Status:         p.PacketStatusFlag,
+			Data:           append(make([]byte, 0, p.ISOSDULength), p.Payload...),
+		}
+		// ISOSDULength is at most maxISOSDULength, which bounds the
+		// reassembly buffer.
+		s.rxSDULength = int(p.ISOSDULength)
+		if len(p.Payload) > s.rxSDULength {
+			s.discard()
+		}
+	case ISOPacketBoundaryContinuation, ISOPacketBoundaryLast:
+		if s.rxDiscarding {
+			s.rxDiscarding = p.PacketBoundaryFlag != ISOPacketBoundaryLast
+			return
+		}
+		if s.rxSDU == nil {
+			atomic.AddUint64(&s.dropped, 1)
+			zap.L().Debug("dropping iso fragment", zap.Uint16("handle", s.ConnectionHandle), zap.String("reason", "unexpected continuation"))
+			return
+		}
+		if len(s.rxSDU.Data)+len(p.Payload) > s.rxSDULength {
+			s.discard()
+			s.rxDiscarding = p.PacketBoundaryFlag != ISOPacketBoundaryLast
+			return
+		}
+		s.rxSDU.Data = append(s.rxSDU.Data, p.Payload...)
+		if p.PacketBoundaryFlag == ISOPacketBoundaryLast {
+			if len(s.rxSDU.Data) != s.rxSDULength {
+				s.drop("length mismatch")
+				return
+			}
+			sdu := s.rxSDU
+			s.rxSDU = nil
+			s.deliver(sdu)
+		}
+	}
+}
+
+// drop discards the SDU being reassembled.
+func (s *ISOStream) drop(reason string) {
+	zap.L().Debug("dropping partial iso sdu", zap.Uint16("handle", s.ConnectionHandle), zap.String("reason", reason))
+	atomic.AddUint64(&s.dropped, 1)
+	s.rxSDU = nil
+}
+
+// discard drops the SDU being reassembled for exceeding its announced length
+// and skips its remaining fragments.
+func (s *ISOStream) discard() {
+	s.drop("oversized")
+	s.rxDiscarding = true
+}
+
+// deliver queues a received SDU, dropping the oldest if the queue is full.
+func (s *ISOStream) deliver(sdu *ISOSDU) {
+	for {
+		select {
+		case s.rx <- sdu:
+			return
+		default:
+		}
+		select {
+		case <-s.rx:
+			atomic.AddUint64(&s.dropped, 1)
+		default:
+		}
+	}
+}
+
+// ReadSDU returns the next received SDU.
+func (s *ISOStream) ReadSDU() (*ISOSDU, error) {
+	select {
+	case sdu := <-s.rx:
+		return sdu, nil
+	default:
+	}
+	select {
+	case sdu := <-s.rx:
+		return sdu, nil
+	case <-s.closed:
+		return nil, s.closeErr
+	}
+}
+
+// Read reads the data of the next received SDU.
+func (s *ISOStream) Read(buf []byte) (int, error) {
+	sdu, err := s.ReadSDU()
+	if err != nil {
+		return 0, err
+	}
+	n := copy(buf, sdu.Data)
+	if n < len(sdu.Data) {
+		return n, io.ErrShortBuffer
+	}
+	return n, nil
+}
+
+// Write sends buf as an SDU without a timestamp, numbered after the previous
+// SDU written.
+func (s *ISOStream) Write(buf []byte) (int, error) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	if err := s.writeSDU(&ISOSDU{SequenceNumber: s.nextSequenceNumber, Data: buf}); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// WriteSDU sends an SDU with the given timestamp and sequence number. The
+// sequence numbers of subsequent writes follow it.
+func (s *ISOStream) WriteSDU(sdu *ISOSDU) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	return s.writeSDU(sdu)
+}
+
+// writeSDU fragments the SDU into ISO data packets and sends them as the
+// controller frees ISO buffers. The caller must hold writeLock.
+func (s *ISOStream) writeSDU(sdu *ISOSDU) error {
+	a := s.adapter
+	if len(sdu.Data) > maxISOSDULength {
+		return errors.New("sdu too long")
+	}
+	mtu := int(a.ISOMTU)
+	if mtu <= 8 {
+		return errors.New("controller has no iso buffers")
+	}
+	data, first := sdu.Data, true
+	for first || len(data) > 0 {
+		p := &ISODataPacket{ConnectionHandle: s.ConnectionHandle}
+		room := mtu
+		if first {
+			p.HasTimestamp, p.Timestamp = sdu.HasTimestamp, sdu.Timestamp
+			p.PacketSequenceNumber, p.ISOSDULength = sdu.SequenceNumber, uint16(len(sdu.Data))
+			if p.HasTimestamp {
+				room -= 4
+			}
+			room -= 4
+		}
+		n := len(data)
+		if n > room {
+			n = room
+		}
+		p.Payload, data = data[:n], data[n:]
+		switch {
+		case first && len(data) == 0:
+			p.PacketBoundaryFlag = ISOPacketBoundaryComplete
+		case first:
+			p.PacketBoundaryFlag = ISOPacketBoundaryFirst
+		case len(data) == 0:
+			p.PacketBoundaryFlag = ISOPacketBoundaryLast
+		default:
+			p.PacketBoundaryFlag = ISOPacketBoundaryContinuation
+		}
+		first = false
+		if err := s.send(p); err != nil {
+			return err
+		}
+	}
+	s.nextSequenceNumber = sdu.SequenceNumber + 1
+	return nil
+}
+
+// send writes an ISO data packet once the controller has a buffer for it.
+func (s *ISOStream) send(p *ISODataPacket) error {
+	a := s.adapter
+	cond := a.ACLPacketsRemainingCond
+	cond.L.Lock()
+	for a.isoPacketsRemaining == 0 && !s.isClosed() && !a.isClosing() {
+		cond.Wait()
+	}
+	if s.isClosed() {
+		cond.L.Unlock()
+		return s.closeErr
+	}
+	if a.isClosing() {
+		cond.L.Unlock()
+		return ErrAdapterClosed
+	}
+	a.isoPacketsRemaining--
+	a.isoPacketsPending[p.ConnectionHandle]++
+	cond.L.Unlock()
+
+	if err := a.Socket.WritePacket(p); err != nil {
+		cond.L.Lock()
+		a.isoPacketsRemaining++
+		if a.isoPacketsPending[p.ConnectionHandle]--; a.isoPacketsPending[p.ConnectionHandle] == 0 {
+			delete(a.isoPacketsPending, p.ConnectionHandle)
+		}
+		cond.L.Unlock()
+		return err
+	}
+	return nil
+}
+
+// completeISOPackets returns the credits of n ISO data packets the
+// controller completed for handle and reports whether handle had any ISO
+// data packets pending. The caller must hold ACLPacketsRemainingCond.L.
+func (a *Adapter) completeISOPackets(handle, n uint16) bool {
+	pending, ok := a.isoPacketsPending[handle]
+	if !ok {
+		return false
+	}
+	if n > pending {
+		n = pending
+	}
+	if a.isoPacketsPending[handle] -= n; a.isoPacketsPending[handle] == 0 {
+		delete(a.isoPacketsPending, handle)
+	}
+	a.isoPacketsRemaining += n
+	return true
+}
+
+// RemoveDataPath removes the stream's data path in direction.
+func (s *ISOStream) RemoveDataPath(direction ISODataPathDirection) error {
+	return s.adapter.LERemoveISODataPath(s.ConnectionHandle, direction)
+}
+
+// putUint24 and uint24 encode the three octet little endian fields of ISO
+// commands and events.
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
@@ -0,0 +1,99 @@
+package hci
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestISOStreamReceive(t *testing.T) {
+	first := func(length uint16, payload ...byte) *ISODataPacket {
+		return &ISODataPacket{PacketBoundaryFlag: ISOPacketBoundaryFirst, ISOSDULength: length, Payload: payload}
+	}
+	cont := func(payload ...byte) *ISODataPacket {
+		return &ISODataPacket{PacketBoundaryFlag: ISOPacketBoundaryContinuation, Payload: payload}
+	}
+	last := func(payload ...byte) *ISODataPacket {
+		return &ISODataPacket{PacketBoundaryFlag: ISOPacketBoundaryLast, Payload: payload}
+	}
+	complete := func(length uint16, payload ...byte) *ISODataPacket {
+		return &ISODataPacket{PacketBoundaryFlag: ISOPacketBoundaryComplete, ISOSDULength: length, Payload: payload}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		packets []*ISODataPacket
+		want    [][]byte
+		dropped uint64
+	}{
+		{
+			name:    "complete",
+			packets: []*ISODataPacket{complete(3, 1, 2, 3)},
+			want:    [][]byte{{1, 2, 3}},
+		},
+		{
+			name:    "fragmented",
+			packets: []*ISODataPacket{first(5, 1, 2), cont(3), last(4, 5)},
+			want:    [][]byte{{1, 2, 3, 4, 5}},
+		},
+		{
+			name:    "complete length mismatch",
+			packets: []*ISODataPacket{complete(4, 1, 2, 3), complete(1, 4)},
+			want:    [][]byte{{4}},
+			dropped: 1,
+		},
+		{
+			name:    "unexpected start",
+			packets: []*ISODataPacket{first(4, 1, 2), first(2, 3), last(4)},
+			want:    [][]byte{{3, 4}},
+			dropped: 1,
+		},
+		{
+			name:    "unexpected continuation",
+			packets: []*ISODataPacket{cont(1), last(2), complete(1, 3)},
+			want:    [][]byte{{3}},
+			dropped: 2,
+		},
+		{
+			name:    "oversized first",
+			packets: []*ISODataPacket{first(1, 1, 2), cont(3), last(4), complete(1, 5)},
+			want:    [][]byte{{5}},
+			dropped: 1,
+		},
+		{
+			name:    "oversized continuation",
+			packets: []*ISODataPacket{first(3, 1, 2), cont(3, 4), cont(5), last(6), first(2, 7), last(8)},
+			want:    [][]byte{{7, 8}},
+			dropped: 1,
+		},
+		{
+			name:    "oversized last",
+			packets: []*ISODataPacket{first(3, 1, 2), last(3, 4), complete(1, 5)},
+			want:    [][]byte{{5}},
+			dropped: 1,
+		},
+		{
+			name:    "short last",
+			packets: []*ISODataPacket{first(4, 1, 2), last(3), complete(1, 5)},
+			want:    [][]byte{{5}},
+			dropped: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &ISOStream{rx: make(chan *ISOSDU, isoRxQueueLength), closed: make(chan struct{})}
+			for _, p := range tc.packets {
+				s.receive(p)
+			}
+			if len(s.rx) != len(tc.want) {
+				t.Fatalf("received %d sdus, want %d", len(s.rx), len(tc.want))
+			}
+			for _, want := range tc.want {
+				if sdu := <-s.rx; !bytes.Equal(sdu.Data, want) {
+					t.Errorf("sdu = %v, want %v", sdu.Data, want)
+				}
+			}
+			if d := s.Dropped(); d != tc.dropped {
+				t.Errorf("dropped %d sdus, want %d", d, tc.dropped)
+			}
+		})
+	}
+}
@@ -9,23 +9,117 @@ const (
 	PacketTypeACLData         PacketType = 0x02
 	PacketTypeSynchronousData PacketType = 0x03
 	PacketTypeEvent           PacketType = 0x04
+	PacketTypeISOData         PacketType = 0x05
 	PacketTypeExtendedCommand PacketType = 0x09
 )
 
 type Opcode uint16
 
 const (
-	OpcodeReset                      Opcode = 0x0C03
-	OpcodeReadBDAddr                 Opcode = 0x1009
-	OpcodeClearFilterAcceptList      Opcode = 0x2010
-	OpcodeReadFilterAcceptListSize   Opcode = 0x200F
-	OpcodeSetEventMask               Opcode = 0x0c01
-	OpcodeLESetEventMask             Opcode = 0x2001
-	OpcodeLEReadBufferSize           Opcode = 0x2002
-	OpcodeLEReadSupportedStates      Opcode = 0x201C
-	OpcodeSetAdvertisingData         Opcode = 0x2008
-	OpcodeLESetAdvertisingParameters Opcode = 0x2006
-	OpcodeLESetAdvertisingEnable     Opcode = 0x200A
+	OpcodeDisconnect                              Opcode = 0x0406
+	OpcodeReadRemoteVersionInformation            Opcode = 0x041D
+	OpcodeReset                                   Opcode = 0x0C03
+	OpcodeReadLocalVersionInformation             Opcode = 0x1001
+	OpcodeReadLocalSupportedCommands              Opcode = 0x1002
+	OpcodeReadLocalSupportedFeatures              Opcode = 0x1003
+	OpcodeReadBufferSize                          Opcode = 0x1005
+	OpcodeLEReadLocalSupportedFeatures            Opcode = 0x2003
+	OpcodeReadTransmitPowerLevel                  Opcode = 0x0C2D
+	OpcodeSetControllerToHostFlowControl          Opcode = 0x0C31
+	OpcodeHostBufferSize                          Opcode = 0x0C33
+	OpcodeHostNumberOfCompletedPackets            Opcode = 0x0C35
+	OpcodeReadRSSI                                Opcode = 0x1405
+	OpcodeReadEncryptionKeySize                   Opcode = 0x1408
+	OpcodeSetEventMaskPage2                       Opcode = 0x0C63
+	OpcodeReadBDAddr                              Opcode = 0x1009
+	OpcodeClearFilterAcceptList                   Opcode = 0x2010
+	OpcodeReadFilterAcceptListSize                Opcode = 0x200F
+	OpcodeAddDeviceToFilterAcceptList             Opcode = 0x2011
+	OpcodeRemoveDeviceFromFilterAcceptList        Opcode = 0x2012
+	OpcodeSetEventMask                            Opcode = 0x0c01
+	OpcodeLESetEventMask                          Opcode = 0x2001
+	OpcodeLEReadBufferSize                        Opcode = 0x2002
+	OpcodeLEReadSupportedStates                   Opcode = 0x201C
+	OpcodeLESetRandomAddress                      Opcode = 0x2005
+	OpcodeLEReadAdvertisingPhysicalChannelTxPower Opcode = 0x2007
+	OpcodeSetAdvertisingData                      Opcode = 0x2008
+	OpcodeLESetAdvertisingParameters              Opcode = 0x2006
+	OpcodeLESetAdvertisingEnable                  Opcode = 0x200A
+
+	OpcodeLEAddDeviceToResolvingList           Opcode = 0x2027
+	OpcodeLERemoveDeviceFromResolvingList      Opcode = 0x2028
+	OpcodeLEClearResolvingList                 Opcode = 0x2029
+	OpcodeLEReadResolvingListSize              Opcode = 0x202A
+	OpcodeLEReadPeerResolvableAddress          Opcode = 0x202B
+	OpcodeLEReadLocalResolvableAddress         Opcode = 0x202C
+	OpcodeLESetAddressResolutionEnable         Opcode = 0x202D
+	OpcodeLESetResolvablePrivateAddressTimeout Opcode = 0x202E
+	OpcodeLESetPrivacyMode                     Opcode = 0x204E
+
+	OpcodeLEConnectionUpdate                              Opcode = 0x2013
+	OpcodeLECreateConnectionCancel                        Opcode = 0x200E
+	OpcodeLEReadRemoteFeatures                            Opcode = 0x2016
+	OpcodeLEEncrypt                                       Opcode = 0x2017
+	OpcodeLERand                                          Opcode = 0x2018
+	OpcodeLEEnableEncryption                              Opcode = 0x2019
+	OpcodeLELongTermKeyRequestReply                       Opcode = 0x201A
+	OpcodeLELongTermKeyRequestNegativeReply               Opcode = 0x201B
+	OpcodeLERemoteConnectionParameterRequestReply         Opcode = 0x2020
+	OpcodeLERemoteConnectionParameterRequestNegativeReply Opcode = 0x2021
+
+	OpcodeLESetDataLength                   Opcode = 0x2022
+	OpcodeLEReadSuggestedDefaultDataLength  Opcode = 0x2023
+	OpcodeLEWriteSuggestedDefaultDataLength Opcode = 0x2024
+	OpcodeLEReadLocalP256PublicKey          Opcode = 0x2025
+	OpcodeLEGenerateDHKey                   Opcode = 0x2026
+	OpcodeLEGenerateDHKeyV2                 Opcode = 0x205E
+	OpcodeLEReadMaximumDataLength           Opcode = 0x202F
+
+	OpcodeLEReadPHY       Opcode = 0x2030
+	OpcodeLESetDefaultPHY Opcode = 0x2031
+	OpcodeLESetPHY        Opcode = 0x2032
+
+	OpcodeLESetAdvertisingSetRandomAddress   Opcode = 0x2035
+	OpcodeLESetExtendedAdvertisingParameters Opcode = 0x2036
+	OpcodeLESetExtendedAdvertisingEnable     Opcode = 0x2039
+	OpcodeLESetPeriodicAdvertisingEnable     Opcode = 0x2040
+	OpcodeLESetExtendedScanParameters        Opcode = 0x2041
+	OpcodeLESetExtendedScanEnable            Opcode = 0x2042
+
+	OpcodeLEPeriodicAdvertisingCreateSync       Opcode = 0x2044
+	OpcodeLEPeriodicAdvertisingCreateSyncCancel Opcode = 0x2045
+	OpcodeLEPeriodicAdvertisingTerminateSync    Opcode = 0x2046
+
+	OpcodeLEReadTransmitPower       Opcode = 0x204B
+	OpcodeLEReadRFPathCompensation  Opcode = 0x204C
+	OpcodeLEWriteRFPathCompensation Opcode = 0x204D
+
+	OpcodeLESetPeriodicAdvertisingSubeventData Opcode = 0x2082
+	OpcodeLESetPeriodicAdvertisingResponseData Opcode = 0x2083
+	OpcodeLESetPeriodicSyncSubevent            Opcode = 0x2084
+	OpcodeLEExtendedCreateConnectionV2         Opcode = 0x2085
+	OpcodeLESetPeriodicAdvertisingParametersV2 Opcode = 0x2086
+
+	OpcodeLEEnhancedReadTransmitPowerLevel  Opcode = 0x2076
+	OpcodeLEReadRemoteTransmitPowerLevel    Opcode = 0x2077
+	OpcodeLESetPathLossReportingParameters  Opcode = 0x2078
+	OpcodeLESetPathLossReportingEnable      Opcode = 0x2079
+	OpcodeLESetTransmitPowerReportingEnable Opcode = 0x207A
+
+	OpcodeLEReadBufferSizeV2  Opcode = 0x2060
+	OpcodeLESetCIGParameters  Opcode = 0x2062
+	OpcodeLECreateCIS         Opcode = 0x2064
+	OpcodeLERemoveCIG         Opcode = 0x2065
+	OpcodeLEAcceptCISRequest  Opcode = 0x2066
+	OpcodeLERejectCISRequest  Opcode = 0x2067
+	OpcodeLECreateBIG         Opcode = 0x2068
+	OpcodeLECreateBIGTest     Opcode = 0x2069
+	OpcodeLETerminateBIG      Opcode = 0x206A
+	OpcodeLEBIGCreateSync     Opcode = 0x206B
+	OpcodeLEBIGTerminateSync  Opcode = 0x206C
+	OpcodeLESetupISODataPath  Opcode = 0x206E
+	OpcodeLERemoveISODataPath Opcode = 0x206F
+	OpcodeLESetHostFeature    Opcode = 0x2074
 )
 
 type EventCode uint8
@@ -41,20 +135,44 @@ const (
 	EventCodeDataBufferOverflow                   EventCode = 0x1A
 	EventCodeEncryptionKeyRefreshComplete         EventCode = 0x30
 	EventCodeAuthenticatedPayloadTimeoutExpired   EventCode = 0x57
+	EventCodeEncryptionChangeV2                   EventCode = 0x59
 	EventCodeLEMeta                               EventCode = 0x3E
 )
 
 type LEMetaSubeventCode uint8
 
 const (
-	LEMetaSubeventCodeConnectionComplete             LEMetaSubeventCode = 0x01
-	LEMetaSubeventCodeAdvertisingReport              LEMetaSubeventCode = 0x02
-	LEMetaSubeventCodeConnectionUpdate               LEMetaSubeventCode = 0x03
-	LEMetaSubeventCodeReadRemoteUsedFeaturesComplete LEMetaSubeventCode = 0x04
-	LEMetaSubeventCodeLongTermKeyRequest             LEMetaSubeventCode = 0x05
-	LEMetaSubeventCodeReadLocalP256PublicKeyComplete LEMetaSubeventCode = 0x08
-	LEMetaSubeventCodeGenerateDHKeyComplete          LEMetaSubeventCode = 0x09
-	LEMetaSubeventCodeEnhancedConnectionComplete     LEMetaSubeventCode = 0x0A
-	LEMetaSubeventCodePHYUpdateComplete              LEMetaSubeventCode = 0x0C
-	LEMetaSubeventCodeExtendedAdvertisingReport      LEMetaSubeventCode = 0x0D
+	LEMetaSubeventCodeConnectionComplete                 LEMetaSubeventCode = 0x01
+	LEMetaSubeventCodeAdvertisingReport                  LEMetaSubeventCode = 0x02
+	LEMetaSubeventCodeConnectionUpdate                   LEMetaSubeventCode = 0x03
+	LEMetaSubeventCodeReadRemoteUsedFeaturesComplete     LEMetaSubeventCode = 0x04
+	LEMetaSubeventCodeLongTermKeyRequest                 LEMetaSubeventCode = 0x05
+	LEMetaSubeventCodeRemoteConnectionParameterRequest   LEMetaSubeventCode = 0x06
+	LEMetaSubeventCodeDataLengthChange                   LEMetaSubeventCode = 0x07
+	LEMetaSubeventCodeReadLocalP256PublicKeyComplete     LEMetaSubeventCode = 0x08
+	LEMetaSubeventCodeGenerateDHKeyComplete              LEMetaSubeventCode = 0x09
+	LEMetaSubeventCodeEnhancedConnectionComplete         LEMetaSubeventCode = 0x0A
+	LEMetaSubeventCodePHYUpdateComplete                  LEMetaSubeventCode = 0x0C
+	LEMetaSubeventCodeExtendedAdvertisingReport          LEMetaSubeventCode = 0x0D
+	LEMetaSubeventCodePeriodicAdvertisingSyncEstablished LEMetaSubeventCode = 0x0E
+	LEMetaSubeventCodePeriodicAdvertisingReport          LEMetaSubeventCode = 0x0F
+	LEMetaSubeventCodePeriodicAdvertisingSyncLost        LEMetaSubeventCode = 0x10
+	LEMetaSubeventCodeScanTimeout                        LEMetaSubeventCode = 0x11
+	LEMetaSubeventCodeAdvertisingSetTerminated           LEMetaSubeventCode = 0x12
+
+	LEMetaSubeventCodeCISEstablished           LEMetaSubeventCode = 0x19
+	LEMetaSubeventCodeCISRequest               LEMetaSubeventCode = 0x1A
+	LEMetaSubeventCodeBIGComplete              LEMetaSubeventCode = 0x1B
+	LEMetaSubeventCodeTerminateBIGComplete     LEMetaSubeventCode = 0x1C
+	LEMetaSubeventCodeBIGSyncEstablished       LEMetaSubeventCode = 0x1D
+	LEMetaSubeventCodeBIGSyncLost              LEMetaSubeventCode = 0x1E
+	LEMetaSubeventCodeBIGInfoAdvertisingReport LEMetaSubeventCode = 0x22
+
+	LEMetaSubeventCodePathLossThreshold      LEMetaSubeventCode = 0x20
+	LEMetaSubeventCodeTransmitPowerReporting LEMetaSubeventCode = 0x21
+
+	LEMetaSubeventCodePeriodicAdvertisingReportV2            LEMetaSubeventCode = 0x25
+	LEMetaSubeventCodePeriodicAdvertisingSubeventDataRequest LEMetaSubeventCode = 0x27
+	LEMetaSubeventCodePeriodicAdvertisingResponseReport      LEMetaSubeventCode = 0x28
+	LEMetaSubeventCodeEnhancedConnectionCompleteV2           LEMetaSubeventCode = 0x29
 )
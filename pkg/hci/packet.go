@@ -37,18 +37,114 @@ func Unmarshal(buf []byte) (Packet, error) {
 		case EventCodeCommandComplete:
 			p := &CommandCompleteEventPacket{}
 			return p, p.Unmarshal(buf)
+		case EventCodeCommandStatus:
+			p := &CommandStatusEventPacket{}
+			return p, p.Unmarshal(buf)
 		case EventCodeLEMeta:
 			switch LEMetaSubeventCode(buf[3]) {
+			case LEMetaSubeventCodeAdvertisingReport:
+				p := &LEAdvertisingReportEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeExtendedAdvertisingReport:
+				p := &LEExtendedAdvertisingReportEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodePeriodicAdvertisingSyncEstablished:
+				p := &LEPeriodicAdvertisingSyncEstablishedEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodePeriodicAdvertisingReport, LEMetaSubeventCodePeriodicAdvertisingReportV2:
+				p := &LEPeriodicAdvertisingReportEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeScanTimeout:
+				p := &LEScanTimeoutEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeAdvertisingSetTerminated:
+				p := &LEAdvertisingSetTerminatedEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodePeriodicAdvertisingSyncLost:
+				p := &LEPeriodicAdvertisingSyncLostEventPacket{}
+				return p, p.Unmarshal(buf)
 			case LEMetaSubeventCodeConnectionComplete:
 				p := &LEConnectionCompleteEventPacket{}
 				if err := p.Unmarshal(buf); err != nil {
 					return nil, err
 				}
 				return p, nil
+			case LEMetaSubeventCodeEnhancedConnectionComplete, LEMetaSubeventCodeEnhancedConnectionCompleteV2:
+				p := &LEEnhancedConnectionCompleteEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeReadRemoteUsedFeaturesComplete:
+				p := &LEReadRemoteFeaturesCompleteEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeConnectionUpdate:
+				p := &LEConnectionUpdateCompleteEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeRemoteConnectionParameterRequest:
+				p := &LERemoteConnectionParameterRequestEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeDataLengthChange:
+				p := &LEDataLengthChangeEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodePHYUpdateComplete:
+				p := &LEPHYUpdateCompleteEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeReadLocalP256PublicKeyComplete:
+				p := &LEReadLocalP256PublicKeyCompleteEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeGenerateDHKeyComplete:
+				p := &LEGenerateDHKeyCompleteEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeLongTermKeyRequest:
+				p := &LELongTermKeyRequestEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeCISEstablished:
+				p := &LECISEstablishedEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeCISRequest:
+				p := &LECISRequestEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeBIGComplete:
+				p := &LEBIGCompleteEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeTerminateBIGComplete:
+				p := &LETerminateBIGCompleteEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeBIGSyncEstablished:
+				p := &LEBIGSyncEstablishedEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeBIGSyncLost:
+				p := &LEBIGSyncLostEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeBIGInfoAdvertisingReport:
+				p := &LEBIGInfoAdvertisingReportEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodePathLossThreshold:
+				p := &LEPathLossThresholdEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodeTransmitPowerReporting:
+				p := &LETransmitPowerReportingEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodePeriodicAdvertisingSubeventDataRequest:
+				p := &LEPeriodicAdvertisingSubeventDataRequestEventPacket{}
+				return p, p.Unmarshal(buf)
+			case LEMetaSubeventCodePeriodicAdvertisingResponseReport:
+				p := &LEPeriodicAdvertisingResponseReportEventPacket{}
+				return p, p.Unmarshal(buf)
 			}
+		case EventCodeReadRemoteVersionInformationComplete:
+			p := &ReadRemoteVersionInformationCompleteEventPacket{}
+			return p, p.Unmarshal(buf)
 		case EventCodeDisconnectionComplete:
 			p := &DisconnectionCompleteEventPacket{}
 			return p, p.Unmarshal(buf)
+		case EventCodeHardwareError:
+			p := &HardwareErrorEventPacket{}
+			return p, p.Unmarshal(buf)
+		case EventCodeEncryptionChange, EventCodeEncryptionChangeV2:
+			p := &EncryptionChangeEventPacket{}
+			return p, p.Unmarshal(buf)
+		case EventCodeEncryptionKeyRefreshComplete:
+			p := &EncryptionKeyRefreshCompleteEventPacket{}
+			return p, p.Unmarshal(buf)
 		case EventCodeNumberOfCompletedPackets:
 			p := &NumberOfCompletedPacketsEventPacket{}
 			return p, p.Unmarshal(buf)
@@ -59,18 +155,45 @@ func Unmarshal(buf []byte) (Packet, error) {
 			return nil, err
 		}
 		return p, nil
+	case PacketTypeISOData:
+		p := &ISODataPacket{}
+		if err := p.Unmarshal(buf); err != nil {
+			return nil, err
+		}
+		return p, nil
 	}
 	return nil, errors.New("unsupported packet type")
 }
 
+// Packet boundary flags, Vol 4, Part E, Section 5.4.2. On LE-U the host sends
+// ACLPacketBoundaryFirstNonFlushable and ACLPacketBoundaryContinuation, and the
+// controller sends ACLPacketBoundaryFirstFlushable and
+// ACLPacketBoundaryContinuation.
+const (
+	ACLPacketBoundaryFirstNonFlushable uint8 = 0b00
+	ACLPacketBoundaryContinuation      uint8 = 0b01
+	ACLPacketBoundaryFirstFlushable    uint8 = 0b10
+	ACLPacketBoundaryComplete          uint8 = 0b11
+)
+
+// ACLBroadcastPointToPoint is the only broadcast flag used on LE-U.
+const ACLBroadcastPointToPoint uint8 = 0b00
+
 type ACLDataPacket struct {
 	PacketBoundaryFlag uint8
 	BroadcastFlag      uint8
 	ConnectionHandle   uint16
 	Payload            []byte
+
+	// pooled is the buffer Payload was decoded in for packets read from the
+	// socket.
+	pooled *buffer
 }
 
 func (p *ACLDataPacket) Unmarshal(buf []byte) error {
+	if len(buf) < 5 {
+		return io.ErrShortBuffer
+	}
 	if buf[0] != byte(PacketTypeACLData) {
 		return errors.New("incorrect packet")
 	}
@@ -176,19 +299,49 @@ func (p *CommandCompleteEventPacket) Unmarshal(buf []byte) error {
 }
 
 func (p *CommandCompleteEventPacket) Marshal() ([]byte, error) {
-	if len(p.ReturnParameters)+2 > math.MaxUint8 {
+	if len(p.ReturnParameters)+3 > math.MaxUint8 {
 		return nil, io.ErrShortWrite
 	}
 	buf := make([]byte, 6+len(p.ReturnParameters))
 	buf[0] = byte(PacketTypeEvent)
 	buf[1] = byte(EventCodeCommandComplete)
-	buf[2] = byte(len(p.ReturnParameters) + 2)
+	buf[2] = byte(len(p.ReturnParameters) + 3)
 	buf[3] = byte(p.NumCommandPackets)
 	binary.LittleEndian.PutUint16(buf[4:], uint16(p.CommandOpcode))
 	copy(buf[6:], p.ReturnParameters)
 	return buf, nil
 }
 
+type CommandStatusEventPacket struct {
+	Status            uint8
+	NumCommandPackets uint8
+	CommandOpcode     Opcode
+}
+
+func (p *CommandStatusEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeCommandStatus) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 4 || len(buf) != 7 {
+		return io.ErrShortBuffer
+	}
+	p.Status = buf[3]
+	p.NumCommandPackets = buf[4]
+	p.CommandOpcode = Opcode(binary.LittleEndian.Uint16(buf[5:]))
+	return nil
+}
+
+func (p *CommandStatusEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 7)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeCommandStatus)
+	buf[2] = 4
+	buf[3] = p.Status
+	buf[4] = p.NumCommandPackets
+	binary.LittleEndian.PutUint16(buf[5:], uint16(p.CommandOpcode))
+	return buf, nil
+}
+
 type NumberOfCompletedPacketsEventPacket struct {
 	NumHandles          uint8
 	ConnectionHandles   []uint16
@@ -217,10 +370,10 @@ func (p *NumberOfCompletedPacketsEventPacket) Marshal() ([]byte, error) {
 	if len(p.ConnectionHandles) != int(p.NumHandles) || len(p.NumCompletedPackets) != int(p.NumHandles) {
 		return nil, io.ErrShortWrite
 	}
-	buf := make([]byte, 4+len(p.ConnectionHandles)+len(p.NumCompletedPackets)*2)
+	buf := make([]byte, 4+4*int(p.NumHandles))
 	buf[0] = byte(PacketTypeEvent)
 	buf[1] = byte(EventCodeNumberOfCompletedPackets)
-	buf[2] = byte(len(p.ConnectionHandles) + len(p.NumCompletedPackets))
+	buf[2] = byte(1 + 4*int(p.NumHandles))
 	buf[3] = byte(p.NumHandles)
 	for i := 0; i < int(p.NumHandles); i++ {
 		binary.LittleEndian.PutUint16(buf[4+i*2:], p.ConnectionHandles[i])
@@ -230,7 +383,7 @@ func (p *NumberOfCompletedPacketsEventPacket) Marshal() ([]byte, error) {
 }
 
 type DisconnectionCompleteEventPacket struct {
-	Status uint8
+	Status           uint8
 	ConnectionHandle uint16
 	Reason           uint8
 }
@@ -239,22 +392,23 @@ func (p *DisconnectionCompleteEventPacket) Unmarshal(buf []byte) error {
 	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeDisconnectionComplete) {
 		return errors.New("incorrect packet")
 	}
-	if len(buf) != 6 {
+	if buf[2] != 4 || len(buf) != 7 {
 		return io.ErrShortBuffer
 	}
-	p.Status = buf[2]
-	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[3:])
-	p.Reason = buf[5]
+	p.Status = buf[3]
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[4:])
+	p.Reason = buf[6]
 	return nil
 }
 
 func (p *DisconnectionCompleteEventPacket) Marshal() ([]byte, error) {
-	buf := make([]byte, 6)
+	buf := make([]byte, 7)
 	buf[0] = byte(PacketTypeEvent)
 	buf[1] = byte(EventCodeDisconnectionComplete)
-	buf[2] = p.Status
-	binary.LittleEndian.PutUint16(buf[3:], p.ConnectionHandle)
-	buf[5] = p.Reason
+	buf[2] = 4
+	buf[3] = p.Status
+	binary.LittleEndian.PutUint16(buf[4:], p.ConnectionHandle)
+	buf[6] = p.Reason
 	return buf, nil
 }
 
@@ -279,6 +433,7 @@ const (
 )
 
 type LEConnectionCompleteEventPacket struct {
+	Status               uint8
 	ConnectionHandle     uint16
 	Role                 Role
 	PeerAddressType      PeerAddressType
@@ -287,10 +442,28 @@ type LEConnectionCompleteEventPacket struct {
 	PeripheralLatency    uint16
 	SupervisionTimeout   uint16
 	CentralClockAccuracy CentralClockAccuracy
+
+	// established is the connection registered with the adapter when the
+	// event was read.
+	established *Conn
 }
 
 func (p *LEConnectionCompleteEventPacket) Marshal() ([]byte, error) {
-	return nil, errors.New("unimplemented")
+	buf := make([]byte, 22)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeLEMeta)
+	buf[2] = 19
+	buf[3] = byte(LEMetaSubeventCodeConnectionComplete)
+	buf[4] = p.Status
+	binary.LittleEndian.PutUint16(buf[5:], p.ConnectionHandle)
+	buf[7] = byte(p.Role)
+	buf[8] = byte(p.PeerAddressType)
+	copy(buf[9:], p.PeerAddress[:])
+	binary.LittleEndian.PutUint16(buf[15:], p.ConnectionInterval)
+	binary.LittleEndian.PutUint16(buf[17:], p.PeripheralLatency)
+	binary.LittleEndian.PutUint16(buf[19:], p.SupervisionTimeout)
+	buf[21] = byte(p.CentralClockAccuracy)
+	return buf, nil
 }
 
 func (p *LEConnectionCompleteEventPacket) Unmarshal(buf []byte) error {
@@ -303,9 +476,7 @@ func (p *LEConnectionCompleteEventPacket) Unmarshal(buf []byte) error {
 	if buf[3] != byte(LEMetaSubeventCodeConnectionComplete) {
 		return errors.New("incorrect subevent")
 	}
-	if buf[4] != 0 {
-		return errors.New("unexpected status")
-	}
+	p.Status = buf[4]
 	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[5:7])
 	p.Role = Role(buf[7])
 	p.PeerAddressType = PeerAddressType(buf[8])
@@ -316,3 +487,78 @@ func (p *LEConnectionCompleteEventPacket) Unmarshal(buf []byte) error {
 	p.CentralClockAccuracy = CentralClockAccuracy(buf[21])
 	return nil
 }
+
+// LEEnhancedConnectionCompleteEventPacket decodes both the v1 and v2 LE
+// Enhanced Connection Complete subevents. AdvertisingHandle and SyncHandle are
+// only populated by v2.
+type LEEnhancedConnectionCompleteEventPacket struct {
+	Status                        uint8
+	ConnectionHandle              uint16
+	Role                          Role
+	PeerAddressType               PeerAddressType
+	PeerAddress                   BDAddr
+	LocalResolvablePrivateAddress BDAddr
+	PeerResolvablePrivateAddress  BDAddr
+	ConnectionInterval            uint16
+	PeripheralLatency             uint16
+	SupervisionTimeout            uint16
+	CentralClockAccuracy          CentralClockAccuracy
+	AdvertisingHandle             uint8
+	SyncHandle                    uint16
+
+	// established is the connection registered with the adapter when the
+	// event was read.
+	established *Conn
+}
+
+func (p *LEEnhancedConnectionCompleteEventPacket) Marshal() ([]byte, error) {
+	return nil, errors.New("unimplemented")
+}
+
+func (p *LEEnhancedConnectionCompleteEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeLEMeta) {
+		return errors.New("incorrect packet")
+	}
+	switch LEMetaSubeventCode(buf[3]) {
+	case LEMetaSubeventCodeEnhancedConnectionComplete:
+		if buf[2] != 31 || len(buf) != 34 {
+			return io.ErrShortBuffer
+		}
+	case LEMetaSubeventCodeEnhancedConnectionCompleteV2:
+		if buf[2] != 34 || len(buf) != 37 {
+			return io.ErrShortBuffer
+		}
+		p.AdvertisingHandle = buf[34]
+		p.SyncHandle = binary.LittleEndian.Uint16(buf[35:37])
+	default:
+		return errors.New("incorrect subevent")
+	}
+	p.Status = buf[4]
+	p.ConnectionHandle = binary.LittleEndian.Uint16(buf[5:7])
+	p.Role = Role(buf[7])
+	p.PeerAddressType = PeerAddressType(buf[8])
+	copy(p.PeerAddress[:], buf[9:15])
+	copy(p.LocalResolvablePrivateAddress[:], buf[15:21])
+	copy(p.PeerResolvablePrivateAddress[:], buf[21:27])
+	p.ConnectionInterval = binary.LittleEndian.Uint16(buf[27:29])
+	p.PeripheralLatency = binary.LittleEndian.Uint16(buf[29:31])
+	p.SupervisionTimeout = binary.LittleEndian.Uint16(buf[31:33])
+	p.CentralClockAccuracy = CentralClockAccuracy(buf[33])
+	return nil
+}
+
+func (p *LEEnhancedConnectionCompleteEventPacket) conn() *Conn {
+	return &Conn{
+		ConnectionHandle:     p.ConnectionHandle,
+		Role:                 p.Role,
+		PeerAddressType:      p.PeerAddressType,
+		PeerAddress:          p.PeerAddress,
+		ConnectionInterval:   p.ConnectionInterval,
+		PeripheralLatency:    p.PeripheralLatency,
+		SupervisionTimeout:   p.SupervisionTimeout,
+		CentralClockAccuracy: p.CentralClockAccuracy,
+
+		LocalResolvablePrivateAddress: p.LocalResolvablePrivateAddress,
+		PeerResolvablePrivateAddress:  p.PeerResolvablePrivateAddress,
+	}
+}
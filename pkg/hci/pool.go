@@ -0,0 +1,61 @@
+package hci
+
+import "sync"
+
+// maxPacketSize is the largest HCI packet, an ACL data packet with a 65535
+// byte payload and its packet type and header.
+const maxPacketSize = 0xFFFF + 5
+
+// bufferClasses are the capacities of pooled buffers. Most ACL data packets
+// fit the smallest class, reassembled PDUs are rounded up to the next one.
+var bufferClasses = [...]int{256, 1024, 4096, 16384, maxPacketSize}
+
+var bufferPools [len(bufferClasses)]sync.Pool
+
+// buffer is a pooled byte slice. It is passed by pointer so that returning it
+// to the pool does not allocate.
+type buffer struct {
+	b []byte
+}
+
+// getBuffer returns a buffer of length n from the smallest class that fits
+// it. Buffers larger than every class are not pooled.
+func getBuffer(n int) *buffer {
+	for i, size := range bufferClasses {
+		if n > size {
+			continue
+		}
+		if b, ok := bufferPools[i].Get().(*buffer); ok {
+			b.b = b.b[:n]
+			return b
+		}
+		return &buffer{b: make([]byte, n, size)}
+	}
+	return &buffer{b: make([]byte, n)}
+}
+
+// putBuffer returns b to its pool. b must not be used afterwards. It is a no
+// op for nil.
+func putBuffer(b *buffer) {
+	if b == nil {
+		return
+	}
+	for i, size := range bufferClasses {
+		if cap(b.b) == size {
+			bufferPools[i].Put(b)
+			return
+		}
+	}
+}
+
+// aclPool holds ACLDataPacket values read from the socket, see
+// releaseACLDataPacket.
+var aclPool = sync.Pool{New: func() interface{} { return &ACLDataPacket{} }}
+
+// releaseACLDataPacket returns a packet read from the socket and its buffer to
+// their pools once its payload is no longer referenced.
+func releaseACLDataPacket(p *ACLDataPacket) {
+	putBuffer(p.pooled)
+	*p = ACLDataPacket{}
+	aclPool.Put(p)
+}
@@ -0,0 +1,189 @@
+package hci
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// maxPDUSize is the largest L2CAP PDU, a 65535 byte payload and its basic
+// header.
+const maxPDUSize = 0xFFFF + 4
+
+// ReassemblyStats counts the ACL data packets dropped while reassembling a
+// connection's L2CAP PDUs.
+type ReassemblyStats struct {
+	// UnexpectedStart counts fragments of incomplete PDUs discarded because
+	// a new PDU started.
+	UnexpectedStart uint64
+	// UnexpectedContinuation counts continuation fragments received without
+	// a start fragment.
+	UnexpectedContinuation uint64
+	// InvalidFlags counts packets with packet boundary or broadcast flags not
+	// valid on LE-U.
+	InvalidFlags uint64
+	// Oversized counts fragments of PDUs longer than MaxPDUSize or than their
+	// basic header declared.
+	Oversized uint64
+}
+
+// Dropped is the total number of dropped fragments.
+func (s ReassemblyStats) Dropped() uint64 {
+	return s.UnexpectedStart + s.UnexpectedContinuation + s.InvalidFlags + s.Oversized
+}
+
+// ReassemblyStats returns the connection's dropped fragment counters.
+func (c *Conn) ReassemblyStats() ReassemblyStats {
+	return ReassemblyStats{
+		UnexpectedStart:        atomic.LoadUint64(&c.stats.UnexpectedStart),
+		UnexpectedContinuation: atomic.LoadUint64(&c.stats.UnexpectedContinuation),
+		InvalidFlags:           atomic.LoadUint64(&c.stats.InvalidFlags),
+		Oversized:              atomic.LoadUint64(&c.stats.Oversized),
+	}
+}
+
+// reassembler accumulates the fragments of one L2CAP PDU. Each fragment is
+// copied to the PDU's buffer, so only the credit of the first is held until
+// the PDU is consumed and the others are returned as they arrive. Otherwise a
+// PDU spanning more packets than the host buffers could never complete.
+type reassembler struct {
+	pdu       *buffer
+	fragments uint16
+	// discarding is set while the rest of a dropped PDU is skipped.
+	discarding bool
+}
+
+// drop discards the fragments accumulated so far, counting them in counter.
+func (r *reassembler) drop(c *Conn, counter *uint64, reason string) {
+	if r.fragments == 0 {
+		return
+	}
+	zap.L().Debug("dropping partial pdu", zap.Uint16("handle", c.ConnectionHandle), zap.String("reason", reason), zap.Uint16("fragments", r.fragments))
+	atomic.AddUint64(counter, uint64(r.fragments))
+	c.release(1)
+	putBuffer(r.pdu)
+	r.pdu, r.fragments = nil, 0
+}
+
+// append copies a fragment's payload to the PDU. The buffer is sized by the
+// basic header of the first fragment so that it is copied at most once.
+func (r *reassembler) append(b []byte) {
+	if r.pdu == nil {
+		size := len(b)
+		if len(b) >= 4 {
+			if n := int(binary.LittleEndian.Uint16(b[:2])) + 4; n > size {
+				size = n
+			}
+		}
+		r.pdu = getBuffer(size)
+		r.pdu.b = r.pdu.b[:0]
+	}
+	if n := len(r.pdu.b) + len(b); n > cap(r.pdu.b) {
+		// the first fragment did not hold the whole header or the PDU is
+		// longer than declared.
+		t := getBuffer(n)
+		t.b = append(t.b[:0], r.pdu.b...)
+		putBuffer(r.pdu)
+		r.pdu = t
+	}
+	r.pdu.b = append(r.pdu.b, b...)
+}
+
+// dropFragment discards a single fragment, counting it in counter.
+func dropFragment(c *Conn, counter *uint64, reason string) {
+	zap.L().Debug("dropping fragment", zap.Uint16("handle", c.ConnectionHandle), zap.String("reason", reason))
+	atomic.AddUint64(counter, 1)
+	c.release(1)
+}
+
+// push adds an ACL data packet and returns the PDU it completes, if any. The
+// packet is released.
+func (r *reassembler) push(c *Conn, q *ACLDataPacket) *rxPDU {
+	defer releaseACLDataPacket(q)
+	if q.BroadcastFlag != ACLBroadcastPointToPoint {
+		dropFragment(c, &c.stats.InvalidFlags, "broadcast flag")
+		return nil
+	}
+	switch q.PacketBoundaryFlag {
+	case ACLPacketBoundaryFirstFlushable, ACLPacketBoundaryFirstNonFlushable:
+		// a start fragment ends any PDU in progress, which cannot be
+		// completed anymore.
+		r.drop(c, &c.stats.UnexpectedStart, "unexpected start")
+		r.discarding = false
+		if len(q.Payload) >= 4 && int(binary.LittleEndian.Uint16(q.Payload[:2]))+4 == len(q.Payload) && len(q.Payload) <= c.MaxPDUSize {
+			// a PDU in a single fragment is passed on in the packet's
+			// buffer.
+			p := &rxPDU{conn: c, buf: q.Payload, pooled: q.pooled}
+			q.pooled = nil
+			return p
+		}
+		r.append(q.Payload)
+	case ACLPacketBoundaryContinuation:
+		if r.discarding {
+			dropFragment(c, &c.stats.Oversized, "oversized pdu")
+			return nil
+		}
+		if r.fragments == 0 {
+			dropFragment(c, &c.stats.UnexpectedContinuation, "unexpected continuation")
+			return nil
+		}
+		r.append(q.Payload)
+		c.release(1)
+	default:
+		dropFragment(c, &c.stats.InvalidFlags, "packet boundary flag")
+		return nil
+	}
+	r.fragments++
+
+	buf := r.pdu.b
+	if len(buf) < 4 {
+		// the basic header is incomplete.
+		return nil
+	}
+	n := int(binary.LittleEndian.Uint16(buf[:2])) + 4
+	if n > c.MaxPDUSize || len(buf) > n {
+		r.drop(c, &c.stats.Oversized, "oversized pdu")
+		// skip the remaining fragments of the PDU.
+		r.discarding = true
+		return nil
+	}
+	if len(buf) < n {
+		return nil
+	}
+	p := &rxPDU{conn: c, buf: buf, pooled: r.pdu}
+	r.pdu, r.fragments = nil, 0
+	return p
+}
+
+// reassemble turns the ACL data packets queued for the connection into L2CAP
+// PDUs, in the order they were received, until the connection closes.
+func (c *Conn) reassemble() {
+	var r reassembler
+	// the inbox is swapped with spare so that neither is reallocated.
+	var spare []*ACLDataPacket
+	for {
+		select {
+		case <-c.inboxReady:
+		case <-c.closed:
+			return
+		}
+		c.inboxLock.Lock()
+		inbox := c.inbox
+		c.inbox = spare[:0]
+		c.inboxLock.Unlock()
+		for i, q := range inbox {
+			inbox[i] = nil
+			p := r.push(c, q)
+			if p == nil {
+				continue
+			}
+			select {
+			case c.bufCh <- p:
+			case <-c.closed:
+				return
+			}
+		}
+		spare = inbox
+	}
+}
@@ -0,0 +1,115 @@
+package hci
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReassembly(t *testing.T) {
+	start := func(payload ...byte) *ACLDataPacket {
+		return &ACLDataPacket{PacketBoundaryFlag: ACLPacketBoundaryFirstFlushable, Payload: payload}
+	}
+	cont := func(payload ...byte) *ACLDataPacket {
+		return &ACLDataPacket{PacketBoundaryFlag: ACLPacketBoundaryContinuation, Payload: payload}
+	}
+
+	for _, tc := range []struct {
+		name       string
+		maxPDUSize int
+		packets    []*ACLDataPacket
+		want       [][]byte
+		stats      ReassemblyStats
+	}{
+		{
+			name:    "single fragment",
+			packets: []*ACLDataPacket{start(0x02, 0x00, 0x40, 0x00, 0x01, 0x02)},
+			want:    [][]byte{{0x02, 0x00, 0x40, 0x00, 0x01, 0x02}},
+		},
+		{
+			name:    "fragmented",
+			packets: []*ACLDataPacket{start(0x03, 0x00, 0x40, 0x00, 0x01), cont(0x02), cont(0x03)},
+			want:    [][]byte{{0x03, 0x00, 0x40, 0x00, 0x01, 0x02, 0x03}},
+		},
+		{
+			name: "non-flushable start",
+			packets: []*ACLDataPacket{
+				{PacketBoundaryFlag: ACLPacketBoundaryFirstNonFlushable, Payload: []byte{0x01, 0x00, 0x40, 0x00}},
+				cont(0x01),
+			},
+			want: [][]byte{{0x01, 0x00, 0x40, 0x00, 0x01}},
+		},
+		{
+			name:    "split basic header",
+			packets: []*ACLDataPacket{start(0x01), cont(0x00, 0x40), cont(0x00, 0x01)},
+			want:    [][]byte{{0x01, 0x00, 0x40, 0x00, 0x01}},
+		},
+		{
+			name: "unexpected start",
+			packets: []*ACLDataPacket{
+				start(0x04, 0x00, 0x40, 0x00, 0x01), cont(0x02),
+				start(0x01, 0x00, 0x40, 0x00, 0x03),
+			},
+			want:  [][]byte{{0x01, 0x00, 0x40, 0x00, 0x03}},
+			stats: ReassemblyStats{UnexpectedStart: 2},
+		},
+		{
+			name:    "unexpected continuation",
+			packets: []*ACLDataPacket{cont(0x01), start(0x00, 0x00, 0x40, 0x00)},
+			want:    [][]byte{{0x00, 0x00, 0x40, 0x00}},
+			stats:   ReassemblyStats{UnexpectedContinuation: 1},
+		},
+		{
+			name: "invalid flags",
+			packets: []*ACLDataPacket{
+				{PacketBoundaryFlag: ACLPacketBoundaryComplete, Payload: []byte{0x00, 0x00, 0x40, 0x00}},
+				{PacketBoundaryFlag: ACLPacketBoundaryFirstFlushable, BroadcastFlag: 0b01, Payload: []byte{0x00, 0x00, 0x40, 0x00}},
+			},
+			stats: ReassemblyStats{InvalidFlags: 2},
+		},
+		{
+			name: "longer than declared",
+			packets: []*ACLDataPacket{
+				start(0x02, 0x00, 0x40, 0x00, 0x01), cont(0x02, 0x03), cont(0x04),
+				start(0x00, 0x00, 0x40, 0x00),
+			},
+			want:  [][]byte{{0x00, 0x00, 0x40, 0x00}},
+			stats: ReassemblyStats{Oversized: 3},
+		},
+		{
+			name:       "larger than MaxPDUSize",
+			maxPDUSize: 8,
+			packets: []*ACLDataPacket{
+				start(0x06, 0x00, 0x40, 0x00, 0x01, 0x02), cont(0x03, 0x04), cont(0x05, 0x06),
+				start(0x04, 0x00, 0x40, 0x00, 0x01, 0x02, 0x03, 0x04),
+			},
+			want:  [][]byte{{0x04, 0x00, 0x40, 0x00, 0x01, 0x02, 0x03, 0x04}},
+			stats: ReassemblyStats{Oversized: 3},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Conn{Adapter: &Adapter{}, MaxPDUSize: tc.maxPDUSize}
+			if c.MaxPDUSize == 0 {
+				c.MaxPDUSize = maxPDUSize
+			}
+			var r reassembler
+			var got [][]byte
+			for _, q := range tc.packets {
+				if p := r.push(c, q); p != nil {
+					got = append(got, append([]byte(nil), p.buf...))
+					p.free()
+				}
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("reassembled %d pdus, want %d", len(got), len(tc.want))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tc.want[i]) {
+					t.Errorf("pdu %d = %x, want %x", i, got[i], tc.want[i])
+				}
+			}
+			if s := c.ReassemblyStats(); s != tc.stats {
+				t.Errorf("stats = %+v, want %+v", s, tc.stats)
+			}
+		})
+	}
+}
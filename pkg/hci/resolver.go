@@ -0,0 +1,60 @@
+package hci
+
+import "sync"
+
+// Identity is a bonded peer's identity address and identity resolving key.
+type Identity struct {
+	AddressType PeerAddressType
+	Address     BDAddr
+	IRK         IRK
+}
+
+// Resolver maps resolvable private addresses back to bonded identities in
+// software. It is used when the controller does not support address
+// resolution or its resolving list is full.
+type Resolver struct {
+	mu         sync.Mutex
+	identities []Identity
+}
+
+// Add registers an identity, replacing any existing entry for the same
+// identity address.
+func (r *Resolver) Add(id Identity) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, v := range r.identities {
+		if v.AddressType == id.AddressType && v.Address == id.Address {
+			r.identities[i] = id
+			return
+		}
+	}
+	r.identities = append(r.identities, id)
+}
+
+func (r *Resolver) Remove(addrType PeerAddressType, addr BDAddr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, v := range r.identities {
+		if v.AddressType == addrType && v.Address == addr {
+			r.identities = append(r.identities[:i], r.identities[i+1:]...)
+			return
+		}
+	}
+}
+
+// Resolve returns the identity that generated addr. Addresses that are not
+// resolvable private addresses are never resolved.
+func (r *Resolver) Resolve(addrType PeerAddressType, addr BDAddr) (*Identity, bool) {
+	if addrType != PeerAddressTypeRandomDeviceAddress || addr.Type() != RandomAddressTypeResolvablePrivate {
+		return nil, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range r.identities {
+		if ok, err := ResolvePrivateAddress(v.IRK, addr); err == nil && ok {
+			id := v
+			return &id, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,208 @@
+package hci
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrConnectionNotRegistered is returned by writes on a connection the
+// adapter does not track, such as one replaced by a newer connection with the
+// same handle.
+var ErrConnectionNotRegistered = errors.New("connection not registered")
+
+// TxPriority is the class an outgoing L2CAP PDU is scheduled in.
+type TxPriority uint8
+
+const (
+	TxPrioritySignalling TxPriority = iota
+	TxPriorityATT
+	TxPriorityBulk
+
+	numTxPriorities
+)
+
+// txPriority classifies an L2CAP PDU by its channel identifier.
+func txPriority(pdu []byte) TxPriority {
+	if len(pdu) < 4 {
+		return TxPriorityBulk
+	}
+	switch binary.LittleEndian.Uint16(pdu[2:4]) {
+	case 0x0005, 0x0006: // LE signalling, security manager
+		return TxPrioritySignalling
+	case 0x0004: // attribute protocol
+		return TxPriorityATT
+	}
+	return TxPriorityBulk
+}
+
+// txPDU is an L2CAP PDU queued for transmission as ACL data packets.
+type txPDU struct {
+	fragments []*ACLDataPacket
+	done      chan error
+}
+
+// finish reports the outcome of the PDU. Only the first outcome is kept.
+func (p *txPDU) finish(err error) {
+	select {
+	case p.done <- err:
+	default:
+	}
+}
+
+type txQueue struct {
+	conn    *Conn
+	classes [numTxPriorities][]*txPDU
+	// current is the PDU being transmitted. Its fragments must be sent before
+	// any other PDU on the connection.
+	current *txPDU
+}
+
+// txScheduler shares the controller's ACL buffers between connections. It is
+// guarded by the adapter's ACLPacketsRemainingCond.
+//
+// Connections are served round-robin one fragment at a time, so a bulk
+// transfer cannot starve other connections. Within a connection the highest
+// priority PDU is sent next, so signalling and ATT overtake queued bulk data.
+type txScheduler struct {
+	queues map[uint16]*txQueue
+	order  []uint16
+	next   int
+}
+
+func (s *txScheduler) add(c *Conn) {
+	if s.queues == nil {
+		s.queues = make(map[uint16]*txQueue)
+	}
+	if _, ok := s.queues[c.ConnectionHandle]; !ok {
+		s.order = append(s.order, c.ConnectionHandle)
+	}
+	s.queues[c.ConnectionHandle] = &txQueue{conn: c}
+}
+
+// remove drops the queue of c, failing its pending PDUs with err.
+func (s *txScheduler) remove(c *Conn, err error) {
+	q, ok := s.queues[c.ConnectionHandle]
+	if !ok || q.conn != c {
+		return
+	}
+	if q.current != nil {
+		q.current.finish(err)
+	}
+	for _, class := range q.classes {
+		for _, pdu := range class {
+			pdu.finish(err)
+		}
+	}
+	delete(s.queues, c.ConnectionHandle)
+	for i, h := range s.order {
+		if h == c.ConnectionHandle {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	if s.next >= len(s.order) {
+		s.next = 0
+	}
+}
+
+// pop returns the next fragment to transmit, the PDU it belongs to and whether
+// it is the PDU's last fragment.
+func (s *txScheduler) pop() (*ACLDataPacket, *txPDU, bool) {
+	n := len(s.order)
+	for i := 0; i < n; i++ {
+		k := (s.next + i) % n
+		q := s.queues[s.order[k]]
+		if q.current == nil {
+			for p := range q.classes {
+				if len(q.classes[p]) > 0 {
+					q.current, q.classes[p] = q.classes[p][0], q.classes[p][1:]
+					break
+				}
+			}
+		}
+		if q.current == nil {
+			continue
+		}
+		pdu := q.current
+		f := pdu.fragments[0]
+		pdu.fragments = pdu.fragments[1:]
+		last := len(pdu.fragments) == 0
+		if last {
+			q.current = nil
+		}
+		s.next = (k + 1) % n
+		return f, pdu, last
+	}
+	return nil, nil, false
+}
+
+// transmit sends queued fragments as the controller frees buffers until the
+// adapter is closed.
+func (a *Adapter) transmit() {
+	defer close(a.transmitDone)
+	cond := a.ACLPacketsRemainingCond
+	for {
+		cond.L.Lock()
+		var f *ACLDataPacket
+		var pdu *txPDU
+		var last bool
+		for {
+			if a.ACLPacketsRemaining > 0 {
+				if f, pdu, last = a.tx.pop(); f != nil {
+					break
+				}
+			}
+			if a.isClosing() {
+				cond.L.Unlock()
+				return
+			}
+			cond.Wait()
+		}
+		a.ACLPacketsRemaining--
+		a.ACLPacketsPending[f.ConnectionHandle]++
+		cond.L.Unlock()
+
+		if err := a.Socket.WritePacket(f); err != nil {
+			cond.L.Lock()
+			a.ACLPacketsRemaining++
+			if a.ACLPacketsPending[f.ConnectionHandle]--; a.ACLPacketsPending[f.ConnectionHandle] == 0 {
+				delete(a.ACLPacketsPending, f.ConnectionHandle)
+			}
+			if q, ok := a.tx.queues[f.ConnectionHandle]; ok && q.current == pdu {
+				// the remaining fragments cannot be sent without the one
+				// that failed.
+				q.current = nil
+			}
+			cond.L.Unlock()
+			pdu.finish(err)
+			continue
+		}
+		if last {
+			pdu.finish(nil)
+		}
+	}
+}
+
+// enqueue schedules fragments for transmission on c and waits until they have
+// been handed to the controller.
+func (c *Conn) enqueue(fragments []*ACLDataPacket, priority TxPriority) error {
+	if len(fragments) == 0 {
+		// the transmitter expects every PDU to have a fragment.
+		return errors.New("empty pdu")
+	}
+	pdu := &txPDU{fragments: fragments, done: make(chan error, 1)}
+	c.ACLPacketsRemainingCond.L.Lock()
+	if c.isClosed() {
+		c.ACLPacketsRemainingCond.L.Unlock()
+		return c.closeErr
+	}
+	q, ok := c.tx.queues[c.ConnectionHandle]
+	if !ok || q.conn != c {
+		c.ACLPacketsRemainingCond.L.Unlock()
+		return ErrConnectionNotRegistered
+	}
+	q.classes[priority] = append(q.classes[priority], pdu)
+	c.ACLPacketsRemainingCond.Broadcast()
+	c.ACLPacketsRemainingCond.L.Unlock()
+	return <-pdu.done
+}
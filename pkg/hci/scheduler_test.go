@@ -0,0 +1,76 @@
+package hci
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func newTestConn(handle uint16) *Conn {
+	a := &Adapter{ACLPacketsRemainingCond: sync.NewCond(&sync.Mutex{})}
+	return &Conn{Adapter: a, ConnectionHandle: handle, closed: make(chan struct{})}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	c := newTestConn(1)
+	c.tx.add(c)
+	if n, err := c.Write([]byte{}); n != 0 || err != nil {
+		t.Fatalf("Write(empty) = %d, %v, want 0, nil", n, err)
+	}
+	if err := c.enqueue(nil, TxPriorityBulk); err == nil {
+		t.Fatal("enqueue(nil) succeeded")
+	}
+	if f, _, _ := c.tx.pop(); f != nil {
+		t.Fatalf("pop() = %v, want nothing queued", f)
+	}
+}
+
+func TestEnqueueUnregistered(t *testing.T) {
+	c := newTestConn(1)
+	f := &ACLDataPacket{ConnectionHandle: 1, Payload: []byte{0}}
+	if err := c.enqueue([]*ACLDataPacket{f}, TxPriorityBulk); !errors.Is(err, ErrConnectionNotRegistered) {
+		t.Fatalf("enqueue() = %v, want %v", err, ErrConnectionNotRegistered)
+	}
+
+	// a newer connection with the same handle does not adopt the old one's
+	// writes.
+	c.tx.add(newTestConn(1))
+	if err := c.enqueue([]*ACLDataPacket{f}, TxPriorityBulk); !errors.Is(err, ErrConnectionNotRegistered) {
+		t.Fatalf("enqueue() = %v, want %v", err, ErrConnectionNotRegistered)
+	}
+}
+
+func TestEnqueueClosed(t *testing.T) {
+	c := newTestConn(1)
+	c.tx.add(c)
+	c.closeErr = &DisconnectError{ConnectionHandle: 1}
+	close(c.closed)
+	f := &ACLDataPacket{ConnectionHandle: 1, Payload: []byte{0}}
+	if err := c.enqueue([]*ACLDataPacket{f}, TxPriorityBulk); err != c.closeErr {
+		t.Fatalf("enqueue() = %v, want %v", err, c.closeErr)
+	}
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	c := newTestConn(1)
+	c.tx.add(c)
+	bulk := &txPDU{fragments: []*ACLDataPacket{{Payload: []byte{1}}, {Payload: []byte{2}}}}
+	att := &txPDU{fragments: []*ACLDataPacket{{Payload: []byte{3}}}}
+	q := c.tx.queues[1]
+	q.classes[TxPriorityBulk] = append(q.classes[TxPriorityBulk], bulk)
+
+	// the first fragment of the bulk PDU pins it until it is complete.
+	if f, pdu, last := c.tx.pop(); pdu != bulk || last || f.Payload[0] != 1 {
+		t.Fatalf("pop() = %v, %v, %v", f, pdu, last)
+	}
+	q.classes[TxPriorityATT] = append(q.classes[TxPriorityATT], att)
+	if f, pdu, last := c.tx.pop(); pdu != bulk || !last || f.Payload[0] != 2 {
+		t.Fatalf("pop() = %v, %v, %v", f, pdu, last)
+	}
+	if f, pdu, last := c.tx.pop(); pdu != att || !last || f.Payload[0] != 3 {
+		t.Fatalf("pop() = %v, %v, %v", f, pdu, last)
+	}
+	if f, _, _ := c.tx.pop(); f != nil {
+		t.Fatalf("pop() = %v, want nothing queued", f)
+	}
+}
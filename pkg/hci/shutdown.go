@@ -0,0 +1,90 @@
+package hci
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrAdapterClosed is the error of connections and commands cut short by
+// Adapter.Close.
+var ErrAdapterClosed = errors.New("adapter closed")
+
+// defaultShutdownTimeout bounds how long Close waits for connections to
+// disconnect if no command timeout is set.
+const defaultShutdownTimeout = 2 * time.Second
+
+// isClosing reports whether Close has been called.
+func (a *Adapter) isClosing() bool {
+	select {
+	case <-a.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close shuts the adapter down. Address rotation and supervision stop, every
+// connection is disconnected and the socket is closed. Connections that do
+// not disconnect in time are closed with ErrAdapterClosed. Close returns once
+// the adapter's goroutines have exited.
+func (a *Adapter) Close() error {
+	first := false
+	a.closeOnce.Do(func() {
+		first = true
+		close(a.closing)
+	})
+	if !first {
+		return ErrAdapterClosed
+	}
+
+	a.addressLock.Lock()
+	if a.stopRotation != nil {
+		close(a.stopRotation)
+		a.stopRotation = nil
+	}
+	a.addressLock.Unlock()
+
+	timeout := a.CommandTimeout()
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	var wg sync.WaitGroup
+	for _, c := range a.Connections() {
+		wg.Add(1)
+		go func(c *Conn) {
+			defer wg.Done()
+			c.Close()
+		}(c)
+	}
+	disconnected := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(disconnected)
+	}()
+	t := time.NewTimer(timeout)
+	select {
+	case <-disconnected:
+	case <-t.C:
+	}
+	t.Stop()
+	for _, c := range a.Connections() {
+		c.teardown(ErrAdapterClosed)
+	}
+	a.teardownISOStreams(ErrAdapterClosed)
+
+	// the transmitter exits once woken, the reader once the socket is
+	// closed, failing any command still waiting for a response.
+	a.ACLPacketsRemainingCond.L.Lock()
+	a.ACLPacketsRemainingCond.Broadcast()
+	a.ACLPacketsRemainingCond.L.Unlock()
+	err := a.Socket.Close()
+
+	a.faultLock.Lock()
+	readerDone := a.readerDone
+	a.faultLock.Unlock()
+	<-readerDone
+	<-a.transmitDone
+	<-disconnected
+	return err
+}
@@ -0,0 +1,130 @@
+package hci_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/muxable/bluetooth/pkg/hci"
+	"github.com/muxable/bluetooth/pkg/hci/hcitest"
+)
+
+// returns fails tb unless every blocked call reports on results before the
+// deadline.
+func returns(tb testing.TB, results chan error, n int, check func(error) bool) {
+	tb.Helper()
+	t := time.NewTimer(time.Second)
+	defer t.Stop()
+	for i := 0; i < n; i++ {
+		select {
+		case err := <-results:
+			if !check(err) {
+				tb.Errorf("blocked call returned %v", err)
+			}
+		case <-t.C:
+			tb.Fatalf("%d of %d blocked calls did not return", n-i, n)
+		}
+	}
+}
+
+func TestCloseStopsGoroutines(t *testing.T) {
+	s, c, err := hcitest.NewController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan hci.Opcode, 1)
+	c.HandleCommand = func(opcode hci.Opcode, params []byte) []hci.Packet {
+		if opcode == hci.OpcodeReadBDAddr {
+			// never answer, so the command blocks until Close.
+			received <- opcode
+			return []hci.Packet{}
+		}
+		return nil
+	}
+	// without controller buffers, writes block in the transmit queue.
+	a := hci.NewConn(s)
+	conn := hcitest.Connect(t, a, c, 1, hci.RolePeripheral)
+
+	results := make(chan error, 4)
+	go func() {
+		_, err := a.ReadBDAddr()
+		results <- err
+	}()
+	<-received
+	go func() {
+		_, err := conn.Read(make([]byte, 64))
+		results <- err
+	}()
+	go func() {
+		_, _, err := conn.ReadPDU()
+		results <- err
+	}()
+	go func() {
+		_, err := conn.Write([]byte{0x01, 0x00, 0x40, 0x00, 0xFF})
+		results <- err
+	}()
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	returns(t, results, 4, func(err error) bool { return err != nil })
+	var disconnectErr *hci.DisconnectError
+	if err := conn.Err(); !errors.As(err, &disconnectErr) {
+		t.Errorf("connection closed with %v, want a *DisconnectError", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	hcitest.CheckLeaks(t)
+}
+
+func TestCloseUnresponsiveController(t *testing.T) {
+	s, c, err := hcitest.NewController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.HandleCommand = func(opcode hci.Opcode, params []byte) []hci.Packet {
+		// disconnections are never acknowledged.
+		return []hci.Packet{}
+	}
+	a := hci.NewConn(s)
+	a.SetCommandTimeout(50 * time.Millisecond)
+	conn := hcitest.Connect(t, a, c, 1, hci.RolePeripheral)
+
+	results := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 64))
+		results <- err
+	}()
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	returns(t, results, 1, func(err error) bool { return errors.Is(err, hci.ErrAdapterClosed) })
+	if err := a.Close(); !errors.Is(err, hci.ErrAdapterClosed) {
+		t.Errorf("second Close() = %v, want %v", err, hci.ErrAdapterClosed)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	hcitest.CheckLeaks(t)
+}
+
+func TestControllerGone(t *testing.T) {
+	a, c, err := hcitest.NewAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := hcitest.Connect(t, a, c, 1, hci.RolePeripheral)
+
+	// the reader fails once the controller's end is closed.
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-conn.Done():
+	case <-time.After(time.Second):
+		t.Fatal("connection was not closed")
+	}
+	a.Close()
+	hcitest.CheckLeaks(t)
+}
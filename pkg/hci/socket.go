@@ -1,9 +1,10 @@
 package hci
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"math"
 	"sync"
 	"unsafe"
 
@@ -50,10 +51,48 @@ type devListRequest struct {
 
 // Socket implements a HCI User Channel as ReadWriteCloser.
 type Socket struct {
-	fd     int
-	closed chan struct{}
-	rmu    sync.Mutex
-	wmu    sync.Mutex
+	// ReadBatchSize is the maximum number of packets ReadPacket takes from
+	// the kernel in one system call. Packets beyond the first are only taken
+	// if they are already queued. It must be set before the first read.
+	ReadBatchSize int
+
+	fd int
+	id int
+	// wake is an eventfd signalled by Close to interrupt blocked reads and
+	// writes.
+	wake      int
+	closed    chan struct{}
+	closeOnce sync.Once
+	rmu       sync.Mutex
+	wmu       sync.Mutex
+
+	// scratch holds the packets of the last batch read, guarded by rmu.
+	scratch [][]byte
+	msgs    []mmsghdr
+	iovecs  []unix.Iovec
+	// pending are the packets of the last batch not yet returned.
+	pending [][]byte
+}
+
+// mmsghdr is struct mmsghdr of recvmmsg(2).
+type mmsghdr struct {
+	hdr unix.Msghdr
+	len uint32
+}
+
+// DecodeError is returned by ReadPacket for a packet that was read but could
+// not be decoded. The socket remains usable.
+type DecodeError struct {
+	Packet []byte
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode packet %x: %v", e.Packet, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
 }
 
 // NewSocket returns a HCI User Channel of specified device id.
@@ -67,11 +106,16 @@ func NewSocket(id int) (*Socket, error) {
 	}
 
 	if id != -1 {
-		return open(fd, id)
+		s, err := open(fd, id)
+		if err != nil {
+			unix.Close(fd)
+		}
+		return s, err
 	}
 
 	req := devListRequest{devNum: hciMaxDevices}
 	if err = ioctl(uintptr(fd), hciGetDeviceList, uintptr(unsafe.Pointer(&req))); err != nil {
+		unix.Close(fd)
 		return nil, err
 	}
 	var msg string
@@ -82,28 +126,70 @@ func NewSocket(id int) (*Socket, error) {
 		}
 		msg = msg + fmt.Sprintf("(hci%d: %s)", id, err)
 	}
+	unix.Close(fd)
 	return nil, fmt.Errorf("no devices available: %s", msg)
 }
 
+// NewSocketPair returns two connected sockets that carry packets in memory
+// instead of to a device. One end is used by an Adapter in place of a User
+// Channel, the other by a stand-in controller, see package hcitest.
+func NewSocketPair() (*Socket, *Socket, error) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	var s [2]*Socket
+	for i, fd := range fds {
+		wake, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+		if err != nil {
+			for j := 0; j < i; j++ {
+				s[j].Close()
+			}
+			for _, fd := range fds[i:] {
+				unix.Close(fd)
+			}
+			return nil, nil, err
+		}
+		s[i] = &Socket{fd: fd, id: -1, wake: wake, closed: make(chan struct{})}
+	}
+	return s[0], s[1], nil
+}
+
+// open binds fd to device id and returns it as a Socket. If it fails, fd is
+// left open so that another device can be tried.
 func open(fd, id int) (*Socket, error) {
+	wake, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	if err := bind(fd, id); err != nil {
+		unix.Close(wake)
+		return nil, err
+	}
+	return &Socket{fd: fd, id: id, wake: wake, closed: make(chan struct{})}, nil
+}
+
+// bind binds fd to the HCI User Channel of device id and makes it
+// non-blocking.
+func bind(fd, id int) error {
 	// Reset the device in case previous session didn't cleanup properly.
 	if err := ioctl(uintptr(fd), hciDownDevice, uintptr(id)); err != nil {
-		return nil, err
+		return err
 	}
 	if err := ioctl(uintptr(fd), hciUpDevice, uintptr(id)); err != nil {
-		return nil, err
+		return err
 	}
 
 	// HCI User Channel requires exclusive access to the device.
 	// The device has to be down at the time of binding.
 	if err := ioctl(uintptr(fd), hciDownDevice, uintptr(id)); err != nil {
-		return nil, err
+		return err
 	}
 
 	// Bind the RAW socket to HCI User Channel
 	sa := unix.SockaddrHCI{Dev: uint16(id), Channel: unix.HCI_CHANNEL_USER}
 	if err := unix.Bind(fd, &sa); err != nil {
-		return nil, err
+		return err
 	}
 
 	// poll for 20ms to see if any data becomes available, then clear it
@@ -114,50 +200,288 @@ func open(fd, id int) (*Socket, error) {
 		unix.Read(fd, b)
 	}
 
-	return &Socket{fd: fd, closed: make(chan struct{})}, nil
+	// reads and writes wait in poll so that Close can interrupt them.
+	return unix.SetNonblock(fd, true)
 }
 
-func (s *Socket) Read(p []byte) (int, error) {
+// Reopen closes the underlying socket and binds a new one to the same device.
+// It must not be called while a Read is in progress.
+func (s *Socket) Reopen() error {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
 	select {
 	case <-s.closed:
-		return 0, io.EOF
+		return io.ErrClosedPipe
 	default:
 	}
+	if s.id < 0 {
+		return errors.New("socket is not bound to a device")
+	}
+	unix.Close(s.fd)
+	// packets read from the old socket are stale.
+	s.pending = nil
+	fd, err := unix.Socket(unix.AF_BLUETOOTH, unix.SOCK_RAW, unix.BTPROTO_HCI)
+	if err != nil {
+		return err
+	}
+	if err := bind(fd, s.id); err != nil {
+		unix.Close(fd)
+		return err
+	}
+	s.fd = fd
+	return nil
+}
+
+// signal increments the counter of eventfd fd, making it readable.
+func signal(fd int) {
+	var b [8]byte
+	b[0] = 1
+	unix.Write(fd, b[:])
+}
+
+// wait blocks until the socket is ready for events, it is closed or ctx is
+// done. closedErr is returned if the socket is closed.
+func (s *Socket) wait(ctx context.Context, events int16, closedErr error) error {
+	fds := []unix.PollFd{
+		{Fd: int32(s.fd), Events: events},
+		{Fd: int32(s.wake), Events: unix.POLLIN},
+	}
+	if done := ctx.Done(); done != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		cancel, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+		if err != nil {
+			return err
+		}
+		stop, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-done:
+				signal(cancel)
+			case <-stop:
+			}
+		}()
+		defer func() {
+			// the eventfd may only be closed once nothing signals it.
+			close(stop)
+			<-stopped
+			unix.Close(cancel)
+		}()
+		fds = append(fds, unix.PollFd{Fd: int32(cancel), Events: unix.POLLIN})
+	}
+	for {
+		if _, err := unix.Poll(fds, -1); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return err
+		}
+		if fds[1].Revents != 0 {
+			return closedErr
+		}
+		if len(fds) > 2 && fds[2].Revents != 0 {
+			return ctx.Err()
+		}
+		if fds[0].Revents != 0 {
+			// errors are reported by the next read or write.
+			return nil
+		}
+	}
+}
+
+// do runs op until it does not block, waiting for the socket to become ready
+// for events in between.
+func (s *Socket) do(ctx context.Context, events int16, closedErr error, op func() (int, error)) (int, error) {
+	for {
+		select {
+		case <-s.closed:
+			return 0, closedErr
+		default:
+		}
+		n, err := op()
+		if err != unix.EAGAIN && err != unix.EINTR {
+			return n, err
+		}
+		if err := s.wait(ctx, events, closedErr); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (s *Socket) Read(p []byte) (int, error) {
+	return s.ReadContext(context.Background(), p)
+}
+
+// ReadContext reads a packet into p. It returns io.EOF once the socket is
+// closed and ctx.Err() if ctx is done first.
+func (s *Socket) ReadContext(ctx context.Context, p []byte) (int, error) {
 	s.rmu.Lock()
 	defer s.rmu.Unlock()
-	return unix.Read(s.fd, p)
+	return s.do(ctx, unix.POLLIN, io.EOF, func() (int, error) {
+		return unix.Read(s.fd, p)
+	})
 }
 
 func (s *Socket) Write(p []byte) (int, error) {
+	return s.WriteContext(context.Background(), p)
+}
+
+// WriteContext writes the packet p. It returns io.ErrClosedPipe once the
+// socket is closed and ctx.Err() if ctx is done first.
+func (s *Socket) WriteContext(ctx context.Context, p []byte) (int, error) {
 	s.wmu.Lock()
 	defer s.wmu.Unlock()
-	return unix.Write(s.fd, p)
+	return s.do(ctx, unix.POLLOUT, io.ErrClosedPipe, func() (int, error) {
+		return unix.Write(s.fd, p)
+	})
 }
 
+// ReadPacket reads the next packet. ACL data packets are decoded in a pooled
+// buffer that is reused once the data has been consumed, other packets own
+// their buffer. A packet that cannot be decoded is returned as *DecodeError.
 func (s *Socket) ReadPacket() (Packet, error) {
-	buf := make([]byte, math.MaxUint16)
-	n, err := s.Read(buf)
+	return s.ReadPacketContext(context.Background())
+}
+
+// ReadPacketContext is ReadPacket, returning ctx.Err() if ctx is done before
+// a packet is available.
+func (s *Socket) ReadPacketContext(ctx context.Context) (Packet, error) {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	if len(s.pending) == 0 {
+		if err := s.fill(ctx); err != nil {
+			return nil, err
+		}
+	}
+	raw := s.pending[0]
+	s.pending = s.pending[1:]
+	if ce := zap.L().Check(zap.DebugLevel, "bluetooth reading"); ce != nil {
+		ce.Write(zap.String("packet", fmt.Sprintf("%x", raw)))
+	}
+	p, err := decode(raw)
 	if err != nil {
-		return nil, err
+		return nil, &DecodeError{Packet: append([]byte(nil), raw...), Err: err}
 	}
-	zap.L().Debug("bluetooth reading", zap.String("packet", fmt.Sprintf("%x", buf[:n])))
-	return Unmarshal(buf[:n])
+	return p, nil
+}
+
+// fill reads the next batch of packets into the scratch buffers, blocking
+// until at least one is available.
+func (s *Socket) fill(ctx context.Context) error {
+	n := s.ReadBatchSize
+	if n < 1 {
+		n = 1
+	}
+	if len(s.scratch) != n {
+		s.scratch = make([][]byte, n)
+		s.msgs = make([]mmsghdr, n)
+		s.iovecs = make([]unix.Iovec, n)
+		for i := range s.scratch {
+			s.scratch[i] = make([]byte, maxPacketSize)
+			s.iovecs[i].Base = &s.scratch[i][0]
+			s.iovecs[i].SetLen(maxPacketSize)
+			s.msgs[i].hdr.Iov = &s.iovecs[i]
+			s.msgs[i].hdr.SetIovlen(1)
+		}
+	}
+	if n == 1 {
+		m, err := s.do(ctx, unix.POLLIN, io.EOF, func() (int, error) {
+			return unix.Read(s.fd, s.scratch[0])
+		})
+		if err != nil {
+			return err
+		}
+		if m == 0 {
+			// the device is gone.
+			return io.EOF
+		}
+		s.pending = append(s.pending[:0], s.scratch[0][:m])
+		return nil
+	}
+	// the socket is non-blocking so only queued packets are taken.
+	m, err := s.do(ctx, unix.POLLIN, io.EOF, func() (int, error) {
+		return recvmmsg(s.fd, s.msgs, 0)
+	})
+	if err != nil {
+		return err
+	}
+	s.pending = s.pending[:0]
+	for i := 0; i < m; i++ {
+		if s.msgs[i].len == 0 {
+			// the peer is gone, which the next fill reports if packets
+			// preceded the end.
+			break
+		}
+		s.pending = append(s.pending, s.scratch[i][:s.msgs[i].len])
+	}
+	if len(s.pending) == 0 {
+		return io.EOF
+	}
+	return nil
+}
+
+// recvmmsg receives up to len(msgs) datagrams, see recvmmsg(2).
+func recvmmsg(fd int, msgs []mmsghdr, flags int) (int, error) {
+	n, _, errno := unix.Syscall6(unix.SYS_RECVMMSG, uintptr(fd), uintptr(unsafe.Pointer(&msgs[0])), uintptr(len(msgs)), uintptr(flags), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
+
+// decode decodes a packet held in a scratch buffer. ACL data packets are
+// copied to a pooled buffer and decoded in place. Other packets may be
+// retained by any number of callbacks so they are copied to a buffer of
+// their own.
+func decode(raw []byte) (Packet, error) {
+	if len(raw) > 0 && PacketType(raw[0]) == PacketTypeACLData {
+		b := getBuffer(len(raw))
+		copy(b.b, raw)
+		p := aclPool.Get().(*ACLDataPacket)
+		p.pooled = b
+		if err := p.Unmarshal(b.b); err != nil {
+			releaseACLDataPacket(p)
+			return nil, err
+		}
+		return p, nil
+	}
+	return Unmarshal(append([]byte(nil), raw...))
 }
 
 func (s *Socket) WritePacket(p Packet) error {
+	return s.WritePacketContext(context.Background(), p)
+}
+
+// WritePacketContext is WritePacket, returning ctx.Err() if ctx is done
+// before the packet could be written.
+func (s *Socket) WritePacketContext(ctx context.Context, p Packet) error {
 	buf, err := p.Marshal()
 	if err != nil {
 		return err
 	}
 	zap.L().Debug("bluetooth writing", zap.String("packet", fmt.Sprintf("%x", buf)))
-	_, err = s.Write(buf)
+	_, err = s.WriteContext(ctx, buf)
 	return err
 }
 
+// Close closes the socket. Blocked reads and writes return immediately,
+// nothing is sent to the controller.
 func (s *Socket) Close() error {
-	close(s.closed)
-	s.Write([]byte{0x01, 0x09, 0x10, 0x00})
-	s.rmu.Lock()
-	defer s.rmu.Unlock()
-	return unix.Close(s.fd)
+	err := io.ErrClosedPipe
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		signal(s.wake)
+		// wait for the readers and writers to leave the file descriptors.
+		s.rmu.Lock()
+		defer s.rmu.Unlock()
+		s.wmu.Lock()
+		defer s.wmu.Unlock()
+		err = unix.Close(s.fd)
+		unix.Close(s.wake)
+	})
+	return err
 }
@@ -0,0 +1,206 @@
+package hci_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/muxable/bluetooth/pkg/hci"
+	"github.com/muxable/bluetooth/pkg/hci/hcitest"
+)
+
+// marshalPDU returns the ACL data packets of an L2CAP PDU with size bytes of
+// payload, split into fragments of at most mtu bytes.
+func marshalPDU(tb testing.TB, handle uint16, size, mtu int) [][]byte {
+	pdu := make([]byte, 4+size)
+	binary.LittleEndian.PutUint16(pdu, uint16(size))
+	binary.LittleEndian.PutUint16(pdu[2:], 0x0040)
+	var packets [][]byte
+	for i := 0; i < len(pdu); i += mtu {
+		j := i + mtu
+		if j > len(pdu) {
+			j = len(pdu)
+		}
+		pb := hci.ACLPacketBoundaryFirstFlushable
+		if i > 0 {
+			pb = hci.ACLPacketBoundaryContinuation
+		}
+		buf, err := (&hci.ACLDataPacket{ConnectionHandle: handle, PacketBoundaryFlag: pb, Payload: pdu[i:j]}).Marshal()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		packets = append(packets, buf)
+	}
+	return packets
+}
+
+func TestReadPacketEOF(t *testing.T) {
+	for _, batch := range []int{1, 4} {
+		t.Run(fmt.Sprintf("batch=%d", batch), func(t *testing.T) {
+			s, peer, err := hci.NewSocketPair()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			s.ReadBatchSize = batch
+			if err := peer.WritePacket(&hci.HardwareErrorEventPacket{HardwareCode: 1}); err != nil {
+				t.Fatal(err)
+			}
+			peer.Close()
+
+			// the packets sent before the peer closed are still read.
+			if _, err := s.ReadPacket(); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := s.ReadPacket(); err != io.EOF {
+					t.Fatalf("ReadPacket() = %v, want %v", err, io.EOF)
+				}
+			}
+		})
+	}
+}
+
+// fill writes packets of size bytes to s until a write blocks and fails,
+// reporting the error on results and the number of packets written on
+// written.
+func fill(ctx context.Context, s *hci.Socket, size int, results chan error, written chan int) {
+	p := make([]byte, size)
+	for n := 0; ; n++ {
+		if _, err := s.WriteContext(ctx, p); err != nil {
+			written <- n
+			results <- err
+			return
+		}
+	}
+}
+
+func TestSocketCloseUnblocks(t *testing.T) {
+	s, peer, err := hci.NewSocketPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	results := make(chan error, 2)
+	written := make(chan int, 1)
+	go func() {
+		_, err := s.Read(make([]byte, 64))
+		results <- err
+	}()
+	go fill(context.Background(), s, 1024, results, written)
+	// give both calls time to block.
+	time.Sleep(50 * time.Millisecond)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	returns(t, results, 2, func(err error) bool { return err == io.EOF || err == io.ErrClosedPipe })
+
+	// the peer receives the packets written and then the end of the socket.
+	n := <-written
+	buf := make([]byte, 2048)
+	for i := 0; ; i++ {
+		m, err := peer.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m == 0 {
+			if i != n {
+				t.Errorf("peer read %d packets, want %d", i, n)
+			}
+			break
+		}
+		if m != 1024 {
+			t.Fatalf("peer read a packet of %d bytes that was not written", m)
+		}
+	}
+}
+
+func TestSocketContext(t *testing.T) {
+	s, peer, err := hci.NewSocketPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	defer peer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := make(chan error, 2)
+	written := make(chan int, 1)
+	go func() {
+		_, err := s.ReadContext(ctx, make([]byte, 64))
+		results <- err
+	}()
+	go fill(ctx, s, 1024, results, written)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	returns(t, results, 2, func(err error) bool { return err == context.Canceled })
+
+	// the socket remains usable.
+	if err := peer.WritePacket(&hci.HardwareErrorEventPacket{HardwareCode: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReadPacket(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// BenchmarkReadPDU measures the throughput of L2CAP PDUs from the controller
+// to a reader of the connection.
+func BenchmarkReadPDU(b *testing.B) {
+	for _, bc := range []struct {
+		size, mtu, batch int
+	}{
+		{size: 1000, mtu: 1021, batch: 1},
+		{size: 1000, mtu: 1021, batch: 16},
+		{size: 1000, mtu: 251, batch: 1},
+		{size: 1000, mtu: 251, batch: 16},
+	} {
+		b.Run(fmt.Sprintf("size=%d/mtu=%d/batch=%d", bc.size, bc.mtu, bc.batch), func(b *testing.B) {
+			s, c, err := hcitest.NewController()
+			if err != nil {
+				b.Fatal(err)
+			}
+			s.ReadBatchSize = bc.batch
+			a := hci.NewConn(s)
+			defer c.Close()
+			defer a.Close()
+			conn := hcitest.Connect(b, a, c, 1, hci.RolePeripheral)
+			packets := marshalPDU(b, 1, bc.size, bc.mtu)
+
+			errch := make(chan error, 1)
+			go func() {
+				for i := 0; i < b.N; i++ {
+					for _, p := range packets {
+						if _, err := c.Write(p); err != nil {
+							errch <- err
+							return
+						}
+					}
+				}
+				errch <- nil
+			}()
+
+			b.SetBytes(int64(bc.size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				buf, release, err := conn.ReadPDU()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(buf) != 4+bc.size {
+					b.Fatalf("read %d bytes, want %d", len(buf), 4+bc.size)
+				}
+				release()
+			}
+			b.StopTimer()
+			if err := <-errch; err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package hci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrCommandTimeout is returned when the controller does not respond to a
+	// command within the adapter's CommandTimeout.
+	ErrCommandTimeout = errors.New("command timed out")
+
+	// ErrRecovering is delivered to pending operations when the supervisor
+	// resets the controller.
+	ErrRecovering = errors.New("controller recovering")
+)
+
+// Section 7.7.16
+type HardwareErrorEventPacket struct {
+	HardwareCode uint8
+}
+
+func (p *HardwareErrorEventPacket) Unmarshal(buf []byte) error {
+	if buf[0] != byte(PacketTypeEvent) || buf[1] != byte(EventCodeHardwareError) {
+		return errors.New("incorrect packet")
+	}
+	if buf[2] != 1 || len(buf) != 4 {
+		return io.ErrShortBuffer
+	}
+	p.HardwareCode = buf[3]
+	return nil
+}
+
+func (p *HardwareErrorEventPacket) Marshal() ([]byte, error) {
+	buf := make([]byte, 4)
+	buf[0] = byte(PacketTypeEvent)
+	buf[1] = byte(EventCodeHardwareError)
+	buf[2] = 1
+	buf[3] = p.HardwareCode
+	return buf, nil
+}
+
+type RecoveryReason uint8
+
+const (
+	RecoveryReasonHardwareError RecoveryReason = iota
+	RecoveryReasonCommandTimeout
+	RecoveryReasonSocketLost
+)
+
+func (r RecoveryReason) String() string {
+	switch r {
+	case RecoveryReasonHardwareError:
+		return "hardware error"
+	case RecoveryReasonCommandTimeout:
+		return "command timeout"
+	case RecoveryReasonSocketLost:
+		return "socket lost"
+	}
+	return fmt.Sprintf("RecoveryReason(%d)", uint8(r))
+}
+
+type fault struct {
+	reason       RecoveryReason
+	hardwareCode uint8
+	err          error
+}
+
+// RecoveryEvent describes a recovery performed by the supervisor.
+type RecoveryEvent struct {
+	Reason RecoveryReason
+	// HardwareCode is the code reported by the controller for
+	// RecoveryReasonHardwareError.
+	HardwareCode uint8
+	// Err is the error that triggered the recovery, if any.
+	Err error
+	// LostConnections were terminated by the recovery. Their reads and writes
+	// fail with a *DisconnectError carrying DisconnectReasonHardwareFailure.
+	LostConnections []*Conn
+	// RecoveryErr is set if the controller could not be recovered.
+	RecoveryErr error
+}
+
+type SupervisorOptions struct {
+	// CommandTimeout is applied to the adapter while supervised. It defaults
+	// to two seconds.
+	CommandTimeout time.Duration
+	// MaxAttempts bounds the attempts to recover from a single fault. It
+	// defaults to five.
+	MaxAttempts int
+	// Backoff is the delay between attempts. It defaults to one second.
+	Backoff time.Duration
+	// OnRecovery, if set, is called after every recovery.
+	OnRecovery func(*RecoveryEvent)
+}
+
+// Supervise monitors the adapter for hardware errors, command timeouts and the
+// loss of the socket and recovers from them by reopening the socket if
+// necessary, resetting the controller, repeating Init with the options it was
+// last called with and restoring what the host configured since: the random
+// address, the filter accept and resolving lists, address resolution, legacy
+// advertising, advertising sets with their periodic advertising trains, and
+// extended scanning. Connections do not survive a reset and are reported as
+// lost. ISO streams and periodic advertising syncs are lost too and have to
+// be set up again. Supervise blocks until ctx is done.
+func (a *Adapter) Supervise(ctx context.Context, opts *SupervisorOptions) error {
+	if opts == nil {
+		opts = &SupervisorOptions{}
+	}
+	if opts.CommandTimeout == 0 {
+		opts.CommandTimeout = 2 * time.Second
+	}
+	if opts.MaxAttempts == 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = time.Second
+	}
+
+	faults := make(chan *fault, 1)
+	a.faultLock.Lock()
+	if a.faults != nil {
+		a.faultLock.Unlock()
+		return errors.New("already supervised")
+	}
+	a.faults = faults
+	a.faultLock.Unlock()
+	a.SetCommandTimeout(opts.CommandTimeout)
+	defer func() {
+		a.faultLock.Lock()
+		a.faults = nil
+		a.faultLock.Unlock()
+	}()
+
+	// the reader may have failed before supervision started.
+	select {
+	case <-a.readerDone:
+		a.fault(&fault{reason: RecoveryReasonSocketLost, err: io.ErrUnexpectedEOF})
+	default:
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-a.closing:
+			return ErrAdapterClosed
+		case f := <-faults:
+			e := a.recoverFrom(ctx, f, opts)
+			if e.RecoveryErr != nil {
+				zap.L().Error("controller recovery failed", zap.Stringer("reason", e.Reason), zap.Error(e.RecoveryErr))
+			} else {
+				zap.L().Warn("controller recovered", zap.Stringer("reason", e.Reason), zap.Int("lost", len(e.LostConnections)))
+			}
+			if opts.OnRecovery != nil {
+				opts.OnRecovery(e)
+			}
+			// faults raised while recovering were caused by the recovery.
+			select {
+			case <-faults:
+			default:
+			}
+		}
+	}
+}
+
+// fault reports f to the supervisor and reports whether one is running.
+func (a *Adapter) fault(f *fault) bool {
+	a.faultLock.Lock()
+	defer a.faultLock.Unlock()
+	if a.faults == nil || a.isClosing() {
+		return false
+	}
+	select {
+	case a.faults <- f:
+	default:
+		// a recovery is already pending.
+	}
+	return true
+}
+
+func (a *Adapter) recoverFrom(ctx context.Context, f *fault, opts *SupervisorOptions) *RecoveryEvent {
+	e := &RecoveryEvent{Reason: f.reason, HardwareCode: f.hardwareCode, Err: f.err}
+
+	cause := f.err
+	if cause == nil {
+		cause = fmt.Errorf("hardware error 0x%02x", f.hardwareCode)
+	}
+	// failing the pending commands also ends a connection attempt, which
+	// holds addressLock.
+	a.broadcast(nil, fmt.Errorf("%w: %s: %v", ErrRecovering, f.reason, cause))
+
+	// the host state is cleared now rather than by the reset so that the
+	// connections are closed even if the controller cannot be reached.
+	state := a.snapshot()
+	e.LostConnections = a.resetHostState(DisconnectReasonHardwareFailure)
+	a.faultLock.Lock()
+	var initOptions InitOptions
+	if a.initOptions != nil {
+		initOptions = *a.initOptions
+	}
+	a.faultLock.Unlock()
+	// advertising is restored from its last state rather than the initial
+	// options.
+	initOptions.AdvertisingData = nil
+	initOptions.AdvertisingParameters = nil
+	initOptions.Advertise = false
+
+	for attempt := 1; ; attempt++ {
+		err := a.restart(ctx, &initOptions)
+		if err == nil {
+			err = a.restore(state)
+		}
+		if err == nil {
+			return e
+		}
+		if attempt >= opts.MaxAttempts {
+			e.RecoveryErr = err
+			return e
+		}
+		zap.L().Warn("controller recovery attempt failed", zap.Int("attempt", attempt), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			e.RecoveryErr = ctx.Err()
+			return e
+		case <-a.closing:
+			e.RecoveryErr = ErrAdapterClosed
+			return e
+		case <-time.After(opts.Backoff):
+		}
+	}
+}
+
+// restart reopens the socket if the reader has stopped and initializes the
+// controller.
+func (a *Adapter) restart(ctx context.Context, opts *InitOptions) error {
+	select {
+	case <-a.readerDone:
+		if err := a.Reopen(); err != nil {
+			return err
+		}
+		a.faultLock.Lock()
+		if a.isClosing() {
+			a.faultLock.Unlock()
+			return ErrAdapterClosed
+		}
+		a.readerDone = make(chan struct{})
+		go a.readLoop(a.readerDone)
+		a.faultLock.Unlock()
+	default:
+	}
+	_, err := a.init(ctx, opts, DisconnectReasonHardwareFailure)
+	return err
+}
+
+// hostState is the configuration the host has programmed into the
+// controller, which a reset clears.
+type hostState struct {
+	randomAddress     BDAddr
+	filterAcceptList  []FilterAcceptListEntry
+	resolvingList     []resolvingListEntry
+	addressResolution bool
+	rpaTimeout        time.Duration
+
+	advertisingParameters *SetAdvertisingParametersRequest
+	advertisingData       []DataType
+	advertising           bool
+	// advertisingSets is ordered by handle.
+	advertisingSets []advertisingSet
+
+	scanParameters *SetExtendedScanParametersRequest
+	scan           *HCILESetExtendedScanEnableCommandPacket
+}
+
+// snapshot returns the host's configuration of the controller.
+func (a *Adapter) snapshot() *hostState {
+	s := &hostState{randomAddress: a.RandomAddress(), filterAcceptList: a.FilterAcceptList()}
+
+	a.resolvingListLock.Lock()
+	s.resolvingList, s.addressResolution, s.rpaTimeout = a.resolvingList, a.addressResolution, a.rpaTimeout
+	a.resolvingListLock.Unlock()
+
+	a.addressLock.Lock()
+	s.advertisingParameters, s.advertisingData = a.advertisingParameters, a.advertisingData
+	a.activityLock.Lock()
+	s.advertising, s.scanParameters, s.scan = a.advertising, a.scanParameters, a.scan
+	for _, set := range a.advertisingSets {
+		s.advertisingSets = append(s.advertisingSets, *set)
+	}
+	a.activityLock.Unlock()
+	a.addressLock.Unlock()
+	sort.Slice(s.advertisingSets, func(i, j int) bool {
+		return s.advertisingSets[i].parameters.AdvertisingHandle < s.advertisingSets[j].parameters.AdvertisingHandle
+	})
+	return s
+}
+
+// restore programs s into the controller after a reset. Advertising sets
+// that were enabled for a duration are enabled for all of it again.
+func (a *Adapter) restore(s *hostState) error {
+	if s.randomAddress != (BDAddr{}) {
+		if err := a.LESetRandomAddress(s.randomAddress); err != nil {
+			return err
+		}
+	}
+	for _, e := range s.filterAcceptList {
+		if err := a.AddDeviceToFilterAcceptList(e.AddressType, e.Address); err != nil {
+			return err
+		}
+	}
+	for _, e := range s.resolvingList {
+		if err := a.LEAddDeviceToResolvingList(e.peerType, e.peer, e.peerIRK, e.localIRK); err != nil {
+			return err
+		}
+		if e.privacyMode == PrivacyModeNetwork {
+			continue
+		}
+		if err := a.LESetPrivacyMode(e.peerType, e.peer, e.privacyMode); err != nil {
+			return err
+		}
+	}
+	if s.rpaTimeout != 0 {
+		if err := a.LESetResolvablePrivateAddressTimeout(s.rpaTimeout); err != nil {
+			return err
+		}
+	}
+	if s.addressResolution {
+		if err := a.LESetAddressResolutionEnable(true); err != nil {
+			return err
+		}
+	}
+	if s.advertisingData != nil {
+		if err := a.SetAdvertisingData(s.advertisingData...); err != nil {
+			return err
+		}
+	}
+	if s.advertisingParameters != nil {
+		if err := a.LESetAdvertisingParameters(s.advertisingParameters); err != nil {
+			return err
+		}
+	}
+	var enabled []ExtendedAdvertisingSet
+	for _, set := range s.advertisingSets {
+		parameters := set.parameters
+		if _, err := a.LESetExtendedAdvertisingParameters(&parameters); err != nil {
+			return err
+		}
+		handle := parameters.AdvertisingHandle
+		if set.periodicParameters != nil {
+			if err := a.LESetPeriodicAdvertisingParametersV2(set.periodicParameters); err != nil {
+				return err
+			}
+		}
+		if set.periodic != 0 {
+			if err := a.LESetPeriodicAdvertisingEnable(handle, set.periodic); err != nil {
+				return err
+			}
+		}
+		if set.enabled != nil {
+			enabled = append(enabled, *set.enabled)
+		}
+	}
+	if len(enabled) > 0 {
+		if err := a.LESetExtendedAdvertisingEnable(true, enabled...); err != nil {
+			return err
+		}
+	}
+	if s.scanParameters != nil {
+		if err := a.LESetExtendedScanParameters(s.scanParameters); err != nil {
+			return err
+		}
+	}
+	if s.advertising {
+		if err := a.LESetAdvertisingEnable(true); err != nil {
+			return err
+		}
+	}
+	if s.scan != nil {
+		return a.LESetExtendedScanEnable(true, s.scan.FilterDuplicates, s.scan.Duration, s.scan.Period)
+	}
+	return nil
+}
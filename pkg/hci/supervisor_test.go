@@ -0,0 +1,134 @@
+package hci_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/muxable/bluetooth/pkg/hci"
+	"github.com/muxable/bluetooth/pkg/hci/hcitest"
+)
+
+func TestRecoveryRestoresHostState(t *testing.T) {
+	s, c, err := hcitest.NewController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := map[hci.Opcode]bool{
+		hci.OpcodeLESetRandomAddress:                   true,
+		hci.OpcodeAddDeviceToFilterAcceptList:          true,
+		hci.OpcodeLEAddDeviceToResolvingList:           true,
+		hci.OpcodeLESetAddressResolutionEnable:         true,
+		hci.OpcodeLESetExtendedAdvertisingParameters:   true,
+		hci.OpcodeLESetAdvertisingSetRandomAddress:     true,
+		hci.OpcodeLESetPeriodicAdvertisingParametersV2: true,
+		hci.OpcodeLESetPeriodicAdvertisingEnable:       true,
+		hci.OpcodeLESetExtendedAdvertisingEnable:       true,
+		hci.OpcodeLESetExtendedScanParameters:          true,
+		hci.OpcodeLESetExtendedScanEnable:              true,
+	}
+	var lock sync.Mutex
+	var commands []hci.Opcode
+	c.HandleCommand = func(opcode hci.Opcode, params []byte) []hci.Packet {
+		lock.Lock()
+		defer lock.Unlock()
+		if opcode == hci.OpcodeReset {
+			commands = nil
+		}
+		if restored[opcode] {
+			commands = append(commands, opcode)
+		}
+		return nil
+	}
+	a := hci.NewConn(s)
+	defer c.Close()
+	defer a.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := a.Init(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	steps := []func() error{
+		func() error { return a.LESetRandomAddress(hci.BDAddr{1, 0, 0, 0, 0, 0xC0}) },
+		func() error {
+			return a.AddDeviceToFilterAcceptList(hci.PeerAddressTypePublicDeviceAddress, hci.BDAddr{2})
+		},
+		func() error {
+			return a.LEAddDeviceToResolvingList(hci.PeerAddressTypePublicDeviceAddress, hci.BDAddr{2}, hci.IRK{1}, hci.IRK{2})
+		},
+		func() error { return a.LESetAddressResolutionEnable(true) },
+		func() error {
+			_, err := a.LESetExtendedAdvertisingParameters(&hci.SetExtendedAdvertisingParametersRequest{
+				AdvertisingHandle: 1,
+				OwnAddressType:    hci.OwnAddressTypeRandomDeviceAddress,
+			})
+			return err
+		},
+		func() error {
+			return a.LESetPeriodicAdvertisingParametersV2(&hci.SetPeriodicAdvertisingParametersV2Request{
+				AdvertisingHandle:              1,
+				PeriodicAdvertisingIntervalMin: 0x0006,
+				PeriodicAdvertisingIntervalMax: 0x0006,
+			})
+		},
+		func() error { return a.LESetPeriodicAdvertisingEnable(1, hci.PeriodicAdvertisingEnableEnable) },
+		func() error {
+			return a.LESetExtendedAdvertisingEnable(true, hci.ExtendedAdvertisingSet{AdvertisingHandle: 1})
+		},
+		func() error {
+			return a.LESetExtendedScanParameters(&hci.SetExtendedScanParametersRequest{
+				Parameters: []hci.ScanningPHYParameters{{ScanInterval: 0x10, ScanWindow: 0x10}},
+			})
+		},
+		func() error { return a.LESetExtendedScanEnable(true, 0, 0, 0) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recovered := make(chan *hci.RecoveryEvent, 1)
+	opts := &hci.SupervisorOptions{
+		CommandTimeout: 1500 * time.Millisecond,
+		OnRecovery:     func(e *hci.RecoveryEvent) { recovered <- e },
+	}
+	go a.Supervise(ctx, opts)
+	// supervision has started once its command timeout is applied.
+	for a.CommandTimeout() != opts.CommandTimeout {
+		time.Sleep(time.Millisecond)
+	}
+	if err := c.WritePacket(&hci.HardwareErrorEventPacket{HardwareCode: 1}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-recovered:
+		if e.RecoveryErr != nil {
+			t.Fatal(e.RecoveryErr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the controller was not recovered")
+	}
+
+	want := []hci.Opcode{
+		hci.OpcodeLESetRandomAddress,
+		hci.OpcodeAddDeviceToFilterAcceptList,
+		hci.OpcodeLEAddDeviceToResolvingList,
+		hci.OpcodeLESetAddressResolutionEnable,
+		hci.OpcodeLESetExtendedAdvertisingParameters,
+		hci.OpcodeLESetAdvertisingSetRandomAddress,
+		hci.OpcodeLESetPeriodicAdvertisingParametersV2,
+		hci.OpcodeLESetPeriodicAdvertisingEnable,
+		hci.OpcodeLESetExtendedAdvertisingEnable,
+		hci.OpcodeLESetExtendedScanParameters,
+		hci.OpcodeLESetExtendedScanEnable,
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if !reflect.DeepEqual(commands, want) {
+		t.Errorf("restored with %04x, want %04x", commands, want)
+	}
+}
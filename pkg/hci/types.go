@@ -14,6 +14,11 @@ type PeerAddressType uint8
 const (
 	PeerAddressTypePublicDeviceAddress PeerAddressType = 0x00
 	PeerAddressTypeRandomDeviceAddress PeerAddressType = 0x01
+
+	// Reported in connection events when the controller resolved the peer's
+	// resolvable private address to an identity address.
+	PeerAddressTypePublicIdentityAddress PeerAddressType = 0x02
+	PeerAddressTypeRandomIdentityAddress PeerAddressType = 0x03
 )
 
 type BDAddr [6]byte
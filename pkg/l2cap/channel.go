@@ -2,6 +2,7 @@ package l2cap
 
 import (
 	"encoding/binary"
+	"errors"
 	"io"
 	"sync"
 )
@@ -25,7 +26,42 @@ type ConnectionOrientedChannel struct {
 
 	writeMutex        sync.Mutex // this is necessary to prevent writes from interfering with each other.
 	txCreditSemaphore *sync.Cond
-	rxCh              chan []byte
+	rxCh              chan *rxSDU
+	closeOnce         sync.Once
+	closed            chan struct{}
+	closeErr          error
+}
+
+// rxSDU is a reassembled SDU and the function that releases the last frame
+// it was received in.
+type rxSDU struct {
+	buf     []byte
+	release func()
+}
+
+// ErrChannelClosed is returned by writes to a channel that was closed by
+// either side.
+var ErrChannelClosed = errors.New("channel closed")
+
+// close closes the channel with err, waking blocked readers and writers. Only
+// the first call has an effect.
+func (c *ConnectionOrientedChannel) close(err error) {
+	c.closeOnce.Do(func() {
+		c.closeErr = err
+		close(c.closed)
+		c.txCreditSemaphore.L.Lock()
+		c.txCreditSemaphore.Broadcast()
+		c.txCreditSemaphore.L.Unlock()
+	})
+}
+
+func (c *ConnectionOrientedChannel) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
 }
 
 type ApprovedConnectionOrientedChannel struct {
@@ -53,7 +89,13 @@ func (c *ConnectionOrientedChannel) Approve(initiallyPaused bool, rxMTU uint16)
 
 	a := &ApprovedConnectionOrientedChannel{ConnectionOrientedChannel: c}
 
+	c.L2CAPConn.cocsLock.Lock()
 	c.L2CAPConn.cocs[c.RxCID] = a
+	c.L2CAPConn.cocsLock.Unlock()
+	if err := c.L2CAPConn.HCIConn.Err(); err != nil {
+		// the connection closed before the channel could be watched.
+		c.close(err)
+	}
 
 	return a, c.L2CAPConn.writeSignallingPacket(ChannelIDSignallingLEU, r)
 }
@@ -67,8 +109,18 @@ func (c *ConnectionOrientedChannel) Reject(result LECreditBasedConnectionResult)
 	return c.L2CAPConn.writeSignallingPacket(ChannelIDSignallingLEU, r)
 }
 
-func (c *ConnectionOrientedChannel) receive(buf []byte) error {
+// receive handles a K-frame. The frame that completes an SDU is released once
+// the SDU has been read. The others are copied to RxBuf and released right
+// away, so that an SDU spanning more frames than the controller may hold
+// for the host can complete.
+func (c *ConnectionOrientedChannel) receive(buf []byte, release func()) error {
+	if c.isClosed() {
+		release()
+		return nil
+	}
 	if c.RxCredits == 0 || (c.RxSDUBytesLeft == 0 && len(buf) < 2) {
+		release()
+		c.discard()
 		return c.L2CAPConn.writeSignallingPacket(ChannelIDSignallingLEU, &DisconnectionRequestPacket{
 			Identifier:     NextIdentifier(),
 			DestinationCID: c.TxCID,
@@ -84,6 +136,8 @@ func (c *ConnectionOrientedChannel) receive(buf []byte) error {
 	}
 
 	if len(buf) > int(c.RxSDUBytesLeft) || len(buf) > int(c.RxMPS) || c.RxSDUBytesLeft > c.RxMTU {
+		release()
+		c.discard()
 		return c.L2CAPConn.writeSignallingPacket(ChannelIDSignallingLEU, &DisconnectionRequestPacket{
 			Identifier:     NextIdentifier(),
 			DestinationCID: c.TxCID,
@@ -91,12 +145,27 @@ func (c *ConnectionOrientedChannel) receive(buf []byte) error {
 		})
 	}
 
-	c.RxBuf = append(c.RxBuf, buf...)
+	if c.RxBuf == nil && len(buf) == int(c.RxSDUBytesLeft) {
+		// an SDU in a single K-frame is read from the PDU's buffer.
+		c.RxBuf = buf
+	} else {
+		if c.RxBuf == nil {
+			c.RxBuf = make([]byte, 0, c.RxSDUBytesLeft)
+		}
+		c.RxBuf = append(c.RxBuf, buf...)
+	}
 	c.RxSDUBytesLeft -= uint16(len(buf))
 
 	if c.RxSDUBytesLeft == 0 {
-		c.rxCh <- c.RxBuf
+		s := &rxSDU{buf: c.RxBuf, release: release}
+		select {
+		case c.rxCh <- s:
+		case <-c.closed:
+			release()
+		}
 		c.RxBuf = nil
+	} else {
+		release()
 	}
 	// assign new credits if necessary
 	if c.RxCredits <= 70 {
@@ -112,15 +181,23 @@ func (c *ConnectionOrientedChannel) receive(buf []byte) error {
 	return nil
 }
 
+// discard drops the partially received SDU.
+func (c *ConnectionOrientedChannel) discard() {
+	c.RxBuf, c.RxSDUBytesLeft = nil, 0
+}
+
 func (c *ApprovedConnectionOrientedChannel) Read(buf []byte) (int, error) {
-	b, ok := <-c.rxCh
-	if !ok {
+	var s *rxSDU
+	select {
+	case s = <-c.rxCh:
+	case <-c.closed:
 		return 0, io.EOF
 	}
-	if len(buf) < len(b) {
+	defer s.release()
+	if len(buf) < len(s.buf) {
 		return 0, io.ErrShortBuffer
 	}
-	return copy(buf, b), nil
+	return copy(buf, s.buf), nil
 }
 
 func (c *ApprovedConnectionOrientedChannel) Write(buf []byte) (int, error) {
@@ -131,18 +208,21 @@ func (c *ApprovedConnectionOrientedChannel) Write(buf []byte) (int, error) {
 	binary.LittleEndian.PutUint16(sdu, uint16(len(sdu)-2))
 	for i := 0; i < len(sdu); i += int(c.TxMPS) {
 		c.txCreditSemaphore.L.Lock()
-		for c.TxCredits == 0 {
+		for c.TxCredits == 0 && !c.isClosed() {
 			c.txCreditSemaphore.Wait()
 		}
-		c.txCreditSemaphore.L.Unlock()
-
+		if c.isClosed() {
+			c.txCreditSemaphore.L.Unlock()
+			return 0, c.closeErr
+		}
 		c.TxCredits--
+		c.txCreditSemaphore.L.Unlock()
 
 		j := i + int(c.TxMPS)
 		if j > len(sdu) {
 			j = len(sdu)
 		}
-		
+
 		f := &BFrame{ChannelID: c.TxCID, Payload: sdu[i:j]}
 		fbuf, err := f.Marshal()
 		if err != nil {
@@ -156,7 +236,9 @@ func (c *ApprovedConnectionOrientedChannel) Write(buf []byte) (int, error) {
 	return len(buf), nil
 }
 
+// Close closes the channel locally. Blocked reads return io.EOF and writes
+// ErrChannelClosed.
 func (c *ApprovedConnectionOrientedChannel) Close() error {
-	close(c.rxCh)
+	c.close(ErrChannelClosed)
 	return nil
 }
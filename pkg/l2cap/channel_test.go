@@ -0,0 +1,204 @@
+package l2cap_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/muxable/bluetooth/pkg/hci"
+	"github.com/muxable/bluetooth/pkg/hci/hcitest"
+	"github.com/muxable/bluetooth/pkg/l2cap"
+)
+
+// writeFrame sends a B-frame from the peer in a single ACL data packet.
+func writeFrame(tb testing.TB, c *hcitest.Controller, handle uint16, f *l2cap.BFrame) {
+	tb.Helper()
+	buf, err := f.Marshal()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := c.WritePacket(&hci.ACLDataPacket{
+		ConnectionHandle:   handle,
+		PacketBoundaryFlag: hci.ACLPacketBoundaryFirstFlushable,
+		Payload:            buf,
+	}); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// openChannel has the peer open a credit based channel, granting credits
+// K-frames, and approves it.
+func openChannel(tb testing.TB, c *hcitest.Controller, conn *l2cap.Conn, mtu, mps, credits uint16) *l2cap.ApprovedConnectionOrientedChannel {
+	tb.Helper()
+	req, err := (&l2cap.LECreditBasedConnectionRequestPacket{
+		Identifier:     1,
+		SPSM:           0x0080,
+		SourceCID:      0x0040,
+		MTU:            mtu,
+		MPS:            mps,
+		InitialCredits: credits,
+	}).Marshal()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	writeFrame(tb, c, conn.HCIConn.ConnectionHandle, &l2cap.BFrame{ChannelID: l2cap.ChannelIDSignallingLEU, Payload: req})
+	ch, err := conn.Accept()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	approved, err := ch.Approve(false, mtu)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	// frames for the channel are dispatched by Accept.
+	go func() {
+		for {
+			if _, err := conn.Accept(); err != nil {
+				return
+			}
+		}
+	}()
+	return approved
+}
+
+// BenchmarkChannelRead measures the throughput of SDUs from the peer to a
+// reader of a credit based channel.
+func BenchmarkChannelRead(b *testing.B) {
+	for _, size := range []int{200, 1000, 4000} {
+		b.Run(fmt.Sprintf("sdu=%d", size), func(b *testing.B) {
+			a, c, err := hcitest.NewAdapter()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer c.Close()
+			defer a.Close()
+			hciConn := hcitest.Connect(b, a, c, 1, hci.RolePeripheral)
+			ch := openChannel(b, c, l2cap.NewConn(hciConn), 4096, 1004, 0xFFFF)
+
+			// segment the SDU into K-frames of the channel's MPS.
+			sdu := make([]byte, 2+size)
+			binary.LittleEndian.PutUint16(sdu, uint16(size))
+			var packets [][]byte
+			for i := 0; i < len(sdu); i += int(ch.RxMPS) {
+				j := i + int(ch.RxMPS)
+				if j > len(sdu) {
+					j = len(sdu)
+				}
+				f, err := (&l2cap.BFrame{ChannelID: ch.RxCID, Payload: sdu[i:j]}).Marshal()
+				if err != nil {
+					b.Fatal(err)
+				}
+				p, err := (&hci.ACLDataPacket{
+					ConnectionHandle:   1,
+					PacketBoundaryFlag: hci.ACLPacketBoundaryFirstFlushable,
+					Payload:            f,
+				}).Marshal()
+				if err != nil {
+					b.Fatal(err)
+				}
+				packets = append(packets, p)
+			}
+
+			errch := make(chan error, 1)
+			go func() {
+				for i := 0; i < b.N; i++ {
+					for _, p := range packets {
+						if _, err := c.Write(p); err != nil {
+							errch <- err
+							return
+						}
+					}
+				}
+				errch <- nil
+			}()
+
+			buf := make([]byte, size)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n, err := ch.Read(buf)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if n != size {
+					b.Fatalf("read %d bytes, want %d", n, size)
+				}
+			}
+			b.StopTimer()
+			if err := <-errch; err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestChannelReadCredits(t *testing.T) {
+	s, c, err := hcitest.NewController()
+	if err != nil {
+		t.Fatal(err)
+	}
+	returned := make(chan uint16, 64)
+	c.HandleCommand = func(opcode hci.Opcode, params []byte) []hci.Packet {
+		if opcode != hci.OpcodeHostNumberOfCompletedPackets {
+			return nil
+		}
+		for i := 0; i < int(params[0]); i++ {
+			returned <- binary.LittleEndian.Uint16(params[1+2*int(params[0])+2*i:])
+		}
+		return []hci.Packet{}
+	}
+	// expect waits for the host to return n credits and checks that no more
+	// follow.
+	expect := func(n int) {
+		t.Helper()
+		got := 0
+		for got < n {
+			select {
+			case m := <-returned:
+				got += int(m)
+			case <-time.After(time.Second):
+				t.Fatalf("%d credits returned, want %d", got, n)
+			}
+		}
+		select {
+		case m := <-returned:
+			t.Fatalf("%d credits returned, want %d", got+int(m), n)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	a := hci.NewConn(s)
+	a.ACLPacketsRemainingCond.L.Lock()
+	a.ACLPacketsRemaining = hcitest.ACLPackets
+	a.ACLPacketsRemainingCond.L.Unlock()
+	defer c.Close()
+	defer a.Close()
+	if err := a.EnableHostFlowControl(27, 4); err != nil {
+		t.Fatal(err)
+	}
+	ch := openChannel(t, c, l2cap.NewConn(hcitest.Connect(t, a, c, 1, hci.RolePeripheral)), 1000, 100, 100)
+	// the connection request.
+	expect(1)
+
+	// the SDU spans more K-frames than the host has buffers for.
+	const size, mps = 600, 50
+	sdu := make([]byte, 2+size)
+	binary.LittleEndian.PutUint16(sdu, size)
+	frames := 0
+	for i := 0; i < len(sdu); i += mps {
+		j := i + mps
+		if j > len(sdu) {
+			j = len(sdu)
+		}
+		writeFrame(t, c, 1, &l2cap.BFrame{ChannelID: ch.RxCID, Payload: sdu[i:j]})
+		frames++
+	}
+	// the frames are copied, only the SDU holds a credit until it is read.
+	expect(frames - 1)
+	buf := make([]byte, size)
+	if n, err := ch.Read(buf); err != nil || n != size {
+		t.Fatalf("Read() = %d, %v, want %d", n, err, size)
+	}
+	expect(1)
+}
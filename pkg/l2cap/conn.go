@@ -1,9 +1,13 @@
 package l2cap
 
 import (
+	"context"
+	"encoding/binary"
 	"errors"
+	"io"
 	"math"
 	"sync"
+	"time"
 
 	"github.com/muxable/bluetooth/pkg/hci"
 	"go.uber.org/zap"
@@ -12,8 +16,11 @@ import (
 type Conn struct {
 	HCIConn *hci.Conn
 
+	cocsLock      sync.Mutex
 	cocs          map[ChannelID]*ApprovedConnectionOrientedChannel
 	nextChannelID ChannelID
+
+	paramUpdateCh chan *ConnectionParameterUpdateResponsePacket
 }
 
 func NewConn(conn *hci.Conn) *Conn {
@@ -21,163 +28,332 @@ func NewConn(conn *hci.Conn) *Conn {
 		HCIConn:       conn,
 		cocs:          make(map[ChannelID]*ApprovedConnectionOrientedChannel),
 		nextChannelID: 0x40,
+		paramUpdateCh: make(chan *ConnectionParameterUpdateResponsePacket, 1),
 	}
+	go c.watch()
 	return c
 }
 
+// watch closes the channels once the underlying connection closes.
+func (c *Conn) watch() {
+	<-c.HCIConn.Done()
+	for _, coc := range c.channels() {
+		coc.close(c.HCIConn.Err())
+	}
+}
+
+// channel returns the approved channel with the local channel id.
+func (c *Conn) channel(id ChannelID) (*ApprovedConnectionOrientedChannel, bool) {
+	c.cocsLock.Lock()
+	defer c.cocsLock.Unlock()
+	coc, ok := c.cocs[id]
+	return coc, ok
+}
+
+// channels returns the approved channels.
+func (c *Conn) channels() []*ApprovedConnectionOrientedChannel {
+	c.cocsLock.Lock()
+	defer c.cocsLock.Unlock()
+	cocs := make([]*ApprovedConnectionOrientedChannel, 0, len(c.cocs))
+	for _, coc := range c.cocs {
+		cocs = append(cocs, coc)
+	}
+	return cocs
+}
+
+// removeChannel closes the approved channel with the local channel id, if
+// any, and forgets it.
+func (c *Conn) removeChannel(id ChannelID) {
+	c.cocsLock.Lock()
+	coc, ok := c.cocs[id]
+	delete(c.cocs, id)
+	c.cocsLock.Unlock()
+	if ok {
+		coc.close(ErrChannelClosed)
+	}
+}
+
 func (c *Conn) Accept() (*ConnectionOrientedChannel, error) {
 	for {
-		f, err := c.ReadFrame()
+		buf, release, err := c.HCIConn.ReadPDU()
 		if err != nil {
 			return nil, err
 		}
+		if len(buf) >= 4 {
+			if coc, ok := c.channel(ChannelID(binary.LittleEndian.Uint16(buf[2:]))); ok {
+				var b BFrame
+				if err := b.Unmarshal(buf); err != nil {
+					release()
+					return nil, err
+				}
+				// the channel's reader consumes the frame.
+				coc.receive(b.Payload, release)
+				continue
+			}
+		}
+		// other frames are decoded in place and handled before the PDU is
+		// released.
+		f, err := UnmarshalFrame(buf)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		ch, err := c.handleFrame(f)
+		release()
+		if err != nil || ch != nil {
+			return ch, err
+		}
+	}
+}
 
-		switch f := f.(type) {
-		case *BFrame:
-			switch f.ChannelID {
-			case ChannelIDAttributeProtocol:
-				opcode := f.Payload[0]
-				if opcode == 0x08 {
-					// this is an attribute request, return with not found since we don't have a gatt db.
-					if err := c.HCIConn.WritePacket(&hci.ACLDataPacket{
-						ConnectionHandle: c.HCIConn.ConnectionHandle,
-						Payload:          []byte{0x05, 0x00, 0x04, 0x00, 0x01, 0x08, 0x01, 0x00, 0x0a},
-					}); err != nil {
+// handleFrame handles a frame that is not addressed to an approved channel. It
+// returns the channel requested by a connection request, if any. The frame
+// must not be referenced once it returns.
+func (c *Conn) handleFrame(f Frame) (*ConnectionOrientedChannel, error) {
+	switch f := f.(type) {
+	case *BFrame:
+		switch f.ChannelID {
+		case ChannelIDAttributeProtocol:
+			opcode := f.Payload[0]
+			if opcode == 0x08 {
+				// this is an attribute request, return with not found since we don't have a gatt db.
+				if err := c.HCIConn.WritePacket(&hci.ACLDataPacket{
+					ConnectionHandle: c.HCIConn.ConnectionHandle,
+					Payload:          []byte{0x05, 0x00, 0x04, 0x00, 0x01, 0x08, 0x01, 0x00, 0x0a},
+				}); err != nil {
+					return nil, err
+				}
+			}
+		case ChannelIDSignallingLEU:
+			p, err := UnmarshalSignallingPacket(f.Payload)
+			if err != nil {
+				// this is an internal error that we should handle.
+				return nil, err
+			}
+			switch p := p.(type) {
+			case *LECreditBasedConnectionRequestPacket:
+				if p.MTU < 23 || p.MPS < 23 || p.MPS > 65533 {
+					r := &LECreditBasedConnectionResponsePacket{
+						Identifier: p.Identifier,
+						Result:     LECreditBasedConnectionResultRefusedUnacceptableParameters,
+					}
+					if err := c.writeSignallingPacket(ChannelIDSignallingLEU, r); err != nil {
 						return nil, err
 					}
 				}
-			case ChannelIDSignallingLEU:
-				p, err := UnmarshalSignallingPacket(f.Payload)
-				if err != nil {
-					// this is an internal error that we should handle.
-					return nil, err
+				mps := p.MPS
+				if mps > 1004 {
+					mps = 1004
 				}
-				switch p := p.(type) {
-				case *LECreditBasedConnectionRequestPacket:
-					if p.MTU < 23 || p.MPS < 23 || p.MPS > 65533 {
-						r := &LECreditBasedConnectionResponsePacket{
-							Identifier: p.Identifier,
-							Result:     LECreditBasedConnectionResultRefusedUnacceptableParameters,
-						}
-						if err := c.writeSignallingPacket(ChannelIDSignallingLEU, r); err != nil {
-							return nil, err
-						}
+				if len(c.channels()) == 0xFFC0 {
+					r := &LECreditBasedConnectionResponsePacket{
+						Identifier: p.Identifier,
+						Result:     LECreditBasedConnectionResultRefusedNoResourcesAvailable,
 					}
-					mps := p.MPS
-					if mps > 1004 {
-						mps = 1004
+					if err := c.writeSignallingPacket(ChannelIDSignallingLEU, r); err != nil {
+						return nil, err
 					}
-					if len(c.cocs) == 0xFFC0 {
-						r := &LECreditBasedConnectionResponsePacket{
-							Identifier: p.Identifier,
-							Result:     LECreditBasedConnectionResultRefusedNoResourcesAvailable,
-						}
-						if err := c.writeSignallingPacket(ChannelIDSignallingLEU, r); err != nil {
-							return nil, err
-						}
+				}
+				if p.SourceCID <= 0x003F {
+					r := &LECreditBasedConnectionResponsePacket{
+						Identifier: p.Identifier,
+						Result:     LECreditBasedConnectionResultRefusedInvalidSourceCID,
+					}
+					if err := c.writeSignallingPacket(ChannelIDSignallingLEU, r); err != nil {
+						return nil, err
 					}
-					if p.SourceCID <= 0x003F {
+				}
+				for _, channel := range c.channels() {
+					if channel.TxCID == p.SourceCID {
 						r := &LECreditBasedConnectionResponsePacket{
 							Identifier: p.Identifier,
-							Result:     LECreditBasedConnectionResultRefusedInvalidSourceCID,
+							Result:     LECreditBasedConnectionResultRefusedSourceCIDAlreadyAllocated,
 						}
 						if err := c.writeSignallingPacket(ChannelIDSignallingLEU, r); err != nil {
 							return nil, err
 						}
 					}
-					for _, channel := range c.cocs {
-						if channel.TxCID == p.SourceCID {
-							r := &LECreditBasedConnectionResponsePacket{
-								Identifier: p.Identifier,
-								Result:     LECreditBasedConnectionResultRefusedSourceCIDAlreadyAllocated,
-							}
-							if err := c.writeSignallingPacket(ChannelIDSignallingLEU, r); err != nil {
-								return nil, err
-							}
-						}
-					}
+				}
 
-					ch := &ConnectionOrientedChannel{
-						L2CAPConn:         c,
-						Identifier:        p.Identifier,
-						PSM:               p.SPSM,
-						RxCID:             c.nextChannelID,
-						TxCID:             p.SourceCID,
-						TxMPS:             p.MPS,
-						TxMTU:             p.MTU,
-						TxCredits:         p.InitialCredits,
-						rxCh:              make(chan []byte),
-						txCreditSemaphore: sync.NewCond(&sync.Mutex{}),
-					}
+				ch := &ConnectionOrientedChannel{
+					L2CAPConn:         c,
+					Identifier:        p.Identifier,
+					PSM:               p.SPSM,
+					RxCID:             c.nextChannelID,
+					TxCID:             p.SourceCID,
+					TxMPS:             p.MPS,
+					TxMTU:             p.MTU,
+					TxCredits:         p.InitialCredits,
+					rxCh:              make(chan *rxSDU),
+					closed:            make(chan struct{}),
+					txCreditSemaphore: sync.NewCond(&sync.Mutex{}),
+				}
 
-					c.nextChannelID++
+				c.nextChannelID++
 
-					return ch, nil
+				return ch, nil
 
-				case *FlowControlCreditIndicationPacket:
-					if p.Credits == 0 {
-						break
+			case *FlowControlCreditIndicationPacket:
+				if p.Credits == 0 {
+					break
+				}
+				for _, ch := range c.channels() {
+					if ch.TxCID != p.CID {
+						continue
 					}
-					for _, ch := range c.cocs {
-						if ch.TxCID != p.CID {
-							continue
-						}
-						ch.txCreditSemaphore.L.Lock()
-						if int(ch.TxCredits)+int(p.Credits) > math.MaxUint16 {
-							if err := c.writeSignallingPacket(ChannelIDSignallingLEU, &DisconnectionRequestPacket{
-								Identifier:     NextIdentifier(),
-								DestinationCID: ch.TxCID,
-								SourceCID:      ch.RxCID,
-							}); err != nil {
-								return nil, err
-							}
-						} else {
-							ch.TxCredits += p.Credits
+					ch.txCreditSemaphore.L.Lock()
+					if int(ch.TxCredits)+int(p.Credits) > math.MaxUint16 {
+						if err := c.writeSignallingPacket(ChannelIDSignallingLEU, &DisconnectionRequestPacket{
+							Identifier:     NextIdentifier(),
+							DestinationCID: ch.TxCID,
+							SourceCID:      ch.RxCID,
+						}); err != nil {
+							return nil, err
 						}
-						ch.txCreditSemaphore.Broadcast()
-						ch.txCreditSemaphore.L.Unlock()
-
+					} else {
+						ch.TxCredits += p.Credits
 					}
+					ch.txCreditSemaphore.Broadcast()
+					ch.txCreditSemaphore.L.Unlock()
 
-				case *DisconnectionRequestPacket:
-					r := &DisconnectionResponsePacket{
-						Identifier:     p.Identifier,
-						DestinationCID: p.DestinationCID,
-						SourceCID:      p.SourceCID,
-					}
-					if err := c.writeSignallingPacket(ChannelIDSignallingLEU, r); err != nil {
-						return nil, err
-					}
-					if err := c.cocs[ChannelID(p.DestinationCID)].Close(); err != nil {
-						return nil, err
-					}
-				case *DisconnectionResponsePacket:
-					if err := c.cocs[ChannelID(p.DestinationCID)].Close(); err != nil {
+				}
+
+			case *ConnectionParameterUpdateRequestPacket:
+				if c.HCIConn.Role != hci.RoleCentral {
+					// only the central may be asked to update the parameters.
+					if err := c.writeSignallingPacket(ChannelIDSignallingLEU, &CommandRejectResponsePacket{
+						Identifier:          p.Identifier,
+						CommandRejectReason: CommandRejectReasonCommandNotUnderstood,
+					}); err != nil {
 						return nil, err
 					}
+					break
+				}
+				u := &hci.ConnectionUpdateRequest{
+					IntervalMin:        p.IntervalMin,
+					IntervalMax:        p.IntervalMax,
+					MaxLatency:         p.Latency,
+					SupervisionTimeout: p.Timeout,
+				}
+				r := &ConnectionParameterUpdateResponsePacket{
+					Identifier: p.Identifier,
+					Result:     ConnectionParameterUpdateResultRejected,
+				}
+				if c.HCIConn.AcceptConnectionParameters(u) {
+					r.Result = ConnectionParameterUpdateResultAccepted
+				}
+				if err := c.writeSignallingPacket(ChannelIDSignallingLEU, r); err != nil {
+					return nil, err
+				}
+				if r.Result == ConnectionParameterUpdateResultAccepted {
+					go func() {
+						if err := c.HCIConn.UpdateConnection(u); err != nil {
+							zap.L().Warn("failed to update connection parameters", zap.Error(err))
+						}
+					}()
+				}
+			case *ConnectionParameterUpdateResponsePacket:
+				select {
+				case c.paramUpdateCh <- p:
 				default:
-					// this is an internal error that we should handle.
-					return nil, errors.New("unhandled packet type")
+					zap.L().Warn("unexpected connection parameter update response", zap.Uint8("identifier", p.Identifier))
 				}
-			default:
-				if coc, ok := c.cocs[f.ChannelID]; ok {
-					coc.receive(f.Payload)
-				} else {
-					zap.L().Warn("received packet for unknown channel", zap.Uint16("channel", uint16(f.ChannelID)))
+			case *DisconnectionRequestPacket:
+				r := &DisconnectionResponsePacket{
+					Identifier:     p.Identifier,
+					DestinationCID: p.DestinationCID,
+					SourceCID:      p.SourceCID,
+				}
+				if err := c.writeSignallingPacket(ChannelIDSignallingLEU, r); err != nil {
+					return nil, err
 				}
-				// this is an external channel.
+				c.removeChannel(ChannelID(p.DestinationCID))
+			case *DisconnectionResponsePacket:
+				c.removeChannel(ChannelID(p.DestinationCID))
+			default:
+				// this is an internal error that we should handle.
+				return nil, errors.New("unhandled packet type")
+			}
+		default:
+			// this is an external channel.
+			zap.L().Warn("received packet for unknown channel", zap.Uint16("channel", uint16(f.ChannelID)))
+		}
+	}
+	return nil, nil
+}
+
+// ResponseTimeout is how long a signalling request waits for its response,
+// the RTX timer of Vol 3, Part A, Section 6.2.1, which may be 1 to 60 seconds.
+const ResponseTimeout = 30 * time.Second
+
+// ErrResponseTimeout is returned when the peer does not respond to a
+// signalling request within ResponseTimeout.
+var ErrResponseTimeout = errors.New("signalling response timeout")
+
+// RequestConnectionParameterUpdate asks the central to change the connection
+// parameters and reports whether it accepted. It may only be used by the
+// peripheral, and requires Accept to be running to receive the response:
+// without it, or if the central does not respond, it returns
+// ErrResponseTimeout after ResponseTimeout, or ctx.Err() if ctx is done first.
+func (c *Conn) RequestConnectionParameterUpdate(ctx context.Context, r *hci.ConnectionUpdateRequest) (bool, error) {
+	if c.HCIConn.Role != hci.RolePeripheral {
+		return false, errors.New("only the peripheral may request a connection parameter update")
+	}
+	if !r.Valid() {
+		return false, errors.New("invalid connection parameters")
+	}
+	id := NextIdentifier()
+	if err := c.writeSignallingPacket(ChannelIDSignallingLEU, &ConnectionParameterUpdateRequestPacket{
+		Identifier:  id,
+		IntervalMin: r.IntervalMin,
+		IntervalMax: r.IntervalMax,
+		Latency:     r.MaxLatency,
+		Timeout:     r.SupervisionTimeout,
+	}); err != nil {
+		return false, err
+	}
+	rtx := time.NewTimer(ResponseTimeout)
+	defer rtx.Stop()
+	for {
+		select {
+		case p := <-c.paramUpdateCh:
+			if p.Identifier == id {
+				return p.Result == ConnectionParameterUpdateResultAccepted, nil
 			}
+		case <-c.HCIConn.Done():
+			return false, io.EOF
+		case <-rtx.C:
+			return false, ErrResponseTimeout
+		case <-ctx.Done():
+			return false, ctx.Err()
 		}
 	}
 }
 
+// ReadFrame returns the next frame.
 func (c *Conn) ReadFrame() (Frame, error) {
-	buf := make([]byte, math.MaxUint16)
-	n, err := c.HCIConn.Read(buf)
+	buf, release, err := c.HCIConn.ReadPDU()
 	if err != nil {
 		return nil, err
 	}
-	return UnmarshalFrame(buf[:n])
+	defer release()
+	return UnmarshalFrame(append([]byte(nil), buf...))
+}
+
+// ReadFrameInPlace is like ReadFrame but decodes the frame in the PDU's
+// buffer, so the frame must not be referenced once release is called, see
+// hci.Conn.ReadPDU.
+func (c *Conn) ReadFrameInPlace() (Frame, func(), error) {
+	buf, release, err := c.HCIConn.ReadPDU()
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := UnmarshalFrame(buf)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return f, release, nil
 }
 
 func (c *Conn) writeSignallingPacket(channelID ChannelID, p SignallingPacket) error {
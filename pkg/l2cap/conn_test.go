@@ -0,0 +1,78 @@
+package l2cap_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/muxable/bluetooth/pkg/hci"
+	"github.com/muxable/bluetooth/pkg/hci/hcitest"
+	"github.com/muxable/bluetooth/pkg/l2cap"
+)
+
+func TestAdapterCloseClosesChannels(t *testing.T) {
+	a, c, err := hcitest.NewAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := l2cap.NewConn(hcitest.Connect(t, a, c, 1, hci.RolePeripheral))
+	// without credits, writes wait for the peer.
+	ch := openChannel(t, c, conn, 256, 256, 0)
+
+	reads := make(chan error, 1)
+	go func() {
+		_, err := ch.Read(make([]byte, 256))
+		reads <- err
+	}()
+	writes := make(chan error, 1)
+	go func() {
+		_, err := ch.Write([]byte{1, 2, 3})
+		writes <- err
+	}()
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for name, results := range map[string]chan error{"Read": reads, "Write": writes} {
+		select {
+		case err := <-results:
+			if name == "Read" && err != io.EOF {
+				t.Errorf("Read() = %v, want %v", err, io.EOF)
+			}
+			var disconnectErr *hci.DisconnectError
+			if name == "Write" && !errors.As(err, &disconnectErr) {
+				t.Errorf("Write() = %v, want a *DisconnectError", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s did not return", name)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	hcitest.CheckLeaks(t)
+}
+
+func TestRequestConnectionParameterUpdateCancel(t *testing.T) {
+	a, c, err := hcitest.NewAdapter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	defer a.Close()
+	// without Accept, the response is never received.
+	conn := l2cap.NewConn(hcitest.Connect(t, a, c, 1, hci.RolePeripheral))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = conn.RequestConnectionParameterUpdate(ctx, &hci.ConnectionUpdateRequest{
+		IntervalMin:        0x0018,
+		IntervalMax:        0x0028,
+		SupervisionTimeout: 0x0048,
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("RequestConnectionParameterUpdate() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}